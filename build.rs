@@ -1,6 +1,7 @@
 use std::{fs, io::Write};
 
 fn main() -> Result<(), Box<dyn std::error::Error>>  {
+    println!("cargo:rerun-if-changed=migrations");
     generate_protos()?;
     generate_level_xp();
     generate_mnstr_xp();
@@ -0,0 +1,5 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_archived_transactions_archived_at;
+DROP INDEX IF EXISTS idx_archived_transactions_created_at;
+DROP INDEX IF EXISTS idx_archived_transactions_wallet_id;
+DROP TABLE IF EXISTS archived_transactions;
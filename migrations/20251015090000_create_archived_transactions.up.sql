@@ -0,0 +1,18 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS archived_transactions (
+	id varchar(255) NOT NULL,
+	wallet_id varchar(255) NOT NULL,
+	transaction_type varchar(255) NOT NULL,
+	transaction_amount int4 NOT NULL,
+	transaction_status varchar(255) NOT NULL,
+	transaction_data text NULL,
+	error_message text NULL,
+	created_at timestamp with time zone NOT NULL,
+	updated_at timestamp with time zone NOT NULL,
+	archived_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT archived_transactions_pkey PRIMARY KEY (id),
+	CONSTRAINT archived_transactions_wallet_id_fkey FOREIGN KEY (wallet_id) REFERENCES wallets(id)
+);
+CREATE INDEX IF NOT EXISTS idx_archived_transactions_archived_at ON archived_transactions USING btree (archived_at);
+CREATE INDEX IF NOT EXISTS idx_archived_transactions_created_at ON archived_transactions USING btree (created_at);
+CREATE INDEX IF NOT EXISTS idx_archived_transactions_wallet_id ON archived_transactions USING btree (wallet_id);
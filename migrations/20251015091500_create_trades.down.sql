@@ -0,0 +1,6 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_trades_created_at;
+DROP INDEX IF EXISTS idx_trades_offerer_user_id;
+DROP INDEX IF EXISTS idx_trades_target_user_id;
+DROP INDEX IF EXISTS idx_trades_trade_status;
+DROP TABLE IF EXISTS trades;
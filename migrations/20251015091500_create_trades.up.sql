@@ -0,0 +1,20 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS trades (
+	id varchar(255) NOT NULL,
+	offerer_user_id varchar(255) NOT NULL,
+	offerer_mnstr_id varchar(255) NOT NULL,
+	target_user_id varchar(255) NOT NULL,
+	requested_mnstr_id varchar(255) NOT NULL,
+	trade_status varchar(255) NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	updated_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT trades_pkey PRIMARY KEY (id),
+	CONSTRAINT trades_offerer_user_id_fkey FOREIGN KEY (offerer_user_id) REFERENCES users(id),
+	CONSTRAINT trades_offerer_mnstr_id_fkey FOREIGN KEY (offerer_mnstr_id) REFERENCES mnstrs(id),
+	CONSTRAINT trades_target_user_id_fkey FOREIGN KEY (target_user_id) REFERENCES users(id),
+	CONSTRAINT trades_requested_mnstr_id_fkey FOREIGN KEY (requested_mnstr_id) REFERENCES mnstrs(id)
+);
+CREATE INDEX IF NOT EXISTS idx_trades_created_at ON trades USING btree (created_at);
+CREATE INDEX IF NOT EXISTS idx_trades_offerer_user_id ON trades USING btree (offerer_user_id);
+CREATE INDEX IF NOT EXISTS idx_trades_target_user_id ON trades USING btree (target_user_id);
+CREATE INDEX IF NOT EXISTS idx_trades_trade_status ON trades USING btree (trade_status);
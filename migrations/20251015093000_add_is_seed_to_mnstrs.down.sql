@@ -0,0 +1,3 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_mnstrs_user_id_is_seed;
+ALTER TABLE mnstrs DROP COLUMN is_seed;
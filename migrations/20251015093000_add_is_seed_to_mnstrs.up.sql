@@ -0,0 +1,3 @@
+-- Add up migration script here
+ALTER TABLE mnstrs ADD COLUMN is_seed BOOLEAN DEFAULT FALSE NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mnstrs_user_id_is_seed ON mnstrs (user_id) WHERE is_seed;
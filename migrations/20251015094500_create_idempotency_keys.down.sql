@@ -0,0 +1,4 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_idempotency_keys_user_id_idempotency_key;
+DROP INDEX IF EXISTS idx_idempotency_keys_created_at;
+DROP TABLE IF EXISTS idempotency_keys;
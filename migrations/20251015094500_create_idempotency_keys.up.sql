@@ -0,0 +1,13 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	idempotency_key varchar(255) NOT NULL,
+	response_status integer NULL,
+	response_body text NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT idempotency_keys_pkey PRIMARY KEY (id),
+	CONSTRAINT idempotency_keys_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_user_id_idempotency_key ON idempotency_keys USING btree (user_id, idempotency_key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys USING btree (created_at);
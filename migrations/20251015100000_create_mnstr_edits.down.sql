@@ -0,0 +1,5 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_mnstr_edits_mnstr_id;
+DROP INDEX IF EXISTS idx_mnstr_edits_user_id;
+DROP INDEX IF EXISTS idx_mnstr_edits_created_at;
+DROP TABLE IF EXISTS mnstr_edits;
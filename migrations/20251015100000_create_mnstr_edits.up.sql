@@ -0,0 +1,17 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS mnstr_edits (
+	id varchar(255) NOT NULL,
+	mnstr_id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	previous_name varchar(255) NOT NULL,
+	new_name varchar(255) NOT NULL,
+	previous_description text NOT NULL,
+	new_description text NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT mnstr_edits_pkey PRIMARY KEY (id),
+	CONSTRAINT mnstr_edits_mnstr_id_fkey FOREIGN KEY (mnstr_id) REFERENCES mnstrs(id),
+	CONSTRAINT mnstr_edits_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_mnstr_edits_mnstr_id ON mnstr_edits USING btree (mnstr_id);
+CREATE INDEX IF NOT EXISTS idx_mnstr_edits_user_id ON mnstr_edits USING btree (user_id);
+CREATE INDEX IF NOT EXISTS idx_mnstr_edits_created_at ON mnstr_edits USING btree (created_at);
@@ -0,0 +1,3 @@
+-- Add down migration script here
+ALTER TABLE users DROP COLUMN daily_reward_streak;
+ALTER TABLE users DROP COLUMN last_daily_reward_at;
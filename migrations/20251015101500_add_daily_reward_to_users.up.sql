@@ -0,0 +1,3 @@
+-- Add up migration script here
+ALTER TABLE users ADD COLUMN last_daily_reward_at timestamp with time zone NULL;
+ALTER TABLE users ADD COLUMN daily_reward_streak integer DEFAULT 0 NOT NULL;
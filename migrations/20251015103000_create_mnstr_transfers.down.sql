@@ -0,0 +1,5 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_mnstr_transfers_mnstr_id;
+DROP INDEX IF EXISTS idx_mnstr_transfers_from_user_id;
+DROP INDEX IF EXISTS idx_mnstr_transfers_to_user_id;
+DROP TABLE IF EXISTS mnstr_transfers;
@@ -0,0 +1,15 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS mnstr_transfers (
+	id varchar(255) NOT NULL,
+	mnstr_id varchar(255) NOT NULL,
+	from_user_id varchar(255) NOT NULL,
+	to_user_id varchar(255) NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT mnstr_transfers_pkey PRIMARY KEY (id),
+	CONSTRAINT mnstr_transfers_mnstr_id_fkey FOREIGN KEY (mnstr_id) REFERENCES mnstrs(id),
+	CONSTRAINT mnstr_transfers_from_user_id_fkey FOREIGN KEY (from_user_id) REFERENCES users(id),
+	CONSTRAINT mnstr_transfers_to_user_id_fkey FOREIGN KEY (to_user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_mnstr_transfers_mnstr_id ON mnstr_transfers USING btree (mnstr_id);
+CREATE INDEX IF NOT EXISTS idx_mnstr_transfers_from_user_id ON mnstr_transfers USING btree (from_user_id);
+CREATE INDEX IF NOT EXISTS idx_mnstr_transfers_to_user_id ON mnstr_transfers USING btree (to_user_id);
@@ -0,0 +1,2 @@
+-- Add down migration script here
+ALTER TABLE wallets DROP COLUMN coin_balance;
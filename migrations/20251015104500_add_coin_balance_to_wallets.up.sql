@@ -0,0 +1,6 @@
+-- Add up migration script here
+ALTER TABLE wallets ADD COLUMN coin_balance integer DEFAULT 0 NOT NULL;
+UPDATE wallets SET coin_balance = (
+	SELECT COALESCE(SUM(transaction_amount), 0) FROM transactions WHERE transactions.wallet_id = wallets.id
+		AND transaction_status = 'completed'
+);
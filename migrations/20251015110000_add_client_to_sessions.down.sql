@@ -0,0 +1,3 @@
+-- Add down migration script here
+ALTER TABLE sessions DROP COLUMN ip_address;
+ALTER TABLE sessions DROP COLUMN user_agent;
@@ -0,0 +1,3 @@
+-- Add up migration script here
+ALTER TABLE sessions ADD COLUMN user_agent varchar(255) NULL;
+ALTER TABLE sessions ADD COLUMN ip_address varchar(64) NULL;
@@ -0,0 +1,2 @@
+-- Add down migration script here
+ALTER TABLE sessions DROP COLUMN remember_me;
@@ -0,0 +1,4 @@
+-- Add up migration script here
+ALTER TABLE sessions ADD COLUMN remember_me boolean DEFAULT false NOT NULL;
+-- Existing sessions were issued with the long lifetime.
+UPDATE sessions SET remember_me = true;
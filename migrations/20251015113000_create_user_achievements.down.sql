@@ -0,0 +1,3 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_user_achievements_user_id;
+DROP TABLE IF EXISTS user_achievements;
@@ -0,0 +1,12 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS user_achievements (
+	id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	achievement_key varchar(64) NOT NULL,
+	coins_awarded integer DEFAULT 0 NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT user_achievements_pkey PRIMARY KEY (id),
+	CONSTRAINT user_achievements_user_id_achievement_key_key UNIQUE (user_id, achievement_key),
+	CONSTRAINT user_achievements_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_achievements_user_id ON user_achievements USING btree (user_id);
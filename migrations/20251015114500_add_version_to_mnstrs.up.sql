@@ -0,0 +1,2 @@
+-- Add up migration script here
+ALTER TABLE mnstrs ADD COLUMN version integer DEFAULT 0 NOT NULL;
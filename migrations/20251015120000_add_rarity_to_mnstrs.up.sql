@@ -0,0 +1,12 @@
+-- Add up migration script here
+ALTER TABLE mnstrs ADD COLUMN rarity varchar(16) DEFAULT 'common' NOT NULL;
+
+-- Same tiers as rarity_for_qr_code: byte 16 of the QR code's SHA-256 hash.
+UPDATE mnstrs SET rarity = CASE
+	WHEN get_byte(sha256(convert_to(mnstr_qr_code, 'UTF8')), 16) >= 251 THEN 'legendary'
+	WHEN get_byte(sha256(convert_to(mnstr_qr_code, 'UTF8')), 16) >= 242 THEN 'epic'
+	WHEN get_byte(sha256(convert_to(mnstr_qr_code, 'UTF8')), 16) >= 216 THEN 'rare'
+	ELSE 'common'
+END;
+
+CREATE INDEX IF NOT EXISTS idx_mnstrs_rarity ON mnstrs USING btree (rarity);
@@ -0,0 +1,3 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_api_tokens_user_id;
+DROP TABLE IF EXISTS api_tokens;
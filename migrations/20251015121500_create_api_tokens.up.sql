@@ -0,0 +1,14 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	label varchar(64) NOT NULL,
+	token_hash varchar(64) NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	last_used_at timestamp with time zone NULL,
+	archived_at timestamp with time zone NULL,
+	CONSTRAINT api_tokens_pkey PRIMARY KEY (id),
+	CONSTRAINT api_tokens_token_hash_key UNIQUE (token_hash),
+	CONSTRAINT api_tokens_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens USING btree (user_id);
@@ -0,0 +1,14 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS mnstr_catalog (
+	mnstr_qr_code varchar(255) NOT NULL,
+	mnstr_name varchar(255) NOT NULL,
+	mnstr_description text DEFAULT '' NOT NULL,
+	max_health integer DEFAULT 10 NOT NULL,
+	max_attack integer DEFAULT 10 NOT NULL,
+	max_defense integer DEFAULT 10 NOT NULL,
+	max_speed integer DEFAULT 10 NOT NULL,
+	max_intelligence integer DEFAULT 10 NOT NULL,
+	max_magic integer DEFAULT 10 NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT mnstr_catalog_pkey PRIMARY KEY (mnstr_qr_code)
+);
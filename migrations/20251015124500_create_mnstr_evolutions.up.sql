@@ -0,0 +1,16 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS mnstr_evolutions (
+	id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	mnstr_id varchar(255) NOT NULL,
+	fodder_mnstr_id varchar(255) NOT NULL,
+	from_level integer NOT NULL,
+	to_level integer NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT mnstr_evolutions_pkey PRIMARY KEY (id),
+	CONSTRAINT mnstr_evolutions_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id),
+	CONSTRAINT mnstr_evolutions_mnstr_id_fkey FOREIGN KEY (mnstr_id) REFERENCES mnstrs(id),
+	CONSTRAINT mnstr_evolutions_fodder_mnstr_id_fkey FOREIGN KEY (fodder_mnstr_id) REFERENCES mnstrs(id)
+);
+CREATE INDEX IF NOT EXISTS idx_mnstr_evolutions_user_id ON mnstr_evolutions USING btree (user_id);
+CREATE INDEX IF NOT EXISTS idx_mnstr_evolutions_mnstr_id ON mnstr_evolutions USING btree (mnstr_id);
@@ -0,0 +1,14 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS ownership_events (
+	id varchar(255) NOT NULL,
+	mnstr_id varchar(255) NOT NULL,
+	event_type varchar(255) NOT NULL,
+	from_user_id varchar(255),
+	to_user_id varchar(255),
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT ownership_events_pkey PRIMARY KEY (id),
+	CONSTRAINT ownership_events_mnstr_id_fkey FOREIGN KEY (mnstr_id) REFERENCES mnstrs(id),
+	CONSTRAINT ownership_events_from_user_id_fkey FOREIGN KEY (from_user_id) REFERENCES users(id),
+	CONSTRAINT ownership_events_to_user_id_fkey FOREIGN KEY (to_user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_ownership_events_mnstr_id ON ownership_events USING btree (mnstr_id);
@@ -0,0 +1,2 @@
+-- Add down migration script here
+ALTER TABLE mnstrs DROP COLUMN image_url;
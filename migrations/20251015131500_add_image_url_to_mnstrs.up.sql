@@ -0,0 +1,2 @@
+-- Add up migration script here
+ALTER TABLE mnstrs ADD COLUMN image_url VARCHAR(255);
@@ -0,0 +1,10 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS mnstr_tags (
+	id varchar(255) NOT NULL,
+	mnstr_id varchar(255) NOT NULL,
+	tag varchar(255) NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT mnstr_tags_pkey PRIMARY KEY (id),
+	CONSTRAINT mnstr_tags_mnstr_id_tag_key UNIQUE (mnstr_id, tag),
+	CONSTRAINT mnstr_tags_mnstr_id_fkey FOREIGN KEY (mnstr_id) REFERENCES mnstrs(id)
+);
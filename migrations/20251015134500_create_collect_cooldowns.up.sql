@@ -0,0 +1,10 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS collect_cooldowns (
+	id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	mnstr_qr_code text NOT NULL,
+	collected_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	CONSTRAINT collect_cooldowns_pkey PRIMARY KEY (id),
+	CONSTRAINT collect_cooldowns_user_id_mnstr_qr_code_key UNIQUE (user_id, mnstr_qr_code),
+	CONSTRAINT collect_cooldowns_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id)
+);
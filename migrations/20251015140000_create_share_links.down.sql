@@ -0,0 +1,3 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_share_links_user_id;
+DROP TABLE IF EXISTS share_links;
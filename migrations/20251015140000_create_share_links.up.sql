@@ -0,0 +1,12 @@
+-- Add up migration script here
+CREATE TABLE IF NOT EXISTS share_links (
+	id varchar(255) NOT NULL,
+	user_id varchar(255) NOT NULL,
+	token varchar(64) NOT NULL,
+	created_at timestamp with time zone DEFAULT CURRENT_TIMESTAMP NOT NULL,
+	archived_at timestamp with time zone NULL,
+	CONSTRAINT share_links_pkey PRIMARY KEY (id),
+	CONSTRAINT share_links_token_key UNIQUE (token),
+	CONSTRAINT share_links_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_share_links_user_id ON share_links USING btree (user_id);
@@ -0,0 +1,3 @@
+-- Add down migration script here
+ALTER TABLE transactions DROP CONSTRAINT IF EXISTS transactions_wallet_id_client_reference_key;
+ALTER TABLE transactions DROP COLUMN client_reference;
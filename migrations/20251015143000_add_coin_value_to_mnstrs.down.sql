@@ -0,0 +1,3 @@
+-- Add down migration script here
+DROP INDEX IF EXISTS idx_mnstrs_coin_value;
+ALTER TABLE mnstrs DROP COLUMN coin_value;
@@ -0,0 +1,25 @@
+-- Add up migration script here
+ALTER TABLE mnstrs ADD COLUMN coin_value integer DEFAULT 5 NOT NULL;
+
+-- Same derivation as coins_for_qr_code: byte 15 of the QR code's SHA-256
+-- hash is the base amount and byte 16 the multiplier.
+WITH hashes AS (
+	SELECT id,
+		COALESCE(NULLIF(get_byte(sha256(convert_to(mnstr_qr_code, 'UTF8')), 15), 0), 5) AS coins,
+		get_byte(sha256(convert_to(mnstr_qr_code, 'UTF8')), 16) AS multiplier
+	FROM mnstrs
+)
+UPDATE mnstrs SET coin_value = GREATEST(5, CASE
+	WHEN hashes.multiplier >= 251 THEN LEAST(hashes.coins * (hashes.multiplier / 100) + 1000, 2000)
+	WHEN hashes.multiplier >= 242 THEN LEAST(hashes.coins * (hashes.multiplier / 100) + 400, 750)
+	WHEN hashes.multiplier >= 216 THEN LEAST(hashes.coins * (hashes.multiplier / 100) + 150, 400)
+	WHEN hashes.multiplier >= 85 AND hashes.coins * (hashes.multiplier / 100) > 25
+		THEN hashes.coins * (hashes.multiplier / 100) / 10
+	WHEN hashes.multiplier >= 85 THEN hashes.coins * (hashes.multiplier / 100)
+	WHEN hashes.coins > 25 THEN hashes.coins / 10
+	ELSE hashes.coins
+END)
+FROM hashes
+WHERE hashes.id = mnstrs.id;
+
+CREATE INDEX IF NOT EXISTS idx_mnstrs_coin_value ON mnstrs USING btree (coin_value);
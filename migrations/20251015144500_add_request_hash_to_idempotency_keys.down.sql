@@ -0,0 +1,3 @@
+-- Add down migration script here
+ALTER TABLE idempotency_keys DROP COLUMN locked_until;
+ALTER TABLE idempotency_keys DROP COLUMN request_hash;
@@ -0,0 +1,6 @@
+-- Add up migration script here
+ALTER TABLE idempotency_keys ADD COLUMN request_hash varchar(64) NULL;
+ALTER TABLE idempotency_keys ADD COLUMN locked_until timestamp with time zone NULL;
+
+-- Reservations made before leases existed lapse as soon as they are retried.
+UPDATE idempotency_keys SET locked_until = created_at WHERE locked_until IS NULL;
@@ -0,0 +1,3 @@
+-- Add down migration script here
+ALTER TABLE archived_transactions DROP CONSTRAINT IF EXISTS archived_transactions_wallet_id_client_reference_key;
+ALTER TABLE archived_transactions DROP COLUMN client_reference;
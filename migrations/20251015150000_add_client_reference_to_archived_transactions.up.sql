@@ -0,0 +1,3 @@
+-- Add up migration script here
+ALTER TABLE archived_transactions ADD COLUMN client_reference varchar(64) NULL;
+ALTER TABLE archived_transactions ADD CONSTRAINT archived_transactions_wallet_id_client_reference_key UNIQUE (wallet_id, client_reference);
@@ -0,0 +1,2 @@
+-- Add down migration script here
+DELETE FROM ownership_events WHERE id = md5('collected:' || mnstr_id)::uuid::text;
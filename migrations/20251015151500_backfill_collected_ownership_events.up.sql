@@ -0,0 +1,34 @@
+-- Add up migration script here
+INSERT INTO ownership_events (id, mnstr_id, event_type, from_user_id, to_user_id, created_at)
+SELECT
+	md5('collected:' || mnstrs.id)::uuid::text,
+	mnstrs.id,
+	'collected',
+	NULL,
+	COALESCE(
+		(
+			SELECT previous.from_user_id
+			FROM (
+				SELECT from_user_id, created_at FROM ownership_events
+				WHERE mnstr_id = mnstrs.id AND from_user_id IS NOT NULL
+				UNION ALL
+				SELECT from_user_id, created_at FROM mnstr_transfers
+				WHERE mnstr_id = mnstrs.id
+				UNION ALL
+				SELECT offerer_user_id, updated_at FROM trades
+				WHERE offerer_mnstr_id = mnstrs.id AND trade_status = 'completed'
+				UNION ALL
+				SELECT target_user_id, updated_at FROM trades
+				WHERE requested_mnstr_id = mnstrs.id AND trade_status = 'completed'
+			) AS previous
+			ORDER BY previous.created_at ASC
+			LIMIT 1
+		),
+		mnstrs.user_id
+	),
+	mnstrs.created_at
+FROM mnstrs
+WHERE NOT EXISTS (
+	SELECT 1 FROM ownership_events
+	WHERE ownership_events.mnstr_id = mnstrs.id AND ownership_events.event_type = 'collected'
+);
@@ -0,0 +1,2 @@
+-- Add up migration script here
+ALTER TABLE users ADD COLUMN xp_decayed_at timestamp with time zone NULL;
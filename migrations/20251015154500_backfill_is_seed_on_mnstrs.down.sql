@@ -0,0 +1,3 @@
+-- Add down migration script here
+-- Backfilled seeds cannot be told apart from ones flagged at collect, so they
+-- are left in place. Dropping the column in 20251015093000 clears them all.
@@ -0,0 +1,21 @@
+-- Add up migration script here
+-- Each user's seed is the first mnstr they collected, as long as they still
+-- hold it and have no seed yet.
+UPDATE mnstrs SET is_seed = TRUE
+WHERE mnstrs.id IN (
+	SELECT DISTINCT ON (ownership_events.to_user_id) ownership_events.mnstr_id
+	FROM ownership_events
+	WHERE ownership_events.event_type = 'collected'
+	ORDER BY ownership_events.to_user_id, ownership_events.created_at ASC, ownership_events.mnstr_id ASC
+)
+AND mnstrs.archived_at IS NULL
+AND EXISTS (
+	SELECT 1 FROM ownership_events
+	WHERE ownership_events.mnstr_id = mnstrs.id
+		AND ownership_events.event_type = 'collected'
+		AND ownership_events.to_user_id = mnstrs.user_id
+)
+AND NOT EXISTS (
+	SELECT 1 FROM mnstrs AS seed
+	WHERE seed.user_id = mnstrs.user_id AND seed.is_seed
+);
@@ -0,0 +1,176 @@
+use rocket::{Route, get, http::Status, post, serde::json::Json};
+
+use crate::{
+    config::config,
+    models::{
+        mnstr::{
+            DEFAULT_QR_COLLISION_THRESHOLD, DERIVED_VALUES_PAGE_SIZE, Mnstr, MnstrRecompute,
+            QrCollision, search_bounds,
+        },
+        user::{User, UserSearchResult},
+        wallet::{Wallet, WalletReconciliation},
+    },
+    utils::{
+        admin::{RawAdminToken, is_admin_token},
+        response::Envelope,
+    },
+};
+
+/// Routes for operators, mounted under /admin.
+pub fn routes() -> Vec<Route> {
+    routes![
+        search_users,
+        qr_collisions,
+        reconcile_wallet,
+        recompute_mnstrs
+    ]
+}
+
+/// Users whose display name or email contains `q`, a page at a time, with
+/// their level and mnstr count. `meta` echoes the `limit` and `offset` used.
+/// Requires X-Admin-Token.
+#[get("/users?<q>&<limit>&<offset>")]
+pub async fn search_users(
+    q: Option<String>,
+    limit: Option<i64>,
+    offset: Option<i64>,
+    admin_token: RawAdminToken,
+) -> Result<Json<Envelope<Vec<UserSearchResult>>>, Status> {
+    if !is_admin_token(admin_token.value.as_deref(), &config().admin_token) {
+        return Err(Status::Unauthorized);
+    }
+    let query = match q {
+        Some(q) if !q.trim().is_empty() => q,
+        _ => return Err(Status::BadRequest),
+    };
+
+    let (limit, offset) = search_bounds(limit, offset);
+    match User::search(query, Some(limit), Some(offset)).await {
+        Ok(users) => Ok(Envelope::ok_with_meta(
+            users,
+            serde_json::json!({ "limit": limit, "offset": offset }),
+        )),
+        Err(e) => {
+            println!("[search_users] Failed to search users: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+/// QR codes owned by at least `min_owners` different users (10 unless
+/// given), for review in case different cards print the same code. Requires
+/// X-Admin-Token.
+#[get("/qr-collisions?<min_owners>")]
+pub async fn qr_collisions(
+    min_owners: Option<i64>,
+    admin_token: RawAdminToken,
+) -> Result<Json<Envelope<Vec<QrCollision>>>, Status> {
+    if !is_admin_token(admin_token.value.as_deref(), &config().admin_token) {
+        return Err(Status::Unauthorized);
+    }
+    let min_owners = min_owners.unwrap_or(DEFAULT_QR_COLLISION_THRESHOLD);
+    if min_owners < 2 {
+        return Err(Status::BadRequest);
+    }
+
+    match Mnstr::detect_qr_collisions(min_owners).await {
+        Ok(collisions) => Ok(Envelope::ok(collisions)),
+        Err(e) => {
+            println!("[qr_collisions] Failed to detect QR collisions: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+/// Checks the user's cached coin balance against their completed
+/// transactions. Nothing changes unless `fix=true`, which rewrites a drifted
+/// balance from the ledger. Requires X-Admin-Token.
+#[get("/wallets/<user_id>/reconcile?<fix>")]
+pub async fn reconcile_wallet(
+    user_id: String,
+    fix: Option<bool>,
+    admin_token: RawAdminToken,
+) -> Result<Json<Envelope<WalletReconciliation>>, Status> {
+    if !is_admin_token(admin_token.value.as_deref(), &config().admin_token) {
+        return Err(Status::Unauthorized);
+    }
+
+    let mut wallet = match Wallet::find_one_by(vec![("user_id", user_id.into())]).await {
+        Ok(wallet) => wallet,
+        Err(e) => {
+            println!("[reconcile_wallet] Failed to get wallet: {:?}", e);
+            return Err(Status::NotFound);
+        }
+    };
+    match wallet.reconcile(fix.unwrap_or(false)).await {
+        Ok(reconciliation) => Ok(Envelope::ok(reconciliation)),
+        Err(e) => {
+            println!("[reconcile_wallet] Failed to reconcile wallet: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+/// Refreshes every mnstr's stored rarity and coin value from the current
+/// formulas, a page at a time, and reports how many changed. Run it after
+/// changing either formula. Requires X-Admin-Token.
+#[post("/mnstrs/recompute")]
+pub async fn recompute_mnstrs(
+    admin_token: RawAdminToken,
+) -> Result<Json<Envelope<MnstrRecompute>>, Status> {
+    if !is_admin_token(admin_token.value.as_deref(), &config().admin_token) {
+        return Err(Status::Unauthorized);
+    }
+    match Mnstr::recompute_all_derived_values(DERIVED_VALUES_PAGE_SIZE).await {
+        Ok(recompute) => Ok(Envelope::ok(recompute)),
+        Err(e) => {
+            println!("[recompute_mnstrs] Failed to recompute mnstrs: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rocket::local::asynchronous::Client;
+
+    #[tokio::test]
+    async fn test_search_users_requires_admin_token() {
+        let rocket = rocket::build().mount("/admin", routes());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client.get("/admin/users?q=ali").dispatch().await;
+        assert_eq!(response.status(), Status::Unauthorized);
+    }
+
+    #[tokio::test]
+    async fn test_qr_collisions_requires_admin_token() {
+        let rocket = rocket::build().mount("/admin", routes());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client.get("/admin/qr-collisions").dispatch().await;
+        assert_eq!(response.status(), Status::Unauthorized);
+    }
+
+    #[tokio::test]
+    async fn test_reconcile_wallet_requires_admin_token() {
+        let rocket = rocket::build().mount("/admin", routes());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client
+            .get("/admin/wallets/user-id/reconcile?fix=true")
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Unauthorized);
+    }
+
+    #[tokio::test]
+    async fn test_recompute_mnstrs_requires_admin_token() {
+        let rocket = rocket::build().mount("/admin", routes());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client.post("/admin/mnstrs/recompute").dispatch().await;
+        assert_eq!(response.status(), Status::Unauthorized);
+    }
+}
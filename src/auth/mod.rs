@@ -0,0 +1,157 @@
+use rocket::{Responder, Route, post, serde::json::Json};
+use serde::Deserialize;
+
+use crate::{
+    models::{
+        session::Session,
+        user::{INVALID_CREDENTIALS, User},
+    },
+    utils::{client::RequestClient, response::Envelope},
+};
+
+pub fn routes() -> Vec<Route> {
+    routes![login]
+}
+
+#[derive(Debug, Deserialize, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct LoginBody {
+    pub email: String,
+    pub password: String,
+    #[serde(default)]
+    pub remember_me: bool,
+}
+
+#[derive(Responder)]
+pub enum LoginResponse {
+    #[response(status = 200)]
+    Ok(Json<Envelope<Session>>),
+    #[response(status = 401)]
+    Unauthorized(Json<Envelope<()>>),
+    #[response(status = 500)]
+    Failed(Json<Envelope<()>>),
+}
+
+/// Signs in with an email and password and returns the new session as
+/// `data`. Its `sessionToken` goes in the Authorization header of later
+/// requests.
+#[post("/login", format = "json", data = "<body>")]
+pub async fn login(body: Json<LoginBody>, client: RequestClient) -> LoginResponse {
+    let body = body.into_inner();
+    if body.email.is_empty() || body.password.is_empty() {
+        return LoginResponse::Unauthorized(Envelope::error(INVALID_CREDENTIALS));
+    }
+
+    let user = match User::authenticate(body.email, &body.password).await {
+        Some(user) => user,
+        None => return LoginResponse::Unauthorized(Envelope::error(INVALID_CREDENTIALS)),
+    };
+
+    let mut session = Session::new_with_client(user.id.clone(), &client);
+    session.remember_me = body.remember_me;
+    if let Some(error) = session.create().await {
+        println!("[login] Failed to create session: {:?}", error);
+        return LoginResponse::Failed(Envelope::error("Failed to create session"));
+    }
+    LoginResponse::Ok(Envelope::ok(session))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        database::test_support::{create_test_user, test_pool},
+        utils::passwords::hash_password,
+    };
+    use rocket::{
+        http::{ContentType, Status},
+        local::asynchronous::Client,
+    };
+
+    #[tokio::test]
+    async fn test_login_rejects_blank_credentials_generically() {
+        let rocket = rocket::build().mount("/auth", routes());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        for body in [
+            r#"{"email":"","password":"secret"}"#,
+            r#"{"email":"player@example.com","password":""}"#,
+        ] {
+            let response = client
+                .post("/auth/login")
+                .header(ContentType::JSON)
+                .body(body)
+                .dispatch()
+                .await;
+            assert_eq!(response.status(), Status::Unauthorized);
+            let json: serde_json::Value =
+                serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+            assert_eq!(json["error"], INVALID_CREDENTIALS);
+            assert!(json["data"].is_null());
+        }
+    }
+
+    /// A new user who signs in with `password`.
+    async fn user_with_password(password: &str) -> User {
+        let user = create_test_user().await;
+        sqlx::query("UPDATE users SET password_hash = $1 WHERE id = $2")
+            .bind(hash_password(password))
+            .bind(user.id.clone())
+            .execute(&test_pool().await)
+            .await
+            .unwrap();
+        user
+    }
+
+    /// Posts a login and returns its status and parsed body.
+    async fn post_login(
+        client: &Client,
+        email: &str,
+        password: &str,
+    ) -> (Status, serde_json::Value) {
+        let response = client
+            .post("/auth/login")
+            .header(ContentType::JSON)
+            .body(serde_json::json!({ "email": email, "password": password }).to_string())
+            .dispatch()
+            .await;
+        let status = response.status();
+        let json = serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+        (status, json)
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_login_returns_a_session() {
+        let user = user_with_password("secret").await;
+        let client = Client::untracked(rocket::build().mount("/auth", routes()))
+            .await
+            .unwrap();
+
+        let email = user.email.clone().unwrap();
+        let (status, json) = post_login(&client, &email, "secret").await;
+        assert_eq!(status, Status::Ok);
+        assert_eq!(json["data"]["user_id"], user.id);
+        assert!(!json["data"]["session_token"].as_str().unwrap().is_empty());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_login_rejects_wrong_password_and_unknown_email_alike() {
+        let user = user_with_password("secret").await;
+        let client = Client::untracked(rocket::build().mount("/auth", routes()))
+            .await
+            .unwrap();
+
+        let email = user.email.clone().unwrap();
+        let (status, wrong_password) = post_login(&client, &email, "guess").await;
+        assert_eq!(status, Status::Unauthorized);
+        assert_eq!(wrong_password["error"], INVALID_CREDENTIALS);
+        assert!(wrong_password["data"].is_null());
+
+        let (status, unknown_email) =
+            post_login(&client, &format!("unknown-{}", email), "secret").await;
+        assert_eq!(status, Status::Unauthorized);
+        assert_eq!(unknown_email, wrong_password);
+    }
+}
@@ -0,0 +1,79 @@
+use rocket::{Responder, Route, post, serde::json::Json};
+
+use crate::{
+    models::{
+        mnstr_bulk_edit::{MnstrBulkEdit, MnstrBulkEditResult},
+        session::Session,
+    },
+    utils::{response::Envelope, sessions::get_user_from_token, token::RawToken},
+};
+
+pub fn routes() -> Vec<Route> {
+    routes![bulk_edit]
+}
+
+#[derive(Responder)]
+pub enum BulkEditResponse {
+    #[response(status = 200)]
+    Ok(Json<Envelope<Vec<MnstrBulkEditResult>>>),
+    #[response(status = 400)]
+    BadRequest(Json<Envelope<()>>),
+    #[response(status = 401)]
+    Unauthorized(Json<Envelope<()>>),
+    #[response(status = 500)]
+    Failed(Json<Envelope<()>>),
+}
+
+/// Applies one name and/or description to many of the session user's mnstrs
+/// in a single transaction. `{name}` in the description is replaced with
+/// each mnstr's name. `data` holds a result for every id; ids of mnstrs the
+/// user does not own are reported as not found.
+#[post("/bulk-edit", format = "json", data = "<body>")]
+pub async fn bulk_edit(body: Json<MnstrBulkEdit>, token: RawToken) -> BulkEditResponse {
+    if token.value.is_empty() {
+        return BulkEditResponse::Unauthorized(Envelope::error("Invalid session"));
+    }
+    let user = match get_user_from_token::<Session>(token.value).await {
+        Ok(user) => user,
+        Err(_) => return BulkEditResponse::Unauthorized(Envelope::error("Invalid session")),
+    };
+
+    let edit = body.into_inner();
+    if let Err(e) = edit.validate() {
+        return BulkEditResponse::BadRequest(Envelope::error(&e.to_string()));
+    }
+    match edit.save(user.id).await {
+        Ok(results) => BulkEditResponse::Ok(Envelope::ok(results)),
+        Err(e) => {
+            println!("[bulk_edit] Failed to edit mnstrs: {:?}", e);
+            BulkEditResponse::Failed(Envelope::error("Failed to edit mnstrs"))
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rocket::{
+        http::{ContentType, Status},
+        local::asynchronous::Client,
+    };
+
+    #[tokio::test]
+    async fn test_bulk_edit_requires_a_session() {
+        let rocket = rocket::build().mount("/mnstrs", routes());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client
+            .post("/mnstrs/bulk-edit")
+            .header(ContentType::JSON)
+            .body(r#"{"ids":["a"],"mnstrDescription":"Shared"}"#)
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Unauthorized);
+        let json: serde_json::Value =
+            serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+        assert_eq!(json["error"], "Invalid session");
+        assert!(json["data"].is_null());
+    }
+}
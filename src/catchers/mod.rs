@@ -0,0 +1,241 @@
+use rocket::{
+    Catcher, Request, Responder,
+    http::{Header, Method, Status},
+    serde::json::Json,
+};
+
+use crate::utils::{response::Envelope, token::AuthorizationError};
+
+pub fn catchers() -> Vec<Catcher> {
+    catchers![not_found, default]
+}
+
+#[derive(Responder)]
+#[response(status = 405)]
+pub struct MethodNotAllowed {
+    body: Json<Envelope<()>>,
+    allow: Header<'static>,
+}
+
+#[derive(Responder)]
+#[response(status = 404)]
+pub struct NotFound(Json<Envelope<()>>);
+
+/// Rocket answers a known path with an unsupported method with a 404. When
+/// only other methods are routed for the path this answers 405 with an Allow
+/// header instead. A 404 from a handler routed for the request's own method
+/// stays a 404.
+#[catch(404)]
+pub fn not_found(request: &Request) -> Result<MethodNotAllowed, NotFound> {
+    let path = request.uri().path().as_str();
+    let routes = request
+        .rocket()
+        .routes()
+        .map(|route| (route.method, route.uri.path()));
+    let allowed = allowed_methods(routes, path);
+    if allowed.is_empty() || allowed.contains(&request.method().as_str()) {
+        return Err(NotFound(Envelope::error("Not found")));
+    }
+    Ok(MethodNotAllowed {
+        body: Envelope::error("Method not allowed"),
+        allow: Header::new("Allow", allowed.join(", ")),
+    })
+}
+
+/// Any other error status a handler returns, as an envelope naming the
+/// status. A refused Authorization header is named instead of the status.
+#[catch(default)]
+pub fn default(status: Status, request: &Request) -> (Status, Json<Envelope<()>>) {
+    if let AuthorizationError(Some(message)) = request.local_cache(AuthorizationError::default) {
+        return (status, Envelope::error(message));
+    }
+    (status, Envelope::error(status.reason().unwrap_or("Error")))
+}
+
+/// Every method routed for `path`, sorted. GET routes also answer HEAD.
+pub fn allowed_methods<'a>(
+    routes: impl Iterator<Item = (Method, &'a str)>,
+    path: &str,
+) -> Vec<&'static str> {
+    let mut allowed = Vec::new();
+    for (method, template) in routes {
+        if !path_matches(template, path) {
+            continue;
+        }
+        allowed.push(method.as_str());
+        if method == Method::Get {
+            allowed.push(Method::Head.as_str());
+        }
+    }
+    allowed.sort();
+    allowed.dedup();
+    allowed
+}
+
+/// Whether `path` fits a route path template such as `/mnstrs/<id>/qr.png`.
+pub fn path_matches(template: &str, path: &str) -> bool {
+    let mut path = path.split('/').filter(|segment| !segment.is_empty());
+    for segment in template.split('/').filter(|segment| !segment.is_empty()) {
+        if segment.starts_with('<') && segment.ends_with("..>") {
+            return true;
+        }
+        match path.next() {
+            Some(_) if segment.starts_with('<') && segment.ends_with('>') => (),
+            Some(value) if value == segment => (),
+            _ => return false,
+        }
+    }
+    path.next().is_none()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        admin, auth, bulk_edit, duplicates, exports, graphql, health, images, metrics, qr, share,
+        stats,
+    };
+    use rocket::{
+        http::{Header, Status},
+        local::asynchronous::Client,
+    };
+
+    #[test]
+    fn test_path_matches() {
+        assert!(path_matches("/stats", "/stats"));
+        assert!(path_matches("/stats", "/stats/"));
+        assert!(path_matches("/mnstrs/<mnstr_id>/qr.png", "/mnstrs/abc/qr.png"));
+        assert!(path_matches("/static/<path..>", "/static/css/app.css"));
+        assert!(path_matches("/graphql", "/graphql"));
+        assert!(!path_matches("/stats", "/stats/extra"));
+        assert!(!path_matches("/mnstrs/<mnstr_id>/qr.png", "/mnstrs/qr.png"));
+    }
+
+    #[test]
+    fn test_allowed_methods() {
+        let routes = vec![(Method::Post, "/graphql"), (Method::Get, "/graphql/graphiql")];
+        assert_eq!(allowed_methods(routes.clone().into_iter(), "/graphql"), vec!["POST"]);
+        assert_eq!(
+            allowed_methods(routes.clone().into_iter(), "/graphql/graphiql"),
+            vec!["GET", "HEAD"]
+        );
+        assert!(allowed_methods(routes.into_iter(), "/missing").is_empty());
+    }
+
+    #[tokio::test]
+    async fn test_unsupported_methods_are_405() {
+        let rocket = rocket::build()
+            .mount("/", health::routes())
+            .mount("/", metrics::routes())
+            .mount("/", stats::routes())
+            .mount("/auth", auth::routes())
+            .mount("/graphql", graphql::routes())
+            .mount("/mnstrs", qr::routes())
+            .mount("/mnstrs", exports::routes())
+            .mount("/mnstrs", images::routes())
+            .mount("/mnstrs", stats::mnstr_routes())
+            .mount("/mnstrs", bulk_edit::routes())
+            .mount("/mnstrs", duplicates::routes())
+            .mount("/admin", exports::admin_routes())
+            .mount("/admin", admin::routes())
+            .mount("/share", share::routes())
+            .register("/", catchers());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let cases = vec![
+            (Method::Post, "/healthz", "GET, HEAD"),
+            (Method::Delete, "/metrics", "GET, HEAD"),
+            (Method::Put, "/stats", "GET, HEAD"),
+            (Method::Get, "/graphql", "POST"),
+            (Method::Patch, "/graphql", "POST"),
+            (Method::Post, "/mnstrs/abc/qr.png", "GET, HEAD"),
+            (Method::Delete, "/mnstrs/export", "GET, HEAD"),
+            (Method::Get, "/auth/login", "POST"),
+            (Method::Get, "/mnstrs/abc/image", "POST"),
+            (Method::Post, "/mnstrs/abc/stats", "GET, HEAD"),
+            (Method::Get, "/mnstrs/bulk-edit", "POST"),
+            (Method::Post, "/mnstrs/duplicates", "GET, HEAD"),
+            (Method::Delete, "/share/abc", "GET, HEAD"),
+            (Method::Post, "/admin/users", "GET, HEAD"),
+            (Method::Delete, "/admin/qr-collisions", "GET, HEAD"),
+            (Method::Post, "/admin/wallets/user-id/reconcile", "GET, HEAD"),
+            (Method::Get, "/admin/mnstrs/recompute", "POST"),
+        ];
+        for (method, path, allow) in cases {
+            let response = client.req(method, path).dispatch().await;
+            assert_eq!(response.status(), Status::MethodNotAllowed, "{} {}", method, path);
+            assert_eq!(response.headers().get_one("Allow"), Some(allow));
+            let body: serde_json::Value =
+                serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+            assert_eq!(body["error"], "Method not allowed");
+            assert!(body["data"].is_null());
+        }
+
+        let response = client.get("/missing").dispatch().await;
+        assert_eq!(response.status(), Status::NotFound);
+        assert_eq!(response.headers().get_one("Allow"), None);
+    }
+
+    #[tokio::test]
+    async fn test_routed_method_not_found_stays_404() {
+        let rocket = rocket::build()
+            .mount("/share", share::routes())
+            .register("/", catchers());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        for method in [Method::Get, Method::Head] {
+            let response = client.req(method, "/share/not-a-token").dispatch().await;
+            assert_eq!(response.status(), Status::NotFound, "{}", method);
+            assert_eq!(response.headers().get_one("Allow"), None);
+        }
+        let response = client.get("/share/not-a-token").dispatch().await;
+        let body: serde_json::Value =
+            serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+        assert_eq!(body["error"], "Not found");
+    }
+
+    #[tokio::test]
+    async fn test_other_errors_are_enveloped() {
+        let rocket = rocket::build()
+            .mount("/mnstrs", qr::routes())
+            .register("/", catchers());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client.get("/mnstrs/abc/qr.png?size=1").dispatch().await;
+        assert_eq!(response.status(), Status::BadRequest);
+        let body: serde_json::Value =
+            serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+        assert_eq!(
+            body,
+            serde_json::json!({ "data": null, "error": "Bad Request", "meta": null })
+        );
+    }
+
+    #[tokio::test]
+    async fn test_malformed_authorization_is_401() {
+        let rocket = rocket::build()
+            .mount("/mnstrs", qr::routes())
+            .register("/", catchers());
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client
+            .get("/mnstrs/abc/qr.png")
+            .header(Header::new("Authorization", "Token abc123"))
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Unauthorized);
+        let body: serde_json::Value =
+            serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+        assert_eq!(body["error"], "Authorization header must use the Bearer scheme");
+
+        let response = client
+            .get("/mnstrs/abc/qr.png")
+            .header(Header::new("Authorization", "Bearer "))
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Unauthorized);
+        let body: serde_json::Value =
+            serde_json::from_str(&response.into_string().await.unwrap()).unwrap();
+        assert_eq!(body["error"], "Authorization header is missing a bearer token");
+    }
+}
@@ -0,0 +1,372 @@
+use std::{env, sync::OnceLock};
+
+use time::{Duration, OffsetDateTime, format_description::well_known::Rfc3339};
+
+use crate::{
+    models::{
+        collect_cooldown::DEFAULT_COLLECT_COOLDOWN,
+        mnstr::{DEFAULT_RARITY_MULTIPLIERS, RarityMultipliers},
+        session::{DEFAULT_SESSION_TTL, REMEMBER_ME_SESSION_TTL},
+        transaction::DEFAULT_RETENTION_DAYS,
+    },
+    storage::{DEFAULT_IMAGE_BASE_URL, DEFAULT_IMAGE_DIR},
+    utils::deadline::DEFAULT_REQUEST_TIMEOUT_SECS,
+};
+
+/// Environment variables the server cannot start without.
+pub const REQUIRED_VARS: [&str; 8] = [
+    "DATABASE_URL",
+    "GRPC_PORT",
+    "REDIS_URL",
+    "TWILIO_ACCOUNT_SSID",
+    "TWILIO_AUTH_TOKEN",
+    "TWILIO_PHONE_NUMBER",
+    "SENDGRID_API_KEY",
+    "SENDGRID_FROM_EMAIL",
+];
+
+/// Everything the server reads from its environment, loaded and checked
+/// once at startup. See `.envrc.example` for the variables.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Config {
+    pub database_url: String,
+    pub grpc_port: u16,
+    pub redis_url: String,
+    pub twilio_account_ssid: String,
+    pub twilio_auth_token: String,
+    pub twilio_phone_number: String,
+    pub sendgrid_api_key: String,
+    pub sendgrid_from_email: String,
+    pub session_ttl: Duration,
+    pub remember_me_session_ttl: Duration,
+    pub request_timeout: std::time::Duration,
+    pub transaction_retention_days: i64,
+    pub collect_cooldown: Duration,
+    pub xp_multiplier: f64,
+    pub xp_multiplier_ends_at: Option<OffsetDateTime>,
+    pub rarity_multipliers: RarityMultipliers,
+    pub generate_mnstr_descriptions: bool,
+    pub require_mnstr_catalog: bool,
+    pub unique_mnstr_names: bool,
+    pub xp_decay_enabled: bool,
+    pub webhook_urls: Vec<String>,
+    pub webhook_secret: String,
+    pub blocked_words: Vec<String>,
+    pub admin_token: String,
+    pub image_dir: String,
+    pub image_base_url: String,
+}
+
+impl Default for Config {
+    fn default() -> Self {
+        Self {
+            database_url: String::new(),
+            grpc_port: 0,
+            redis_url: String::new(),
+            twilio_account_ssid: String::new(),
+            twilio_auth_token: String::new(),
+            twilio_phone_number: String::new(),
+            sendgrid_api_key: String::new(),
+            sendgrid_from_email: String::new(),
+            session_ttl: DEFAULT_SESSION_TTL,
+            remember_me_session_ttl: REMEMBER_ME_SESSION_TTL,
+            request_timeout: std::time::Duration::from_secs(DEFAULT_REQUEST_TIMEOUT_SECS),
+            transaction_retention_days: DEFAULT_RETENTION_DAYS,
+            collect_cooldown: DEFAULT_COLLECT_COOLDOWN,
+            xp_multiplier: 1.0,
+            xp_multiplier_ends_at: None,
+            rarity_multipliers: DEFAULT_RARITY_MULTIPLIERS,
+            generate_mnstr_descriptions: true,
+            require_mnstr_catalog: false,
+            unique_mnstr_names: false,
+            xp_decay_enabled: false,
+            webhook_urls: Vec::new(),
+            webhook_secret: String::new(),
+            blocked_words: Vec::new(),
+            admin_token: String::new(),
+            image_dir: DEFAULT_IMAGE_DIR.to_string(),
+            image_base_url: DEFAULT_IMAGE_BASE_URL.to_string(),
+        }
+    }
+}
+
+static CONFIG: OnceLock<Config> = OnceLock::new();
+
+/// Loads the config from the environment. Called once from `main` so a bad
+/// environment stops the server before it serves anything.
+pub fn init() -> Result<&'static Config, anyhow::Error> {
+    let config = Config::from_env()?;
+    Ok(CONFIG.get_or_init(|| config))
+}
+
+/// The loaded config. Defaults are used until `init` has run, which only
+/// happens in tests.
+pub fn config() -> &'static Config {
+    CONFIG.get_or_init(Config::default)
+}
+
+impl Config {
+    pub fn from_env() -> Result<Self, anyhow::Error> {
+        Config::from_lookup(|key| env::var(key).ok())
+    }
+
+    /// Builds a config from `lookup`, reporting every missing or invalid
+    /// variable at once. Blank values count as unset.
+    pub fn from_lookup(lookup: impl Fn(&str) -> Option<String>) -> Result<Self, anyhow::Error> {
+        let value = |key: &str| {
+            lookup(key)
+                .map(|value| value.trim().to_string())
+                .filter(|value| !value.is_empty())
+        };
+        let mut config = Config::default();
+        let mut problems: Vec<String> = Vec::new();
+
+        let missing = REQUIRED_VARS
+            .iter()
+            .filter(|key| value(key).is_none())
+            .copied()
+            .collect::<Vec<&str>>();
+        if !missing.is_empty() {
+            problems.push(format!(
+                "Missing required environment variables: {}",
+                missing.join(", ")
+            ));
+        }
+
+        let required = |key: &str| value(key).unwrap_or_default();
+        config.database_url = required("DATABASE_URL");
+        config.redis_url = required("REDIS_URL");
+        config.twilio_account_ssid = required("TWILIO_ACCOUNT_SSID");
+        config.twilio_auth_token = required("TWILIO_AUTH_TOKEN");
+        config.twilio_phone_number = required("TWILIO_PHONE_NUMBER");
+        config.sendgrid_api_key = required("SENDGRID_API_KEY");
+        config.sendgrid_from_email = required("SENDGRID_FROM_EMAIL");
+
+        if let Some(port) = value("GRPC_PORT") {
+            match port.parse::<u16>() {
+                Ok(port) if port > 0 => config.grpc_port = port,
+                _ => problems.push(format!("GRPC_PORT must be a port number, got {:?}", port)),
+            }
+        }
+
+        let mut positive = |key: &str| -> Option<i64> {
+            let raw = value(key)?;
+            match raw.parse::<i64>() {
+                Ok(number) if number > 0 => Some(number),
+                _ => {
+                    problems.push(format!("{} must be a positive whole number, got {:?}", key, raw));
+                    None
+                }
+            }
+        };
+        if let Some(days) = positive("SESSION_TTL_DAYS") {
+            config.session_ttl = Duration::days(days);
+        }
+        if let Some(days) = positive("REMEMBER_ME_SESSION_TTL_DAYS") {
+            config.remember_me_session_ttl = Duration::days(days);
+        }
+        if let Some(secs) = positive("REQUEST_TIMEOUT_SECS") {
+            config.request_timeout = std::time::Duration::from_secs(secs as u64);
+        }
+        if let Some(days) = positive("TRANSACTION_RETENTION_DAYS") {
+            config.transaction_retention_days = days;
+        }
+        if let Some(hours) = positive("COLLECT_COOLDOWN_HOURS") {
+            config.collect_cooldown = Duration::hours(hours);
+        }
+
+        if let Some(factor) = value("XP_MULTIPLIER") {
+            match factor.parse::<f64>() {
+                Ok(factor) if factor > 0.0 && factor.is_finite() => config.xp_multiplier = factor,
+                _ => problems.push(format!(
+                    "XP_MULTIPLIER must be a positive number, got {:?}",
+                    factor
+                )),
+            }
+        }
+        if let Some(ends_at) = value("XP_MULTIPLIER_ENDS_AT") {
+            match OffsetDateTime::parse(&ends_at, &Rfc3339) {
+                Ok(ends_at) => config.xp_multiplier_ends_at = Some(ends_at),
+                Err(_) => problems.push(format!(
+                    "XP_MULTIPLIER_ENDS_AT must be an RFC 3339 timestamp, got {:?}",
+                    ends_at
+                )),
+            }
+        }
+        for entry in list(value("RARITY_MULTIPLIERS")) {
+            let set = match entry.split_once('=') {
+                Some((rarity, factor)) => match factor.trim().parse::<f64>() {
+                    Ok(factor) if factor > 0.0 && factor.is_finite() => config
+                        .rarity_multipliers
+                        .set(&rarity.trim().to_lowercase(), factor),
+                    _ => false,
+                },
+                None => false,
+            };
+            if !set {
+                problems.push(format!(
+                    "RARITY_MULTIPLIERS must be rarity=factor pairs with positive factors, got {:?}",
+                    entry
+                ));
+            }
+        }
+        if let Some(enabled) = value("GENERATE_MNSTR_DESCRIPTIONS") {
+            config.generate_mnstr_descriptions = enabled != "false";
+        }
+        if let Some(required) = value("REQUIRE_MNSTR_CATALOG") {
+            config.require_mnstr_catalog = required == "true";
+        }
+        if let Some(unique) = value("UNIQUE_MNSTR_NAMES") {
+            config.unique_mnstr_names = unique == "true";
+        }
+        if let Some(enabled) = value("XP_DECAY_ENABLED") {
+            config.xp_decay_enabled = enabled == "true";
+        }
+
+        config.webhook_urls = list(value("WEBHOOK_URLS"));
+        config.webhook_secret = value("WEBHOOK_SECRET").unwrap_or_default();
+        config.blocked_words = list(value("BLOCKED_WORDS"))
+            .into_iter()
+            .map(|word| word.to_lowercase())
+            .collect();
+        config.admin_token = value("ADMIN_TOKEN").unwrap_or_default();
+        if let Some(image_dir) = value("IMAGE_DIR") {
+            config.image_dir = image_dir;
+        }
+        if let Some(image_base_url) = value("IMAGE_BASE_URL") {
+            config.image_base_url = image_base_url;
+        }
+
+        if !problems.is_empty() {
+            return Err(anyhow::Error::msg(problems.join("; ")));
+        }
+        Ok(config)
+    }
+}
+
+/// Splits a comma separated value, dropping blank entries.
+fn list(value: Option<String>) -> Vec<String> {
+    value
+        .unwrap_or_default()
+        .split(',')
+        .map(|item| item.trim().to_string())
+        .filter(|item| !item.is_empty())
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use std::collections::HashMap;
+
+    use super::*;
+
+    fn lookup(vars: &[(&str, &str)]) -> impl Fn(&str) -> Option<String> {
+        let vars = vars
+            .iter()
+            .map(|(key, value)| (key.to_string(), value.to_string()))
+            .collect::<HashMap<String, String>>();
+        move |key| vars.get(key).cloned()
+    }
+
+    fn required() -> Vec<(&'static str, &'static str)> {
+        vec![
+            ("DATABASE_URL", "postgresql://localhost/mnstr"),
+            ("GRPC_PORT", "50051"),
+            ("REDIS_URL", "redis://localhost"),
+            ("TWILIO_ACCOUNT_SSID", "ssid"),
+            ("TWILIO_AUTH_TOKEN", "token"),
+            ("TWILIO_PHONE_NUMBER", "+15550100"),
+            ("SENDGRID_API_KEY", "key"),
+            ("SENDGRID_FROM_EMAIL", "hello@mnstr.app"),
+        ]
+    }
+
+    #[test]
+    fn test_defaults_when_only_required_vars_are_set() {
+        let config = Config::from_lookup(lookup(&required())).unwrap();
+        assert_eq!(config.grpc_port, 50051);
+        assert_eq!(config.database_url, "postgresql://localhost/mnstr");
+        assert_eq!(config.session_ttl, DEFAULT_SESSION_TTL);
+        assert_eq!(config.remember_me_session_ttl, REMEMBER_ME_SESSION_TTL);
+        assert_eq!(config.request_timeout.as_secs(), DEFAULT_REQUEST_TIMEOUT_SECS);
+        assert_eq!(config.transaction_retention_days, DEFAULT_RETENTION_DAYS);
+        assert_eq!(config.collect_cooldown, DEFAULT_COLLECT_COOLDOWN);
+        assert_eq!(config.xp_multiplier, 1.0);
+        assert_eq!(config.rarity_multipliers, DEFAULT_RARITY_MULTIPLIERS);
+        assert!(config.generate_mnstr_descriptions);
+        assert!(!config.require_mnstr_catalog);
+        assert!(!config.unique_mnstr_names);
+        assert!(!config.xp_decay_enabled);
+        assert!(config.webhook_urls.is_empty());
+        assert!(config.blocked_words.is_empty());
+        assert!(config.admin_token.is_empty());
+        assert_eq!(config.image_dir, DEFAULT_IMAGE_DIR);
+        assert_eq!(config.image_base_url, DEFAULT_IMAGE_BASE_URL);
+    }
+
+    #[test]
+    fn test_missing_required_vars_are_all_named() {
+        let mut vars = required();
+        vars.retain(|(key, _)| *key != "DATABASE_URL" && *key != "SENDGRID_API_KEY");
+        vars.push(("REDIS_URL", "  "));
+
+        let error = Config::from_lookup(lookup(&vars)).unwrap_err().to_string();
+        assert!(error.contains("DATABASE_URL"));
+        assert!(error.contains("SENDGRID_API_KEY"));
+        assert!(error.contains("REDIS_URL"));
+        assert!(!error.contains("GRPC_PORT"));
+    }
+
+    #[test]
+    fn test_invalid_values_are_rejected() {
+        let mut vars = required();
+        vars.retain(|(key, _)| *key != "GRPC_PORT");
+        vars.push(("GRPC_PORT", "grpc"));
+        vars.push(("SESSION_TTL_DAYS", "-1"));
+        vars.push(("XP_MULTIPLIER", "0"));
+        vars.push(("RARITY_MULTIPLIERS", "mythic=3"));
+
+        let error = Config::from_lookup(lookup(&vars)).unwrap_err().to_string();
+        assert!(error.contains("GRPC_PORT must be a port number"));
+        assert!(error.contains("SESSION_TTL_DAYS must be a positive whole number"));
+        assert!(error.contains("XP_MULTIPLIER must be a positive number"));
+        assert!(error.contains("RARITY_MULTIPLIERS must be rarity=factor pairs"));
+    }
+
+    #[test]
+    fn test_optional_values_override_defaults() {
+        let mut vars = required();
+        vars.push(("SESSION_TTL_DAYS", "3"));
+        vars.push(("REQUEST_TIMEOUT_SECS", "10"));
+        vars.push(("COLLECT_COOLDOWN_HOURS", "6"));
+        vars.push(("XP_MULTIPLIER", "2.5"));
+        vars.push(("XP_MULTIPLIER_ENDS_AT", ""));
+        vars.push(("RARITY_MULTIPLIERS", "rare=1.5, Legendary=3"));
+        vars.push(("GENERATE_MNSTR_DESCRIPTIONS", "false"));
+        vars.push(("UNIQUE_MNSTR_NAMES", "true"));
+        vars.push(("WEBHOOK_URLS", "https://a.example/hook, ,https://b.example/hook"));
+        vars.push(("BLOCKED_WORDS", "Darn, Heck"));
+
+        let config = Config::from_lookup(lookup(&vars)).unwrap();
+        assert_eq!(config.session_ttl, Duration::days(3));
+        assert_eq!(config.request_timeout.as_secs(), 10);
+        assert_eq!(config.collect_cooldown, Duration::hours(6));
+        assert_eq!(config.xp_multiplier, 2.5);
+        assert_eq!(config.xp_multiplier_ends_at, None);
+        assert_eq!(
+            config.rarity_multipliers,
+            RarityMultipliers {
+                rare: 1.5,
+                legendary: 3.0,
+                ..DEFAULT_RARITY_MULTIPLIERS
+            }
+        );
+        assert!(!config.generate_mnstr_descriptions);
+        assert!(config.unique_mnstr_names);
+        assert_eq!(
+            config.webhook_urls,
+            vec!["https://a.example/hook", "https://b.example/hook"]
+        );
+        assert_eq!(config.blocked_words, vec!["darn", "heck"]);
+    }
+}
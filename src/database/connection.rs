@@ -56,7 +56,7 @@ use sqlx::PgPool;
 pub async fn get_connection() -> PgPool {
     // Implementation details would go here
     // This is a placeholder for the actual connection logic
-    PgPool::connect(&std::env::var("DATABASE_URL").unwrap())
+    PgPool::connect(&crate::config::config().database_url)
         .await
         .unwrap()
 }
@@ -102,7 +102,13 @@ macro_rules! delete_resource_where_fields {
                 query = query.bind(archived_at);
             }
 
-            match query.fetch_one(&pool).await {
+            match crate::metrics::time_db_query(
+                "delete_resource_where_fields",
+                resource_name.as_str(),
+                query.fetch_one(&pool),
+            )
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(anyhow::Error::msg(e.to_string())),
             }
@@ -164,7 +170,13 @@ macro_rules! delete_resource_where_fields {
                 query = query.bind(archived_at);
             }
 
-            match query.fetch_one(&pool).await {
+            match crate::metrics::time_db_query(
+                "delete_resource_where_fields",
+                resource_name.as_str(),
+                query.fetch_one(&pool),
+            )
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(anyhow::Error::msg(e.to_string())),
             }
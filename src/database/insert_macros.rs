@@ -29,13 +29,20 @@
 ///     ("password_hash", "hashed_password".into())
 /// ];
 /// let new_user = insert_resource!(User, params).await?;
+///
+/// // Insertion as part of a transaction
+/// let new_user = insert_resource!(User, params, &mut *tx).await?;
 /// ```
 #[macro_export]
 macro_rules! insert_resource {
     ($resource:ty, $params:expr) => {{
-        use crate::database::{
-            connection::get_connection, traits::DatabaseResource, values::DatabaseValue,
-        };
+        async {
+            let pool = crate::database::connection::get_connection().await;
+            insert_resource!($resource, $params, &pool).await
+        }
+    }};
+    ($resource:ty, $params:expr, $executor:expr) => {{
+        use crate::database::{traits::DatabaseResource, values::DatabaseValue};
         use crate::utils::strings::camel_to_snake_case;
         use pluralizer::pluralize;
         use time::{Duration, OffsetDateTime};
@@ -57,8 +64,6 @@ macro_rules! insert_resource {
                 2,
                 false,
             );
-            let pool = get_connection().await;
-
             let mut params: Vec<(String, DatabaseValue)> = Vec::new();
             for (field, value) in input_params.into_iter() {
                 params.push((field.to_string(), value.clone()))
@@ -175,7 +180,13 @@ macro_rules! insert_resource {
                 query = query.bind(value);
             }
 
-            match query.fetch_one(&pool).await {
+            match crate::metrics::time_db_query(
+                "insert_resource",
+                resource_name.as_str(),
+                query.fetch_one($executor),
+            )
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => {
                     println!("Error fetching row: {:?}", e);
@@ -189,16 +200,19 @@ macro_rules! insert_resource {
 #[macro_export]
 macro_rules! insert_resource_batch {
     ($resource:ty, $resources:expr) => {{
-        use crate::database::{
-            connection::get_connection, traits::DatabaseResource, values::DatabaseValue,
-        };
+        async {
+            let pool = crate::database::connection::get_connection().await;
+            insert_resource_batch!($resource, $resources, &pool).await
+        }
+    }};
+    ($resource:ty, $resources:expr, $executor:expr) => {{
+        use crate::database::{traits::DatabaseResource, values::DatabaseValue};
         use crate::utils::strings::camel_to_snake_case;
         use pluralizer::pluralize;
         use time::{Duration, OffsetDateTime};
         use uuid::Uuid;
 
         async {
-            let pool = get_connection().await;
             let resources: Vec<Vec<(&str, DatabaseValue)>> = $resources.clone();
             let resource_name = pluralize(
                 camel_to_snake_case(stringify!($resource).to_string()).as_str(),
@@ -389,7 +403,13 @@ macro_rules! insert_resource_batch {
                 query = query.bind(value);
             }
 
-            match query.fetch_all(&pool).await {
+            match crate::metrics::time_db_query(
+                "insert_resource_batch",
+                resource_name.as_str(),
+                query.fetch_all($executor),
+            )
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
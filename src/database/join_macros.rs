@@ -115,7 +115,13 @@ macro_rules! join_all_resources_where_fields_on {
                 query = query.bind(value);
             }
 
-            match query.fetch_all(&pool).await {
+            match crate::metrics::time_db_query(
+                "join_all_resources_where_fields_on",
+                resource_name.as_str(),
+                query.fetch_all(&pool),
+            )
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(row).unwrap())
@@ -0,0 +1,83 @@
+//! Database Migrations
+//!
+//! Embeds the SQL files in `migrations/` at compile time and applies any that
+//! have not run yet. Applied versions are tracked by SQLx in the
+//! `_sqlx_migrations` table, the same table `sqlx migrate run` uses, so
+//! databases migrated by hand are picked up where they left off.
+
+use sqlx::{
+    PgPool,
+    migrate::{MigrateError, Migrator},
+};
+
+/// Every migration in `migrations/`, ordered by version.
+pub static MIGRATOR: Migrator = sqlx::migrate!("./migrations");
+
+/// Applies pending migrations. Running it again once everything is applied is
+/// a no-op.
+///
+/// # Example
+///
+/// ```rust
+/// use crate::database::migrations::migrate;
+///
+/// async fn example(pool: &sqlx::PgPool) {
+///     migrate(pool).await.expect("migrations failed");
+/// }
+/// ```
+pub async fn migrate(pool: &PgPool) -> Result<(), MigrateError> {
+    MIGRATOR.run(pool).await
+}
+
+#[cfg(test)]
+mod tests {
+    use sqlx::postgres::PgConnectOptions;
+    use uuid::Uuid;
+
+    use super::*;
+    use crate::database::connection::get_connection;
+
+    #[test]
+    fn test_migrations_are_ordered_and_reversible() {
+        let ups = MIGRATOR
+            .iter()
+            .filter(|migration| migration.migration_type.is_up_migration())
+            .map(|migration| migration.version)
+            .collect::<Vec<i64>>();
+        let downs = MIGRATOR
+            .iter()
+            .filter(|migration| migration.migration_type.is_down_migration())
+            .count();
+
+        assert!(!ups.is_empty());
+        assert!(ups.windows(2).all(|pair| pair[0] < pair[1]));
+        assert_eq!(ups.len(), downs);
+    }
+
+    /// Runs against a scratch database, so reverting every migration does not
+    /// pull tables out from under the tests sharing `DATABASE_URL`.
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_migrations_rerun_and_revert_cleanly() {
+        let url = std::env::var("DATABASE_URL").expect("DATABASE_URL must be set");
+        let admin = get_connection().await;
+        let database = format!("mnstr_migrations_{}", Uuid::new_v4().simple());
+        sqlx::query(sqlx::AssertSqlSafe(format!("CREATE DATABASE {}", database)))
+            .execute(&admin)
+            .await
+            .unwrap();
+
+        let options = url.parse::<PgConnectOptions>().unwrap().database(&database);
+        let pool = PgPool::connect_with(options).await.unwrap();
+        migrate(&pool).await.unwrap();
+        migrate(&pool).await.unwrap();
+        MIGRATOR.undo(&pool, 0).await.unwrap();
+        migrate(&pool).await.unwrap();
+        pool.close().await;
+
+        sqlx::query(sqlx::AssertSqlSafe(format!("DROP DATABASE {}", database)))
+            .execute(&admin)
+            .await
+            .unwrap();
+    }
+}
@@ -23,6 +23,8 @@
 //! - `upsert_macros.rs` - Macros for upserting resources
 //! - `delete_macros.rs` - Macros for deleting resources (soft/hard delete)
 //! - `join_macros.rs` - Macros for complex queries with table joins
+//! - `retry.rs` - Retrying queries that fail with transient errors
+//! - `transaction.rs` - Running several statements as one transaction
 //!
 //! ## Quick Start
 //!
@@ -101,8 +103,13 @@ pub mod connection;
 pub mod delete_macros;
 pub mod insert_macros;
 pub mod join_macros;
+pub mod migrations;
 pub mod query_macros;
+pub mod retry;
+#[cfg(test)]
+pub mod test_support;
 pub mod traits;
+pub mod transaction;
 pub mod update_macros;
 pub mod upsert_macros;
 pub mod values;
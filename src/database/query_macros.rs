@@ -95,12 +95,19 @@ macro_rules! find_all_resources_where_fields {
 
             query.push_str(&format!(" ORDER BY {} {}", order_by, order_direction));
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for value in values.iter() {
-                query = query.bind(value);
-            }
-
-            match query.fetch_all(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for value in values.iter() {
+                    query = query.bind(value);
+                }
+                crate::metrics::time_db_query(
+                    "find_all_resources_where_fields",
+                    resource_name.as_str(),
+                    query.fetch_all(&pool),
+                )
+            })
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
@@ -194,11 +201,6 @@ macro_rules! find_all_unarchived_resources_where_fields {
                 }
             }
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for (_, value) in values.iter().enumerate() {
-                query = query.bind(value);
-            }
-
             let order_by = match $order_by {
                 Some(order_by) => order_by.to_string(),
                 None => "updated_at".to_string(),
@@ -211,7 +213,19 @@ macro_rules! find_all_unarchived_resources_where_fields {
 
             query.push_str(&format!(" ORDER BY {} {}", order_by, order_direction));
 
-            match query.fetch_all(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for (_, value) in values.iter().enumerate() {
+                    query = query.bind(value);
+                }
+                crate::metrics::time_db_query(
+                    "find_all_unarchived_resources_where_fields",
+                    resource_name.as_str(),
+                    query.fetch_all(&pool),
+                )
+            })
+            .await
+            {
                 Ok(rows) => rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
@@ -319,12 +333,19 @@ macro_rules! find_all_archived_resources_where_fields {
 
             query.push_str(&format!(" ORDER BY {} {}", order_by, order_direction));
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for (_, value) in values.iter().enumerate() {
-                query = query.bind(value);
-            }
-
-            match query.fetch_all(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for (_, value) in values.iter().enumerate() {
+                    query = query.bind(value);
+                }
+                crate::metrics::time_db_query(
+                    "find_all_archived_resources_where_fields",
+                    resource_name.as_str(),
+                    query.fetch_all(&pool),
+                )
+            })
+            .await
+            {
                 Ok(rows) => rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
@@ -425,12 +446,19 @@ macro_rules! find_one_resource_where_fields {
 
             query.push_str(" LIMIT 1");
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for (_, value) in values.iter().enumerate() {
-                query = query.bind(value);
-            }
-
-            match query.fetch_one(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for (_, value) in values.iter().enumerate() {
+                    query = query.bind(value);
+                }
+                crate::metrics::time_db_query(
+                    "find_one_resource_where_fields",
+                    resource_name.as_str(),
+                    query.fetch_one(&pool),
+                )
+            })
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(anyhow::Error::msg(e.to_string())),
             }
@@ -535,12 +563,19 @@ macro_rules! find_one_unarchived_resource_where_fields {
 
             query.push_str(" LIMIT 1");
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for (_, value) in values.iter().enumerate() {
-                query = query.bind(value);
-            }
-
-            match query.fetch_one(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for (_, value) in values.iter().enumerate() {
+                    query = query.bind(value);
+                }
+                crate::metrics::time_db_query(
+                    "find_one_unarchived_resource_where_fields",
+                    resource_name.as_str(),
+                    query.fetch_one(&pool),
+                )
+            })
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(e),
             }
@@ -617,12 +652,19 @@ macro_rules! find_one_archived_resource_where_fields {
 
             query.push_str(" LIMIT 1");
 
-            let mut query = sqlx::query(&query);
-            for (_, value) in params.iter().enumerate() {
-                query = query.bind(value.1.clone());
-            }
-
-            match query.fetch_one(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(&query);
+                for (_, value) in params.iter().enumerate() {
+                    query = query.bind(value.1.clone());
+                }
+                crate::metrics::time_db_query(
+                    "find_one_archived_resource_where_fields",
+                    resource_name.as_str(),
+                    query.fetch_one(&pool),
+                )
+            })
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(anyhow::Error::msg(e.to_string())),
             }
@@ -730,12 +772,19 @@ macro_rules! find_all_resources_where_fields_like {
 
             query.push_str(&format!(" ORDER BY {} {}", order_by, order_direction));
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for _ in params.iter() {
-                query = query.bind(format!("%{}%", $search_term));
-            }
-
-            match query.fetch_all(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for _ in params.iter() {
+                    query = query.bind(format!("%{}%", $search_term));
+                }
+                crate::metrics::time_db_query(
+                    "find_all_resources_where_fields_like",
+                    resource_name.as_str(),
+                    query.fetch_all(&pool),
+                )
+            })
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
@@ -837,12 +886,19 @@ macro_rules! find_all_resources_where_fields_in {
 
             query.push_str(&format!(" ORDER BY {} {}", order_by, order_direction));
 
-            let mut query = sqlx::query(sqlx::AssertSqlSafe(query));
-            for value in $values.iter() {
-                query = query.bind(value);
-            }
-
-            match query.fetch_all(&pool).await {
+            match crate::database::retry::with_retry(|| {
+                let mut query = sqlx::query(sqlx::AssertSqlSafe(query.clone()));
+                for value in $values.iter() {
+                    query = query.bind(value);
+                }
+                crate::metrics::time_db_query(
+                    "find_all_resources_where_fields_in",
+                    resource_name.as_str(),
+                    query.fetch_all(&pool),
+                )
+            })
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
@@ -0,0 +1,212 @@
+use std::time::Duration;
+
+pub const MAX_RETRY_ATTEMPTS: u32 = 3;
+const INITIAL_RETRY_BACKOFF: Duration = Duration::from_millis(50);
+const MAX_RETRY_BACKOFF: Duration = Duration::from_secs(1);
+
+/// Postgres error codes worth trying again: serialization failures,
+/// deadlocks, and the server dropping or refusing the connection.
+const TRANSIENT_SQLSTATES: [&str; 6] = ["40001", "40P01", "57P01", "08000", "08003", "08006"];
+/// Serialization failures and deadlocks, after which the server has rolled
+/// the transaction back and nothing in it was applied.
+const ROLLED_BACK_SQLSTATES: [&str; 2] = ["40001", "40P01"];
+
+/// Errors that may succeed when the same operation is tried again.
+pub trait Transient {
+    fn is_transient(&self) -> bool;
+
+    /// Whether the server is known to have rolled the transaction back, so
+    /// running it again cannot apply its writes twice. A dropped connection
+    /// is not: it may have been lost after the server committed.
+    fn is_rolled_back(&self) -> bool;
+}
+
+impl Transient for sqlx::Error {
+    fn is_transient(&self) -> bool {
+        match self {
+            sqlx::Error::Io(_) | sqlx::Error::PoolTimedOut | sqlx::Error::WorkerCrashed => true,
+            sqlx::Error::Database(error) => error
+                .code()
+                .is_some_and(|code| TRANSIENT_SQLSTATES.contains(&code.as_ref())),
+            _ => false,
+        }
+    }
+
+    fn is_rolled_back(&self) -> bool {
+        match self {
+            sqlx::Error::Database(error) => error
+                .code()
+                .is_some_and(|code| ROLLED_BACK_SQLSTATES.contains(&code.as_ref())),
+            _ => false,
+        }
+    }
+}
+
+impl Transient for anyhow::Error {
+    fn is_transient(&self) -> bool {
+        self.downcast_ref::<sqlx::Error>()
+            .is_some_and(|error| error.is_transient())
+    }
+
+    fn is_rolled_back(&self) -> bool {
+        self.downcast_ref::<sqlx::Error>()
+            .is_some_and(|error| error.is_rolled_back())
+    }
+}
+
+/// Runs `operation` until it succeeds, fails with an error that is not
+/// transient, or has been tried `MAX_RETRY_ATTEMPTS` times, backing off
+/// exponentially in between. Only use it for reads; transactions that write
+/// go through [`with_write_retry`]. Dropping the returned future (a request
+/// deadline, say) stops any further attempts.
+pub async fn with_retry<T, E, F, Fut>(operation: F) -> Result<T, E>
+where
+    E: Transient + std::fmt::Debug,
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, E>>,
+{
+    retry_with_backoff(operation, E::is_transient, INITIAL_RETRY_BACKOFF).await
+}
+
+/// Like [`with_retry`] for a whole transaction that writes. It is only run
+/// again when the server rolled the last attempt back, never after an error
+/// that leaves it unknown whether COMMIT went through.
+pub async fn with_write_retry<T, E, F, Fut>(operation: F) -> Result<T, E>
+where
+    E: Transient + std::fmt::Debug,
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, E>>,
+{
+    retry_with_backoff(operation, E::is_rolled_back, INITIAL_RETRY_BACKOFF).await
+}
+
+async fn retry_with_backoff<T, E, F, Fut>(
+    mut operation: F,
+    is_retryable: fn(&E) -> bool,
+    initial_backoff: Duration,
+) -> Result<T, E>
+where
+    E: Transient + std::fmt::Debug,
+    F: FnMut() -> Fut,
+    Fut: Future<Output = Result<T, E>>,
+{
+    let mut backoff = initial_backoff;
+    let mut attempt = 1;
+    loop {
+        let error = match operation().await {
+            Ok(value) => return Ok(value),
+            Err(error) if !is_retryable(&error) => return Err(error),
+            Err(error) => error,
+        };
+        if attempt >= MAX_RETRY_ATTEMPTS {
+            return Err(error);
+        }
+        println!(
+            "[database::with_retry] Attempt {} failed, retrying: {:?}",
+            attempt, error
+        );
+        tokio::time::sleep(backoff).await;
+        backoff = (backoff * 2).min(MAX_RETRY_BACKOFF);
+        attempt += 1;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::{
+        io,
+        sync::atomic::{AtomicU32, Ordering},
+    };
+
+    fn connection_reset() -> sqlx::Error {
+        sqlx::Error::Io(io::Error::new(io::ErrorKind::ConnectionReset, "reset"))
+    }
+
+    #[tokio::test]
+    async fn test_transient_error_succeeds_on_second_attempt() {
+        let attempts = AtomicU32::new(0);
+        let result = retry_with_backoff(
+            || async {
+                match attempts.fetch_add(1, Ordering::SeqCst) {
+                    0 => Err(connection_reset()),
+                    _ => Ok(5),
+                }
+            },
+            Transient::is_transient,
+            Duration::ZERO,
+        )
+        .await;
+
+        assert_eq!(result.unwrap(), 5);
+        assert_eq!(attempts.load(Ordering::SeqCst), 2);
+    }
+
+    #[tokio::test]
+    async fn test_permanent_errors_are_not_retried() {
+        let attempts = AtomicU32::new(0);
+        let result: Result<(), sqlx::Error> = retry_with_backoff(
+            || async {
+                attempts.fetch_add(1, Ordering::SeqCst);
+                Err(sqlx::Error::RowNotFound)
+            },
+            Transient::is_transient,
+            Duration::ZERO,
+        )
+        .await;
+
+        assert!(matches!(result, Err(sqlx::Error::RowNotFound)));
+        assert_eq!(attempts.load(Ordering::SeqCst), 1);
+    }
+
+    #[tokio::test]
+    async fn test_gives_up_after_max_attempts() {
+        let attempts = AtomicU32::new(0);
+        let result: Result<(), anyhow::Error> = retry_with_backoff(
+            || async {
+                attempts.fetch_add(1, Ordering::SeqCst);
+                Err(connection_reset().into())
+            },
+            Transient::is_transient,
+            Duration::ZERO,
+        )
+        .await;
+
+        assert!(result.is_err());
+        assert_eq!(attempts.load(Ordering::SeqCst), MAX_RETRY_ATTEMPTS);
+    }
+
+    #[tokio::test]
+    async fn test_writes_are_not_retried_after_a_dropped_connection() {
+        let attempts = AtomicU32::new(0);
+        let result: Result<(), anyhow::Error> = retry_with_backoff(
+            || async {
+                attempts.fetch_add(1, Ordering::SeqCst);
+                Err(connection_reset().into())
+            },
+            Transient::is_rolled_back,
+            Duration::ZERO,
+        )
+        .await;
+
+        assert!(result.is_err());
+        assert_eq!(attempts.load(Ordering::SeqCst), 1);
+    }
+
+    #[test]
+    fn test_is_rolled_back() {
+        assert!(!connection_reset().is_rolled_back());
+        assert!(!sqlx::Error::PoolTimedOut.is_rolled_back());
+        assert!(!sqlx::Error::WorkerCrashed.is_rolled_back());
+        assert!(!anyhow::Error::from(connection_reset()).is_rolled_back());
+    }
+
+    #[test]
+    fn test_is_transient() {
+        assert!(connection_reset().is_transient());
+        assert!(sqlx::Error::PoolTimedOut.is_transient());
+        assert!(!sqlx::Error::RowNotFound.is_transient());
+        assert!(!anyhow::Error::msg("Insufficient funds").is_transient());
+        assert!(anyhow::Error::from(connection_reset()).is_transient());
+    }
+}
@@ -0,0 +1,77 @@
+//! Test Support
+//!
+//! Helpers for tests that run against a real database. Those tests are
+//! `#[ignore]`d so `cargo test` stays self-contained; run them against a
+//! scratch database with:
+//!
+//! ```sh
+//! DATABASE_URL=postgresql://localhost/mnstr_test cargo test -- --ignored
+//! ```
+
+use sqlx::PgPool;
+use uuid::Uuid;
+
+use crate::{
+    database::{connection::get_connection, migrations::migrate},
+    models::{mnstr::Mnstr, user::User, wallet::Wallet},
+};
+
+/// The pool named by `DATABASE_URL`, migrated to the latest version.
+pub async fn test_pool() -> PgPool {
+    let pool = get_connection().await;
+    migrate(&pool).await.expect("migrations failed");
+    pool
+}
+
+/// A new user with an empty wallet. Every call gets its own email and
+/// display name so tests never collide.
+pub async fn create_test_user() -> User {
+    let pool = test_pool().await;
+    let id = Uuid::new_v4().to_string();
+    sqlx::query(
+        "INSERT INTO users (id, display_name, email, password_hash) VALUES ($1, $2, $3, '')",
+    )
+    .bind(id.clone())
+    .bind(format!("test-{}", id))
+    .bind(format!("{}@test.mnstr.app", id))
+    .execute(&pool)
+    .await
+    .expect("failed to insert user");
+    sqlx::query("INSERT INTO wallets (id, user_id) VALUES ($1, $2)")
+        .bind(Uuid::new_v4().to_string())
+        .bind(id.clone())
+        .execute(&pool)
+        .await
+        .expect("failed to insert wallet");
+    User::find_one(id, false).await.expect("failed to read user")
+}
+
+/// The wallet of a user made by [`create_test_user`], with `coins` holding
+/// its cached `coin_balance`.
+pub async fn test_wallet(user: &User) -> Wallet {
+    let mut wallet = Wallet::find_one_by(vec![("user_id", user.id.clone().into())])
+        .await
+        .expect("failed to read wallet");
+    if let Some(error) = wallet.get_coins().await {
+        panic!("failed to read coin balance: {:?}", error);
+    }
+    wallet
+}
+
+/// Inserts a live mnstr for `user` straight into the table, without awarding
+/// anything for it.
+pub async fn create_test_mnstr(user: &User, mnstr_qr_code: &str) -> Mnstr {
+    let pool = test_pool().await;
+    let id = Uuid::new_v4().to_string();
+    sqlx::query(
+        "INSERT INTO mnstrs (id, user_id, mnstr_name, mnstr_description, mnstr_qr_code)
+        VALUES ($1, $2, '', '', $3)",
+    )
+    .bind(id.clone())
+    .bind(user.id.clone())
+    .bind(mnstr_qr_code)
+    .execute(&pool)
+    .await
+    .expect("failed to insert mnstr");
+    Mnstr::find_one(id, false).await.expect("failed to read mnstr")
+}
@@ -26,6 +26,8 @@ use sqlx::{Error, postgres::PgRow};
 /// - `is_expirable()` - Whether resource has expires_at timestamps
 /// - `is_verifiable()` - Whether resource supports verification
 ///
+/// `is_versioned()` is optional and defaults to `false`.
+///
 /// # Example Implementation
 ///
 /// ```rust
@@ -141,4 +143,16 @@ pub trait DatabaseResource {
     /// `bool` - Whether the resource supports verification
     #[allow(unused)]
     fn is_verifiable() -> bool;
+
+    /// Whether the resource has a `version` column bumped by every write.
+    ///
+    /// If this returns `true`, update operations will increment `version` so an
+    /// edit made against an older read can be turned away. Defaults to `false`.
+    ///
+    /// # Returns
+    ///
+    /// `bool` - Whether the resource has a version column
+    fn is_versioned() -> bool {
+        false
+    }
 }
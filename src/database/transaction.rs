@@ -0,0 +1,187 @@
+use std::panic::{AssertUnwindSafe, resume_unwind};
+
+use futures::{FutureExt, future::BoxFuture};
+use sqlx::{PgConnection, Postgres, Transaction};
+
+use crate::database::connection::get_connection;
+
+/// Runs `body` in a transaction. The transaction is committed when `body`
+/// returns `Ok` and rolled back when it returns an error or panics, so a
+/// failure part way through never leaves half of its writes behind. A panic
+/// is passed on to the caller once the rollback has been sent.
+///
+/// ```rust
+/// let user = with_tx(move |conn| {
+///     Box::pin(async move {
+///         let row = sqlx::query("INSERT INTO users ...").fetch_one(&mut *conn).await?;
+///         sqlx::query("INSERT INTO wallets ...").execute(&mut *conn).await?;
+///         Ok(User::from_row(&row)?)
+///     })
+/// })
+/// .await?;
+/// ```
+pub async fn with_tx<T, F>(body: F) -> Result<T, anyhow::Error>
+where
+    T: Send,
+    F: for<'c> FnOnce(&'c mut PgConnection) -> BoxFuture<'c, Result<T, anyhow::Error>> + Send,
+{
+    let pool = get_connection().await;
+    let tx = match pool.begin().await {
+        Ok(tx) => tx,
+        Err(e) => {
+            println!("[database::with_tx] Failed to begin transaction: {:?}", e);
+            return Err(e.into());
+        }
+    };
+    run_in_tx(tx, body).await
+}
+
+/// What [`run_in_tx`] needs from a transaction, so the commit and rollback
+/// decisions can be tested without a database.
+trait Tx {
+    type Connection: ?Sized;
+
+    fn connection(&mut self) -> &mut Self::Connection;
+    fn commit(self) -> impl Future<Output = Result<(), sqlx::Error>> + Send;
+    fn rollback(self) -> impl Future<Output = Result<(), sqlx::Error>> + Send;
+}
+
+impl Tx for Transaction<'static, Postgres> {
+    type Connection = PgConnection;
+
+    fn connection(&mut self) -> &mut PgConnection {
+        &mut *self
+    }
+
+    fn commit(self) -> impl Future<Output = Result<(), sqlx::Error>> + Send {
+        Transaction::commit(self)
+    }
+
+    fn rollback(self) -> impl Future<Output = Result<(), sqlx::Error>> + Send {
+        Transaction::rollback(self)
+    }
+}
+
+async fn run_in_tx<X, T, F>(mut tx: X, body: F) -> Result<T, anyhow::Error>
+where
+    X: Tx,
+    F: for<'c> FnOnce(&'c mut X::Connection) -> BoxFuture<'c, Result<T, anyhow::Error>>,
+{
+    let conn = tx.connection();
+    let result = AssertUnwindSafe(async move { body(conn).await })
+        .catch_unwind()
+        .await;
+    match result {
+        Ok(Ok(value)) => {
+            if let Err(e) = tx.commit().await {
+                println!("[database::with_tx] Failed to commit transaction: {:?}", e);
+                return Err(e.into());
+            }
+            Ok(value)
+        }
+        Ok(Err(error)) => {
+            if let Err(e) = tx.rollback().await {
+                println!("[database::with_tx] Failed to roll back transaction: {:?}", e);
+            }
+            Err(error)
+        }
+        Err(panic) => {
+            if let Err(e) = tx.rollback().await {
+                println!("[database::with_tx] Failed to roll back transaction: {:?}", e);
+            }
+            resume_unwind(panic)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::{Arc, Mutex};
+
+    /// Records the statements run through it and how it was finished.
+    #[derive(Default)]
+    struct FakeTx {
+        statements: Vec<&'static str>,
+        finished: Arc<Mutex<Vec<&'static str>>>,
+    }
+
+    impl Tx for FakeTx {
+        type Connection = Vec<&'static str>;
+
+        fn connection(&mut self) -> &mut Vec<&'static str> {
+            &mut self.statements
+        }
+
+        fn commit(self) -> impl Future<Output = Result<(), sqlx::Error>> + Send {
+            let mut finished = self.finished.lock().unwrap();
+            finished.extend(self.statements.iter().copied());
+            finished.push("COMMIT");
+            async { Ok(()) }
+        }
+
+        fn rollback(self) -> impl Future<Output = Result<(), sqlx::Error>> + Send {
+            self.finished.lock().unwrap().push("ROLLBACK");
+            async { Ok(()) }
+        }
+    }
+
+    #[tokio::test]
+    async fn test_commits_when_body_succeeds() {
+        let tx = FakeTx::default();
+        let finished = tx.finished.clone();
+
+        let result = run_in_tx(tx, |statements| {
+            Box::pin(async move {
+                statements.push("INSERT INTO users");
+                statements.push("INSERT INTO wallets");
+                Ok(2)
+            })
+        })
+        .await;
+
+        assert_eq!(result.unwrap(), 2);
+        assert_eq!(
+            *finished.lock().unwrap(),
+            vec!["INSERT INTO users", "INSERT INTO wallets", "COMMIT"]
+        );
+    }
+
+    #[tokio::test]
+    async fn test_rolls_back_on_a_mid_sequence_error() {
+        let tx = FakeTx::default();
+        let finished = tx.finished.clone();
+
+        let result: Result<(), anyhow::Error> = run_in_tx(tx, |statements| {
+            Box::pin(async move {
+                statements.push("INSERT INTO users");
+                let wallet: Result<(), anyhow::Error> =
+                    Err(anyhow::Error::msg("Failed to create wallet"));
+                wallet?;
+                statements.push("INSERT INTO wallets");
+                Ok(())
+            })
+        })
+        .await;
+
+        assert_eq!(result.unwrap_err().to_string(), "Failed to create wallet");
+        assert_eq!(*finished.lock().unwrap(), vec!["ROLLBACK"]);
+    }
+
+    #[tokio::test]
+    async fn test_rolls_back_and_resumes_a_panic() {
+        let tx = FakeTx::default();
+        let finished = tx.finished.clone();
+
+        let handle = tokio::spawn(run_in_tx::<_, (), _>(tx, |statements| {
+            Box::pin(async move {
+                statements.push("INSERT INTO users");
+                panic!("wallet exploded");
+            })
+        }));
+
+        let error = handle.await.unwrap_err();
+        assert!(error.is_panic());
+        assert_eq!(*finished.lock().unwrap(), vec!["ROLLBACK"]);
+    }
+}
@@ -9,6 +9,7 @@
 /// This macro generates an UPDATE query and automatically handles common database fields:
 /// - Sets `updated_at` timestamp if `is_updatable()` returns true
 /// - Sets `expires_at` timestamp (30 days from now) if `is_expirable()` returns true
+/// - Increments `version` if `is_versioned()` returns true
 /// - Fetches and returns the updated resource after successful update
 /// - Supports updating multiple fields in a single operation
 ///
@@ -127,6 +128,10 @@ macro_rules! update_resource {
                 }
             }
 
+            if <$resource as DatabaseResource>::is_versioned() {
+                query.push_str(", version = version + 1");
+            }
+
             query.push_str(&format!(" WHERE id = ${}", fields.len() + 1));
             query.push_str(&format!(" RETURNING *"));
 
@@ -139,7 +144,13 @@ macro_rules! update_resource {
             }
             query = query.bind(&id);
 
-            match query.fetch_one(&pool).await {
+            match crate::metrics::time_db_query(
+                "update_resource",
+                resource_name.as_str(),
+                query.fetch_one(&pool),
+            )
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(anyhow::Error::msg(e.to_string())),
             }
@@ -152,6 +163,7 @@ macro_rules! update_resource {
 /// This macro generates an UPDATE query and automatically handles common database fields:
 /// - Sets `updated_at` timestamp if `is_updatable()` returns true
 /// - Sets `expires_at` timestamp (30 days from now) if `is_expirable()` returns true
+/// - Increments `version` if `is_versioned()` returns true
 /// - Fetches and returns the updated resources after successful update
 /// - Supports updating multiple fields in a single operation
 /// - Supports updating multiple resources in a single operation
@@ -229,6 +241,10 @@ macro_rules! update_resource_batch {
                 }
             }
 
+            if <$resource as DatabaseResource>::is_versioned() {
+                query.push_str(", version = t.version + 1");
+            }
+
             query.push_str(" FROM (VALUES ");
 
             let mut values: Vec<DatabaseValue> = Vec::new();
@@ -327,7 +343,13 @@ macro_rules! update_resource_batch {
                 query = query.bind(value);
             }
 
-            match query.fetch_all(&pool).await {
+            match crate::metrics::time_db_query(
+                "update_resource_batch",
+                resource_name.as_str(),
+                query.fetch_all(&pool),
+            )
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
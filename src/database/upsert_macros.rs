@@ -134,7 +134,13 @@ macro_rules! upsert_resource {
                     _ => query = query.bind(value),
                 }
             }
-            match query.fetch_one(&pool).await {
+            match crate::metrics::time_db_query(
+                "upsert_resource",
+                resource_name.as_str(),
+                query.fetch_one(&pool),
+            )
+            .await
+            {
                 Ok(row) => Ok(<$resource as DatabaseResource>::from_row(&row)?),
                 Err(e) => Err(e.into()),
             }
@@ -330,7 +336,13 @@ macro_rules! upsert_resource_batch {
             for (_, value) in values.iter().enumerate() {
                 query = query.bind(value);
             }
-            match query.fetch_all(&pool).await {
+            match crate::metrics::time_db_query(
+                "upsert_resource_batch",
+                resource_name.as_str(),
+                query.fetch_all(&pool),
+            )
+            .await
+            {
                 Ok(rows) => Ok(rows
                     .into_iter()
                     .map(|row| <$resource as DatabaseResource>::from_row(&row))
@@ -0,0 +1,36 @@
+use rocket::{Route, get, http::Status, serde::json::Json};
+
+use crate::{
+    models::{
+        mnstr::{Mnstr, MnstrDuplicateGroup},
+        session::Session,
+    },
+    utils::{response::Envelope, sessions::get_user_from_token, token::RawToken},
+};
+
+pub fn routes() -> Vec<Route> {
+    routes![duplicates]
+}
+
+/// The session user's duplicate catches: every QR code they hold more than
+/// one live mnstr for, with those mnstrs oldest first.
+#[get("/duplicates")]
+pub async fn duplicates(
+    token: RawToken,
+) -> Result<Json<Envelope<Vec<MnstrDuplicateGroup>>>, Status> {
+    if token.value.is_empty() {
+        return Err(Status::Unauthorized);
+    }
+    let user = match get_user_from_token::<Session>(token.value).await {
+        Ok(user) => user,
+        Err(_) => return Err(Status::Unauthorized),
+    };
+
+    match Mnstr::find_duplicates_by_user_id(user.id).await {
+        Ok(groups) => Ok(Envelope::ok(groups)),
+        Err(e) => {
+            println!("[duplicates] Failed to find duplicate mnstrs: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
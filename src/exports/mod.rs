@@ -0,0 +1,477 @@
+use futures::StreamExt;
+use rocket::{
+    Route, get,
+    http::{ContentType, Status},
+    response::stream::TextStream,
+};
+use serde::Serialize;
+use time::{OffsetDateTime, format_description::well_known::Rfc3339};
+
+use crate::{
+    config::config,
+    database::{connection::get_connection, traits::DatabaseResource},
+    models::{
+        mnstr::Mnstr,
+        session::Session,
+        transaction::{EXPORT_TRANSACTIONS_QUERY, Transaction},
+    },
+    utils::{
+        admin::{RawAdminToken, is_admin_token},
+        sessions::get_user_from_token,
+        token::RawToken,
+    },
+};
+
+pub const CSV_HEADER: &str = "id,name,description,qr_code,created_at,coins\n";
+pub const TRANSACTIONS_CSV_HEADER: &str =
+    "id,wallet_id,type,amount,status,data,error_message,created_at\n";
+
+/// Ends an export that failed partway. It is never valid CSV or JSON, so a
+/// cut-off file cannot be mistaken for a complete one.
+pub const EXPORT_ERROR_MARKER: &str = "\n#error: export incomplete\n";
+
+pub fn routes() -> Vec<Route> {
+    routes![export_mnstrs]
+}
+
+/// Routes for operators, mounted under /admin.
+pub fn admin_routes() -> Vec<Route> {
+    routes![export_transactions]
+}
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum ExportFormat {
+    Csv,
+    Json,
+}
+
+impl ExportFormat {
+    pub fn from_string(value: &str) -> Option<Self> {
+        match value {
+            "csv" => Some(ExportFormat::Csv),
+            "json" => Some(ExportFormat::Json),
+            _ => None,
+        }
+    }
+}
+
+/// One exported mnstr.
+#[derive(Debug, Serialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrExport {
+    pub id: String,
+    pub name: String,
+    pub description: String,
+    pub qr_code: String,
+    pub created_at: String,
+    pub coins: i32,
+}
+
+impl MnstrExport {
+    pub fn from_mnstr(mnstr: &Mnstr) -> Self {
+        Self {
+            id: mnstr.id.clone(),
+            name: mnstr.mnstr_name.clone(),
+            description: mnstr.mnstr_description.clone(),
+            qr_code: mnstr.mnstr_qr_code.clone(),
+            created_at: format_timestamp(mnstr.created_at),
+            coins: mnstr.coins(),
+        }
+    }
+
+    pub fn to_csv_row(&self) -> String {
+        format!(
+            "{},{},{},{},{},{}\n",
+            csv_field(&self.id),
+            csv_field(&self.name),
+            csv_field(&self.description),
+            csv_field(&self.qr_code),
+            csv_field(&self.created_at),
+            self.coins
+        )
+    }
+}
+
+/// One exported transaction.
+#[derive(Debug, Serialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct TransactionExport {
+    pub id: String,
+    pub wallet_id: String,
+    pub transaction_type: String,
+    pub transaction_amount: i32,
+    pub transaction_status: String,
+    pub transaction_data: Option<String>,
+    pub error_message: Option<String>,
+    pub created_at: String,
+}
+
+impl TransactionExport {
+    pub fn from_transaction(transaction: &Transaction) -> Self {
+        Self {
+            id: transaction.id.clone(),
+            wallet_id: transaction.wallet_id.clone(),
+            transaction_type: transaction.transaction_type.to_string(),
+            transaction_amount: transaction.transaction_amount,
+            transaction_status: transaction.transaction_status.to_string(),
+            transaction_data: transaction.transaction_data.clone(),
+            error_message: transaction.error_message.clone(),
+            created_at: format_timestamp(transaction.created_at),
+        }
+    }
+
+    pub fn to_csv_row(&self) -> String {
+        format!(
+            "{},{},{},{},{},{},{},{}\n",
+            csv_field(&self.id),
+            csv_field(&self.wallet_id),
+            csv_field(&self.transaction_type),
+            self.transaction_amount,
+            csv_field(&self.transaction_status),
+            csv_field(self.transaction_data.as_deref().unwrap_or_default()),
+            csv_field(self.error_message.as_deref().unwrap_or_default()),
+            csv_field(&self.created_at)
+        )
+    }
+}
+
+fn format_timestamp(timestamp: Option<OffsetDateTime>) -> String {
+    timestamp
+        .and_then(|timestamp| timestamp.format(&Rfc3339).ok())
+        .unwrap_or_default()
+}
+
+/// What follows the last row of an export: the closing bracket of a JSON
+/// array, or the error marker when the rows stopped early.
+pub fn export_footer(format: ExportFormat, failed: bool) -> String {
+    if failed {
+        return EXPORT_ERROR_MARKER.to_string();
+    }
+    match format {
+        ExportFormat::Csv => String::new(),
+        ExportFormat::Json => "]".to_string(),
+    }
+}
+
+/// Quotes a CSV field when it holds a delimiter, quote or line break.
+pub fn csv_field(value: &str) -> String {
+    if value.contains([',', '"', '\n', '\r']) {
+        return format!("\"{}\"", value.replace('"', "\"\""));
+    }
+    value.to_string()
+}
+
+/// Streams the session user's mnstrs as CSV (the default) or a JSON array,
+/// one row at a time so large collections are never held in memory.
+#[get("/export?<format>")]
+pub async fn export_mnstrs(
+    format: Option<String>,
+    token: RawToken,
+) -> Result<(ContentType, TextStream![String]), Status> {
+    let format = match format.as_deref() {
+        Some(format) => ExportFormat::from_string(format).ok_or(Status::BadRequest)?,
+        None => ExportFormat::Csv,
+    };
+    if token.value.is_empty() {
+        return Err(Status::Unauthorized);
+    }
+    let user = match get_user_from_token::<Session>(token.value).await {
+        Ok(user) => user,
+        Err(_) => return Err(Status::Unauthorized),
+    };
+
+    let content_type = match format {
+        ExportFormat::Csv => ContentType::CSV,
+        ExportFormat::Json => ContentType::JSON,
+    };
+    let stream = TextStream! {
+        let pool = get_connection().await;
+        let mut rows = sqlx::query(
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND archived_at IS NULL ORDER BY created_at ASC",
+        )
+        .bind(user.id)
+        .fetch(&pool);
+
+        match format {
+            ExportFormat::Csv => yield CSV_HEADER.to_string(),
+            ExportFormat::Json => yield "[".to_string(),
+        }
+        let mut first = true;
+        let mut failed = false;
+        while let Some(row) = rows.next().await {
+            let mnstr = match row.map(|row| Mnstr::from_row(&row)) {
+                Ok(Ok(mnstr)) => mnstr,
+                Ok(Err(e)) => {
+                    println!("[export_mnstrs] Failed to read mnstr: {:?}", e);
+                    failed = true;
+                    break;
+                }
+                Err(e) => {
+                    println!("[export_mnstrs] Failed to get mnstrs: {:?}", e);
+                    failed = true;
+                    break;
+                }
+            };
+            let export = MnstrExport::from_mnstr(&mnstr);
+            match format {
+                ExportFormat::Csv => yield export.to_csv_row(),
+                ExportFormat::Json => {
+                    let separator = if first { "" } else { "," };
+                    yield format!("{}{}", separator, serde_json::to_string(&export).unwrap_or_default());
+                }
+            }
+            first = false;
+        }
+        yield export_footer(format, failed);
+    };
+    Ok((content_type, stream))
+}
+
+fn parse_timestamp(value: Option<String>) -> Result<OffsetDateTime, Status> {
+    value
+        .and_then(|value| OffsetDateTime::parse(&value, &Rfc3339).ok())
+        .ok_or(Status::BadRequest)
+}
+
+/// Streams every transaction created in `[since, until)`, including archived
+/// ones, as CSV (the default) or a JSON array for reconciling the coin
+/// economy. Both bounds are RFC 3339 timestamps. Requires X-Admin-Token.
+#[get("/transactions/export?<since>&<until>&<format>")]
+pub async fn export_transactions(
+    since: Option<String>,
+    until: Option<String>,
+    format: Option<String>,
+    admin_token: RawAdminToken,
+) -> Result<(ContentType, TextStream![String]), Status> {
+    if !is_admin_token(admin_token.value.as_deref(), &config().admin_token) {
+        return Err(Status::Unauthorized);
+    }
+    let format = match format.as_deref() {
+        Some(format) => ExportFormat::from_string(format).ok_or(Status::BadRequest)?,
+        None => ExportFormat::Csv,
+    };
+    let since = parse_timestamp(since)?;
+    let until = parse_timestamp(until)?;
+    if since >= until {
+        return Err(Status::BadRequest);
+    }
+
+    let content_type = match format {
+        ExportFormat::Csv => ContentType::CSV,
+        ExportFormat::Json => ContentType::JSON,
+    };
+    Ok((content_type, transactions_export(since, until, format)))
+}
+
+/// The body of a transaction export, read a row at a time.
+pub fn transactions_export(
+    since: OffsetDateTime,
+    until: OffsetDateTime,
+    format: ExportFormat,
+) -> TextStream![String] {
+    TextStream! {
+        let pool = get_connection().await;
+        let mut rows = sqlx::query(EXPORT_TRANSACTIONS_QUERY)
+            .bind(since)
+            .bind(until)
+            .fetch(&pool);
+
+        match format {
+            ExportFormat::Csv => yield TRANSACTIONS_CSV_HEADER.to_string(),
+            ExportFormat::Json => yield "[".to_string(),
+        }
+        let mut first = true;
+        let mut failed = false;
+        while let Some(row) = rows.next().await {
+            let transaction = match row.map(|row| Transaction::from_row(&row)) {
+                Ok(Ok(transaction)) => transaction,
+                Ok(Err(e)) => {
+                    println!("[export_transactions] Failed to read transaction: {:?}", e);
+                    failed = true;
+                    break;
+                }
+                Err(e) => {
+                    println!("[export_transactions] Failed to get transactions: {:?}", e);
+                    failed = true;
+                    break;
+                }
+            };
+            let export = TransactionExport::from_transaction(&transaction);
+            match format {
+                ExportFormat::Csv => yield export.to_csv_row(),
+                ExportFormat::Json => {
+                    let separator = if first { "" } else { "," };
+                    yield format!("{}{}", separator, serde_json::to_string(&export).unwrap_or_default());
+                }
+            }
+            first = false;
+        }
+        yield export_footer(format, failed);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        database::test_support::{create_test_user, test_pool, test_wallet},
+        models::transaction::{TransactionStatus, TransactionType},
+    };
+    use rocket::local::asynchronous::Client;
+    use time::{Date, Duration, Month};
+
+    fn mnstr() -> Mnstr {
+        let mut mnstr = Mnstr::new(
+            "owner".to_string(),
+            Some("Fluffy, Jr.".to_string()),
+            Some("Says \"hi\"".to_string()),
+            "mnstr-22".to_string(),
+        );
+        mnstr.id = "mnstr-id".to_string();
+        mnstr.created_at = Some(
+            Date::from_calendar_date(2025, Month::October, 15)
+                .unwrap()
+                .with_hms(12, 30, 0)
+                .unwrap()
+                .assume_utc(),
+        );
+        mnstr
+    }
+
+    #[test]
+    fn test_csv_export() {
+        assert_eq!(CSV_HEADER, "id,name,description,qr_code,created_at,coins\n");
+        assert_eq!(
+            MnstrExport::from_mnstr(&mnstr()).to_csv_row(),
+            "mnstr-id,\"Fluffy, Jr.\",\"Says \"\"hi\"\"\",mnstr-22,2025-10-15T12:30:00Z,1056\n"
+        );
+    }
+
+    #[test]
+    fn test_json_export() {
+        let json = serde_json::to_value(MnstrExport::from_mnstr(&mnstr())).unwrap();
+        assert_eq!(json["id"], "mnstr-id");
+        assert_eq!(json["name"], "Fluffy, Jr.");
+        assert_eq!(json["qrCode"], "mnstr-22");
+        assert_eq!(json["coins"], 1056);
+    }
+
+    fn transaction(id: &str, created_at: OffsetDateTime) -> Transaction {
+        let mut transaction = Transaction::new("wallet-id".to_string());
+        transaction.id = id.to_string();
+        transaction.transaction_type = TransactionType::Debit;
+        transaction.transaction_amount = 25;
+        transaction.transaction_status = TransactionStatus::Completed;
+        transaction.transaction_data = Some(r#"{"source":"spend","reason":"hat"}"#.to_string());
+        transaction.created_at = Some(created_at);
+        transaction
+    }
+
+    async fn seed_transaction(
+        pool: &sqlx::PgPool,
+        table: &str,
+        wallet_id: &str,
+        label: &str,
+        created_at: OffsetDateTime,
+    ) {
+        sqlx::query(sqlx::AssertSqlSafe(format!(
+            "INSERT INTO {} (id, wallet_id, transaction_type, transaction_amount,
+                transaction_status, created_at, updated_at)
+            VALUES ($1, $2, 'credit', 10, 'completed', $3, $3)",
+            table
+        )))
+        .bind(format!("{}-{}", label, wallet_id))
+        .bind(wallet_id)
+        .bind(created_at)
+        .execute(pool)
+        .await
+        .unwrap();
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_transaction_export_range() {
+        let pool = test_pool().await;
+        let wallet = test_wallet(&create_test_user().await).await;
+        let since = mnstr().created_at.unwrap();
+        let until = since + Duration::days(1);
+        for (table, label, created_at) in [
+            ("transactions", "before", since - Duration::seconds(1)),
+            ("transactions", "first", since),
+            (
+                "archived_transactions",
+                "archived",
+                since + Duration::hours(3),
+            ),
+            ("transactions", "inside", since + Duration::hours(6)),
+            ("transactions", "at-until", until),
+            ("archived_transactions", "after", until + Duration::days(3)),
+        ] {
+            seed_transaction(&pool, table, &wallet.id, label, created_at).await;
+        }
+
+        let csv = transactions_export(since, until, ExportFormat::Csv)
+            .0
+            .collect::<Vec<String>>()
+            .await
+            .concat();
+        assert!(csv.starts_with(TRANSACTIONS_CSV_HEADER));
+        assert!(!csv.contains(EXPORT_ERROR_MARKER));
+        let suffix = format!("-{}", wallet.id);
+        let exported = csv
+            .lines()
+            .filter_map(|line| {
+                let mut fields = line.split(',');
+                let id = fields.next()?;
+                let wallet_id = fields.next()?;
+                (wallet_id == wallet.id).then(|| id.trim_end_matches(&suffix))
+            })
+            .collect::<Vec<_>>();
+        assert_eq!(exported, vec!["first", "archived", "inside"]);
+    }
+
+    #[test]
+    fn test_transaction_csv_export() {
+        let created_at = mnstr().created_at.unwrap();
+        let export = TransactionExport::from_transaction(&transaction("tx-id", created_at));
+        assert_eq!(
+            TRANSACTIONS_CSV_HEADER,
+            "id,wallet_id,type,amount,status,data,error_message,created_at\n"
+        );
+        assert_eq!(
+            export.to_csv_row(),
+            "tx-id,wallet-id,debit,25,completed,\"{\"\"source\"\":\"\"spend\"\",\"\"reason\"\":\"\"hat\"\"}\",,2025-10-15T12:30:00Z\n"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_export_transactions_requires_admin_token() {
+        let rocket = rocket::build().mount("/admin", admin_routes());
+        let client = Client::untracked(rocket).await.unwrap();
+        let response = client
+            .get("/admin/transactions/export?since=2025-10-01T00:00:00Z&until=2025-11-01T00:00:00Z")
+            .header(rocket::http::Header::new("X-Admin-Token", "guess"))
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Unauthorized);
+    }
+
+    #[test]
+    fn test_export_footer() {
+        assert_eq!(export_footer(ExportFormat::Csv, false), "");
+        assert_eq!(export_footer(ExportFormat::Json, false), "]");
+        for format in [ExportFormat::Csv, ExportFormat::Json] {
+            assert_eq!(export_footer(format, true), EXPORT_ERROR_MARKER);
+        }
+
+        let cut_off = format!("[{{\"id\":\"mnstr-id\"}}{}", EXPORT_ERROR_MARKER);
+        assert!(serde_json::from_str::<serde_json::Value>(&cut_off).is_err());
+    }
+
+    #[test]
+    fn test_export_format() {
+        assert_eq!(ExportFormat::from_string("csv"), Some(ExportFormat::Csv));
+        assert_eq!(ExportFormat::from_string("json"), Some(ExportFormat::Json));
+        assert_eq!(ExportFormat::from_string("xml"), None);
+    }
+}
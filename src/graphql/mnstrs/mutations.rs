@@ -1,8 +1,8 @@
-use juniper::{FieldError, GraphQLInputObject};
+use juniper::{FieldError, GraphQLInputObject, graphql_value};
 use serde::{Deserialize, Serialize};
 use time::OffsetDateTime;
 
-use crate::{database::values::DatabaseValue, graphql::Ctx, models::{mnstr::{DEFAULT_STAT_VALUE, Mnstr}, session::Session}, utils::sessions::{get_user_from_token}};
+use crate::{graphql::Ctx, models::{mnstr::{DEFAULT_STAT_VALUE, MAX_ARCHIVE_BATCH_SIZE, MAX_COLLECT_BATCH_SIZE, MNSTR_NAME_CONFLICT, MNSTR_NOT_OWNED, MNSTR_PURGE_AFTER_DAYS, MNSTR_VERSION_CONFLICT, Mnstr, MnstrArchiveResult, MnstrBatchEdit, MnstrCollectResult, MnstrCollectReward, MnstrRelease, is_name_conflict, is_version_conflict}, mnstr_transfer::MnstrTransfer, session::Session}, utils::{sessions::get_user_from_token, validation::{sanitize_mnstr_description, validate_mnstr_description, validate_mnstr_name}}};
 
 #[derive(Debug, Serialize, Deserialize, GraphQLInputObject, Clone)]
 pub struct BatchMnstrInput {
@@ -12,6 +12,8 @@ pub struct BatchMnstrInput {
 #[derive(Debug, Serialize, Deserialize, GraphQLInputObject, Clone)]
 pub struct MnstrInput {
     pub id: Option<String>,
+    /// The version the edit was made against, checked as in `update`.
+    pub version: Option<i32>,
     pub user_id: String,
     pub mnstr_name: Option<String>,
     pub mnstr_description: Option<String>,
@@ -39,10 +41,17 @@ pub struct MnstrMutationType;
 
 #[juniper::graphql_object]
 impl MnstrMutationType {
-    async fn collect(ctx: &Ctx, mnstr_qr_code: String) -> Result<Mnstr, FieldError> {
+    async fn collect(ctx: &Ctx, mnstr_qr_code: String) -> Result<MnstrCollectReward, FieldError> {
         collect(ctx, mnstr_qr_code).await
     }
 
+    async fn collect_batch(
+        ctx: &Ctx,
+        mnstr_qr_codes: Vec<String>,
+    ) -> Result<Vec<MnstrCollectResult>, FieldError> {
+        collect_batch(ctx, mnstr_qr_codes).await
+    }
+
     async fn create(
         ctx: &Ctx,
         mnstr_name: Option<String>,
@@ -86,9 +95,12 @@ impl MnstrMutationType {
         create_batch(ctx, mnstrs.mnstrs).await
     }
 
+    /// Edits a mnstr. `version` is the version the client last read; a
+    /// CONFLICT error means someone else edited it since.
     async fn update(
         ctx: &Ctx,
         id: String,
+        version: i32,
         mnstr_name: Option<String>,
         mnstr_description: Option<String>,
         mnstr_qr_code: Option<String>,
@@ -108,6 +120,7 @@ impl MnstrMutationType {
         update(
             ctx,
             id,
+            version,
             mnstr_name,
             mnstr_description,
             mnstr_qr_code,
@@ -130,12 +143,58 @@ impl MnstrMutationType {
     async fn update_batch(ctx: &Ctx, mnstrs: BatchMnstrInput) -> Result<Vec<Mnstr>, FieldError> {
         update_batch(ctx, mnstrs.mnstrs).await
     }
+
+    async fn level_up(ctx: &Ctx, id: String) -> Result<Mnstr, FieldError> {
+        level_up(ctx, id).await
+    }
+
+    async fn archive_batch(
+        ctx: &Ctx,
+        ids: Vec<String>,
+    ) -> Result<Vec<MnstrArchiveResult>, FieldError> {
+        archive_batch(ctx, ids).await
+    }
+
+    async fn gift(ctx: &Ctx, id: String, to_user_id: String) -> Result<MnstrTransfer, FieldError> {
+        gift(ctx, id, to_user_id).await
+    }
+
+    /// Archives one of the session user's mnstrs for a partial coin refund.
+    async fn release(ctx: &Ctx, id: String) -> Result<MnstrRelease, FieldError> {
+        release(ctx, id).await
+    }
+
+    /// Levels a mnstr up by absorbing `fodder_id`, another of the session
+    /// user's mnstrs from the same QR code.
+    async fn evolve(ctx: &Ctx, id: String, fodder_id: String) -> Result<Mnstr, FieldError> {
+        evolve(ctx, id, fodder_id).await
+    }
+
+    /// Tags one of the session user's mnstrs. Tags are lowercased, and a
+    /// mnstr may have at most 10.
+    async fn add_tag(ctx: &Ctx, id: String, tag: String) -> Result<Mnstr, FieldError> {
+        add_tag(ctx, id, tag).await
+    }
+
+    async fn remove_tag(ctx: &Ctx, id: String, tag: String) -> Result<Mnstr, FieldError> {
+        remove_tag(ctx, id, tag).await
+    }
+
+    /// Permanently deletes mnstrs archived more than `older_than_days` days
+    /// ago (90 by default) and returns how many went. Requires the
+    /// X-Admin-Token header.
+    async fn purge_archived(ctx: &Ctx, older_than_days: Option<i32>) -> Result<i32, FieldError> {
+        purge_archived(ctx, older_than_days).await
+    }
 }
 
-pub async fn collect(ctx: &Ctx, mnstr_qr_code: String) -> Result<Mnstr, FieldError> {
+pub async fn collect(ctx: &Ctx, mnstr_qr_code: String) -> Result<MnstrCollectReward, FieldError> {
     if let None = ctx.session {
         return Err(FieldError::from("Invalid session"));
     }
+    if mnstr_qr_code.trim().is_empty() {
+        return Err(FieldError::from("QR code is required"));
+    }
     let session = ctx.session.as_ref().unwrap().clone();
     let user = match get_user_from_token::<Session>(session.session_token.clone()).await {
         Ok(user) => user,
@@ -145,19 +204,44 @@ pub async fn collect(ctx: &Ctx, mnstr_qr_code: String) -> Result<Mnstr, FieldErr
         }
     };
 
-    let mut mnstr = Mnstr::new(
-        user.id.clone(),
-        None,
-        None,
-        mnstr_qr_code,
-    );
+    match Mnstr::collect(user.id.clone(), mnstr_qr_code).await {
+        Ok(reward) => Ok(reward),
+        Err(e) => {
+            println!("[collect] Failed to create mnstr: {:?}", e);
+            Err(FieldError::from("Failed to create mnstr"))
+        }
+    }
+}
 
-    if let Some(error) = mnstr.create().await {
-        println!("[collect] Failed to create mnstr: {:?}", error);
-        return Err(FieldError::from("Failed to create mnstr"));
+pub async fn collect_batch(
+    ctx: &Ctx,
+    mnstr_qr_codes: Vec<String>,
+) -> Result<Vec<MnstrCollectResult>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    if mnstr_qr_codes.len() > MAX_COLLECT_BATCH_SIZE {
+        return Err(FieldError::from(format!(
+            "Cannot collect more than {} mnstrs at once",
+            MAX_COLLECT_BATCH_SIZE
+        )));
     }
+    let session = ctx.session.as_ref().unwrap().clone();
+    let user = match get_user_from_token::<Session>(session.session_token.clone()).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[collect_batch] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
 
-    Ok(mnstr)
+    match Mnstr::collect_batch(user.id.clone(), mnstr_qr_codes).await {
+        Ok(results) => Ok(results),
+        Err(e) => {
+            println!("[collect_batch] Failed to collect mnstrs: {:?}", e);
+            Err(FieldError::from("Failed to collect mnstrs"))
+        }
+    }
 }
 
 pub async fn create(
@@ -232,53 +316,31 @@ pub async fn create_batch(ctx: &Ctx, mnstrs: Vec<MnstrInput>) -> Result<Vec<Mnst
     };
 
     let mnstrs = mnstrs
-        .iter()
-        .filter(|mnstr_input| mnstr_input.mnstr_qr_code.is_some())
-        .map(|mnstr_input| {
-            let mut mnstr_params: Vec<(&str, Option<DatabaseValue>)> = Vec::new();
-            mnstr_params.push(("user_id", Some(user.id.clone().into())));
-            mnstr_params.push((
-                "mnstr_name",
-                mnstr_input.mnstr_name.as_ref().map(|s| s.into()),
-            ));
-            mnstr_params.push((
-                "mnstr_description",
-                mnstr_input.mnstr_description.as_ref().map(|s| s.into()),
-            ));
-            mnstr_params.push((
-                "mnstr_qr_code",
-                mnstr_input.mnstr_qr_code.as_ref().map(|s| s.into()),
-            ));
-            mnstr_params.push((
-                "current_health",
-                mnstr_input.current_health.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("max_health", mnstr_input.max_health.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_attack",
-                mnstr_input.current_attack.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("max_attack", mnstr_input.max_attack.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_defense",
-                mnstr_input.current_defense.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("max_defense", mnstr_input.max_defense.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push(("current_speed", mnstr_input.current_speed.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push(("max_speed", mnstr_input.max_speed.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_intelligence",
-                mnstr_input.current_intelligence.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push((
-                "max_intelligence",
-                mnstr_input.max_intelligence.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("current_magic", mnstr_input.current_magic.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push(("max_magic", mnstr_input.max_magic.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params
+        .into_iter()
+        .filter_map(|mnstr_input| {
+            let mut mnstr = Mnstr::new(
+                user.id.clone(),
+                mnstr_input.mnstr_name,
+                mnstr_input.mnstr_description,
+                mnstr_input.mnstr_qr_code?,
+            );
+            mnstr.current_health = mnstr_input.current_health.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.max_health = mnstr_input.max_health.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.current_attack = mnstr_input.current_attack.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.max_attack = mnstr_input.max_attack.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.current_defense = mnstr_input.current_defense.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.max_defense = mnstr_input.max_defense.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.current_speed = mnstr_input.current_speed.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.max_speed = mnstr_input.max_speed.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.current_intelligence = mnstr_input
+                .current_intelligence
+                .unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.max_intelligence = mnstr_input.max_intelligence.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.current_magic = mnstr_input.current_magic.unwrap_or(DEFAULT_STAT_VALUE);
+            mnstr.max_magic = mnstr_input.max_magic.unwrap_or(DEFAULT_STAT_VALUE);
+            Some(mnstr)
         })
-        .collect::<Vec<Vec<(&str, Option<DatabaseValue>)>>>();
+        .collect::<Vec<Mnstr>>();
 
     match Mnstr::create_batch(user.id.clone(), mnstrs).await {
         Ok(mnstrs) => Ok(mnstrs),
@@ -292,6 +354,7 @@ pub async fn create_batch(ctx: &Ctx, mnstrs: Vec<MnstrInput>) -> Result<Vec<Mnst
 pub async fn update(
     ctx: &Ctx,
     id: String,
+    version: i32,
     mnstr_name: Option<String>,
     mnstr_description: Option<String>,
     mnstr_qr_code: Option<String>,
@@ -311,12 +374,25 @@ pub async fn update(
     if let None = ctx.session {
         return Err(FieldError::from("Invalid session"));
     }
+    let session = ctx.session.as_ref().unwrap().clone();
 
-    let mut mnstr = match Mnstr::find_one(id, false).await {
+    if let Some(mnstr_name) = mnstr_name.as_ref() {
+        if let Err(e) = validate_mnstr_name(mnstr_name) {
+            return Err(FieldError::from(e.to_string()));
+        }
+    }
+    let mnstr_description = mnstr_description.as_deref().map(sanitize_mnstr_description);
+    if let Some(mnstr_description) = mnstr_description.as_ref() {
+        if let Err(e) = validate_mnstr_description(mnstr_description) {
+            return Err(FieldError::from(e.to_string()));
+        }
+    }
+
+    let mut mnstr = match Mnstr::find_owned(id, &session.user_id).await {
         Ok(mnstr) => mnstr,
         Err(e) => {
             println!("[update] Failed to find mnstr: {:?}", e);
-            return Err(FieldError::from(e.to_string()));
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
         }
     };
 
@@ -336,8 +412,20 @@ pub async fn update(
     mnstr.current_magic = current_magic.unwrap_or(mnstr.current_magic);
     mnstr.max_magic = max_magic.unwrap_or(mnstr.max_magic);
 
-    if let Some(error) = mnstr.update().await {
+    if let Some(error) = mnstr.update_as(session.user_id.clone(), version).await {
         println!("[update] Failed to update mnstr: {:?}", error);
+        if is_version_conflict(&error) {
+            return Err(FieldError::new(
+                MNSTR_VERSION_CONFLICT,
+                graphql_value!({ "code": "CONFLICT" }),
+            ));
+        }
+        if is_name_conflict(&error) {
+            return Err(FieldError::new(
+                MNSTR_NAME_CONFLICT,
+                graphql_value!({ "code": "CONFLICT" }),
+            ));
+        }
         return Err(FieldError::from("Failed to update mnstr"));
     }
 
@@ -360,68 +448,265 @@ pub async fn update_batch(
         }
     };
 
-    let mnstrs = mnstr_inputs
-        .iter()
-        .filter(|mnstr_input| mnstr_input.mnstr_qr_code.is_some())
-        .map(|mnstr_input| {
-            let mut mnstr_params: Vec<(&str, Option<DatabaseValue>)> = Vec::new();
-            mnstr_params.push(("id", mnstr_input.id.as_ref().map(|s| s.into())));
-            mnstr_params.push(("user_id", Some(user.id.clone().into())));
-            mnstr_params.push((
-                "mnstr_name",
-                mnstr_input.mnstr_name.as_ref().map(|s| s.into()),
-            ));
-            mnstr_params.push((
-                "mnstr_description",
-                mnstr_input.mnstr_description.as_ref().map(|s| s.into()),
-            ));
-            mnstr_params.push((
-                "mnstr_qr_code",
-                mnstr_input.mnstr_qr_code.as_ref().map(|s| s.into()),
-            ));
-            mnstr_params.push(("current_level", mnstr_input.current_level.map_or(Some(0.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_experience",
-                mnstr_input.current_experience.map_or(Some(0.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push((
-                "current_health",
-                mnstr_input.current_health.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("max_health", mnstr_input.max_health.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_attack",
-                mnstr_input.current_attack.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("max_attack", mnstr_input.max_attack.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_defense",
-                mnstr_input.current_defense.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("max_defense", mnstr_input.max_defense.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push(("current_speed", mnstr_input.current_speed.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push(("max_speed", mnstr_input.max_speed.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push((
-                "current_intelligence",
-                mnstr_input.current_intelligence.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push((
-                "max_intelligence",
-                mnstr_input.max_intelligence.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-            ));
-            mnstr_params.push(("current_magic", mnstr_input.current_magic.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params.push(("max_magic", mnstr_input.max_magic.map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into()))));
-            mnstr_params
+    let mut mnstr_inputs = mnstr_inputs;
+    for mnstr_input in mnstr_inputs.iter_mut() {
+        if let Some(mnstr_name) = mnstr_input.mnstr_name.as_ref() {
+            if let Err(e) = validate_mnstr_name(mnstr_name) {
+                return Err(FieldError::from(e.to_string()));
+            }
+        }
+        mnstr_input.mnstr_description = mnstr_input
+            .mnstr_description
+            .as_deref()
+            .map(sanitize_mnstr_description);
+        if let Some(mnstr_description) = mnstr_input.mnstr_description.as_ref() {
+            if let Err(e) = validate_mnstr_description(mnstr_description) {
+                return Err(FieldError::from(e.to_string()));
+            }
+        }
+    }
+
+    let edits = mnstr_inputs
+        .into_iter()
+        .filter_map(|mnstr_input| {
+            Some(MnstrBatchEdit {
+                mnstr_qr_code: mnstr_input.mnstr_qr_code?,
+                version: mnstr_input.version,
+                mnstr_name: mnstr_input.mnstr_name,
+                mnstr_description: mnstr_input.mnstr_description,
+                current_level: mnstr_input.current_level,
+                current_experience: mnstr_input.current_experience,
+                current_health: mnstr_input.current_health,
+                max_health: mnstr_input.max_health,
+                current_attack: mnstr_input.current_attack,
+                max_attack: mnstr_input.max_attack,
+                current_defense: mnstr_input.current_defense,
+                max_defense: mnstr_input.max_defense,
+                current_speed: mnstr_input.current_speed,
+                max_speed: mnstr_input.max_speed,
+                current_intelligence: mnstr_input.current_intelligence,
+                max_intelligence: mnstr_input.max_intelligence,
+                current_magic: mnstr_input.current_magic,
+                max_magic: mnstr_input.max_magic,
+            })
         })
-        .collect::<Vec<Vec<(&str, Option<DatabaseValue>)>>>();
+        .collect::<Vec<MnstrBatchEdit>>();
 
-    let mnstrs = match Mnstr::update_batch(user.id.clone(), mnstrs).await {
+    let mnstrs = match Mnstr::update_batch(user.id.clone(), edits).await {
         Ok(mnstrs) => mnstrs,
         Err(e) => {
             println!("[update_batch] Failed to update mnstrs: {:?}", e);
+            if is_version_conflict(&e) {
+                return Err(FieldError::new(
+                    MNSTR_VERSION_CONFLICT,
+                    graphql_value!({ "code": "CONFLICT" }),
+                ));
+            }
+            if is_name_conflict(&e) {
+                return Err(FieldError::new(
+                    MNSTR_NAME_CONFLICT,
+                    graphql_value!({ "code": "CONFLICT" }),
+                ));
+            }
             return Err(FieldError::from("Failed to update mnstrs"));
         }
     };
 
     Ok(mnstrs)
 }
+
+pub async fn level_up(ctx: &Ctx, id: String) -> Result<Mnstr, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+    let mut user = match get_user_from_token::<Session>(session.session_token.clone()).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[level_up] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+
+    let mut mnstr = match Mnstr::find_owned(id, &user.id).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[level_up] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
+        }
+    };
+    if let Some(error) = mnstr.level_up(&mut user).await {
+        println!("[level_up] Failed to level up mnstr: {:?}", error);
+        return Err(FieldError::from(error.to_string()));
+    }
+    Ok(mnstr)
+}
+
+pub async fn archive_batch(
+    ctx: &Ctx,
+    ids: Vec<String>,
+) -> Result<Vec<MnstrArchiveResult>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    if ids.len() > MAX_ARCHIVE_BATCH_SIZE {
+        return Err(FieldError::from(format!(
+            "Cannot archive more than {} mnstrs at once",
+            MAX_ARCHIVE_BATCH_SIZE
+        )));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match Mnstr::archive_batch(session.user_id.clone(), ids).await {
+        Ok(results) => Ok(results),
+        Err(e) => {
+            println!("[archive_batch] Failed to archive mnstrs: {:?}", e);
+            Err(FieldError::from("Failed to archive mnstrs"))
+        }
+    }
+}
+
+pub async fn gift(ctx: &Ctx, id: String, to_user_id: String) -> Result<MnstrTransfer, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut mnstr = match Mnstr::find_owned(id, &session.user_id).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[gift] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
+        }
+    };
+
+    match mnstr.transfer_to(session.user_id.clone(), to_user_id).await {
+        Ok(transfer) => Ok(transfer),
+        Err(e) => {
+            println!("[gift] Failed to gift mnstr: {:?}", e);
+            Err(FieldError::from(e.to_string()))
+        }
+    }
+}
+
+pub async fn release(ctx: &Ctx, id: String) -> Result<MnstrRelease, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+    let mut user = match get_user_from_token::<Session>(session.session_token.clone()).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[release] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+
+    let mut mnstr = match Mnstr::find_one(id, false).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[release] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from("Mnstr not found"));
+        }
+    };
+    match mnstr.release(&mut user).await {
+        Ok(coins) => Ok(MnstrRelease {
+            mnstr,
+            coins,
+            balance: user.coins,
+        }),
+        Err(e) => {
+            println!("[release] Failed to release mnstr: {:?}", e);
+            Err(FieldError::from(e.to_string()))
+        }
+    }
+}
+
+pub async fn evolve(ctx: &Ctx, id: String, fodder_id: String) -> Result<Mnstr, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut mnstr = match Mnstr::find_owned(id, &session.user_id).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[evolve] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
+        }
+    };
+    let fodder = match Mnstr::find_owned(fodder_id, &session.user_id).await {
+        Ok(fodder) => fodder,
+        Err(e) => {
+            println!("[evolve] Failed to get fodder mnstr: {:?}", e);
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
+        }
+    };
+
+    match mnstr.evolve(&fodder, session.user_id.clone()).await {
+        Ok(_) => Ok(mnstr),
+        Err(e) => {
+            println!("[evolve] Failed to evolve mnstr: {:?}", e);
+            Err(FieldError::from(e.to_string()))
+        }
+    }
+}
+
+pub async fn add_tag(ctx: &Ctx, id: String, tag: String) -> Result<Mnstr, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut mnstr = match Mnstr::find_owned(id, &session.user_id).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[add_tag] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
+        }
+    };
+    if let Some(error) = mnstr.add_tag(&session.user_id, &tag).await {
+        println!("[add_tag] Failed to tag mnstr: {:?}", error);
+        return Err(FieldError::from(error.to_string()));
+    }
+    Ok(mnstr)
+}
+
+pub async fn remove_tag(ctx: &Ctx, id: String, tag: String) -> Result<Mnstr, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut mnstr = match Mnstr::find_owned(id, &session.user_id).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[remove_tag] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from(MNSTR_NOT_OWNED));
+        }
+    };
+    if let Some(error) = mnstr.remove_tag(&session.user_id, &tag).await {
+        println!("[remove_tag] Failed to untag mnstr: {:?}", error);
+        return Err(FieldError::from(error.to_string()));
+    }
+    Ok(mnstr)
+}
+
+pub async fn purge_archived(ctx: &Ctx, older_than_days: Option<i32>) -> Result<i32, FieldError> {
+    if !ctx.is_admin {
+        return Err(FieldError::from("Not authorized"));
+    }
+    let older_than_days = older_than_days.map(i64::from).unwrap_or(MNSTR_PURGE_AFTER_DAYS);
+    if older_than_days < 0 {
+        return Err(FieldError::from("olderThanDays must not be negative"));
+    }
+    let cutoff = OffsetDateTime::now_utc() - time::Duration::days(older_than_days);
+
+    match Mnstr::purge_archived(cutoff).await {
+        Ok(purged) => Ok(purged as i32),
+        Err(e) => {
+            println!("[purge_archived] Failed to purge mnstrs: {:?}", e);
+            Err(FieldError::from("Failed to purge mnstrs"))
+        }
+    }
+}
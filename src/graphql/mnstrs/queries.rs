@@ -1,6 +1,18 @@
 use juniper::FieldError;
+use time::OffsetDateTime;
 
-use crate::{graphql::Ctx, models::mnstr::{Mnstr, MnstrOrderBy, MnstrOrderDirection}};
+use crate::{
+    graphql::Ctx,
+    models::{
+        mnstr::{
+            Mnstr, MnstrCollection, MnstrDetails, MnstrFilter, MnstrOrderBy, MnstrOrderDirection,
+            MnstrPage, MnstrPreview, etag_matches,
+        },
+        mnstr_edit::MnstrEdit,
+        ownership_event::OwnershipEvent,
+    },
+    utils::cursor::{Cursor, page_size},
+};
 
 pub type MnstrOrderByInput = MnstrOrderBy;
 pub type MnstrOrderDirectionInput = MnstrOrderDirection;
@@ -13,12 +25,127 @@ impl MnstrQueryType {
         ctx: &Ctx,
         order_by: Option<MnstrOrderByInput>,
         order_direction: Option<MnstrOrderDirectionInput>,
+        seed: Option<bool>,
+        since: Option<OffsetDateTime>,
+        until: Option<OffsetDateTime>,
+        rarity: Option<String>,
+        min_level: Option<i32>,
+        max_level: Option<i32>,
+        tag: Option<String>,
     ) -> Result<Vec<Mnstr>, FieldError> {
-        list(ctx, order_by, order_direction).await
+        list(
+            ctx,
+            order_by,
+            order_direction,
+            seed,
+            since,
+            until,
+            rarity,
+            min_level,
+            max_level,
+            tag,
+        )
+        .await
     }
 
-    async fn qr_code(ctx: &Ctx, mnstr_qr_code: String) -> Result<Option<Mnstr>, FieldError> {
-        by_qr_code(ctx, mnstr_qr_code).await
+    /// The list along with its ETag. Passing the last ETag seen as
+    /// `if_none_match` skips the mnstrs when nothing has changed.
+    async fn collection(
+        ctx: &Ctx,
+        order_by: Option<MnstrOrderByInput>,
+        order_direction: Option<MnstrOrderDirectionInput>,
+        seed: Option<bool>,
+        since: Option<OffsetDateTime>,
+        until: Option<OffsetDateTime>,
+        rarity: Option<String>,
+        min_level: Option<i32>,
+        max_level: Option<i32>,
+        tag: Option<String>,
+        if_none_match: Option<String>,
+    ) -> Result<MnstrCollection, FieldError> {
+        let filter = MnstrFilter {
+            is_seed: seed,
+            created_since: since,
+            created_until: until,
+            rarity,
+            min_level,
+            max_level,
+            tag,
+        };
+        collection(ctx, order_by, order_direction, filter, if_none_match).await
+    }
+
+    /// A page of the session user's mnstrs, oldest first. Pass the returned
+    /// `next_cursor` as `after` to fetch the following page.
+    async fn page(
+        ctx: &Ctx,
+        after: Option<String>,
+        limit: Option<i32>,
+        seed: Option<bool>,
+        since: Option<OffsetDateTime>,
+        until: Option<OffsetDateTime>,
+        rarity: Option<String>,
+        min_level: Option<i32>,
+        max_level: Option<i32>,
+        tag: Option<String>,
+    ) -> Result<MnstrPage, FieldError> {
+        let filter = MnstrFilter {
+            is_seed: seed,
+            created_since: since,
+            created_until: until,
+            rarity,
+            min_level,
+            max_level,
+            tag,
+        };
+        page(ctx, after, limit, filter).await
+    }
+
+    /// The session user's mnstr with this QR code. With `include_others`,
+    /// another user's mnstr is returned without its name or description.
+    async fn qr_code(
+        ctx: &Ctx,
+        mnstr_qr_code: String,
+        include_others: Option<bool>,
+    ) -> Result<Option<Mnstr>, FieldError> {
+        by_qr_code(ctx, mnstr_qr_code, include_others).await
+    }
+
+    async fn preview(ctx: &Ctx, mnstr_qr_code: String) -> Result<MnstrPreview, FieldError> {
+        preview(ctx, mnstr_qr_code).await
+    }
+
+    async fn search(
+        ctx: &Ctx,
+        query: String,
+        limit: Option<i32>,
+        offset: Option<i32>,
+    ) -> Result<Vec<Mnstr>, FieldError> {
+        search(ctx, query, limit, offset).await
+    }
+
+    async fn history(ctx: &Ctx, mnstr_id: String) -> Result<Vec<MnstrEdit>, FieldError> {
+        history(ctx, mnstr_id).await
+    }
+
+    async fn coins(ctx: &Ctx, mnstr_id: String) -> Result<i32, FieldError> {
+        coins(ctx, mnstr_id).await
+    }
+
+    /// The session user's latest catch, or null before their first.
+    async fn recent(ctx: &Ctx) -> Result<Option<Mnstr>, FieldError> {
+        recent(ctx).await
+    }
+
+    /// How the mnstr changed hands, oldest first. Only its current owner may
+    /// see it.
+    async fn ownership(ctx: &Ctx, id: String) -> Result<Vec<OwnershipEvent>, FieldError> {
+        ownership(ctx, id).await
+    }
+
+    /// Any mnstr with its timestamps. Requires the X-Admin-Token header.
+    async fn details(ctx: &Ctx, id: String) -> Result<MnstrDetails, FieldError> {
+        details(ctx, id).await
     }
 }
 
@@ -26,24 +153,47 @@ async fn list(
     ctx: &Ctx,
     order_by: Option<MnstrOrderByInput>,
     order_direction: Option<MnstrOrderDirectionInput>,
+    seed: Option<bool>,
+    since: Option<OffsetDateTime>,
+    until: Option<OffsetDateTime>,
+    rarity: Option<String>,
+    min_level: Option<i32>,
+    max_level: Option<i32>,
+    tag: Option<String>,
+) -> Result<Vec<Mnstr>, FieldError> {
+    let filter = MnstrFilter {
+        is_seed: seed,
+        created_since: since,
+        created_until: until,
+        rarity,
+        min_level,
+        max_level,
+        tag,
+    };
+    list_filtered(ctx, order_by, order_direction, filter).await
+}
+
+async fn list_filtered(
+    ctx: &Ctx,
+    order_by: Option<MnstrOrderByInput>,
+    order_direction: Option<MnstrOrderDirectionInput>,
+    filter: MnstrFilter,
 ) -> Result<Vec<Mnstr>, FieldError> {
     if let None = ctx.session {
         return Err(FieldError::from("Invalid session"));
     }
     let session = ctx.session.as_ref().unwrap().clone();
 
-    let params = vec![("user_id", session.user_id.clone().into())];
+    if let Err(e) = filter.validate() {
+        return Err(FieldError::from(e.to_string()));
+    }
 
-    println!(
-        "[mnstrs] Order by: {:?}",
-        order_by.clone().unwrap().to_string()
-    );
-    println!(
-        "[mnstrs] Order direction: {:?}",
-        order_direction.clone().unwrap().to_string()
-    );
+    println!("[mnstrs] Order by: {:?}", order_by);
+    println!("[mnstrs] Order direction: {:?}", order_direction);
 
-    match Mnstr::find_all_by(params, false, order_by, order_direction).await {
+    match Mnstr::find_all_by_user_id(session.user_id.clone(), filter, order_by, order_direction)
+        .await
+    {
         Ok(mnstrs) => Ok(mnstrs),
         Err(e) => {
             println!("[mnstrs] Failed to get mnstrs: {:?}", e);
@@ -52,18 +202,90 @@ async fn list(
     }
 }
 
-async fn by_qr_code(ctx: &Ctx, mnstr_qr_code: String) -> Result<Option<Mnstr>, FieldError> {
+async fn collection(
+    ctx: &Ctx,
+    order_by: Option<MnstrOrderByInput>,
+    order_direction: Option<MnstrOrderDirectionInput>,
+    filter: MnstrFilter,
+    if_none_match: Option<String>,
+) -> Result<MnstrCollection, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let user_id = ctx.session.as_ref().unwrap().user_id.clone();
+
+    let etag = match Mnstr::collection_etag(user_id, &filter, order_by, order_direction).await {
+        Ok(etag) => etag,
+        Err(e) => {
+            println!("[collection] Failed to get etag: {:?}", e);
+            return Err(FieldError::from("Failed to get mnstrs"));
+        }
+    };
+    if let Some(if_none_match) = if_none_match {
+        if etag_matches(&if_none_match, &etag) {
+            return Ok(MnstrCollection {
+                etag,
+                not_modified: true,
+                mnstrs: vec![],
+            });
+        }
+    }
+
+    let mnstrs = list_filtered(ctx, order_by, order_direction, filter).await?;
+    Ok(MnstrCollection {
+        etag,
+        not_modified: false,
+        mnstrs,
+    })
+}
+
+async fn page(
+    ctx: &Ctx,
+    after: Option<String>,
+    limit: Option<i32>,
+    filter: MnstrFilter,
+) -> Result<MnstrPage, FieldError> {
     if let None = ctx.session {
         return Err(FieldError::from("Invalid session"));
     }
     let session = ctx.session.as_ref().unwrap().clone();
 
-    let params = vec![
-        ("user_id", session.user_id.clone().into()),
-        ("mnstr_qr_code", mnstr_qr_code.clone().into()),
-    ];
+    if let Err(e) = filter.validate() {
+        return Err(FieldError::from(e.to_string()));
+    }
+    let after = match after.as_deref().map(Cursor::decode).transpose() {
+        Ok(after) => after,
+        Err(e) => return Err(FieldError::from(e.to_string())),
+    };
+
+    match Mnstr::find_page_by_user_id(session.user_id.clone(), filter, after, page_size(limit))
+        .await
+    {
+        Ok(page) => Ok(page),
+        Err(e) => {
+            println!("[page] Failed to get mnstrs: {:?}", e);
+            Err(FieldError::from("Failed to get mnstrs"))
+        }
+    }
+}
+
+async fn by_qr_code(
+    ctx: &Ctx,
+    mnstr_qr_code: String,
+    include_others: Option<bool>,
+) -> Result<Option<Mnstr>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
 
-    match Mnstr::find_one_by(params, false).await {
+    match Mnstr::find_one_by_qr_code(
+        session.user_id.clone(),
+        mnstr_qr_code,
+        include_others.unwrap_or(false),
+    )
+    .await
+    {
         Ok(mnstr) => Ok(Some(mnstr)),
         Err(e) => {
             println!("[get_by_qr_code] Failed to get mnstr: {:?}", e);
@@ -71,3 +293,133 @@ async fn by_qr_code(ctx: &Ctx, mnstr_qr_code: String) -> Result<Option<Mnstr>, F
         }
     }
 }
+
+async fn preview(ctx: &Ctx, mnstr_qr_code: String) -> Result<MnstrPreview, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    if mnstr_qr_code.is_empty() {
+        return Err(FieldError::from("QR code is required"));
+    }
+    Ok(Mnstr::preview(mnstr_qr_code))
+}
+
+async fn search(
+    ctx: &Ctx,
+    query: String,
+    limit: Option<i32>,
+    offset: Option<i32>,
+) -> Result<Vec<Mnstr>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match Mnstr::search_by_user_id(
+        session.user_id.clone(),
+        query,
+        limit.map(i64::from),
+        offset.map(i64::from),
+    )
+    .await
+    {
+        Ok(mnstrs) => Ok(mnstrs),
+        Err(e) => {
+            println!("[search] Failed to search mnstrs: {:?}", e);
+            Err(FieldError::from("Failed to search mnstrs"))
+        }
+    }
+}
+
+async fn history(ctx: &Ctx, mnstr_id: String) -> Result<Vec<MnstrEdit>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mnstr = match Mnstr::find_one(mnstr_id, false).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[history] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from("Mnstr not found"));
+        }
+    };
+    if !mnstr.is_owned_by(&session.user_id) {
+        return Err(FieldError::from("Mnstr not found"));
+    }
+
+    match MnstrEdit::find_all_by_mnstr_id(mnstr.id).await {
+        Ok(edits) => Ok(edits),
+        Err(e) => {
+            println!("[history] Failed to get mnstr edits: {:?}", e);
+            Err(FieldError::from("Failed to get mnstr history"))
+        }
+    }
+}
+
+async fn coins(ctx: &Ctx, mnstr_id: String) -> Result<i32, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mnstr = match Mnstr::find_one(mnstr_id, false).await {
+        Ok(mnstr) => mnstr,
+        Err(e) => {
+            println!("[coins] Failed to get mnstr: {:?}", e);
+            return Err(FieldError::from("Mnstr not found"));
+        }
+    };
+    if !mnstr.is_owned_by(&session.user_id) {
+        return Err(FieldError::from("Mnstr not found"));
+    }
+    Ok(mnstr.coins())
+}
+
+async fn recent(ctx: &Ctx) -> Result<Option<Mnstr>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match Mnstr::find_most_recent_by_user_id(session.user_id.clone()).await {
+        Ok(mnstr) => Ok(mnstr),
+        Err(e) => {
+            println!("[recent] Failed to get mnstr: {:?}", e);
+            Err(FieldError::from("Failed to get mnstr"))
+        }
+    }
+}
+
+async fn details(ctx: &Ctx, id: String) -> Result<MnstrDetails, FieldError> {
+    if !ctx.is_admin {
+        return Err(FieldError::from("Not authorized"));
+    }
+    match Mnstr::find_one(id, false).await {
+        Ok(mnstr) => Ok(MnstrDetails::from_mnstr(mnstr)),
+        Err(e) => {
+            println!("[details] Failed to get mnstr: {:?}", e);
+            Err(FieldError::from("Mnstr not found"))
+        }
+    }
+}
+
+async fn ownership(ctx: &Ctx, id: String) -> Result<Vec<OwnershipEvent>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match Mnstr::find_one(id.clone(), false).await {
+        Ok(mnstr) if mnstr.is_owned_by(&session.user_id) => (),
+        _ => return Err(FieldError::from("Mnstr not found")),
+    }
+
+    match OwnershipEvent::find_all_by_mnstr_id(id).await {
+        Ok(events) => Ok(events),
+        Err(e) => {
+            println!("[ownership] Failed to get ownership events: {:?}", e);
+            Err(FieldError::from("Failed to get ownership history"))
+        }
+    }
+}
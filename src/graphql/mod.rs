@@ -1,20 +1,35 @@
 use futures::stream;
 use juniper::{Context, FieldError, RootNode, graphql_object, graphql_subscription};
-use juniper_rocket::{GraphQLRequest, GraphQLResponse};
-use rocket::{Route, get, post, response::content::RawHtml};
+use juniper_rocket::GraphQLResponse;
+use rocket::{Route, get, http::Status, post, response::content::RawHtml};
 
 use crate::{
+    config::config,
     graphql::{
         mnstrs::{mutations::MnstrMutationType, queries::MnstrQueryType},
         sessions::{SessionMutationType, SessionQueryType},
+        trades::mutations::TradeMutationType,
         users::{mutations::UserMutationType, queries::UserQueryType},
     },
-    models::session::Session,
-    utils::{sessions::validate_session, token::RawToken},
+    models::{
+        api_token::{ApiToken, is_api_token},
+        idempotency_key::{IDEMPOTENCY_KEY_MISMATCH, IdempotencyKey, IdempotencyReservation},
+        session::Session,
+    },
+    utils::{
+        admin::{RawAdminToken, is_admin_token},
+        body::GraphQLBody,
+        client::RequestClient,
+        deadline::{request_timeout, with_deadline},
+        idempotency::RawIdempotencyKey,
+        sessions::validate_session,
+        token::RawToken,
+    },
 };
 
 pub mod mnstrs;
 pub mod sessions;
+pub mod trades;
 pub mod users;
 
 pub fn routes() -> Vec<Route> {
@@ -23,6 +38,8 @@ pub fn routes() -> Vec<Route> {
 
 pub struct Ctx {
     pub session: Option<Session>,
+    pub client: RequestClient,
+    pub is_admin: bool,
 }
 
 impl Context for Ctx {}
@@ -59,6 +76,10 @@ impl Mutation {
     pub async fn mnstrs() -> MnstrMutationType {
         MnstrMutationType
     }
+
+    pub async fn trades() -> TradeMutationType {
+        TradeMutationType
+    }
 }
 
 pub struct Subscription;
@@ -78,8 +99,18 @@ pub fn graphiql() -> RawHtml<String> {
 }
 
 #[post("/", data = "<request>")]
-pub async fn graphql(request: GraphQLRequest, token: RawToken) -> GraphQLResponse {
-    let mut ctx = Ctx { session: None };
+pub async fn graphql(
+    request: GraphQLBody,
+    token: RawToken,
+    idempotency_key: RawIdempotencyKey,
+    client: RequestClient,
+    admin_token: RawAdminToken,
+) -> GraphQLResponse {
+    let mut ctx = Ctx {
+        session: None,
+        client,
+        is_admin: is_admin_token(admin_token.value.as_deref(), &config().admin_token),
+    };
     if !token.value.is_empty() {
         let session = match verify_session_token(token).await {
             Ok(session) => session,
@@ -92,12 +123,96 @@ pub async fn graphql(request: GraphQLRequest, token: RawToken) -> GraphQLRespons
         };
         ctx.session = Some(session);
     }
+
+    // Retried requests carrying an Idempotency-Key replay the stored response
+    // instead of collecting or spending twice. Queries write nothing, so
+    // they never reserve a key.
+    let mut reserved_key = None;
+    let idempotency_key = idempotency_key.value.filter(|_| !request.is_read_only());
+    if let (Some(key), Some(session)) = (idempotency_key, ctx.session.as_ref()) {
+        match IdempotencyKey::reserve(session.user_id.clone(), key, request.fingerprint()).await {
+            Ok(IdempotencyReservation::Reserved(reserved)) => reserved_key = Some(reserved),
+            Ok(IdempotencyReservation::Completed(completed)) => {
+                let status = completed
+                    .response_status
+                    .and_then(|status| Status::from_code(status as u16))
+                    .unwrap_or(Status::Ok);
+                return GraphQLResponse(status, completed.response_body.unwrap_or_default());
+            }
+            Ok(IdempotencyReservation::InProgress) => {
+                return GraphQLResponse::error(FieldError::new(
+                    "A request with this idempotency key is in progress",
+                    juniper::Value::Null,
+                ));
+            }
+            Ok(IdempotencyReservation::Mismatch) => {
+                return GraphQLResponse::error(FieldError::new(
+                    IDEMPOTENCY_KEY_MISMATCH,
+                    juniper::Value::Null,
+                ));
+            }
+            Err(_) => {
+                return GraphQLResponse::error(FieldError::new(
+                    "Failed to check idempotency key",
+                    juniper::Value::Null,
+                ));
+            }
+        }
+    }
+
     let schema = Schema::new(Query, Mutation, Subscription);
 
-    request.execute(&schema, &ctx).await
+    // Only queries are cut off at the deadline. Dropping a mutation midway
+    // could leave the writes it made outside a transaction half applied.
+    let response = if request.is_read_only() {
+        match with_deadline(request_timeout(), execute(request, &schema, &ctx)).await {
+            Ok(response) => response,
+            Err(e) => {
+                if let Some(reserved) = reserved_key {
+                    reserved.release().await;
+                }
+                return GraphQLResponse::error(FieldError::new(
+                    e.to_string(),
+                    juniper::Value::Null,
+                ));
+            }
+        }
+    } else {
+        execute(request, &schema, &ctx).await
+    };
+
+    if let Some(mut reserved) = reserved_key {
+        reserved
+            .complete(response.0.code as i32, response.1.clone())
+            .await;
+    }
+    response
+}
+
+/// Runs `request` against `schema`, answering 400 when any operation fails
+/// the same way juniper_rocket does.
+async fn execute(request: GraphQLBody, schema: &Schema, ctx: &Ctx) -> GraphQLResponse {
+    let response = request.0.execute(schema, ctx).await;
+    let status = if response.is_ok() {
+        Status::Ok
+    } else {
+        Status::BadRequest
+    };
+    match serde_json::to_string(&response) {
+        Ok(body) => GraphQLResponse(status, body),
+        Err(e) => GraphQLResponse::error(FieldError::new(e.to_string(), juniper::Value::Null)),
+    }
 }
 
+/// The session for `token`. API tokens get a stand-in session so resolvers
+/// treat both kinds of token alike.
 async fn verify_session_token(token: RawToken) -> Result<Session, FieldError> {
+    if is_api_token(&token.value) {
+        return match ApiToken::find_one_by_token(token.value.clone()).await {
+            Ok(api_token) => Ok(Session::from_api_token(&api_token, token.value)),
+            Err(e) => Err(e.into()),
+        };
+    }
     let mut session = match Session::find_one_by_token(token.value).await {
         Ok(session) => session,
         Err(e) => return Err(e.into()),
@@ -107,3 +222,226 @@ async fn verify_session_token(token: RawToken) -> Result<Session, FieldError> {
     }
     Ok(session)
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        database::test_support::{create_test_user, test_pool, test_wallet},
+        models::user::REGISTRATION_CONFLICT,
+        utils::idempotency::IDEMPOTENCY_KEY_HEADER,
+    };
+    use juniper::graphql_value;
+    use rocket::{
+        http::{ContentType, Header},
+        local::asynchronous::Client,
+    };
+
+    fn ctx(is_admin: bool) -> Ctx {
+        Ctx {
+            session: None,
+            client: RequestClient::default(),
+            is_admin,
+        }
+    }
+
+    async fn execute(query: &str, ctx: &Ctx) -> serde_json::Value {
+        let schema = Schema::new(Query, Mutation, Subscription);
+        let (value, errors) =
+            juniper::execute(query, None, &schema, &juniper::Variables::new(), ctx)
+                .await
+                .unwrap();
+        assert!(errors.is_empty());
+        serde_json::to_value(&value).unwrap()
+    }
+
+    fn field_names(json: &serde_json::Value) -> Vec<String> {
+        json["fields"]
+            .as_array()
+            .unwrap()
+            .iter()
+            .map(|field| field["name"].as_str().unwrap().to_string())
+            .collect()
+    }
+
+    #[tokio::test]
+    async fn test_mnstr_timestamps_only_in_details() {
+        let json = execute(
+            r#"{
+                mnstr: __type(name: "Mnstr") { fields { name } }
+                details: __type(name: "MnstrDetails") { fields { name } }
+            }"#,
+            &ctx(false),
+        )
+        .await;
+
+        let mnstr = field_names(&json["mnstr"]);
+        assert!(mnstr.contains(&"id".to_string()));
+        assert!(!mnstr.contains(&"createdAt".to_string()));
+
+        let details = field_names(&json["details"]);
+        assert!(details.contains(&"createdAt".to_string()));
+        assert!(details.contains(&"updatedAt".to_string()));
+    }
+
+    #[tokio::test]
+    async fn test_user_and_session_details_include_timestamps() {
+        let json = execute(
+            r#"{
+                user: __type(name: "UserDetails") { fields { name } }
+                session: __type(name: "SessionDetails") { fields { name } }
+            }"#,
+            &ctx(false),
+        )
+        .await;
+
+        for details in [field_names(&json["user"]), field_names(&json["session"])] {
+            assert!(details.contains(&"createdAt".to_string()));
+            assert!(details.contains(&"updatedAt".to_string()));
+            assert!(details.contains(&"archivedAt".to_string()));
+        }
+        assert!(!field_names(&json["session"]).contains(&"sessionToken".to_string()));
+    }
+
+    #[tokio::test]
+    async fn test_details_require_admin() {
+        let schema = Schema::new(Query, Mutation, Subscription);
+        for query in [
+            r#"{ mnstrs { details(id: "mnstr") { createdAt } } }"#,
+            r#"{ users { details(id: "user") { createdAt } } }"#,
+            r#"{ session { details(id: "session") { createdAt } } }"#,
+        ] {
+            let (_, errors) = juniper::execute(
+                query,
+                None,
+                &schema,
+                &juniper::Variables::new(),
+                &ctx(false),
+            )
+            .await
+            .unwrap();
+            assert_eq!(errors.len(), 1);
+            assert_eq!(errors[0].error().message(), "Not authorized");
+        }
+    }
+
+    async fn post_with_key(
+        client: &Client,
+        token: &str,
+        key: &str,
+        query: &str,
+    ) -> (Status, String) {
+        let response = client
+            .post("/graphql")
+            .header(ContentType::JSON)
+            .header(Header::new("Authorization", format!("Bearer {}", token)))
+            .header(Header::new(IDEMPOTENCY_KEY_HEADER, key.to_string()))
+            .body(serde_json::json!({ "query": query }).to_string())
+            .dispatch()
+            .await;
+        (
+            response.status(),
+            response.into_string().await.unwrap_or_default(),
+        )
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_repeated_idempotency_key_spends_once() {
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        assert!(wallet.add_coins(100).await.is_none());
+        let mut session = Session::new(user.id.clone());
+        assert!(session.create().await.is_none());
+        let client = Client::untracked(rocket::build().mount("/graphql", routes()))
+            .await
+            .unwrap();
+        let token = session.session_token.as_str();
+
+        let spend = r#"mutation { users { spendCoins(amount: 10, reason: "test") } }"#;
+        let first = post_with_key(&client, token, "spend-1", spend).await;
+        let second = post_with_key(&client, token, "spend-1", spend).await;
+        assert_eq!(first.0, Status::Ok);
+        assert_eq!(first, second);
+        assert_eq!(test_wallet(&user).await.coins, 90);
+
+        let other = r#"mutation { users { spendCoins(amount: 20, reason: "test") } }"#;
+        let (_, body) = post_with_key(&client, token, "spend-1", other).await;
+        assert!(body.contains(IDEMPOTENCY_KEY_MISMATCH));
+        assert_eq!(test_wallet(&user).await.coins, 90);
+
+        let query = "{ __typename }";
+        let (status, _) = post_with_key(&client, token, "read-1", query).await;
+        assert_eq!(status, Status::Ok);
+        let (status, _) = post_with_key(&client, token, "read-1", other).await;
+        assert_eq!(status, Status::Ok);
+        assert_eq!(test_wallet(&user).await.coins, 70);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_registering_a_taken_email_is_a_conflict() {
+        test_pool().await;
+        let schema = Schema::new(Query, Mutation, Subscription);
+        let email = format!("{}@test.mnstr.app", uuid::Uuid::new_v4());
+        let register = |display_name: &str| {
+            format!(
+                r#"mutation {{ users {{ register(email: "{}", password: "correct-horse-battery", displayName: "{}") {{ id }} }} }}"#,
+                email, display_name
+            )
+        };
+
+        let first = register(&format!("first-{}", uuid::Uuid::new_v4()));
+        let (_, errors) = juniper::execute(
+            &first,
+            None,
+            &schema,
+            &juniper::Variables::new(),
+            &ctx(false),
+        )
+        .await
+        .unwrap();
+        assert!(errors.is_empty());
+
+        let second = register(&format!("second-{}", uuid::Uuid::new_v4()));
+        let (_, errors) = juniper::execute(
+            &second,
+            None,
+            &schema,
+            &juniper::Variables::new(),
+            &ctx(false),
+        )
+        .await
+        .unwrap();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(errors[0].error().message(), REGISTRATION_CONFLICT);
+        assert_eq!(
+            errors[0].error().extensions(),
+            &graphql_value!({ "code": "CONFLICT" })
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_failed_logout_is_an_error() {
+        let user = create_test_user().await;
+        // A session that was never stored cannot be revoked.
+        let ctx = Ctx {
+            session: Some(Session::new(user.id)),
+            client: RequestClient::default(),
+            is_admin: false,
+        };
+        let schema = Schema::new(Query, Mutation, Subscription);
+        let (_, errors) = juniper::execute(
+            "mutation { session { logout } }",
+            None,
+            &schema,
+            &juniper::Variables::new(),
+            &ctx,
+        )
+        .await
+        .unwrap();
+        assert_eq!(errors.len(), 1);
+        assert_eq!(errors[0].error().message(), "Failed to revoke session");
+    }
+}
@@ -2,42 +2,64 @@ use juniper::FieldError;
 use uuid::Uuid;
 
 use crate::{
-    delete_resource_where_fields, find_one_unarchived_resource_where_fields,
+    delete_resource_where_fields,
     graphql::Ctx,
     insert_resource,
-    models::{session::Session, user::User},
-    utils::{passwords::hash_password, sessions::validate_session},
+    models::{
+        api_token::{ApiToken, NewApiToken, is_api_token},
+        session::{Session, SessionDetails, SessionSummary},
+        user::{INVALID_CREDENTIALS, User},
+    },
+    utils::{client::RequestClient, sessions::validate_session},
 };
 
 pub struct SessionMutationType;
 
 #[juniper::graphql_object]
 impl SessionMutationType {
-    async fn login(email: String, password: String) -> Result<Session, FieldError> {
-        create_session(email, password).await
+    /// Signs in. Sessions last a week between uses, or 30 days with
+    /// `remember_me`.
+    async fn login(
+        ctx: &Ctx,
+        email: String,
+        password: String,
+        remember_me: Option<bool>,
+    ) -> Result<Session, FieldError> {
+        create_session(email, password, remember_me.unwrap_or(false), &ctx.client).await
     }
 
     async fn logout(ctx: &Ctx) -> Result<bool, FieldError> {
         delete_session(ctx).await
     }
-}
 
-pub async fn create_session(email: String, password: String) -> Result<Session, FieldError> {
-    let password_hash = hash_password(&password);
-    let params = vec![
-        ("email", email.into()),
-        ("password_hash", password_hash.into()),
-    ];
+    /// Signs out one of the user's other devices.
+    async fn revoke(ctx: &Ctx, id: String) -> Result<bool, FieldError> {
+        revoke_session(ctx, id).await
+    }
 
-    let user = match find_one_unarchived_resource_where_fields!(User, params).await {
-        Ok(user) => user,
-        Err(e) => {
-            println!("Invalid email or password: {:?}", e);
-            return Err(FieldError::from("Invalid email or password"));
-        }
+    /// Creates a personal API token. The token is only ever returned here.
+    async fn create_api_token(ctx: &Ctx, label: String) -> Result<NewApiToken, FieldError> {
+        create_api_token(ctx, label).await
+    }
+
+    async fn revoke_api_token(ctx: &Ctx, id: String) -> Result<bool, FieldError> {
+        revoke_api_token(ctx, id).await
+    }
+}
+
+pub async fn create_session(
+    email: String,
+    password: String,
+    remember_me: bool,
+    client: &RequestClient,
+) -> Result<Session, FieldError> {
+    let user = match User::authenticate(email, &password).await {
+        Some(user) => user,
+        None => return Err(FieldError::from(INVALID_CREDENTIALS)),
     };
 
-    let mut session = Session::new(user.id.clone());
+    let mut session = Session::new_with_client(user.id.clone(), client);
+    session.remember_me = remember_me;
     if let Some(error) = session.create().await {
         println!("Failed to create session: {:?}", error);
         return Err(FieldError::from("Failed to create session"));
@@ -52,9 +74,60 @@ pub async fn delete_session(ctx: &Ctx) -> Result<bool, FieldError> {
     }
     let mut session = ctx.session.as_ref().unwrap().clone();
 
+    // Signing out with an API token revokes the token.
+    if is_api_token(&session.session_token) {
+        return revoke_api_token(ctx, session.id.clone()).await;
+    }
+
     if let Some(error) = session.delete().await {
-        println!("Failed to delete session: {:?}", error);
-        return Err(FieldError::from("Failed to delete session"));
+        println!("Failed to revoke session: {:?}", error);
+        return Err(FieldError::from("Failed to revoke session"));
+    }
+
+    Ok(true)
+}
+
+pub async fn revoke_session(ctx: &Ctx, id: String) -> Result<bool, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    if let Some(error) = Session::revoke_for_user(id, session.user_id.clone()).await {
+        println!("Failed to revoke session: {:?}", error);
+        return Err(FieldError::from("Failed to revoke session"));
+    }
+
+    Ok(true)
+}
+
+pub async fn create_api_token(ctx: &Ctx, label: String) -> Result<NewApiToken, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+    if is_api_token(&session.session_token) {
+        return Err(FieldError::from("API tokens cannot create API tokens"));
+    }
+
+    match ApiToken::create(session.user_id.clone(), label).await {
+        Ok(api_token) => Ok(api_token),
+        Err(e) => {
+            println!("Failed to create api token: {:?}", e);
+            Err(FieldError::from(e.to_string()))
+        }
+    }
+}
+
+pub async fn revoke_api_token(ctx: &Ctx, id: String) -> Result<bool, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    if let Some(error) = ApiToken::revoke_for_user(id, session.user_id.clone()).await {
+        println!("Failed to revoke api token: {:?}", error);
+        return Err(FieldError::from("Failed to revoke api token"));
     }
 
     Ok(true)
@@ -67,6 +140,21 @@ impl SessionQueryType {
     async fn verify(ctx: &Ctx) -> Result<Session, FieldError> {
         verify_session(ctx).await
     }
+
+    /// The user's signed in devices.
+    async fn list(ctx: &Ctx) -> Result<Vec<SessionSummary>, FieldError> {
+        list_sessions(ctx).await
+    }
+
+    /// The user's API tokens that have not been revoked.
+    async fn api_tokens(ctx: &Ctx) -> Result<Vec<ApiToken>, FieldError> {
+        list_api_tokens(ctx).await
+    }
+
+    /// Any session with its timestamps. Requires the X-Admin-Token header.
+    async fn details(ctx: &Ctx, id: String) -> Result<SessionDetails, FieldError> {
+        get_session_details(ctx, id).await
+    }
 }
 
 pub async fn verify_session(ctx: &Ctx) -> Result<Session, FieldError> {
@@ -76,3 +164,49 @@ pub async fn verify_session(ctx: &Ctx) -> Result<Session, FieldError> {
     let session = ctx.session.as_ref().unwrap().clone();
     Ok(session)
 }
+
+pub async fn list_sessions(ctx: &Ctx) -> Result<Vec<SessionSummary>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match Session::find_active_by_user_id(session.user_id.clone()).await {
+        Ok(sessions) => Ok(sessions
+            .iter()
+            .map(|s| SessionSummary::from_session(s, &session.id))
+            .collect()),
+        Err(e) => {
+            println!("Failed to get sessions: {:?}", e);
+            Err(FieldError::from("Failed to get sessions"))
+        }
+    }
+}
+
+async fn get_session_details(ctx: &Ctx, id: String) -> Result<SessionDetails, FieldError> {
+    if !ctx.is_admin {
+        return Err(FieldError::from("Not authorized"));
+    }
+    match Session::find_one(id).await {
+        Ok(session) => Ok(SessionDetails::from_session(&session)),
+        Err(e) => {
+            println!("[get_session_details] Failed to get session: {:?}", e);
+            Err(FieldError::from("Session not found"))
+        }
+    }
+}
+
+pub async fn list_api_tokens(ctx: &Ctx) -> Result<Vec<ApiToken>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match ApiToken::find_active_by_user_id(session.user_id.clone()).await {
+        Ok(api_tokens) => Ok(api_tokens),
+        Err(e) => {
+            println!("Failed to get api tokens: {:?}", e);
+            Err(FieldError::from("Failed to get api tokens"))
+        }
+    }
+}
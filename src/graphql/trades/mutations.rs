@@ -0,0 +1,67 @@
+use juniper::FieldError;
+
+use crate::{graphql::Ctx, models::trade::Trade};
+
+pub struct TradeMutationType;
+
+#[juniper::graphql_object]
+impl TradeMutationType {
+    async fn create(
+        ctx: &Ctx,
+        offerer_mnstr_id: String,
+        target_user_id: String,
+        requested_mnstr_id: String,
+    ) -> Result<Trade, FieldError> {
+        create(ctx, offerer_mnstr_id, target_user_id, requested_mnstr_id).await
+    }
+
+    async fn accept(ctx: &Ctx, id: String) -> Result<Trade, FieldError> {
+        accept(ctx, id).await
+    }
+}
+
+pub async fn create(
+    ctx: &Ctx,
+    offerer_mnstr_id: String,
+    target_user_id: String,
+    requested_mnstr_id: String,
+) -> Result<Trade, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut trade = Trade::new(
+        session.user_id.clone(),
+        offerer_mnstr_id,
+        target_user_id,
+        requested_mnstr_id,
+    );
+    if let Some(error) = trade.create().await {
+        println!("[create] Failed to create trade: {:?}", error);
+        return Err(FieldError::from(format!("Failed to create trade: {}", error)));
+    }
+
+    Ok(trade)
+}
+
+pub async fn accept(ctx: &Ctx, id: String) -> Result<Trade, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut trade = match Trade::find_one(id).await {
+        Ok(trade) => trade,
+        Err(e) => {
+            println!("[accept] Failed to find trade: {:?}", e);
+            return Err(FieldError::from("Trade not found"));
+        }
+    };
+    if let Some(error) = trade.accept(session.user_id.clone()).await {
+        println!("[accept] Failed to accept trade: {:?}", error);
+        return Err(FieldError::from(format!("Failed to accept trade: {}", error)));
+    }
+
+    Ok(trade)
+}
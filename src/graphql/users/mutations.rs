@@ -1,9 +1,19 @@
-use juniper::FieldError;
+use juniper::{FieldError, graphql_value};
 
 use crate::{
-    graphql::{Ctx, users::utils::send_email_verification_code},
-    models::user::User,
-    utils::passwords::{generate_verification_code, hash_password},
+    graphql::Ctx,
+    models::{
+        daily_reward::DailyReward,
+        share_link::ShareLink,
+        transaction::{CLIENT_REFERENCE_CONFLICT, validate_client_reference},
+        user::{User, unique_violation_message},
+        wallet::{validate_spend, validate_transfer},
+    },
+    utils::{
+        emails::send_email_verification_code,
+        passwords::{generate_verification_code, hash_password},
+        validation::validate_display_name,
+    },
 };
 
 pub struct UserMutationType;
@@ -34,6 +44,40 @@ impl UserMutationType {
     async fn reset_password(id: String, password: String) -> Result<bool, FieldError> {
         reset_password(id, password).await
     }
+
+    async fn claim_daily_reward(ctx: &Ctx) -> Result<DailyReward, FieldError> {
+        claim_daily_reward(ctx).await
+    }
+
+    async fn update_display_name(ctx: &Ctx, display_name: String) -> Result<User, FieldError> {
+        update_display_name(ctx, display_name).await
+    }
+
+    /// Spends coins on `reason` and returns the remaining balance. Retrying
+    /// with the same `client_reference` does not charge again.
+    async fn spend_coins(
+        ctx: &Ctx,
+        amount: i32,
+        reason: String,
+        client_reference: Option<String>,
+    ) -> Result<i32, FieldError> {
+        spend_coins(ctx, amount, reason, client_reference).await
+    }
+
+    /// Sends coins to another user and returns the remaining balance.
+    async fn send_coins(ctx: &Ctx, to_user_id: String, amount: i32) -> Result<i32, FieldError> {
+        send_coins(ctx, to_user_id, amount).await
+    }
+
+    /// A public link to a read-only view of the session user's collection,
+    /// served at /share/<token>.
+    async fn create_share_link(ctx: &Ctx) -> Result<ShareLink, FieldError> {
+        create_share_link(ctx).await
+    }
+
+    async fn revoke_share_link(ctx: &Ctx, id: String) -> Result<bool, FieldError> {
+        revoke_share_link(ctx, id).await
+    }
 }
 
 pub async fn register(
@@ -55,22 +99,23 @@ pub async fn register(
 
     if let Some(error) = user.create().await {
         println!("[register] Failed to register user: {:?}", error);
+        if let Some(message) = unique_violation_message(&error) {
+            return Err(FieldError::new(
+                message,
+                graphql_value!({ "code": "CONFLICT" }),
+            ));
+        }
         return Err(FieldError::from("Failed to register user"));
     }
 
-    if email != None {
-        if let Err(error) = send_email_verification_code(
-            display_name,
-            email.unwrap(),
-            user.email_verification_code.unwrap(),
-        )
-        .await
-        {
+    // The user is already committed, so a failed email does not undo the
+    // registration. A new code can be sent with forgot_password.
+    if let (Some(email), Some(code)) = (&user.email, &user.email_verification_code) {
+        if let Err(error) = send_email_verification_code(&user.display_name, email, code).await {
             println!(
                 "[register] Failed to send email verification code: {:?}",
                 error
             );
-            return Err(FieldError::from("Failed to send email verification code"));
         }
     }
 
@@ -151,9 +196,9 @@ pub async fn unregister(ctx: &Ctx) -> Result<bool, FieldError> {
         }
     };
 
-    if let Some(error) = user.delete_permanent().await {
-        println!("[unregister] Failed to delete user: {:?}", error);
-        return Err(FieldError::from("Failed to delete user"));
+    if let Some(error) = user.archive().await {
+        println!("[unregister] Failed to archive user: {:?}", error);
+        return Err(FieldError::from("Failed to unregister user"));
     }
 
     Ok(true)
@@ -183,3 +228,141 @@ pub async fn reset_password(id: String, password: String) -> Result<bool, FieldE
 
     Ok(true)
 }
+
+pub async fn claim_daily_reward(ctx: &Ctx) -> Result<DailyReward, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match DailyReward::claim(session.user_id.clone()).await {
+        Ok(reward) => Ok(reward),
+        Err(e) => {
+            println!("[claim_daily_reward] Failed to claim daily reward: {:?}", e);
+            Err(FieldError::from(e.to_string()))
+        }
+    }
+}
+
+pub async fn update_display_name(ctx: &Ctx, display_name: String) -> Result<User, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut user = match User::find_one(session.user_id.clone(), false).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[update_display_name] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+    if let Err(e) = validate_display_name(display_name.trim()) {
+        return Err(FieldError::from(e.to_string()));
+    }
+    if let Some(error) = user.update_display_name(display_name).await {
+        println!("[update_display_name] Failed to update display name: {:?}", error);
+        if let Some(message) = unique_violation_message(&error) {
+            return Err(FieldError::new(
+                message,
+                graphql_value!({ "code": "CONFLICT" }),
+            ));
+        }
+        return Err(FieldError::from("Failed to update display name"));
+    }
+    Ok(user)
+}
+
+pub async fn spend_coins(
+    ctx: &Ctx,
+    amount: i32,
+    reason: String,
+    client_reference: Option<String>,
+) -> Result<i32, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut user = match User::find_one(session.user_id.clone(), false).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[spend_coins] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+    if let Err(e) = validate_spend(amount, &reason) {
+        return Err(FieldError::from(e.to_string()));
+    }
+    if let Some(Err(e)) = client_reference.as_deref().map(validate_client_reference) {
+        return Err(FieldError::from(e.to_string()));
+    }
+    if let Some(error) = user.spend_coins(amount, reason, client_reference).await {
+        println!("[spend_coins] Failed to spend coins: {:?}", error);
+        if error.to_string() == "Insufficient funds" {
+            return Err(FieldError::from("Insufficient funds"));
+        }
+        if error.to_string() == CLIENT_REFERENCE_CONFLICT {
+            return Err(FieldError::from(CLIENT_REFERENCE_CONFLICT));
+        }
+        return Err(FieldError::from("Failed to spend coins"));
+    }
+    Ok(user.coins)
+}
+
+pub async fn send_coins(ctx: &Ctx, to_user_id: String, amount: i32) -> Result<i32, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    if let Err(e) = validate_transfer(&session.user_id, &to_user_id, amount) {
+        return Err(FieldError::from(e.to_string()));
+    }
+    let mut user = match User::find_one(session.user_id.clone(), false).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[send_coins] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+    if let Some(error) = user.send_coins(to_user_id, amount).await {
+        println!("[send_coins] Failed to send coins: {:?}", error);
+        return match error.to_string().as_str() {
+            message @ ("Insufficient funds" | "Recipient not found") => {
+                Err(FieldError::from(message))
+            }
+            _ => Err(FieldError::from("Failed to send coins")),
+        };
+    }
+    Ok(user.coins)
+}
+
+pub async fn create_share_link(ctx: &Ctx) -> Result<ShareLink, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match ShareLink::create(session.user_id.clone()).await {
+        Ok(share_link) => Ok(share_link),
+        Err(e) => {
+            println!("[create_share_link] Failed to create share link: {:?}", e);
+            Err(FieldError::from("Failed to create share link"))
+        }
+    }
+}
+
+pub async fn revoke_share_link(ctx: &Ctx, id: String) -> Result<bool, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    if let Some(error) = ShareLink::revoke_for_user(id, session.user_id.clone()).await {
+        println!("[revoke_share_link] Failed to revoke share link: {:?}", error);
+        return Err(FieldError::from("Failed to revoke share link"));
+    }
+
+    Ok(true)
+}
@@ -1,9 +1,19 @@
 use juniper::FieldError;
+use time::{OffsetDateTime, format_description::well_known::Rfc3339};
 
 use crate::{
     graphql::{Ctx, users::utils::send_email_verification_code},
-    models::user::User,
-    utils::passwords::{generate_verification_code, hash_password},
+    models::{
+        achievement::Achievement,
+        share_link::ShareLink,
+        transaction::{Transaction, TransactionPage},
+        user::{User, UserDetails},
+        wallet::{TransactionSync, WalletSummary},
+    },
+    utils::{
+        cursor::{Cursor, page_size},
+        passwords::{generate_verification_code, hash_password},
+    },
 };
 
 pub struct UserQueryType;
@@ -17,6 +27,49 @@ impl UserQueryType {
     async fn forgot_password(email: String) -> Result<String, FieldError> {
         forgot_password(email).await
     }
+
+    /// The achievements the session user has unlocked.
+    async fn achievements(ctx: &Ctx) -> Result<Vec<Achievement>, FieldError> {
+        get_achievements(ctx).await
+    }
+
+    /// Lifetime coins earned and spent by the session user.
+    async fn wallet_summary(ctx: &Ctx) -> Result<WalletSummary, FieldError> {
+        get_wallet_summary(ctx).await
+    }
+
+    /// A page of the session user's transactions, newest first. Pass the
+    /// returned `next_cursor` as `after` to fetch the following page.
+    async fn transactions(
+        ctx: &Ctx,
+        after: Option<String>,
+        limit: Option<i32>,
+    ) -> Result<TransactionPage, FieldError> {
+        get_transactions(ctx, after, limit).await
+    }
+
+    /// The session user's transactions written since `since`, an RFC 3339
+    /// timestamp, oldest write first. Replace rows already held by id, follow
+    /// `next_cursor` as `after`, then pass the returned `synced_at` as
+    /// `since` on the next sync.
+    async fn transactions_since(
+        ctx: &Ctx,
+        since: String,
+        after: Option<String>,
+        limit: Option<i32>,
+    ) -> Result<TransactionSync, FieldError> {
+        get_transactions_since(ctx, since, after, limit).await
+    }
+
+    /// The session user's share links that have not been revoked.
+    async fn share_links(ctx: &Ctx) -> Result<Vec<ShareLink>, FieldError> {
+        get_share_links(ctx).await
+    }
+
+    /// Any user with their timestamps. Requires the X-Admin-Token header.
+    async fn details(ctx: &Ctx, id: String) -> Result<UserDetails, FieldError> {
+        get_user_details(ctx, id).await
+    }
 }
 
 async fn get_user(ctx: &Ctx) -> Result<User, FieldError> {
@@ -35,6 +88,140 @@ async fn get_user(ctx: &Ctx) -> Result<User, FieldError> {
     Ok(user)
 }
 
+async fn get_achievements(ctx: &Ctx) -> Result<Vec<Achievement>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match Achievement::find_all_by_user_id(session.user_id.clone()).await {
+        Ok(achievements) => Ok(achievements),
+        Err(e) => {
+            println!("[get_achievements] Failed to get achievements: {:?}", e);
+            Err(FieldError::from("Failed to get achievements"))
+        }
+    }
+}
+
+async fn get_share_links(ctx: &Ctx) -> Result<Vec<ShareLink>, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    match ShareLink::find_active_by_user_id(session.user_id.clone()).await {
+        Ok(share_links) => Ok(share_links),
+        Err(e) => {
+            println!("[get_share_links] Failed to get share links: {:?}", e);
+            Err(FieldError::from("Failed to get share links"))
+        }
+    }
+}
+
+async fn get_wallet_summary(ctx: &Ctx) -> Result<WalletSummary, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let mut user = match User::find_one(session.user_id.clone(), false).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[get_wallet_summary] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+    if let Some(error) = user.get_wallet().await {
+        println!("[get_wallet_summary] Failed to get wallet: {:?}", error);
+        return Err(FieldError::from("Failed to get wallet"));
+    }
+
+    match user.wallet.as_ref().unwrap().summary().await {
+        Ok(summary) => Ok(summary),
+        Err(e) => {
+            println!("[get_wallet_summary] Failed to get wallet summary: {:?}", e);
+            Err(FieldError::from("Failed to get wallet summary"))
+        }
+    }
+}
+
+async fn get_transactions(
+    ctx: &Ctx,
+    after: Option<String>,
+    limit: Option<i32>,
+) -> Result<TransactionPage, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let after = match after.as_deref().map(Cursor::decode).transpose() {
+        Ok(after) => after,
+        Err(e) => return Err(FieldError::from(e.to_string())),
+    };
+    let mut user = match User::find_one(session.user_id.clone(), false).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[get_transactions] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+    if let Some(error) = user.get_wallet().await {
+        println!("[get_transactions] Failed to get wallet: {:?}", error);
+        return Err(FieldError::from("Failed to get wallet"));
+    }
+
+    let wallet_id = user.wallet.as_ref().unwrap().id.clone();
+    match Transaction::find_page_by_wallet_id(wallet_id, after, page_size(limit)).await {
+        Ok(page) => Ok(page),
+        Err(e) => {
+            println!("[get_transactions] Failed to get transactions: {:?}", e);
+            Err(FieldError::from("Failed to get transactions"))
+        }
+    }
+}
+
+async fn get_transactions_since(
+    ctx: &Ctx,
+    since: String,
+    after: Option<String>,
+    limit: Option<i32>,
+) -> Result<TransactionSync, FieldError> {
+    if let None = ctx.session {
+        return Err(FieldError::from("Invalid session"));
+    }
+    let session = ctx.session.as_ref().unwrap().clone();
+
+    let since = match OffsetDateTime::parse(&since, &Rfc3339) {
+        Ok(since) => since,
+        Err(_) => return Err(FieldError::from("since must be an RFC 3339 timestamp")),
+    };
+    let after = match after.as_deref().map(Cursor::decode).transpose() {
+        Ok(after) => after,
+        Err(e) => return Err(FieldError::from(e.to_string())),
+    };
+    let mut user = match User::find_one(session.user_id.clone(), false).await {
+        Ok(user) => user,
+        Err(e) => {
+            println!("[get_transactions_since] Failed to get user: {:?}", e);
+            return Err(FieldError::from("Failed to get user"));
+        }
+    };
+    if let Some(error) = user.get_wallet().await {
+        println!("[get_transactions_since] Failed to get wallet: {:?}", error);
+        return Err(FieldError::from("Failed to get wallet"));
+    }
+
+    let wallet = user.wallet.as_ref().unwrap();
+    match wallet.get_transactions_since(since, after, page_size(limit)).await {
+        Ok(sync) => Ok(sync),
+        Err(e) => {
+            println!("[get_transactions_since] Failed to get transactions: {:?}", e);
+            Err(FieldError::from("Failed to get transactions"))
+        }
+    }
+}
+
 pub async fn forgot_password(email: String) -> Result<String, FieldError> {
     let user_params = vec![("email", email.into())];
     let mut user = match User::find_one_by(user_params, false).await {
@@ -68,3 +255,16 @@ pub async fn forgot_password(email: String) -> Result<String, FieldError> {
 
     Ok(user.id)
 }
+
+async fn get_user_details(ctx: &Ctx, id: String) -> Result<UserDetails, FieldError> {
+    if !ctx.is_admin {
+        return Err(FieldError::from("Not authorized"));
+    }
+    match User::find_one(id, false).await {
+        Ok(user) => Ok(UserDetails::from_user(user)),
+        Err(e) => {
+            println!("[get_user_details] Failed to get user: {:?}", e);
+            Err(FieldError::from("User not found"))
+        }
+    }
+}
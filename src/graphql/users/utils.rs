@@ -1,18 +1,19 @@
-use std::env;
-
 use juniper::FieldError;
 use sendgrid::{Mail, SGClient};
 use twilio::{Client, OutboundMessage};
 
+use crate::config::config;
+
 async fn send_phone_verification_code(phone: String, code: String) -> Result<bool, FieldError> {
+    let config = config();
     let client = Client::new(
-        env::var("TWILIO_ACCOUNT_SSID").unwrap().as_str(),
-        env::var("TWILIO_AUTH_TOKEN").unwrap().as_str(),
+        config.twilio_account_ssid.as_str(),
+        config.twilio_auth_token.as_str(),
     );
     let message = format!("Your MNSTR verification code is: {}", code);
     match client
         .send_message(OutboundMessage::new(
-            env::var("TWILIO_PHONE_NUMBER").unwrap().as_str(),
+            config.twilio_phone_number.as_str(),
             phone.as_str(),
             message.as_str(),
         ))
@@ -34,33 +35,12 @@ pub async fn send_email_verification_code(
     email: String,
     code: String,
 ) -> Result<bool, FieldError> {
-    let api_key = match env::var("SENDGRID_API_KEY") {
-        Ok(key) => key,
-        Err(e) => {
-            println!(
-                "[send_email_verification_code] Failed to get API key: {:?}",
-                e
-            );
-            return Err(FieldError::from("Failed to get API key"));
-        }
-    };
-
-    let from_email = match env::var("SENDGRID_FROM_EMAIL") {
-        Ok(email) => email,
-        Err(e) => {
-            println!(
-                "[send_email_verification_code] Failed to get from email: {:?}",
-                e
-            );
-            return Err(FieldError::from("Failed to get from email"));
-        }
-    };
-
-    let client = SGClient::new(api_key.as_str());
+    let config = config();
+    let client = SGClient::new(config.sendgrid_api_key.as_str());
     let message = format!("Your MNSTR verification code is: {}", code);
     let message = Mail::new()
         .add_text(message.as_str())
-        .add_from(from_email.as_str())
+        .add_from(config.sendgrid_from_email.as_str())
         .add_subject("MNSTR Verification Code")
         .add_to((email.as_str(), display_name.as_str()).into());
     match client.send(message).await {
@@ -0,0 +1,213 @@
+use rocket::{
+    Data, Route,
+    data::ToByteUnit,
+    http::{ContentType, Status},
+    post,
+    serde::json::Json,
+};
+use serde::Serialize;
+use uuid::Uuid;
+
+use crate::{
+    config::config,
+    models::{mnstr::Mnstr, session::Session},
+    storage::blob_store,
+    utils::{response::Envelope, sessions::get_user_from_token, token::RawToken},
+};
+
+pub const MAX_IMAGE_BYTES: usize = 2 * 1024 * 1024;
+
+pub fn routes() -> Vec<Route> {
+    routes![upload_mnstr_image]
+}
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum ImageKind {
+    Png,
+    Jpeg,
+    Gif,
+    Webp,
+}
+
+impl ImageKind {
+    pub fn from_content_type(content_type: &ContentType) -> Option<Self> {
+        match (content_type.top().as_str(), content_type.sub().as_str()) {
+            ("image", "png") => Some(ImageKind::Png),
+            ("image", "jpeg") => Some(ImageKind::Jpeg),
+            ("image", "gif") => Some(ImageKind::Gif),
+            ("image", "webp") => Some(ImageKind::Webp),
+            _ => None,
+        }
+    }
+
+    /// The kind of image `bytes` hold, read from their leading magic bytes.
+    pub fn sniff(bytes: &[u8]) -> Option<Self> {
+        if bytes.starts_with(&[0x89, b'P', b'N', b'G', b'\r', b'\n', 0x1a, b'\n']) {
+            return Some(ImageKind::Png);
+        }
+        if bytes.starts_with(&[0xff, 0xd8, 0xff]) {
+            return Some(ImageKind::Jpeg);
+        }
+        if bytes.starts_with(b"GIF87a") || bytes.starts_with(b"GIF89a") {
+            return Some(ImageKind::Gif);
+        }
+        if bytes.len() >= 12 && bytes.starts_with(b"RIFF") && &bytes[8..12] == b"WEBP" {
+            return Some(ImageKind::Webp);
+        }
+        None
+    }
+
+    pub fn extension(&self) -> &'static str {
+        match self {
+            ImageKind::Png => "png",
+            ImageKind::Jpeg => "jpg",
+            ImageKind::Gif => "gif",
+            ImageKind::Webp => "webp",
+        }
+    }
+}
+
+/// Checks that an upload is an image of the kind its Content-Type claims.
+pub fn validate_image(
+    content_type: Option<&ContentType>,
+    bytes: &[u8],
+) -> Result<ImageKind, Status> {
+    let claimed = content_type
+        .and_then(ImageKind::from_content_type)
+        .ok_or(Status::UnsupportedMediaType)?;
+    match ImageKind::sniff(bytes) {
+        Some(kind) if kind == claimed => Ok(kind),
+        _ => Err(Status::UnsupportedMediaType),
+    }
+}
+
+#[derive(Debug, Serialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrImage {
+    pub image_url: String,
+}
+
+/// Stores the request body as the mnstr's picture and returns its URL. The
+/// body must be a PNG, JPEG, GIF or WebP image of at most 2 MiB.
+#[post("/<mnstr_id>/image", data = "<data>")]
+pub async fn upload_mnstr_image(
+    mnstr_id: String,
+    content_type: Option<&ContentType>,
+    data: Data<'_>,
+    token: RawToken,
+) -> Result<Json<Envelope<MnstrImage>>, Status> {
+    let bytes = match data.open(MAX_IMAGE_BYTES.bytes()).into_bytes().await {
+        Ok(bytes) if bytes.is_complete() => bytes.into_inner(),
+        Ok(_) => return Err(Status::PayloadTooLarge),
+        Err(e) => {
+            println!("[upload_mnstr_image] Failed to read upload: {:?}", e);
+            return Err(Status::BadRequest);
+        }
+    };
+    let kind = validate_image(content_type, &bytes)?;
+    if token.value.is_empty() {
+        return Err(Status::Unauthorized);
+    }
+    let user = match get_user_from_token::<Session>(token.value).await {
+        Ok(user) => user,
+        Err(_) => return Err(Status::Unauthorized),
+    };
+
+    let mut mnstr = match Mnstr::find_one(mnstr_id, false).await {
+        Ok(mnstr) if mnstr.is_owned_by(&user.id) => mnstr,
+        _ => return Err(Status::NotFound),
+    };
+
+    let key = format!("{}-{}.{}", mnstr.id, Uuid::new_v4(), kind.extension());
+    let image_url = match blob_store(config()).put(&key, &bytes).await {
+        Ok(image_url) => image_url,
+        Err(e) => {
+            println!("[upload_mnstr_image] Failed to store image: {:?}", e);
+            return Err(Status::InternalServerError);
+        }
+    };
+    if let Some(error) = mnstr.update_image_url(image_url.clone()).await {
+        println!("[upload_mnstr_image] Failed to update mnstr: {:?}", error);
+        return Err(Status::InternalServerError);
+    }
+    Ok(Envelope::ok(MnstrImage { image_url }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::qr::render_qr_png;
+    use rocket::local::asynchronous::Client;
+
+    #[test]
+    fn test_validate_image() {
+        let png = render_qr_png("mnstr-22", 64).unwrap();
+        assert_eq!(validate_image(Some(&ContentType::PNG), &png), Ok(ImageKind::Png));
+        assert_eq!(
+            validate_image(Some(&ContentType::JPEG), &[0xff, 0xd8, 0xff, 0xe0]),
+            Ok(ImageKind::Jpeg)
+        );
+    }
+
+    #[test]
+    fn test_validate_image_rejects_non_images() {
+        let png = render_qr_png("mnstr-22", 64).unwrap();
+        assert_eq!(
+            validate_image(Some(&ContentType::PNG), b"not an image"),
+            Err(Status::UnsupportedMediaType)
+        );
+        assert_eq!(
+            validate_image(Some(&ContentType::Plain), &png),
+            Err(Status::UnsupportedMediaType)
+        );
+        assert_eq!(validate_image(None, &png), Err(Status::UnsupportedMediaType));
+        assert_eq!(
+            validate_image(Some(&ContentType::GIF), &png),
+            Err(Status::UnsupportedMediaType)
+        );
+    }
+
+    async fn client() -> Client {
+        let rocket = rocket::build().mount("/mnstrs", routes());
+        Client::untracked(rocket).await.unwrap()
+    }
+
+    #[tokio::test]
+    async fn test_upload_rejects_oversized_images() {
+        let client = client().await;
+        let mut body = render_qr_png("mnstr-22", 64).unwrap();
+        body.resize(MAX_IMAGE_BYTES + 1, 0);
+
+        let response = client
+            .post("/mnstrs/mnstr-id/image")
+            .header(ContentType::PNG)
+            .body(body)
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::PayloadTooLarge);
+    }
+
+    #[tokio::test]
+    async fn test_upload_rejects_non_images() {
+        let client = client().await;
+        let response = client
+            .post("/mnstrs/mnstr-id/image")
+            .header(ContentType::PNG)
+            .body("not an image")
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::UnsupportedMediaType);
+    }
+
+    #[tokio::test]
+    async fn test_upload_accepts_images_then_requires_a_session() {
+        let client = client().await;
+        let response = client
+            .post("/mnstrs/mnstr-id/image")
+            .header(ContentType::PNG)
+            .body(render_qr_png("mnstr-22", 64).unwrap())
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Unauthorized);
+    }
+}
@@ -3,7 +3,7 @@ extern crate rocket;
 
 use rocket_cors::CorsOptions;
 use sqlx::postgres::PgPoolOptions;
-use std::{env, net::SocketAddr};
+use std::net::SocketAddr;
 use tonic::transport::Server as GrpcServer;
 use tonic_reflection::server::Builder as GrpcReflectionBuilder;
 
@@ -13,11 +13,27 @@ pub mod proto {
     tonic::include_proto!("mnstrv2");
 }
 
+mod admin;
+mod auth;
+mod bulk_edit;
+mod catchers;
+mod config;
 mod database;
+mod duplicates;
+mod exports;
 mod graphql;
+mod health;
+mod images;
+mod metrics;
 mod models;
+mod qr;
+mod scheduler;
 mod services;
+mod share;
+mod stats;
+mod storage;
 mod utils;
+mod webhooks;
 mod websocket;
 mod battle;
 
@@ -30,14 +46,10 @@ fn index() -> &'static str {
 
 #[tokio::main]
 async fn main() -> anyhow::Result<()> {
-    let _ = env::var("TWILIO_ACCOUNT_SSID")?;
-    let _ = env::var("TWILIO_AUTH_TOKEN")?;
-    let _ = env::var("TWILIO_PHONE_NUMBER")?;
-    let _ = env::var("SENDGRID_API_KEY")?;
-    let _ = env::var("SENDGRID_FROM_EMAIL")?;
-    let grpc_port = env::var("GRPC_PORT")?.parse::<u16>()?;
-    let database_url = env::var("DATABASE_URL")?;
-    let pool = PgPoolOptions::new().connect(&*database_url).await?;
+    let config = config::init()?;
+    let grpc_port = config.grpc_port;
+    let pool = PgPoolOptions::new().connect(&config.database_url).await?;
+    database::migrations::migrate(&pool).await?;
     let cors = CorsOptions::default().to_cors().unwrap();
 
     let session_service =
@@ -51,6 +63,7 @@ async fn main() -> anyhow::Result<()> {
    
     let _ = tokio::spawn(async move {
         GrpcServer::builder()
+            .timeout(utils::deadline::request_timeout())
             .add_service(session_service)
             .add_service(mnstr_service)
             .add_service(users_service)
@@ -59,13 +72,32 @@ async fn main() -> anyhow::Result<()> {
             .await
     });
 
+    models::xp_multiplier::load_xp_multiplier(config);
+    webhooks::load(config);
+    scheduler::spawn();
+
     rocket::build()
         .mount("/", routes![index])
+        .mount("/", health::routes())
+        .mount("/", metrics::routes())
+        .mount("/", stats::routes())
+        .mount("/auth", auth::routes())
         .mount("/graphql", graphql::routes())
+        .mount("/mnstrs", qr::routes())
+        .mount("/mnstrs", exports::routes())
+        .mount("/mnstrs", images::routes())
+        .mount("/mnstrs", stats::mnstr_routes())
+        .mount("/mnstrs", bulk_edit::routes())
+        .mount("/mnstrs", duplicates::routes())
+        .mount("/admin", exports::admin_routes())
+        .mount("/admin", admin::routes())
+        .mount("/share", share::routes())
         .mount("/ws", websocket::routes())
         .mount("/static", rocket::fs::FileServer::from("static"))
+        .register("/", catchers::catchers())
         .manage(pool)
         .attach(cors)
+        .attach(metrics::RequestMetrics)
         .launch()
         .await?;
     Ok(())
@@ -0,0 +1,163 @@
+use std::{sync::LazyLock, time::Instant};
+
+use prometheus::{
+    Encoder, HistogramVec, IntCounterVec, TextEncoder, register_histogram_vec,
+    register_int_counter_vec,
+};
+use rocket::{
+    Data, Request, Response, Route,
+    fairing::{Fairing, Info, Kind},
+    get,
+    http::{ContentType, Status},
+};
+
+static HTTP_REQUESTS_TOTAL: LazyLock<IntCounterVec> = LazyLock::new(|| {
+    register_int_counter_vec!(
+        "http_requests_total",
+        "HTTP requests handled, by route and status.",
+        &["method", "route", "status"]
+    )
+    .expect("Failed to register http_requests_total")
+});
+
+static HTTP_REQUEST_DURATION_SECONDS: LazyLock<HistogramVec> = LazyLock::new(|| {
+    register_histogram_vec!(
+        "http_request_duration_seconds",
+        "Time spent handling HTTP requests, by route.",
+        &["method", "route"]
+    )
+    .expect("Failed to register http_request_duration_seconds")
+});
+
+static DB_QUERY_DURATION_SECONDS: LazyLock<HistogramVec> = LazyLock::new(|| {
+    register_histogram_vec!(
+        "db_query_duration_seconds",
+        "Time spent running database queries, by operation and table.",
+        &["operation", "table", "outcome"]
+    )
+    .expect("Failed to register db_query_duration_seconds")
+});
+
+pub fn routes() -> Vec<Route> {
+    routes![metrics]
+}
+
+/// Prometheus scrape endpoint.
+#[get("/metrics")]
+pub fn metrics() -> (Status, (ContentType, String)) {
+    let mut buffer = Vec::new();
+    if let Err(e) = TextEncoder::new().encode(&prometheus::gather(), &mut buffer) {
+        println!("[metrics] Failed to encode metrics: {:?}", e);
+        return (Status::InternalServerError, (ContentType::Plain, "".to_string()));
+    }
+    (
+        Status::Ok,
+        (
+            ContentType::Plain,
+            String::from_utf8(buffer).unwrap_or_default(),
+        ),
+    )
+}
+
+/// Times `query` against `operation` and `table` in the database histogram.
+pub async fn time_db_query<T, E>(
+    operation: &str,
+    table: &str,
+    query: impl Future<Output = Result<T, E>>,
+) -> Result<T, E> {
+    let start = Instant::now();
+    let result = query.await;
+    let outcome = if result.is_ok() { "ok" } else { "error" };
+    DB_QUERY_DURATION_SECONDS
+        .with_label_values(&[operation, table, outcome])
+        .observe(start.elapsed().as_secs_f64());
+    result
+}
+
+struct RequestStart(Instant);
+
+/// Records a count and duration for every response. Requests are labelled
+/// with the matched route template rather than the raw path so ids do not
+/// create new series.
+pub struct RequestMetrics;
+
+#[rocket::async_trait]
+impl Fairing for RequestMetrics {
+    fn info(&self) -> Info {
+        Info {
+            name: "Request metrics",
+            kind: Kind::Request | Kind::Response,
+        }
+    }
+
+    async fn on_request(&self, request: &mut Request<'_>, _: &mut Data<'_>) {
+        request.local_cache(|| RequestStart(Instant::now()));
+    }
+
+    async fn on_response<'r>(&self, request: &'r Request<'_>, response: &mut Response<'r>) {
+        let start = request.local_cache(|| RequestStart(Instant::now()));
+        let method = request.method().as_str();
+        let route = match request.route() {
+            Some(route) => route.uri.as_str().to_string(),
+            None => "unmatched".to_string(),
+        };
+        let status = response.status().code.to_string();
+
+        HTTP_REQUESTS_TOTAL
+            .with_label_values(&[method, route.as_str(), status.as_str()])
+            .inc();
+        HTTP_REQUEST_DURATION_SECONDS
+            .with_label_values(&[method, route.as_str()])
+            .observe(start.0.elapsed().as_secs_f64());
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rocket::local::asynchronous::Client;
+
+    #[get("/ping")]
+    fn ping() -> &'static str {
+        "pong"
+    }
+
+    fn requests_total(body: &str) -> u64 {
+        body.lines()
+            .find(|line| {
+                line.starts_with("http_requests_total{")
+                    && line.contains("route=\"/ping\"")
+                    && line.contains("status=\"200\"")
+            })
+            .and_then(|line| line.rsplit(' ').next())
+            .and_then(|value| value.parse().ok())
+            .unwrap_or(0)
+    }
+
+    #[tokio::test]
+    async fn test_metrics_counts_handled_requests() {
+        let rocket = rocket::build()
+            .attach(RequestMetrics)
+            .mount("/", routes())
+            .mount("/", routes![ping]);
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let before = client.get("/metrics").dispatch().await;
+        let before = requests_total(&before.into_string().await.unwrap());
+
+        let response = client.get("/ping").dispatch().await;
+        assert_eq!(response.status(), Status::Ok);
+
+        let after = client.get("/metrics").dispatch().await;
+        assert_eq!(after.status(), Status::Ok);
+        let body = after.into_string().await.unwrap();
+        assert_eq!(requests_total(&body), before + 1);
+        assert!(body.contains("http_request_duration_seconds"));
+    }
+
+    #[tokio::test]
+    async fn test_time_db_query_passes_result_through() {
+        let result: Result<i32, ()> = time_db_query("test", "tests", async { Ok(1) }).await;
+        assert_eq!(result, Ok(1));
+    }
+}
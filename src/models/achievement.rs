@@ -0,0 +1,421 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use sqlx::Row;
+use time::OffsetDateTime;
+use uuid::Uuid;
+
+use crate::{
+    database::connection::get_connection,
+    models::{transaction::achievement_transaction_data, wallet::Wallet},
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub enum AchievementRequirement {
+    MnstrsCollected(i64),
+    ExperienceLevel(i32),
+    TradesCompleted(i64),
+}
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct AchievementDefinition {
+    pub key: &'static str,
+    pub title: &'static str,
+    pub description: &'static str,
+    pub coins: i32,
+    pub requirement: AchievementRequirement,
+}
+
+pub const ACHIEVEMENTS: [AchievementDefinition; 7] = [
+    AchievementDefinition {
+        key: "first_mnstr",
+        title: "First Catch",
+        description: "Collect your first mnstr",
+        coins: 10,
+        requirement: AchievementRequirement::MnstrsCollected(1),
+    },
+    AchievementDefinition {
+        key: "collected_10",
+        title: "Collector",
+        description: "Collect 10 mnstrs",
+        coins: 50,
+        requirement: AchievementRequirement::MnstrsCollected(10),
+    },
+    AchievementDefinition {
+        key: "collected_50",
+        title: "Hoarder",
+        description: "Collect 50 mnstrs",
+        coins: 250,
+        requirement: AchievementRequirement::MnstrsCollected(50),
+    },
+    AchievementDefinition {
+        key: "collected_100",
+        title: "Curator",
+        description: "Collect 100 mnstrs",
+        coins: 500,
+        requirement: AchievementRequirement::MnstrsCollected(100),
+    },
+    AchievementDefinition {
+        key: "level_5",
+        title: "Rising Star",
+        description: "Reach level 5",
+        coins: 50,
+        requirement: AchievementRequirement::ExperienceLevel(5),
+    },
+    AchievementDefinition {
+        key: "level_10",
+        title: "Veteran",
+        description: "Reach level 10",
+        coins: 150,
+        requirement: AchievementRequirement::ExperienceLevel(10),
+    },
+    AchievementDefinition {
+        key: "first_trade",
+        title: "Deal Maker",
+        description: "Complete your first trade",
+        coins: 25,
+        requirement: AchievementRequirement::TradesCompleted(1),
+    },
+];
+
+pub fn find_definition(key: &str) -> Option<&'static AchievementDefinition> {
+    ACHIEVEMENTS.iter().find(|definition| definition.key == key)
+}
+
+/// What is known about a user's progress. Only achievements whose
+/// requirement is known are considered.
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct AchievementProgress {
+    pub mnstrs_collected: Option<i64>,
+    pub experience_level: Option<i32>,
+    pub trades_completed: Option<i64>,
+}
+
+impl AchievementProgress {
+    pub fn meets(&self, requirement: AchievementRequirement) -> bool {
+        match requirement {
+            AchievementRequirement::MnstrsCollected(count) => {
+                self.mnstrs_collected.is_some_and(|collected| collected >= count)
+            }
+            AchievementRequirement::ExperienceLevel(level) => {
+                self.experience_level.is_some_and(|reached| reached >= level)
+            }
+            AchievementRequirement::TradesCompleted(count) => {
+                self.trades_completed.is_some_and(|completed| completed >= count)
+            }
+        }
+    }
+}
+
+/// Every achievement `progress` qualifies for, unlocked or not.
+pub fn earned(progress: &AchievementProgress) -> Vec<&'static AchievementDefinition> {
+    ACHIEVEMENTS
+        .iter()
+        .filter(|definition| progress.meets(definition.requirement))
+        .collect()
+}
+
+/// The achievements in `earned` that are not already in `unlocked_keys`.
+pub fn newly_unlocked(
+    earned: Vec<&'static AchievementDefinition>,
+    unlocked_keys: &[String],
+) -> Vec<&'static AchievementDefinition> {
+    earned
+        .into_iter()
+        .filter(|definition| !unlocked_keys.iter().any(|key| key == definition.key))
+        .collect()
+}
+
+/// An achievement a user has unlocked.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct Achievement {
+    pub key: String,
+    pub title: String,
+    pub description: String,
+    pub coins_awarded: i32,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub unlocked_at: Option<OffsetDateTime>,
+}
+
+impl Achievement {
+    fn from_definition(
+        definition: &AchievementDefinition,
+        coins_awarded: i32,
+        unlocked_at: Option<OffsetDateTime>,
+    ) -> Self {
+        Self {
+            key: definition.key.to_string(),
+            title: definition.title.to_string(),
+            description: definition.description.to_string(),
+            coins_awarded,
+            unlocked_at,
+        }
+    }
+
+    pub async fn find_all_by_user_id(user_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        let rows = match sqlx::query(
+            "SELECT * FROM user_achievements WHERE user_id = $1 ORDER BY created_at ASC",
+        )
+        .bind(user_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!(
+                    "[Achievement::find_all_by_user_id] Failed to get achievements: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        Ok(rows
+            .iter()
+            .filter_map(|row| {
+                let key: String = row.get("achievement_key");
+                find_definition(&key).map(|definition| {
+                    Achievement::from_definition(
+                        definition,
+                        row.get("coins_awarded"),
+                        row.get("created_at"),
+                    )
+                })
+            })
+            .collect())
+    }
+
+    /// Unlocks the collection achievements for the user's mnstr count.
+    pub async fn check_collection(user_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        let collected: i64 = match sqlx::query(
+            "SELECT COUNT(*) AS count FROM mnstrs WHERE user_id = $1 AND archived_at IS NULL",
+        )
+        .bind(user_id.clone())
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => row.get("count"),
+            Err(e) => {
+                println!("[Achievement::check_collection] Failed to count mnstrs: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let progress = AchievementProgress {
+            mnstrs_collected: Some(collected),
+            ..Default::default()
+        };
+        Achievement::unlock_earned(user_id, progress).await
+    }
+
+    /// Unlocks the level achievements for `experience_level`.
+    pub async fn check_level(
+        user_id: String,
+        experience_level: i32,
+    ) -> Result<Vec<Self>, anyhow::Error> {
+        let progress = AchievementProgress {
+            experience_level: Some(experience_level),
+            ..Default::default()
+        };
+        Achievement::unlock_earned(user_id, progress).await
+    }
+
+    /// Unlocks the trading achievements for the user's completed trades.
+    pub async fn check_trades(user_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        let completed: i64 = match sqlx::query(
+            "SELECT COUNT(*) AS count FROM trades WHERE trade_status = 'completed' AND (offerer_user_id = $1 OR target_user_id = $1)",
+        )
+        .bind(user_id.clone())
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => row.get("count"),
+            Err(e) => {
+                println!("[Achievement::check_trades] Failed to count trades: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let progress = AchievementProgress {
+            trades_completed: Some(completed),
+            ..Default::default()
+        };
+        Achievement::unlock_earned(user_id, progress).await
+    }
+
+    /// Records every achievement `progress` earns and credits its coin bonus
+    /// in the same transaction. The unique key on `(user_id,
+    /// achievement_key)` means an achievement only ever unlocks, and pays
+    /// out, once. Returns the achievements unlocked by this call.
+    async fn unlock_earned(
+        user_id: String,
+        progress: AchievementProgress,
+    ) -> Result<Vec<Self>, anyhow::Error> {
+        let candidates = earned(&progress);
+        if candidates.is_empty() {
+            return Ok(vec![]);
+        }
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Achievement::unlock_earned] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let unlocked_keys: Vec<String> = match sqlx::query(
+            "SELECT achievement_key FROM user_achievements WHERE user_id = $1",
+        )
+        .bind(user_id.clone())
+        .fetch_all(&mut *tx)
+        .await
+        {
+            Ok(rows) => rows.iter().map(|row| row.get("achievement_key")).collect(),
+            Err(e) => {
+                println!("[Achievement::unlock_earned] Failed to get achievements: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let candidates = newly_unlocked(candidates, &unlocked_keys);
+        if candidates.is_empty() {
+            return Ok(vec![]);
+        }
+
+        let wallet_id: String =
+            match sqlx::query("SELECT id FROM wallets WHERE user_id = $1 AND archived_at IS NULL")
+                .bind(user_id.clone())
+                .fetch_one(&mut *tx)
+                .await
+            {
+                Ok(row) => row.get("id"),
+                Err(e) => {
+                    println!("[Achievement::unlock_earned] Failed to get wallet: {:?}", e);
+                    return Err(e.into());
+                }
+            };
+
+        let mut unlocked = Vec::new();
+        for definition in candidates {
+            let row = match sqlx::query(
+                "INSERT INTO user_achievements (id, user_id, achievement_key, coins_awarded, created_at)
+                VALUES ($1, $2, $3, $4, now())
+                ON CONFLICT (user_id, achievement_key) DO NOTHING
+                RETURNING created_at",
+            )
+            .bind(Uuid::new_v4().to_string())
+            .bind(user_id.clone())
+            .bind(definition.key)
+            .bind(definition.coins)
+            .fetch_optional(&mut *tx)
+            .await
+            {
+                Ok(row) => row,
+                Err(e) => {
+                    println!("[Achievement::unlock_earned] Failed to unlock achievement: {:?}", e);
+                    return Err(e.into());
+                }
+            };
+            // Another request unlocked it first.
+            let Some(row) = row else {
+                continue;
+            };
+
+            Wallet::credit(
+                &mut tx,
+                wallet_id.clone(),
+                definition.coins,
+                Some(achievement_transaction_data(definition.key)),
+            )
+            .await?;
+            unlocked.push(Achievement::from_definition(
+                definition,
+                definition.coins,
+                row.get("created_at"),
+            ));
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Achievement::unlock_earned] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        Ok(unlocked)
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM user_achievements WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[Achievement::delete_permanent_by_user_id] Failed to delete achievements: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn collected(count: i64) -> AchievementProgress {
+        AchievementProgress {
+            mnstrs_collected: Some(count),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_collection_achievement_unlocks_once() {
+        let mut unlocked_keys: Vec<String> = Vec::new();
+        let mut unlocks = Vec::new();
+        // Releasing a few mnstrs and collecting them again crosses 50 twice.
+        let counts = (1..=52).chain(48..=120);
+        for count in counts {
+            for definition in newly_unlocked(earned(&collected(count)), &unlocked_keys) {
+                unlocked_keys.push(definition.key.to_string());
+                unlocks.push((count, definition.key));
+            }
+        }
+
+        assert_eq!(
+            unlocks,
+            vec![
+                (1, "first_mnstr"),
+                (10, "collected_10"),
+                (50, "collected_50"),
+                (100, "collected_100"),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_earned_ignores_unknown_progress() {
+        let progress = AchievementProgress {
+            experience_level: Some(5),
+            ..Default::default()
+        };
+        let keys: Vec<&str> = earned(&progress).iter().map(|d| d.key).collect();
+        assert_eq!(keys, vec!["level_5"]);
+        assert!(earned(&AchievementProgress::default()).is_empty());
+    }
+
+    #[test]
+    fn test_achievement_keys_are_unique() {
+        for definition in ACHIEVEMENTS.iter() {
+            assert_eq!(find_definition(definition.key), Some(definition));
+            assert!(definition.coins > 0);
+        }
+    }
+}
@@ -0,0 +1,326 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use sha2::Digest;
+use sqlx::{Row, postgres::PgRow};
+use time::OffsetDateTime;
+use uuid::Uuid;
+
+use crate::{
+    database::connection::get_connection,
+    models::user::User,
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+/// Every API token starts with this, which is how they are told apart from
+/// session tokens.
+pub const API_TOKEN_PREFIX: &str = "mnstr_pat_";
+pub const MAX_API_TOKEN_LABEL_LENGTH: usize = 64;
+
+/// A long-lived personal access token for scripts and integrations. Only a
+/// hash of the token is stored; the token itself is shown once on creation.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct ApiToken {
+    pub id: String,
+    pub user_id: String,
+    pub label: String,
+
+    #[graphql(skip)]
+    #[serde(skip)]
+    pub token_hash: String,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub last_used_at: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub archived_at: Option<OffsetDateTime>,
+}
+
+/// A freshly created token. `token` is never retrievable again.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct NewApiToken {
+    pub token: String,
+    pub api_token: ApiToken,
+}
+
+pub fn is_api_token(token: &str) -> bool {
+    token.starts_with(API_TOKEN_PREFIX)
+}
+
+/// A new random token carrying the API token prefix.
+pub fn generate_api_token() -> String {
+    format!(
+        "{}{}{}",
+        API_TOKEN_PREFIX,
+        Uuid::new_v4().simple(),
+        Uuid::new_v4().simple()
+    )
+}
+
+/// The hex SHA-256 of `token`, as stored in `api_tokens.token_hash`.
+pub fn hash_api_token(token: &str) -> String {
+    sha2::Sha256::digest(token.as_bytes())
+        .iter()
+        .map(|byte| format!("{:02x}", byte))
+        .collect()
+}
+
+pub fn validate_api_token_label(label: &str) -> Result<String, anyhow::Error> {
+    let label = label.trim();
+    if label.is_empty() {
+        return Err(anyhow::Error::msg("Label is required"));
+    }
+    if label.chars().count() > MAX_API_TOKEN_LABEL_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Label must be at most {} characters",
+            MAX_API_TOKEN_LABEL_LENGTH
+        )));
+    }
+    Ok(label.to_string())
+}
+
+impl ApiToken {
+    /// Creates a token for `user_id`, returning the plain token alongside the
+    /// stored record.
+    pub async fn create(user_id: String, label: String) -> Result<NewApiToken, anyhow::Error> {
+        let label = validate_api_token_label(&label)?;
+        let token = generate_api_token();
+
+        let pool = get_connection().await;
+        match sqlx::query(
+            "INSERT INTO api_tokens (id, user_id, label, token_hash, created_at)
+            VALUES ($1, $2, $3, $4, now())
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user_id)
+        .bind(label)
+        .bind(hash_api_token(&token))
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => Ok(NewApiToken {
+                token,
+                api_token: ApiToken::from_row(&row)?,
+            }),
+            Err(e) => {
+                println!("[ApiToken::create] Failed to create api token: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+
+    /// The unrevoked token matching `token`, marked as used now.
+    pub async fn find_one_by_token(token: String) -> Result<Self, anyhow::Error> {
+        if !is_api_token(&token) {
+            return Err(anyhow::Error::msg("Invalid api token"));
+        }
+        let pool = get_connection().await;
+        let mut api_token = match sqlx::query("SELECT * FROM api_tokens WHERE token_hash = $1")
+            .bind(hash_api_token(&token))
+            .fetch_optional(&pool)
+            .await
+        {
+            Ok(Some(row)) => ApiToken::from_row(&row)?,
+            Ok(None) => return Err(anyhow::Error::msg("Invalid api token")),
+            Err(e) => {
+                println!("[ApiToken::find_one_by_token] Failed to get api token: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        if !api_token.is_active() {
+            return Err(anyhow::Error::msg("Api token has been revoked"));
+        }
+
+        let now = OffsetDateTime::now_utc();
+        if let Err(e) = sqlx::query("UPDATE api_tokens SET last_used_at = $1 WHERE id = $2")
+            .bind(now)
+            .bind(api_token.id.clone())
+            .execute(&pool)
+            .await
+        {
+            println!("[ApiToken::find_one_by_token] Failed to mark api token used: {:?}", e);
+        }
+        api_token.last_used_at = Some(now);
+        Ok(api_token)
+    }
+
+    /// The user `token` belongs to, if it is a live API token.
+    pub async fn authenticate(token: String) -> Result<User, anyhow::Error> {
+        let api_token = ApiToken::find_one_by_token(token).await?;
+        User::find_one(api_token.user_id, false).await
+    }
+
+    /// The user's unrevoked tokens, newest first.
+    pub async fn find_active_by_user_id(user_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM api_tokens WHERE user_id = $1 AND archived_at IS NULL ORDER BY created_at DESC",
+        )
+        .bind(user_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(ApiToken::from_row)
+                .collect::<Result<Vec<ApiToken>, _>>()?),
+            Err(e) => {
+                println!(
+                    "[ApiToken::find_active_by_user_id] Failed to get api tokens: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    /// Revokes one of the user's tokens. It stops authenticating at once.
+    pub async fn revoke_for_user(id: String, user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "UPDATE api_tokens SET archived_at = now() WHERE id = $1 AND user_id = $2 AND archived_at IS NULL",
+        )
+        .bind(id)
+        .bind(user_id)
+        .execute(&pool)
+        .await
+        {
+            Ok(result) if result.rows_affected() == 0 => {
+                Some(anyhow::Error::msg("Api token not found"))
+            }
+            Ok(_) => None,
+            Err(e) => {
+                println!("[ApiToken::revoke_for_user] Failed to revoke api token: {:?}", e);
+                Some(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM api_tokens WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[ApiToken::delete_permanent_by_user_id] Failed to delete api tokens: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+
+    /// Whether the token still authenticates.
+    pub fn is_active(&self) -> bool {
+        self.archived_at.is_none()
+    }
+
+    fn from_row(row: &PgRow) -> Result<Self, sqlx::Error> {
+        Ok(ApiToken {
+            id: row.get("id"),
+            user_id: row.get("user_id"),
+            label: row.get("label"),
+            token_hash: row.get("token_hash"),
+            created_at: row.get("created_at"),
+            last_used_at: row.get("last_used_at"),
+            archived_at: row.get("archived_at"),
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        database::test_support::create_test_user, models::session::Session,
+        utils::sessions::get_user_from_token,
+    };
+
+    fn api_token(token: &str) -> ApiToken {
+        ApiToken {
+            id: "token-id".to_string(),
+            user_id: "user".to_string(),
+            label: "backup script".to_string(),
+            token_hash: hash_api_token(token),
+            created_at: Some(OffsetDateTime::now_utc()),
+            last_used_at: None,
+            archived_at: None,
+        }
+    }
+
+    #[test]
+    fn test_generated_tokens_are_api_tokens() {
+        let token = generate_api_token();
+        assert!(is_api_token(&token));
+        assert_eq!(token.len(), API_TOKEN_PREFIX.len() + 64);
+        assert_ne!(token, generate_api_token());
+        assert!(!is_api_token(&Uuid::new_v4().to_string()));
+    }
+
+    #[test]
+    fn test_stores_only_the_token_hash() {
+        let token = generate_api_token();
+        let stored = api_token(&token);
+
+        assert_eq!(hash_api_token(&token), stored.token_hash);
+        assert_ne!(stored.token_hash, token);
+        assert_eq!(stored.token_hash.len(), 64);
+        assert_ne!(hash_api_token(&generate_api_token()), stored.token_hash);
+        assert!(serde_json::to_value(&stored).unwrap().get("tokenHash").is_none());
+    }
+
+    #[test]
+    fn test_validate_api_token_label() {
+        assert_eq!(validate_api_token_label("  ci  ").unwrap(), "ci");
+        assert!(validate_api_token_label("   ").is_err());
+        assert!(validate_api_token_label(&"x".repeat(MAX_API_TOKEN_LABEL_LENGTH + 1)).is_err());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_revoked_token_stops_authenticating() {
+        let user = create_test_user().await;
+        let revoked = ApiToken::create(user.id.clone(), "backup script".to_string())
+            .await
+            .unwrap();
+        let kept = ApiToken::create(user.id.clone(), "ci".to_string())
+            .await
+            .unwrap();
+        let authenticated = get_user_from_token::<Session>(revoked.token.clone())
+            .await
+            .unwrap();
+        assert_eq!(authenticated.id, user.id);
+
+        let stranger = create_test_user().await;
+        let error = ApiToken::revoke_for_user(revoked.api_token.id.clone(), stranger.id).await;
+        assert!(error.is_some());
+        assert!(ApiToken::authenticate(revoked.token.clone()).await.is_ok());
+
+        let error = ApiToken::revoke_for_user(revoked.api_token.id.clone(), user.id.clone()).await;
+        assert!(error.is_none());
+        assert!(get_user_from_token::<Session>(revoked.token).await.is_err());
+        assert_eq!(
+            ApiToken::authenticate(kept.token).await.unwrap().id,
+            user.id
+        );
+        let active = ApiToken::find_active_by_user_id(user.id).await.unwrap();
+        assert_eq!(active.len(), 1);
+        assert_eq!(active[0].id, kept.api_token.id);
+    }
+}
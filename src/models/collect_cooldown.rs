@@ -0,0 +1,75 @@
+use sqlx::{PgConnection, Row};
+use time::Duration;
+use uuid::Uuid;
+
+use crate::database::connection::get_connection;
+
+/// How long after being rewarded for a QR code a user must wait before it
+/// rewards them again.
+pub const DEFAULT_COLLECT_COOLDOWN: Duration = Duration::hours(24);
+
+/// When a user was last rewarded for collecting each QR code, so releasing
+/// or gifting a mnstr and scanning it again cannot farm coins.
+pub struct CollectCooldown;
+
+impl CollectCooldown {
+    /// Starts the cooldown for each of `mnstr_qr_codes` that is not already
+    /// cooling down, as part of the caller's transaction, and returns those
+    /// codes. Only they are rewarded. The row for a code stays locked until
+    /// the transaction ends, so a concurrent collect of it waits and then
+    /// finds it cooling down. `mnstr_qr_codes` must not repeat a code.
+    pub async fn claim(
+        conn: &mut PgConnection,
+        user_id: String,
+        mnstr_qr_codes: Vec<String>,
+        cooldown: Duration,
+    ) -> Result<Vec<String>, anyhow::Error> {
+        if mnstr_qr_codes.is_empty() {
+            return Ok(Vec::new());
+        }
+        let ids = mnstr_qr_codes
+            .iter()
+            .map(|_| Uuid::new_v4().to_string())
+            .collect::<Vec<String>>();
+        match sqlx::query(
+            "INSERT INTO collect_cooldowns (id, user_id, mnstr_qr_code, collected_at)
+            SELECT id, $2, mnstr_qr_code, now()
+            FROM UNNEST($1::varchar[], $3::text[]) AS claims(id, mnstr_qr_code)
+            ON CONFLICT (user_id, mnstr_qr_code) DO UPDATE SET collected_at = now()
+            WHERE collect_cooldowns.collected_at <= now() - $4 * interval '1 second'
+            RETURNING mnstr_qr_code",
+        )
+        .bind(ids)
+        .bind(user_id)
+        .bind(mnstr_qr_codes)
+        .bind(cooldown.as_seconds_f64())
+        .fetch_all(&mut *conn)
+        .await
+        {
+            Ok(rows) => Ok(rows.iter().map(|row| row.get("mnstr_qr_code")).collect()),
+            Err(e) => {
+                println!(
+                    "[CollectCooldown::claim] Failed to start cooldowns: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM collect_cooldowns WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[CollectCooldown::delete_permanent_by_user_id] Failed to delete cooldowns: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
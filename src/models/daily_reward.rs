@@ -0,0 +1,135 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use time::{Duration, OffsetDateTime};
+
+use crate::{database::connection::get_connection, models::user::User};
+
+/// Coins for a one day streak; each consecutive day adds another share.
+pub const DAILY_REWARD_BASE_COINS: i32 = 10;
+/// Streaks keep counting past this, but the reward stops growing.
+pub const DAILY_REWARD_MAX_MULTIPLIER: i32 = 7;
+
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct DailyReward {
+    pub coins: i32,
+    pub streak: i32,
+}
+
+/// The streak after claiming at `now`. Claims are counted per UTC day: a claim
+/// the day after the last one extends the streak, a missed day starts over,
+/// and a second claim on the same day is rejected.
+pub fn next_streak(
+    last_claimed_at: Option<OffsetDateTime>,
+    streak: i32,
+    now: OffsetDateTime,
+) -> Result<i32, anyhow::Error> {
+    let today = now.to_offset(time::UtcOffset::UTC).date();
+    let last_claimed_on = match last_claimed_at {
+        Some(last_claimed_at) => last_claimed_at.to_offset(time::UtcOffset::UTC).date(),
+        None => return Ok(1),
+    };
+    if last_claimed_on >= today {
+        return Err(anyhow::Error::msg("Daily reward already claimed today"));
+    }
+    if last_claimed_on == today - Duration::days(1) {
+        return Ok(streak.max(0) + 1);
+    }
+    Ok(1)
+}
+
+pub fn reward_coins(streak: i32) -> i32 {
+    DAILY_REWARD_BASE_COINS * streak.clamp(1, DAILY_REWARD_MAX_MULTIPLIER)
+}
+
+impl DailyReward {
+    /// Records today's claim for `user_id` and credits the reward. The claim
+    /// only lands if the user's last claim is unchanged, so concurrent claims
+    /// cannot both pay out.
+    pub async fn claim(user_id: String) -> Result<Self, anyhow::Error> {
+        let mut user = User::find_one(user_id.clone(), false).await?;
+
+        let now = OffsetDateTime::now_utc();
+        let streak = next_streak(user.last_daily_reward_at, user.daily_reward_streak, now)?;
+        let reward = DailyReward {
+            coins: reward_coins(streak),
+            streak,
+        };
+
+        let pool = get_connection().await;
+        let claimed = match sqlx::query(
+            "UPDATE users SET last_daily_reward_at = $1, daily_reward_streak = $2, updated_at = now()
+            WHERE id = $3 AND last_daily_reward_at IS NOT DISTINCT FROM $4
+            RETURNING id",
+        )
+        .bind(now)
+        .bind(streak)
+        .bind(user_id)
+        .bind(user.last_daily_reward_at)
+        .fetch_optional(&pool)
+        .await
+        {
+            Ok(row) => row.is_some(),
+            Err(e) => {
+                println!("[DailyReward::claim] Failed to record claim: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        if !claimed {
+            return Err(anyhow::Error::msg("Daily reward already claimed today"));
+        }
+
+        if let Some(error) = user.add_coins(reward.coins).await {
+            println!("[DailyReward::claim] Failed to add coins: {:?}", error);
+            return Err(error);
+        }
+        Ok(reward)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use time::{Date, Month};
+
+    fn at(day: u8, hour: u8, minute: u8) -> OffsetDateTime {
+        Date::from_calendar_date(2025, Month::October, day)
+            .unwrap()
+            .with_hms(hour, minute, 0)
+            .unwrap()
+            .assume_utc()
+    }
+
+    #[test]
+    fn test_first_claim() {
+        let now = at(15, 12, 0);
+        assert_eq!(next_streak(None, 0, now).unwrap(), 1);
+        assert_eq!(reward_coins(1), DAILY_REWARD_BASE_COINS);
+    }
+
+    #[test]
+    fn test_same_day_claim_is_rejected() {
+        let last_claimed_at = Some(at(15, 0, 5));
+        let now = at(15, 23, 55);
+        assert!(next_streak(last_claimed_at, 3, now).is_err());
+    }
+
+    #[test]
+    fn test_consecutive_day_bumps_streak() {
+        let last_claimed_at = Some(at(14, 23, 55));
+        let now = at(15, 0, 5);
+        assert_eq!(next_streak(last_claimed_at, 3, now).unwrap(), 4);
+        assert_eq!(reward_coins(4), DAILY_REWARD_BASE_COINS * 4);
+        assert_eq!(
+            reward_coins(30),
+            DAILY_REWARD_BASE_COINS * DAILY_REWARD_MAX_MULTIPLIER
+        );
+    }
+
+    #[test]
+    fn test_missed_day_resets_streak() {
+        let last_claimed_at = Some(at(13, 12, 0));
+        let now = at(15, 12, 0);
+        assert_eq!(next_streak(last_claimed_at, 5, now).unwrap(), 1);
+    }
+}
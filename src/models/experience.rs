@@ -0,0 +1,247 @@
+use time::OffsetDateTime;
+
+/// `level` clamped to the levels in `xp_for_level`. Only a corrupted row can
+/// hold a level outside the table, so clamping one is logged.
+pub fn clamp_level(xp_for_level: &[i32], level: i32) -> i32 {
+    let last_level_index = xp_for_level.len() as i32 - 1;
+    let clamped = level.clamp(0, last_level_index);
+    if clamped != level {
+        println!(
+            "[experience::clamp_level] Level {} is outside the XP table, using {}",
+            level, clamped
+        );
+    }
+    clamped
+}
+
+/// The XP needed to leave `level` in `xp_for_level`. At the last level this
+/// is the last table entry, matching what clients already display.
+pub fn xp_to_next_level(xp_for_level: &[i32], level: i32) -> i32 {
+    let last_level_index = xp_for_level.len() as i32 - 1;
+    let level = clamp_level(xp_for_level, level);
+    if level < last_level_index {
+        return xp_for_level[level as usize + 1];
+    }
+    xp_for_level[last_level_index as usize]
+}
+
+/// Adds `xp` to `points` at `level` and returns the new `(level, points)`.
+/// Each level up spends `xp_for_level[level + 1]` and anything left over
+/// carries into the next level. Progress stops at the last level.
+pub fn apply_xp(xp_for_level: &[i32], level: i32, points: i32, xp: i32) -> (i32, i32) {
+    let last_level_index = xp_for_level.len() as i32 - 1;
+    let mut level = clamp_level(xp_for_level, level);
+    let mut points = points.saturating_add(xp).max(0);
+    while level < last_level_index {
+        let needed = xp_for_level[level as usize + 1];
+        if points < needed {
+            break;
+        }
+        points -= needed;
+        level += 1;
+    }
+    if level == last_level_index {
+        points = 0;
+    }
+    (level, points)
+}
+
+/// `apply_xp` for several awards at once. Overage always carries, so the
+/// result is the same as applying each award in turn. Negative awards are
+/// ignored.
+pub fn apply_xp_batch(xp_for_level: &[i32], level: i32, points: i32, awards: &[i32]) -> (i32, i32) {
+    let xp = awards
+        .iter()
+        .fold(0i32, |total, xp| total.saturating_add((*xp).max(0)));
+    apply_xp(xp_for_level, level, points, xp)
+}
+
+/// The valid `(level, points)` for a stored pair that is out of range, or
+/// `None` if it is fine. The level is clamped to the table and any points
+/// past what the level needs are carried forward as if just awarded.
+pub fn repair_level(xp_for_level: &[i32], level: i32, points: i32) -> Option<(i32, i32)> {
+    let repaired = apply_xp(xp_for_level, level, points, 0);
+    if repaired == (level, points) {
+        return None;
+    }
+    Some(repaired)
+}
+
+/// Days a player can be away before their XP starts to decay.
+pub const INACTIVITY_GRACE_DAYS: i64 = 14;
+/// Share of a level's points lost for each day inactive past the grace period.
+pub const XP_DECAY_PERCENT_PER_DAY: i64 = 1;
+
+/// Where decay for a player last active at `last_active_at` picks up: at the
+/// end of their grace period, or where the last decay left off if later.
+pub fn decay_start(
+    last_active_at: OffsetDateTime,
+    last_decayed_at: Option<OffsetDateTime>,
+) -> OffsetDateTime {
+    let grace_ends_at = last_active_at + time::Duration::days(INACTIVITY_GRACE_DAYS);
+    match last_decayed_at {
+        Some(last_decayed_at) => last_decayed_at.max(grace_ends_at),
+        None => grace_ends_at,
+    }
+}
+
+/// What is left of `points` after `decay_days` days of decay. Decay only eats
+/// into progress within the current level, so the level itself is never lost.
+pub fn decay_xp(points: i32, decay_days: i64) -> i32 {
+    let decay_days = decay_days.max(0);
+    let kept_percent = (100 - decay_days.saturating_mul(XP_DECAY_PERCENT_PER_DAY)).max(0);
+    (points.max(0) as i64 * kept_percent / 100) as i32
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::generated::level_xp::XP_FOR_LEVEL;
+
+    fn total_xp(level: i32, points: i32) -> i32 {
+        XP_FOR_LEVEL[1..=level as usize].iter().sum::<i32>() + points
+    }
+
+    #[test]
+    fn test_apply_xp_carries_overage() {
+        assert_eq!(apply_xp(&XP_FOR_LEVEL, 0, 0, 50), (0, 50));
+        assert_eq!(apply_xp(&XP_FOR_LEVEL, 0, 50, 50), (1, 0));
+        assert_eq!(apply_xp(&XP_FOR_LEVEL, 0, 90, 20), (1, 10));
+        assert_eq!(
+            apply_xp(&XP_FOR_LEVEL, 0, 0, XP_FOR_LEVEL[1] + XP_FOR_LEVEL[2] + 7),
+            (2, 7)
+        );
+    }
+
+    #[test]
+    fn test_apply_xp_stops_at_last_level() {
+        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+        assert_eq!(
+            apply_xp(&XP_FOR_LEVEL, last_level_index - 1, 0, i32::MAX),
+            (last_level_index, 0)
+        );
+        assert_eq!(
+            apply_xp(&XP_FOR_LEVEL, last_level_index, 0, 500),
+            (last_level_index, 0)
+        );
+        assert_eq!(
+            xp_to_next_level(&XP_FOR_LEVEL, last_level_index),
+            XP_FOR_LEVEL[last_level_index as usize]
+        );
+    }
+
+    #[test]
+    fn test_apply_xp_loses_nothing_across_awards() {
+        let awards = [37, 150, 5, 999, 1, 420, 3000, 64];
+        let (mut level, mut points) = (0, 0);
+        for xp in awards {
+            (level, points) = apply_xp(&XP_FOR_LEVEL, level, points, xp);
+        }
+        assert_eq!(total_xp(level, points), awards.iter().sum::<i32>());
+        assert_eq!(
+            (level, points),
+            apply_xp(&XP_FOR_LEVEL, 0, 0, awards.iter().sum())
+        );
+    }
+
+    #[test]
+    fn test_apply_xp_batch_matches_one_by_one() {
+        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+        let batches: [&[i32]; 5] = [
+            &[],
+            &[40, 40, 40],
+            &[XP_FOR_LEVEL[1], XP_FOR_LEVEL[2], XP_FOR_LEVEL[3] - 1, 2],
+            &[37, 150, 5, 999, 1, 420, 3000, 64, 12_000, 7],
+            &[i32::MAX, i32::MAX],
+        ];
+        for (level, points) in [(0, 0), (0, 90), (3, 17), (last_level_index - 1, 0)] {
+            for awards in batches {
+                let one_by_one = awards.iter().fold((level, points), |(level, points), xp| {
+                    apply_xp(&XP_FOR_LEVEL, level, points, *xp)
+                });
+                assert_eq!(
+                    apply_xp_batch(&XP_FOR_LEVEL, level, points, awards),
+                    one_by_one,
+                    "awards {:?} from level {} with {} points",
+                    awards,
+                    level,
+                    points
+                );
+            }
+        }
+    }
+
+    #[test]
+    fn test_apply_xp_batch_ignores_negative_awards() {
+        assert_eq!(apply_xp_batch(&XP_FOR_LEVEL, 0, 20, &[-50, 30]), (0, 50));
+    }
+
+    #[test]
+    fn test_out_of_range_level_is_clamped() {
+        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+        assert_eq!(clamp_level(&XP_FOR_LEVEL, 5), 5);
+        assert_eq!(clamp_level(&XP_FOR_LEVEL, last_level_index + 10), last_level_index);
+        assert_eq!(clamp_level(&XP_FOR_LEVEL, -3), 0);
+
+        assert_eq!(
+            xp_to_next_level(&XP_FOR_LEVEL, i32::MAX),
+            XP_FOR_LEVEL[last_level_index as usize]
+        );
+        assert_eq!(xp_to_next_level(&XP_FOR_LEVEL, -1), XP_FOR_LEVEL[1]);
+        assert_eq!(
+            apply_xp(&XP_FOR_LEVEL, last_level_index + 1, 40, 10),
+            (last_level_index, 0)
+        );
+    }
+
+    #[test]
+    fn test_repair_level() {
+        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+        assert_eq!(repair_level(&XP_FOR_LEVEL, 1, 10), None);
+        assert_eq!(repair_level(&XP_FOR_LEVEL, last_level_index, 0), None);
+        assert_eq!(
+            repair_level(&XP_FOR_LEVEL, last_level_index + 5, 70),
+            Some((last_level_index, 0))
+        );
+        assert_eq!(repair_level(&XP_FOR_LEVEL, -2, 10), Some((0, 10)));
+        assert_eq!(
+            repair_level(&XP_FOR_LEVEL, 0, XP_FOR_LEVEL[1] + 3),
+            Some((1, 3))
+        );
+    }
+
+    #[test]
+    fn test_decay_xp_within_bounds() {
+        assert_eq!(decay_xp(200, 0), 200);
+        assert_eq!(decay_xp(200, -3), 200);
+        assert_eq!(decay_xp(200, 10), 180);
+
+        let mut previous = 200;
+        for days in 0..120 {
+            let points = decay_xp(200, days);
+            assert!((0..=previous).contains(&points));
+            previous = points;
+        }
+    }
+
+    #[test]
+    fn test_decay_xp_never_drops_below_level_floor() {
+        assert_eq!(decay_xp(200, 100), 0);
+        assert_eq!(decay_xp(200, i64::MAX), 0);
+        assert_eq!(decay_xp(0, 30), 0);
+        assert_eq!(decay_xp(-5, 30), 0);
+    }
+
+    #[test]
+    fn test_decay_start() {
+        let last_active_at = OffsetDateTime::now_utc();
+        let grace_ends_at = last_active_at + time::Duration::days(INACTIVITY_GRACE_DAYS);
+        assert_eq!(decay_start(last_active_at, None), grace_ends_at);
+
+        let decayed_at = grace_ends_at + time::Duration::days(3);
+        assert_eq!(decay_start(last_active_at, Some(decayed_at)), decayed_at);
+        // Activity after the last decay restarts the grace period.
+        let earlier = last_active_at - time::Duration::days(30);
+        assert_eq!(decay_start(last_active_at, Some(earlier)), grace_ends_at);
+    }
+}
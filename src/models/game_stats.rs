@@ -0,0 +1,113 @@
+use std::{
+    sync::{LazyLock, Mutex},
+    time::{Duration, Instant},
+};
+
+use serde::{Deserialize, Serialize};
+use sqlx::Row;
+
+use crate::database::connection::get_connection;
+
+/// How long totals are served from memory before they are recomputed.
+pub const GAME_STATS_TTL: Duration = Duration::from_secs(60);
+
+/// Game wide totals for operators and the public stats page.
+#[derive(Debug, Serialize, Deserialize, Clone, Copy, Default, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct GameStats {
+    pub users: i64,
+    pub mnstrs_collected: i64,
+    pub coins_in_circulation: i64,
+    pub transactions_processed: i64,
+}
+
+static CACHED_STATS: LazyLock<Mutex<Option<(Instant, GameStats)>>> =
+    LazyLock::new(|| Mutex::new(None));
+
+/// The cached stats if they were computed less than `ttl` before `now`.
+pub fn fresh_stats(
+    cached: Option<(Instant, GameStats)>,
+    now: Instant,
+    ttl: Duration,
+) -> Option<GameStats> {
+    match cached {
+        Some((computed_at, stats)) if now.duration_since(computed_at) < ttl => Some(stats),
+        _ => None,
+    }
+}
+
+pub fn cache_game_stats(stats: GameStats, computed_at: Instant) {
+    if let Ok(mut cached) = CACHED_STATS.lock() {
+        *cached = Some((computed_at, stats));
+    }
+}
+
+impl GameStats {
+    /// The current totals, served from memory for up to `GAME_STATS_TTL`.
+    pub async fn current() -> Result<Self, anyhow::Error> {
+        let cached = CACHED_STATS.lock().ok().and_then(|cached| *cached);
+        if let Some(stats) = fresh_stats(cached, Instant::now(), GAME_STATS_TTL) {
+            return Ok(stats);
+        }
+
+        let stats = GameStats::load().await?;
+        cache_game_stats(stats, Instant::now());
+        Ok(stats)
+    }
+
+    /// Computes the totals in a single round trip.
+    pub async fn load() -> Result<Self, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT
+                (SELECT COUNT(*) FROM users WHERE archived_at IS NULL)::int8 AS users,
+                (SELECT COUNT(*) FROM mnstrs WHERE archived_at IS NULL)::int8 AS mnstrs_collected,
+                (SELECT COALESCE(SUM(coin_balance), 0) FROM wallets WHERE archived_at IS NULL)::int8 AS coins_in_circulation,
+                ((SELECT COUNT(*) FROM transactions) + (SELECT COUNT(*) FROM archived_transactions))::int8 AS transactions_processed",
+        )
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => Ok(GameStats {
+                users: row.get("users"),
+                mnstrs_collected: row.get("mnstrs_collected"),
+                coins_in_circulation: row.get("coins_in_circulation"),
+                transactions_processed: row.get("transactions_processed"),
+            }),
+            Err(e) => {
+                println!("[GameStats::load] Failed to get game stats: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_fresh_stats() {
+        let stats = GameStats {
+            users: 3,
+            mnstrs_collected: 12,
+            coins_in_circulation: 4_500,
+            transactions_processed: 40,
+        };
+        let computed_at = Instant::now();
+
+        assert_eq!(
+            fresh_stats(Some((computed_at, stats)), computed_at, GAME_STATS_TTL),
+            Some(stats)
+        );
+        assert_eq!(
+            fresh_stats(
+                Some((computed_at, stats)),
+                computed_at + GAME_STATS_TTL,
+                GAME_STATS_TTL
+            ),
+            None
+        );
+        assert_eq!(fresh_stats(None, computed_at, GAME_STATS_TTL), None);
+    }
+}
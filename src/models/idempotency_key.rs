@@ -0,0 +1,288 @@
+use serde::{Deserialize, Serialize};
+use sqlx::{Error, Row, postgres::PgRow};
+use time::{Duration, OffsetDateTime};
+use uuid::Uuid;
+
+use crate::{
+    database::{connection::get_connection, traits::DatabaseResource},
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+/// How long a processed key is replayed before the request may run again.
+pub const IDEMPOTENCY_KEY_TTL_HOURS: i64 = 24;
+/// How long a reservation holds its key. A request that dies without
+/// completing or releasing its key lets a retry take it over after this.
+pub const IDEMPOTENCY_LEASE_SECS: i64 = 60;
+pub const MAX_IDEMPOTENCY_KEY_LENGTH: usize = 255;
+pub const IDEMPOTENCY_KEY_MISMATCH: &str =
+    "Idempotency key was already used for a different request";
+
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct IdempotencyKey {
+    pub id: String,
+    pub user_id: String,
+    pub idempotency_key: String,
+    /// Hex SHA-256 of the request the key was reserved for.
+    pub request_hash: Option<String>,
+    pub response_status: Option<i32>,
+    pub response_body: Option<String>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub locked_until: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+}
+
+/// The result of claiming a key before running a request.
+#[derive(Debug, Clone)]
+pub enum IdempotencyReservation {
+    /// The key is new (or expired) and the caller must run the request.
+    Reserved(IdempotencyKey),
+    /// The key was already processed; replay the stored response.
+    Completed(IdempotencyKey),
+    /// Another request holding the key has not finished yet.
+    InProgress,
+    /// The key was reserved for a request with a different body.
+    Mismatch,
+}
+
+impl IdempotencyKey {
+    /// Claims `idempotency_key` for `user_id` and the request hashed to
+    /// `request_hash`. An expired key is taken over as if it were new, and so
+    /// is a reservation for the same request whose lease ran out without a
+    /// response.
+    pub async fn reserve(
+        user_id: String,
+        idempotency_key: String,
+        request_hash: String,
+    ) -> Result<IdempotencyReservation, anyhow::Error> {
+        let pool = get_connection().await;
+        let now = OffsetDateTime::now_utc();
+        let cutoff = now - Duration::hours(IDEMPOTENCY_KEY_TTL_HOURS);
+        let locked_until = now + Duration::seconds(IDEMPOTENCY_LEASE_SECS);
+
+        let reserved = match sqlx::query(
+            "INSERT INTO idempotency_keys (
+                id, user_id, idempotency_key, request_hash, locked_until, created_at
+            ) VALUES ($1, $2, $3, $4, $5, now())
+            ON CONFLICT (user_id, idempotency_key) DO UPDATE
+            SET id = EXCLUDED.id, request_hash = EXCLUDED.request_hash,
+                locked_until = EXCLUDED.locked_until, response_status = NULL,
+                response_body = NULL, created_at = now()
+            WHERE idempotency_keys.created_at <= $6
+                OR (idempotency_keys.response_body IS NULL
+                    AND idempotency_keys.locked_until <= $7
+                    AND (idempotency_keys.request_hash IS NULL
+                        OR idempotency_keys.request_hash = EXCLUDED.request_hash))
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user_id.clone())
+        .bind(idempotency_key.clone())
+        .bind(request_hash.clone())
+        .bind(locked_until)
+        .bind(cutoff)
+        .bind(now)
+        .fetch_optional(&pool)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[IdempotencyKey::reserve] Failed to reserve key: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        if let Some(row) = reserved {
+            return Ok(IdempotencyReservation::Reserved(IdempotencyKey::from_row(
+                &row,
+            )?));
+        }
+
+        let row = match sqlx::query(
+            "SELECT * FROM idempotency_keys WHERE user_id = $1 AND idempotency_key = $2",
+        )
+        .bind(user_id)
+        .bind(idempotency_key)
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[IdempotencyKey::reserve] Failed to get key: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        Ok(IdempotencyKey::from_row(&row)?.into_reservation(&request_hash))
+    }
+
+    /// A key that is already held replays its response once one is stored,
+    /// but only to the request it was reserved for. Keys reserved before
+    /// requests were hashed match any request.
+    fn into_reservation(self, request_hash: &str) -> IdempotencyReservation {
+        if self
+            .request_hash
+            .as_deref()
+            .is_some_and(|stored| stored != request_hash)
+        {
+            return IdempotencyReservation::Mismatch;
+        }
+        match self.response_body {
+            Some(_) => IdempotencyReservation::Completed(self),
+            None => IdempotencyReservation::InProgress,
+        }
+    }
+
+    /// Stores the response so later requests with the same key replay it.
+    pub async fn complete(
+        &mut self,
+        response_status: i32,
+        response_body: String,
+    ) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query(
+            "UPDATE idempotency_keys SET response_status = $1, response_body = $2 WHERE id = $3",
+        )
+        .bind(response_status)
+        .bind(response_body.clone())
+        .bind(self.id.clone())
+        .execute(&pool)
+        .await
+        {
+            println!("[IdempotencyKey::complete] Failed to store response: {:?}", e);
+            return Some(e.into());
+        }
+        self.response_status = Some(response_status);
+        self.response_body = Some(response_body);
+        None
+    }
+
+    /// Gives up the key without a response so the request can be retried.
+    pub async fn release(&self) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM idempotency_keys WHERE id = $1")
+            .bind(self.id.clone())
+            .execute(&pool)
+            .await
+        {
+            println!("[IdempotencyKey::release] Failed to release key: {:?}", e);
+            return Some(e.into());
+        }
+        None
+    }
+
+    pub async fn delete_expired() -> Result<u64, anyhow::Error> {
+        let pool = get_connection().await;
+        let cutoff = OffsetDateTime::now_utc() - Duration::hours(IDEMPOTENCY_KEY_TTL_HOURS);
+        match sqlx::query("DELETE FROM idempotency_keys WHERE created_at <= $1")
+            .bind(cutoff)
+            .execute(&pool)
+            .await
+        {
+            Ok(result) => Ok(result.rows_affected()),
+            Err(e) => {
+                println!(
+                    "[IdempotencyKey::delete_expired] Failed to delete keys: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM idempotency_keys WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[IdempotencyKey::delete_permanent_by_user_id] Failed to delete keys: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+impl DatabaseResource for IdempotencyKey {
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        Ok(IdempotencyKey {
+            id: row.get("id"),
+            user_id: row.get("user_id"),
+            idempotency_key: row.get("idempotency_key"),
+            request_hash: row.get("request_hash"),
+            response_status: row.get("response_status"),
+            response_body: row.get("response_body"),
+            locked_until: row.get("locked_until"),
+            created_at: row.get("created_at"),
+        })
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        false
+    }
+    fn is_updatable() -> bool {
+        false
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn key(request_hash: Option<&str>, response_body: Option<String>) -> IdempotencyKey {
+        IdempotencyKey {
+            id: "id".to_string(),
+            user_id: "user".to_string(),
+            idempotency_key: "key".to_string(),
+            request_hash: request_hash.map(str::to_string),
+            response_status: response_body.as_ref().map(|_| 200),
+            response_body,
+            locked_until: None,
+            created_at: Some(OffsetDateTime::now_utc()),
+        }
+    }
+
+    #[test]
+    fn test_into_reservation() {
+        assert!(matches!(
+            key(Some("hash"), None).into_reservation("hash"),
+            IdempotencyReservation::InProgress
+        ));
+        match key(Some("hash"), Some("{}".to_string())).into_reservation("hash") {
+            IdempotencyReservation::Completed(key) => {
+                assert_eq!(key.response_body, Some("{}".to_string()))
+            }
+            other => panic!("unexpected reservation: {:?}", other),
+        }
+        assert!(matches!(
+            key(Some("hash"), Some("{}".to_string())).into_reservation("other"),
+            IdempotencyReservation::Mismatch
+        ));
+        assert!(matches!(
+            key(None, Some("{}".to_string())).into_reservation("other"),
+            IdempotencyReservation::Completed(_)
+        ));
+    }
+}
@@ -0,0 +1,286 @@
+use std::{
+    collections::{BTreeSet, HashMap},
+    sync::{LazyLock, Mutex},
+    time::{Duration, Instant},
+};
+
+/// Consecutive failures an email gets before its logins are slowed, so a
+/// single typo never costs anything.
+pub const FREE_LOGIN_FAILURES: u32 = 1;
+/// The delay after the first failure past the free ones. It doubles with
+/// every further failure.
+pub const LOGIN_DELAY_BASE: Duration = Duration::from_millis(250);
+pub const MAX_LOGIN_DELAY: Duration = Duration::from_secs(8);
+/// How long an email's failures are remembered after its last attempt.
+pub const LOGIN_FAILURE_WINDOW: Duration = Duration::from_secs(15 * 60);
+const LOGIN_THROTTLE_CAPACITY: usize = 10_000;
+
+/// How long a login waits after `failures` consecutive failures for its
+/// email, capped at `MAX_LOGIN_DELAY`.
+pub fn login_delay(failures: u32) -> Duration {
+    if failures <= FREE_LOGIN_FAILURES {
+        return Duration::ZERO;
+    }
+    let doublings = (failures - FREE_LOGIN_FAILURES - 1).min(16);
+    LOGIN_DELAY_BASE
+        .saturating_mul(1 << doublings)
+        .min(MAX_LOGIN_DELAY)
+}
+
+/// An email as counted for throttling: trimmed and lowercased.
+fn throttle_key(email: &str) -> String {
+    email.trim().to_lowercase()
+}
+
+#[derive(Debug, Clone, Copy)]
+struct Attempts {
+    failures: u32,
+    /// When the latest attempt was let through, which is later than it was
+    /// made if it had to wait.
+    last_attempt_at: Instant,
+}
+
+/// Failed logins per email. Every attempt counts as a failure until it
+/// succeeds, and attempts for one email are spaced out one after another, so
+/// guessing in parallel waits as long as guessing in turn. Failures are
+/// forgotten after `LOGIN_FAILURE_WINDOW` without attempts. When full, the
+/// email with the fewest failures is dropped, so guessing at many addresses
+/// cannot push out one that is under attack.
+#[derive(Debug)]
+pub struct LoginThrottle {
+    capacity: usize,
+    attempts: HashMap<String, Attempts>,
+    by_last_attempt: BTreeSet<(Instant, String)>,
+    by_failures: BTreeSet<(u32, Instant, String)>,
+}
+
+impl LoginThrottle {
+    pub fn new(capacity: usize) -> Self {
+        Self {
+            capacity: capacity.max(1),
+            attempts: HashMap::new(),
+            by_last_attempt: BTreeSet::new(),
+            by_failures: BTreeSet::new(),
+        }
+    }
+
+    pub fn failures(&mut self, email: &str, now: Instant) -> u32 {
+        self.forget_expired(now);
+        self.attempts
+            .get(&throttle_key(email))
+            .map(|attempts| attempts.failures)
+            .unwrap_or(0)
+    }
+
+    /// Counts an attempt for `email` as failed and returns how long it
+    /// should wait before it is checked. However many attempts are queued,
+    /// none waits longer than `MAX_LOGIN_DELAY`.
+    pub fn start_attempt(&mut self, email: &str, now: Instant) -> Duration {
+        self.forget_expired(now);
+        let key = throttle_key(email);
+        let previous = match self.remove(&key) {
+            Some(attempts) => attempts,
+            None => {
+                if self.attempts.len() >= self.capacity {
+                    self.evict();
+                }
+                Attempts {
+                    failures: 0,
+                    last_attempt_at: now,
+                }
+            }
+        };
+        let attempt_at = (previous.last_attempt_at.max(now) + login_delay(previous.failures))
+            .min(now + MAX_LOGIN_DELAY);
+        self.insert(
+            key,
+            Attempts {
+                failures: previous.failures.saturating_add(1),
+                last_attempt_at: attempt_at,
+            },
+        );
+        attempt_at - now
+    }
+
+    /// A successful login clears the email's failures.
+    pub fn record_success(&mut self, email: &str) {
+        self.remove(&throttle_key(email));
+    }
+
+    pub fn len(&self) -> usize {
+        self.attempts.len()
+    }
+
+    fn forget_expired(&mut self, now: Instant) {
+        while let Some((last_attempt_at, key)) = self.by_last_attempt.first().cloned() {
+            if now.saturating_duration_since(last_attempt_at) < LOGIN_FAILURE_WINDOW {
+                break;
+            }
+            self.remove(&key);
+        }
+    }
+
+    fn evict(&mut self) {
+        if let Some((_, _, key)) = self.by_failures.first().cloned() {
+            self.remove(&key);
+        }
+    }
+
+    fn insert(&mut self, key: String, attempts: Attempts) {
+        self.by_last_attempt
+            .insert((attempts.last_attempt_at, key.clone()));
+        self.by_failures
+            .insert((attempts.failures, attempts.last_attempt_at, key.clone()));
+        self.attempts.insert(key, attempts);
+    }
+
+    fn remove(&mut self, key: &str) -> Option<Attempts> {
+        let attempts = self.attempts.remove(key)?;
+        self.by_last_attempt
+            .remove(&(attempts.last_attempt_at, key.to_string()));
+        self.by_failures
+            .remove(&(attempts.failures, attempts.last_attempt_at, key.to_string()));
+        Some(attempts)
+    }
+}
+
+static LOGIN_THROTTLE: LazyLock<Mutex<LoginThrottle>> =
+    LazyLock::new(|| Mutex::new(LoginThrottle::new(LOGIN_THROTTLE_CAPACITY)));
+
+/// Counts a login for `email` as failed until [`record_login_success`] says
+/// otherwise, and returns how long it should wait before it is checked.
+pub fn start_login(email: &str) -> Duration {
+    match LOGIN_THROTTLE.lock() {
+        Ok(mut throttle) => throttle.start_attempt(email, Instant::now()),
+        Err(_) => Duration::ZERO,
+    }
+}
+
+pub fn record_login_success(email: &str) {
+    if let Ok(mut throttle) = LOGIN_THROTTLE.lock() {
+        throttle.record_success(email);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_single_failure_is_not_delayed() {
+        let mut throttle = LoginThrottle::new(10);
+        let now = Instant::now();
+        assert_eq!(
+            throttle.start_attempt("player@example.com", now),
+            Duration::ZERO
+        );
+        assert_eq!(
+            throttle.start_attempt("player@example.com", now),
+            Duration::ZERO
+        );
+        assert_eq!(throttle.failures("player@example.com", now), 2);
+    }
+
+    #[test]
+    fn test_delay_grows_with_failures_up_to_the_cap() {
+        let mut throttle = LoginThrottle::new(10);
+        let mut now = Instant::now();
+        let mut previous = Duration::ZERO;
+        for _ in 0..2 {
+            throttle.start_attempt("player@example.com", now);
+        }
+        for _ in 0..20 {
+            let delay = throttle.start_attempt("player@example.com", now);
+            assert!(delay > previous || delay == MAX_LOGIN_DELAY);
+            assert!(delay <= MAX_LOGIN_DELAY);
+            previous = delay;
+            now += delay;
+        }
+        assert_eq!(previous, MAX_LOGIN_DELAY);
+
+        assert_eq!(login_delay(2), LOGIN_DELAY_BASE);
+        assert_eq!(login_delay(3), LOGIN_DELAY_BASE * 2);
+        assert_eq!(login_delay(u32::MAX), MAX_LOGIN_DELAY);
+    }
+
+    #[test]
+    fn test_parallel_attempts_wait_in_turn() {
+        let mut throttle = LoginThrottle::new(10);
+        let now = Instant::now();
+        let delays = (0..4)
+            .map(|_| throttle.start_attempt("player@example.com", now))
+            .collect::<Vec<Duration>>();
+        assert_eq!(
+            delays,
+            vec![
+                Duration::ZERO,
+                Duration::ZERO,
+                LOGIN_DELAY_BASE,
+                LOGIN_DELAY_BASE * 3,
+            ]
+        );
+    }
+
+    #[test]
+    fn test_queued_attempts_never_wait_past_the_cap() {
+        let mut throttle = LoginThrottle::new(10);
+        let now = Instant::now();
+        for _ in 0..1000 {
+            assert!(throttle.start_attempt("player@example.com", now) <= MAX_LOGIN_DELAY);
+        }
+        assert_eq!(
+            throttle.start_attempt("player@example.com", now),
+            MAX_LOGIN_DELAY
+        );
+    }
+
+    #[test]
+    fn test_success_resets_the_delay() {
+        let mut throttle = LoginThrottle::new(10);
+        let now = Instant::now();
+        for _ in 0..5 {
+            throttle.start_attempt("Player@Example.com ", now);
+        }
+        assert!(throttle.start_attempt("player@example.com", now) > Duration::ZERO);
+        assert_eq!(
+            throttle.start_attempt("other@example.com", now),
+            Duration::ZERO
+        );
+
+        throttle.record_success("player@example.com");
+        assert_eq!(throttle.failures("player@example.com", now), 0);
+        assert_eq!(
+            throttle.start_attempt("player@example.com", now),
+            Duration::ZERO
+        );
+    }
+
+    #[test]
+    fn test_failures_are_forgotten_after_the_window() {
+        let mut throttle = LoginThrottle::new(10);
+        let now = Instant::now();
+        for _ in 0..3 {
+            throttle.start_attempt("player@example.com", now);
+        }
+        let last_attempt_at = now + LOGIN_DELAY_BASE;
+        assert_eq!(throttle.failures("player@example.com", last_attempt_at), 3);
+
+        let later = last_attempt_at + LOGIN_FAILURE_WINDOW;
+        assert_eq!(throttle.failures("player@example.com", later), 0);
+        assert_eq!(throttle.len(), 0);
+    }
+
+    #[test]
+    fn test_many_emails_do_not_push_out_one_under_attack() {
+        let mut throttle = LoginThrottle::new(3);
+        let now = Instant::now();
+        for _ in 0..5 {
+            throttle.start_attempt("player@example.com", now);
+        }
+        for guess in 0..100 {
+            throttle.start_attempt(&format!("guess-{}@example.com", guess), now);
+        }
+        assert_eq!(throttle.len(), 3);
+        assert_eq!(throttle.failures("player@example.com", now), 5);
+    }
+}
@@ -1,18 +1,44 @@
+use std::sync::{LazyLock, Mutex};
+
 use juniper::{GraphQLEnum, GraphQLObject};
 use serde::{Deserialize, Serialize};
 use sha2::Digest;
-use sqlx::{Error, Row, postgres::PgRow};
+use sqlx::{Error, PgConnection, Row, postgres::PgRow};
 use time::OffsetDateTime;
+use uuid::Uuid;
 
 use crate::{
-    database::{traits::DatabaseResource, values::DatabaseValue},
-    delete_resource_where_fields, find_all_resources_where_fields,
-    find_all_resources_where_fields_in, find_one_resource_where_fields,
-    insert_resource, insert_resource_batch,
-    models::{generated::mnstr_xp::XP_FOR_LEVEL, user::User},
+    config::config,
+    database::{
+        connection::get_connection, traits::DatabaseResource, transaction::with_tx,
+        values::DatabaseValue,
+    },
+    delete_resource_where_fields, find_all_resources_where_fields, find_one_resource_where_fields,
+    find_one_unarchived_resource_where_fields, insert_resource, insert_resource_batch,
+    models::{
+        achievement::Achievement,
+        collect_cooldown::CollectCooldown,
+        experience::{apply_xp, clamp_level, xp_to_next_level},
+        generated::mnstr_xp::XP_FOR_LEVEL,
+        mnstr_catalog::check_catalog,
+        mnstr_description::description_for_insert,
+        mnstr_edit::MnstrEdit,
+        mnstr_evolution::{MnstrEvolution, validate_evolution},
+        mnstr_tag::{MnstrTag, normalize_tag, tag_key, with_tag, without_tag},
+        mnstr_transfer::{MnstrTransfer, validate_gift},
+        ownership_event::{OwnershipEvent, OwnershipEventType},
+        transaction::{collect_transaction_data, level_up_transaction_data, release_transaction_data}, user::User, wallet::Wallet,
+        xp_multiplier::apply_xp_multiplier,
+    },
     proto::{Mnstr as GrpcMnstr, MnstrOrderBy as GrpcMnstrOrderBy },
-    update_resource, update_resource_batch,
-    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+    update_resource,
+    utils::{
+        cache::LruCache,
+        cursor::{Cursor, next_page},
+        strings::escape_like,
+        time::{deserialize_offset_date_time, serialize_offset_date_time},
+    },
+    webhooks::{self, WebhookEvent},
 };
 
 #[derive(Debug, Clone, Copy, PartialEq, Eq, Hash, GraphQLEnum, Serialize, Deserialize)]
@@ -28,6 +54,7 @@ pub enum MnstrOrderBy {
     Speed,
     Intelligence,
     Magic,
+    Coins,
 }
 
 impl MnstrOrderBy {
@@ -44,6 +71,7 @@ impl MnstrOrderBy {
             MnstrOrderBy::Speed => "max_speed".to_string(),
             MnstrOrderBy::Intelligence => "max_intelligence".to_string(),
             MnstrOrderBy::Magic => "max_magic".to_string(),
+            MnstrOrderBy::Coins => "coin_value".to_string(),
         }
     }
 
@@ -60,6 +88,7 @@ impl MnstrOrderBy {
             "max_speed" => Some(MnstrOrderBy::Speed),
             "max_intelligence" => Some(MnstrOrderBy::Intelligence),
             "max_magic" => Some(MnstrOrderBy::Magic),
+            "coin_value" => Some(MnstrOrderBy::Coins),
             _ => Some(MnstrOrderBy::UpdatedAt),
         }
     }
@@ -94,6 +123,8 @@ impl MnstrOrderBy {
             MnstrOrderBy::Speed => GrpcMnstrOrderBy::Speed.into(),
             MnstrOrderBy::Intelligence => GrpcMnstrOrderBy::Intelligence.into(),
             MnstrOrderBy::Magic => GrpcMnstrOrderBy::Magic.into(),
+            // The gRPC enum has no coin ordering.
+            MnstrOrderBy::Coins => GrpcMnstrOrderBy::UpdatedAt.into(),
         }
     }
 }
@@ -193,10 +224,598 @@ pub struct Mnstr {
     pub current_magic: i32,
     pub max_magic: i32,
 
+    #[serde(default)]
+    pub is_seed: bool,
+
+    /// Bumped by every write to the row, including level ups, xp and
+    /// transfers. Edits send the version they read so a stale edit is
+    /// rejected instead of overwriting a newer one.
+    #[serde(default)]
+    pub version: i32,
+
+    /// common, rare, epic or legendary. Derived from the QR code and stored
+    /// on create so it can be queried.
+    #[serde(default)]
+    pub rarity: String,
+
+    /// Coins collecting the mnstr pays before any rarity multiplier. Derived
+    /// from the QR code and stored on create so collections can be sorted
+    /// by it.
+    #[serde(default)]
+    pub coin_value: i32,
+
+    /// Where the uploaded picture of the mnstr is served from, if it has one.
+    #[serde(default)]
+    pub image_url: Option<String>,
+
+    /// The owner's labels for the mnstr, lowercased and sorted.
+    #[serde(default)]
+    pub tags: Vec<String>,
+
     pub experience_to_next_level: i32,
 }
 
 pub const DEFAULT_STAT_VALUE: i32 = 10;
+/// Archived mnstrs are kept this long before they may be purged for good.
+pub const MNSTR_PURGE_AFTER_DAYS: i64 = 90;
+pub const MNSTR_VERSION_CONFLICT: &str = "Mnstr was changed by another edit";
+pub const MNSTR_NAME_CONFLICT: &str = "Another of your mnstrs already has this name";
+/// Reported for someone else's mnstr exactly as for a missing one, so callers
+/// cannot probe for the ids of other users' mnstrs.
+pub const MNSTR_NOT_OWNED: &str = "Mnstr not found";
+/// Coins to level a mnstr up from level 0; each level costs one more share.
+pub const LEVEL_UP_BASE_COST: i32 = 100;
+/// How much every max stat grows when a mnstr levels up.
+pub const LEVEL_UP_STAT_GAIN: i32 = 2;
+/// Share of a mnstr's collect coins refunded when it is released.
+pub const RELEASE_REFUND_PERCENT: i32 = 25;
+
+/// Multiplier bytes at or above each threshold land in that rarity tier;
+/// they match the coin bonus tiers in `coins_for_qr_code`.
+pub const LEGENDARY_RARITY_THRESHOLD: u8 = 251;
+pub const EPIC_RARITY_THRESHOLD: u8 = 242;
+pub const RARE_RARITY_THRESHOLD: u8 = 216;
+pub const RARITIES: [&str; 4] = ["common", "rare", "epic", "legendary"];
+
+/// How much more each rarity tier earns on collect, applied to both the coins
+/// and the XP it awards. Set with RARITY_MULTIPLIERS.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct RarityMultipliers {
+    pub common: f64,
+    pub rare: f64,
+    pub epic: f64,
+    pub legendary: f64,
+}
+
+pub const DEFAULT_RARITY_MULTIPLIERS: RarityMultipliers = RarityMultipliers {
+    common: 1.0,
+    rare: 1.25,
+    epic: 1.5,
+    legendary: 2.0,
+};
+
+impl Default for RarityMultipliers {
+    fn default() -> Self {
+        DEFAULT_RARITY_MULTIPLIERS
+    }
+}
+
+impl RarityMultipliers {
+    /// The multiplier for `rarity`. Unknown rarities earn as much as common.
+    pub fn factor(&self, rarity: &str) -> f64 {
+        match rarity {
+            "rare" => self.rare,
+            "epic" => self.epic,
+            "legendary" => self.legendary,
+            _ => self.common,
+        }
+    }
+
+    /// Sets the multiplier for `rarity`, returning false for an unknown one.
+    pub fn set(&mut self, rarity: &str, factor: f64) -> bool {
+        match rarity {
+            "common" => self.common = factor,
+            "rare" => self.rare = factor,
+            "epic" => self.epic = factor,
+            "legendary" => self.legendary = factor,
+            _ => return false,
+        }
+        true
+    }
+
+    pub fn apply(&self, rarity: &str, amount: i32) -> i32 {
+        (amount as f64 * self.factor(rarity)).round() as i32
+    }
+}
+
+/// Bump whenever the coin derivation changes so cached values are discarded.
+pub const COINS_FORMULA_VERSION: u32 = 1;
+const COINS_CACHE_CAPACITY: usize = 1024;
+
+static COINS_CACHE: LazyLock<Mutex<LruCache<String, i32>>> =
+    LazyLock::new(|| Mutex::new(LruCache::new(COINS_CACHE_CAPACITY)));
+
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrPreview {
+    pub mnstr_qr_code: String,
+    pub coins: i32,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, GraphQLEnum, Serialize, Deserialize)]
+pub enum MnstrCollectStatus {
+    Created,
+    AlreadyOwned,
+    Failed,
+}
+
+/// The outcome of collecting a single QR code in a batch.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrCollectResult {
+    pub mnstr_qr_code: String,
+    pub status: MnstrCollectStatus,
+    pub mnstr: Option<Mnstr>,
+    pub error: Option<String>,
+}
+
+impl MnstrCollectResult {
+    fn failed(mnstr_qr_code: String, error: &str) -> Self {
+        Self {
+            mnstr_qr_code,
+            status: MnstrCollectStatus::Failed,
+            mnstr: None,
+            error: Some(error.to_string()),
+        }
+    }
+}
+
+pub const MAX_COLLECT_BATCH_SIZE: usize = 100;
+
+/// A collected mnstr with what collecting it earned and the owner's totals
+/// afterwards.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrCollectReward {
+    pub mnstr: Mnstr,
+    pub already_owned: bool,
+    pub coins_awarded: i32,
+    pub xp_awarded: i32,
+    pub experience_level: i32,
+    pub experience_points: i32,
+    pub coins: i32,
+    /// Milestones this collect reached, with the bonus coins each paid.
+    pub achievements: Vec<Achievement>,
+}
+
+impl MnstrCollectReward {
+    pub fn new(mnstr: Mnstr, user: &User, xp_awarded: i32, coins_awarded: i32) -> Self {
+        Self {
+            mnstr,
+            already_owned: false,
+            coins_awarded,
+            xp_awarded,
+            experience_level: user.experience_level,
+            experience_points: user.experience_points,
+            coins: user.coins,
+            achievements: Vec::new(),
+        }
+    }
+
+    /// Re-collecting a mnstr the user already owns awards nothing.
+    pub fn already_owned(mnstr: Mnstr, user: &User) -> Self {
+        Self {
+            already_owned: true,
+            ..Self::new(mnstr, user, 0, 0)
+        }
+    }
+}
+
+/// One entry of a batch update, matched to the owner's live mnstr by QR
+/// code. Fields left `None` keep their current value.
+#[derive(Debug, Clone, Default)]
+pub struct MnstrBatchEdit {
+    pub mnstr_qr_code: String,
+    /// The version the edit was made against. Without one the edit applies
+    /// to whatever version the batch finds.
+    pub version: Option<i32>,
+    pub mnstr_name: Option<String>,
+    pub mnstr_description: Option<String>,
+    pub current_level: Option<i32>,
+    pub current_experience: Option<i32>,
+    pub current_health: Option<i32>,
+    pub max_health: Option<i32>,
+    pub current_attack: Option<i32>,
+    pub max_attack: Option<i32>,
+    pub current_defense: Option<i32>,
+    pub max_defense: Option<i32>,
+    pub current_speed: Option<i32>,
+    pub max_speed: Option<i32>,
+    pub current_intelligence: Option<i32>,
+    pub max_intelligence: Option<i32>,
+    pub current_magic: Option<i32>,
+    pub max_magic: Option<i32>,
+}
+
+impl MnstrBatchEdit {
+    /// `mnstr` with this edit's fields applied.
+    fn apply(&self, mnstr: &Mnstr) -> Mnstr {
+        mnstr.copy_with(
+            self.mnstr_name.clone(),
+            self.mnstr_description.clone(),
+            None,
+            mnstr.created_at,
+            mnstr.updated_at,
+            mnstr.archived_at,
+            self.current_level,
+            self.current_experience,
+            self.current_health,
+            self.max_health,
+            self.current_attack,
+            self.max_attack,
+            self.current_defense,
+            self.max_defense,
+            self.current_speed,
+            self.max_speed,
+            self.current_intelligence,
+            self.max_intelligence,
+            self.current_magic,
+            self.max_magic,
+            None,
+        )
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, GraphQLEnum, Serialize, Deserialize)]
+pub enum MnstrArchiveStatus {
+    Archived,
+    AlreadyArchived,
+    NotFound,
+    /// The user's starter mnstr, which is never archived.
+    Starter,
+}
+
+/// The outcome of archiving a single mnstr in a batch.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrArchiveResult {
+    pub id: String,
+    pub status: MnstrArchiveStatus,
+}
+
+pub const MAX_ARCHIVE_BATCH_SIZE: usize = 100;
+
+/// Sorts requested `ids` against the `found` mnstrs. Mnstrs owned by someone
+/// else are reported as not found so ids of other users' mnstrs are not
+/// revealed, and the user's seed mnstr is kept. Duplicate ids are reported
+/// once.
+pub fn archive_results(user_id: &str, ids: Vec<String>, found: &[Mnstr]) -> Vec<MnstrArchiveResult> {
+    let mut results: Vec<MnstrArchiveResult> = Vec::new();
+    for id in ids {
+        if results.iter().any(|result| result.id == id) {
+            continue;
+        }
+        let status = match found
+            .iter()
+            .find(|mnstr| mnstr.id == id && mnstr.user_id == user_id)
+        {
+            Some(mnstr) if mnstr.archived_at.is_some() => MnstrArchiveStatus::AlreadyArchived,
+            Some(mnstr) if mnstr.is_seed => MnstrArchiveStatus::Starter,
+            Some(_) => MnstrArchiveStatus::Archived,
+            None => MnstrArchiveStatus::NotFound,
+        };
+        results.push(MnstrArchiveResult { id, status });
+    }
+    results
+}
+
+/// The mnstrs that could be read from their rows. Rows that could not are
+/// logged and left out, so one damaged row does not fail a whole list.
+pub fn skip_unreadable(mnstrs: Vec<Result<Mnstr, Error>>) -> Vec<Mnstr> {
+    mnstrs
+        .into_iter()
+        .filter_map(|mnstr| match mnstr {
+            Ok(mnstr) => Some(mnstr),
+            Err(e) => {
+                println!("[skip_unreadable] Skipping unreadable mnstr row: {:?}", e);
+                None
+            }
+        })
+        .collect()
+}
+
+/// Mnstrs a user holds more than once, all caught from the same QR code.
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrDuplicateGroup {
+    pub mnstr_qr_code: String,
+    pub mnstrs: Vec<Mnstr>,
+}
+
+/// Groups the live `mnstrs` by QR code and keeps the groups with more than
+/// one mnstr. Groups come in the order their first mnstr appears in `mnstrs`.
+pub fn duplicate_groups(mnstrs: Vec<Mnstr>) -> Vec<MnstrDuplicateGroup> {
+    let mut groups: Vec<MnstrDuplicateGroup> = Vec::new();
+    for mnstr in mnstrs {
+        if mnstr.archived_at.is_some() {
+            continue;
+        }
+        match groups
+            .iter_mut()
+            .find(|group| group.mnstr_qr_code == mnstr.mnstr_qr_code)
+        {
+            Some(group) => group.mnstrs.push(mnstr),
+            None => groups.push(MnstrDuplicateGroup {
+                mnstr_qr_code: mnstr.mnstr_qr_code.clone(),
+                mnstrs: vec![mnstr],
+            }),
+        }
+    }
+    groups.retain(|group| group.mnstrs.len() > 1);
+    groups
+}
+
+/// How many users own a mnstr with a QR code on which this many owners is
+/// suspicious enough for an admin to look at.
+pub const DEFAULT_QR_COLLISION_THRESHOLD: i64 = 10;
+
+/// A QR code shared by an unusual number of users, which may mean different
+/// physical cards print the same code.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct QrCollision {
+    pub mnstr_qr_code: String,
+    pub owner_count: i64,
+    pub mnstr_count: i64,
+}
+
+/// Mnstrs read per transaction when refreshing derived values, so no page
+/// holds its row locks for long.
+pub const DERIVED_VALUES_PAGE_SIZE: i64 = 500;
+
+/// How many mnstrs a derived value refresh looked at and how many it changed.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq, Default)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrRecompute {
+    pub scanned: i64,
+    pub updated: i64,
+}
+
+/// A page of a user's mnstrs along with the ETag of the whole collection.
+/// When the caller's ETag still matches, `mnstrs` is left empty.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrCollection {
+    pub etag: String,
+    pub not_modified: bool,
+    pub mnstrs: Vec<Mnstr>,
+}
+
+/// A released mnstr, the coins refunded for it and the owner's new balance.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrRelease {
+    pub mnstr: Mnstr,
+    pub coins: i32,
+    pub balance: i32,
+}
+
+/// A mnstr along with the timestamps its public type leaves out, for admin
+/// and debugging clients.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrDetails {
+    pub mnstr: Mnstr,
+    pub created_at: Option<OffsetDateTime>,
+    pub updated_at: Option<OffsetDateTime>,
+    pub archived_at: Option<OffsetDateTime>,
+}
+
+impl MnstrDetails {
+    pub fn from_mnstr(mnstr: Mnstr) -> Self {
+        Self {
+            created_at: mnstr.created_at,
+            updated_at: mnstr.updated_at,
+            archived_at: mnstr.archived_at,
+            mnstr,
+        }
+    }
+}
+
+/// The numbers a mnstr's detail card shows, with the rarity and coin value
+/// stored for the mnstr, so clients need not derive them from the QR code.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrStats {
+    pub level: i32,
+    pub health: i32,
+    pub max_health: i32,
+    pub attack: i32,
+    pub defense: i32,
+    pub rarity: String,
+    pub coins: i32,
+}
+
+impl MnstrStats {
+    pub fn from_mnstr(mnstr: &Mnstr) -> Self {
+        Self {
+            level: mnstr.current_level,
+            health: mnstr.current_health,
+            max_health: mnstr.max_health,
+            attack: mnstr.current_attack,
+            defense: mnstr.current_defense,
+            rarity: mnstr.rarity.clone(),
+            coins: mnstr.coin_value,
+        }
+    }
+}
+
+/// A page of mnstrs and the cursor for the next one, if there is one.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrPage {
+    pub mnstrs: Vec<Mnstr>,
+    pub next_cursor: Option<String>,
+}
+
+/// The ORDER BY for listing mnstrs, least recently updated first unless told
+/// otherwise.
+pub fn order_clause(
+    order_by: Option<MnstrOrderBy>,
+    order_direction: Option<MnstrOrderDirection>,
+) -> String {
+    format!(
+        " ORDER BY {} {}",
+        order_by.unwrap_or(MnstrOrderBy::UpdatedAt).to_string(),
+        order_direction.unwrap_or(MnstrOrderDirection::Asc).to_string()
+    )
+}
+
+/// A weak ETag for a collection of `count` mnstrs whose latest change was at
+/// `last_updated_at`, listed as `query` describes. Each filter and ordering
+/// gets its own tags, so one listing's tag never skips another's.
+pub fn collection_etag(count: i64, last_updated_at: Option<OffsetDateTime>, query: &str) -> String {
+    let last_updated_at = last_updated_at
+        .map(|updated_at| updated_at.unix_timestamp_nanos())
+        .unwrap_or(0);
+    let query = sha2::Sha256::digest(query.as_bytes())
+        .iter()
+        .take(8)
+        .map(|byte| format!("{:02x}", byte))
+        .collect::<String>();
+    format!("W/\"{}-{}-{}\"", count, last_updated_at, query)
+}
+
+/// Whether an If-None-Match value names `etag`, using weak comparison.
+pub fn etag_matches(if_none_match: &str, etag: &str) -> bool {
+    let etag = etag.trim_start_matches("W/");
+    if_none_match
+        .split(',')
+        .map(str::trim)
+        .any(|tag| tag == "*" || tag.trim_start_matches("W/") == etag)
+}
+
+pub const DEFAULT_SEARCH_LIMIT: i64 = 20;
+pub const MAX_SEARCH_LIMIT: i64 = 100;
+
+/// Trims each QR code and drops repeats, keeping the order they were scanned in.
+pub fn dedupe_qr_codes(mnstr_qr_codes: Vec<String>) -> Vec<String> {
+    let mut seen = std::collections::HashSet::new();
+    mnstr_qr_codes
+        .into_iter()
+        .map(|mnstr_qr_code| mnstr_qr_code.trim().to_string())
+        .filter(|mnstr_qr_code| seen.insert(mnstr_qr_code.clone()))
+        .collect()
+}
+
+/// ILIKE patterns matching `query` anywhere and at the start of a value.
+pub fn search_patterns(query: &str) -> (String, String) {
+    let escaped = escape_like(query.trim());
+    (format!("%{}%", escaped), format!("{}%", escaped))
+}
+
+/// The LIMIT and OFFSET for a page of search results, defaulting the limit
+/// and keeping both within range.
+pub fn search_bounds(limit: Option<i64>, offset: Option<i64>) -> (i64, i64) {
+    (
+        limit
+            .unwrap_or(DEFAULT_SEARCH_LIMIT)
+            .clamp(1, MAX_SEARCH_LIMIT),
+        offset.unwrap_or(0).max(0),
+    )
+}
+
+/// A value bound to a placeholder produced by [`MnstrFilter::push_conditions`].
+#[derive(Debug, Clone, PartialEq)]
+pub enum MnstrFilterValue {
+    Bool(bool),
+    Int(i32),
+    Text(String),
+    Timestamp(OffsetDateTime),
+}
+
+/// Optional conditions for listing a user's mnstrs. `created_since` is
+/// inclusive and `created_until` exclusive; both level bounds are inclusive.
+#[derive(Debug, Clone, Default)]
+pub struct MnstrFilter {
+    pub is_seed: Option<bool>,
+    pub created_since: Option<OffsetDateTime>,
+    pub created_until: Option<OffsetDateTime>,
+    pub rarity: Option<String>,
+    pub min_level: Option<i32>,
+    pub max_level: Option<i32>,
+    pub tag: Option<String>,
+}
+
+impl MnstrFilter {
+    pub fn validate(&self) -> Result<(), anyhow::Error> {
+        if let (Some(since), Some(until)) = (self.created_since, self.created_until) {
+            if since > until {
+                return Err(anyhow::Error::msg("since must not be after until"));
+            }
+        }
+        if let Some(rarity) = &self.rarity {
+            if !RARITIES.contains(&rarity.as_str()) {
+                return Err(anyhow::Error::msg(format!(
+                    "rarity must be one of {}",
+                    RARITIES.join(", ")
+                )));
+            }
+        }
+        if self.min_level.is_some_and(|level| level < 0)
+            || self.max_level.is_some_and(|level| level < 0)
+        {
+            return Err(anyhow::Error::msg("levels must not be negative"));
+        }
+        if let (Some(min_level), Some(max_level)) = (self.min_level, self.max_level) {
+            if min_level > max_level {
+                return Err(anyhow::Error::msg("minLevel must not be above maxLevel"));
+            }
+        }
+        if let Some(tag) = &self.tag {
+            normalize_tag(tag)?;
+        }
+        Ok(())
+    }
+
+    /// Appends ` AND ...` conditions to `query` and returns the values to bind,
+    /// numbering placeholders after the `bound` values already in the query.
+    pub fn push_conditions(&self, query: &mut String, bound: usize) -> Vec<MnstrFilterValue> {
+        let mut values = Vec::new();
+        if let Some(is_seed) = self.is_seed {
+            values.push(MnstrFilterValue::Bool(is_seed));
+            query.push_str(&format!(" AND is_seed = ${}", bound + values.len()));
+        }
+        if let Some(created_since) = self.created_since {
+            values.push(MnstrFilterValue::Timestamp(created_since));
+            query.push_str(&format!(" AND created_at >= ${}", bound + values.len()));
+        }
+        if let Some(created_until) = self.created_until {
+            values.push(MnstrFilterValue::Timestamp(created_until));
+            query.push_str(&format!(" AND created_at < ${}", bound + values.len()));
+        }
+        if let Some(rarity) = &self.rarity {
+            values.push(MnstrFilterValue::Text(rarity.clone()));
+            query.push_str(&format!(" AND rarity = ${}", bound + values.len()));
+        }
+        if let Some(min_level) = self.min_level {
+            values.push(MnstrFilterValue::Int(min_level));
+            query.push_str(&format!(" AND current_level >= ${}", bound + values.len()));
+        }
+        if let Some(max_level) = self.max_level {
+            values.push(MnstrFilterValue::Int(max_level));
+            query.push_str(&format!(" AND current_level <= ${}", bound + values.len()));
+        }
+        if let Some(tag) = &self.tag {
+            values.push(MnstrFilterValue::Text(tag_key(tag)));
+            query.push_str(&format!(
+                " AND EXISTS (SELECT 1 FROM mnstr_tags WHERE mnstr_tags.mnstr_id = mnstrs.id AND mnstr_tags.tag = ${})",
+                bound + values.len()
+            ));
+        }
+        values
+    }
+}
 
 impl Mnstr {
     pub fn new(
@@ -210,7 +829,6 @@ impl Mnstr {
             user_id,
             mnstr_name: mnstr_name.unwrap_or(String::new()),
             mnstr_description: mnstr_description.unwrap_or(String::new()),
-            mnstr_qr_code: mnstr_qr_code,
             created_at: None,
             updated_at: None,
             archived_at: None,
@@ -228,6 +846,13 @@ impl Mnstr {
             max_intelligence: DEFAULT_STAT_VALUE,
             current_magic: DEFAULT_STAT_VALUE,
             max_magic: DEFAULT_STAT_VALUE,
+            is_seed: false,
+            version: 0,
+            rarity: rarity_for_qr_code(&mnstr_qr_code),
+            coin_value: coins_for_qr_code(&mnstr_qr_code),
+            image_url: None,
+            tags: Vec::new(),
+            mnstr_qr_code: mnstr_qr_code,
             experience_to_next_level: 0,
         }
     }
@@ -299,7 +924,7 @@ impl Mnstr {
             user_id: self.user_id.clone(),
             mnstr_name: mnstr_name.unwrap_or(self.mnstr_name.clone()),
             mnstr_description: mnstr_description.unwrap_or(self.mnstr_description.clone()),
-            mnstr_qr_code: mnstr_qr_code.unwrap_or(self.mnstr_qr_code.clone()),
+            mnstr_qr_code: mnstr_qr_code.clone().unwrap_or(self.mnstr_qr_code.clone()),
             created_at: created_at,
             updated_at: updated_at,
             archived_at: archived_at,
@@ -317,16 +942,28 @@ impl Mnstr {
             max_intelligence: max_intelligence.unwrap_or(self.max_intelligence),
             current_magic: current_magic.unwrap_or(self.current_magic),
             max_magic: max_magic.unwrap_or(self.max_magic),
+            is_seed: self.is_seed,
+            version: self.version,
+            rarity: match &mnstr_qr_code {
+                Some(mnstr_qr_code) => rarity_for_qr_code(mnstr_qr_code),
+                None => self.rarity.clone(),
+            },
+            coin_value: match &mnstr_qr_code {
+                Some(mnstr_qr_code) => coins_for_qr_code(mnstr_qr_code),
+                None => self.coin_value,
+            },
+            image_url: self.image_url.clone(),
+            tags: self.tags.clone(),
             experience_to_next_level: experience_to_next_level
                 .unwrap_or(self.experience_to_next_level),
         }
     }
 
-    pub async fn create(&mut self) -> Option<anyhow::Error> {
-        let params = vec![
+    fn insert_params(&self) -> Vec<(&'static str, DatabaseValue)> {
+        vec![
             ("user_id", self.user_id.clone().into()),
             ("mnstr_name", self.mnstr_name.clone().into()),
-            ("mnstr_description", self.mnstr_description.clone().into()),
+            ("mnstr_description", description_for_insert(self).into()),
             ("mnstr_qr_code", self.mnstr_qr_code.clone().into()),
             ("current_level", self.current_level.clone().into()),
             ("current_experience", self.current_experience.clone().into()),
@@ -345,42 +982,187 @@ impl Mnstr {
             ("max_intelligence", self.max_intelligence.clone().into()),
             ("current_magic", self.current_magic.clone().into()),
             ("max_magic", self.max_magic.clone().into()),
-        ];
-        let mnstr = match insert_resource!(Mnstr, params).await {
-            Ok(mnstr) => mnstr,
-            Err(e) => {
-                println!("[Mnstr::create] Failed to create mnstr: {:?}", e);
-                return Some(e.into());
-            }
-        };
-        *self = mnstr;
+            ("is_seed", self.is_seed.into()),
+            ("rarity", rarity_for_qr_code(&self.mnstr_qr_code).into()),
+            ("coin_value", coins_for_qr_code(&self.mnstr_qr_code).into()),
+        ]
+    }
+
+    /// The experience and coins collecting this mnstr awards a user at
+    /// `experience_level`.
+    pub fn collect_awards(&self, experience_level: i32) -> (i32, i32) {
+        self.collect_awards_with(experience_level, &config().rarity_multipliers)
+    }
+
+    /// The XP for the owner's level and the mnstr's coins, both scaled by
+    /// the multiplier for its rarity.
+    pub fn collect_awards_with(
+        &self,
+        experience_level: i32,
+        multipliers: &RarityMultipliers,
+    ) -> (i32, i32) {
+        let experience_level = clamp_level(&XP_FOR_LEVEL, experience_level);
+        (
+            multipliers.apply(&self.rarity, XP_FOR_LEVEL[experience_level as usize]),
+            multipliers.apply(&self.rarity, self.coins()),
+        )
+    }
+
+    /// Inserts the mnstr and rewards its owner. A user's first mnstr is their
+    /// seed mnstr.
+    pub async fn create(&mut self) -> Option<anyhow::Error> {
+        match self.create_and_award().await {
+            Ok(_) => None,
+            Err(e) => Some(e),
+        }
+    }
+
+    /// Creates the mnstr and returns the owner with the experience and coins
+    /// awarded and any collection achievements it unlocked. The mnstr, its
+    /// ownership event, the collect cooldown and the rewards commit together.
+    /// A code the user was rewarded for within the cooldown is still
+    /// collected, but awards nothing.
+    async fn create_and_award(
+        &mut self,
+    ) -> Result<(User, i32, i32, Vec<Achievement>), anyhow::Error> {
+        check_catalog(self).await?;
 
         let mut user = match User::find_one(self.user_id.clone(), false).await {
             Ok(user) => user,
             Err(e) => {
                 println!("[Mnstr::create] Failed to get user: {:?}", e);
-                return Some(e.into());
+                return Err(e.into());
             }
         };
-        let xp = XP_FOR_LEVEL[user.experience_level as usize];
-        println!("[Mnstr::create] XP: {:?}", xp);
-        if let Some(error) = user.update_xp(xp).await {
-            println!("[Mnstr::create] Failed to update user xp: {:?}", error);
-            return Some(error.into());
+        if let Some(error) = user.get_wallet().await {
+            println!("[Mnstr::create] Failed to get wallet: {:?}", error);
+            return Err(error);
         }
-        if let Some(error) = user.add_coins(self.coins()).await {
-            println!("[Mnstr::create] Failed to add coins: {:?}", error);
-            return Some(error.into());
+        let wallet_id = match &user.wallet {
+            Some(wallet) => wallet.id.clone(),
+            None => return Err(anyhow::Error::msg("Wallet not found")),
+        };
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::create] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        self.is_seed = !Mnstr::lock_has_any(&mut tx, &self.user_id).await?;
+        let mnstr = match insert_resource!(Mnstr, self.insert_params(), &mut *tx).await {
+            Ok(mnstr) => mnstr,
+            Err(e) => {
+                println!("[Mnstr::create] Failed to create mnstr: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        OwnershipEvent::new(
+            mnstr.id.clone(),
+            OwnershipEventType::Collected,
+            None,
+            Some(mnstr.user_id.clone()),
+        )
+        .record(&mut tx)
+        .await?;
+
+        let rewarded = CollectCooldown::claim(
+            &mut tx,
+            user.id.clone(),
+            vec![mnstr.mnstr_qr_code.clone()],
+            config().collect_cooldown,
+        )
+        .await?;
+        let (mut xp, mut coins, mut experience) = (0, 0, None);
+        if !rewarded.is_empty() {
+            let locked = User::lock_experience(&mut tx, &user.id).await?;
+            (xp, coins) = mnstr.collect_awards(locked.0);
+            println!("[Mnstr::create] XP: {:?}", xp);
+            experience = Some(User::award_xp(&mut tx, &user.id, locked, &[xp]).await?);
+            Wallet::credit(
+                &mut tx,
+                wallet_id,
+                coins,
+                Some(collect_transaction_data(&mnstr.id)),
+            )
+            .await?;
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::create] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        *self = mnstr;
+
+        if let Some((experience_level, experience_points)) = experience {
+            user.set_experience(experience_level, experience_points)
+                .await;
+        }
+        if let Some(error) = user.get_coins().await {
+            println!("[Mnstr::create] Failed to get coins: {:?}", error);
+            return Err(error);
         }
+        let achievements = user
+            .check_achievements(Achievement::check_collection(user.id.clone()).await)
+            .await;
 
         self.update_experience_to_next_level();
 
-        None
+        // award_xp applies any running XP event, so report what it granted.
+        Ok((user, apply_xp_multiplier(xp), coins, achievements))
+    }
+
+    /// Collects `mnstr_qr_code` for `user_id`. A code the user already owns
+    /// returns the existing mnstr without awarding anything again, and one
+    /// they were rewarded for within the collect cooldown is collected with
+    /// no rewards.
+    pub async fn collect(
+        user_id: String,
+        mnstr_qr_code: String,
+    ) -> Result<MnstrCollectReward, anyhow::Error> {
+        let params = vec![
+            ("user_id", user_id.clone().into()),
+            ("mnstr_qr_code", mnstr_qr_code.clone().into()),
+        ];
+        if let Ok(mnstr) = find_one_unarchived_resource_where_fields!(Mnstr, params).await {
+            let mut user = match User::find_one(user_id, false).await {
+                Ok(user) => user,
+                Err(e) => {
+                    println!("[Mnstr::collect] Failed to get user: {:?}", e);
+                    return Err(e);
+                }
+            };
+            if let Some(error) = user.get_coins().await {
+                println!("[Mnstr::collect] Failed to get coins: {:?}", error);
+                return Err(error);
+            }
+            return Ok(MnstrCollectReward::already_owned(mnstr, &user));
+        }
+
+        let mut mnstr = Mnstr::new(user_id, None, None, mnstr_qr_code);
+        let (user, xp, coins, achievements) = mnstr.create_and_award().await?;
+        webhooks::dispatch(WebhookEvent::mnstr_collected(
+            user.id.clone(),
+            mnstr.id.clone(),
+            coins,
+            xp,
+        ));
+        Ok(MnstrCollectReward {
+            achievements,
+            ..MnstrCollectReward::new(mnstr, &user, xp, coins)
+        })
     }
 
+    /// Creates `mnstrs` for `user_id` by the same rules as a single collect:
+    /// catalog entries apply, the user's first mnstr is their seed and each
+    /// one is rewarded unless its code is in its collect cooldown. One bad
+    /// mnstr fails the whole batch.
     pub async fn create_batch(
         user_id: String,
-        mnstrs: Vec<Vec<(&str, Option<DatabaseValue>)>>,
+        mut mnstrs: Vec<Mnstr>,
     ) -> Result<Vec<Mnstr>, anyhow::Error> {
         if mnstrs.is_empty() {
             return Err(anyhow::Error::msg("No mnstrs to create"));
@@ -394,43 +1176,350 @@ impl Mnstr {
             }
         };
 
-        let xp = XP_FOR_LEVEL[user.experience_level as usize];
-        println!("[Mnstr::create_batch] XP: {:?}", xp);
-        if let Some(error) = user.update_xp(xp).await {
+        for mnstr in mnstrs.iter_mut() {
+            mnstr.user_id = user_id.clone();
+            if let Err(e) = check_catalog(mnstr).await {
+                println!("[Mnstr::create_batch] Failed to check catalog: {:?}", e);
+                return Err(e);
+            }
+        }
+
+        Mnstr::create_and_reward_batch(&mut user, &mnstrs).await
+    }
+
+    /// Inserts `new_mnstrs` for `user` and rewards them, committing the
+    /// mnstrs, their ownership events, cooldowns and rewards together.
+    /// Returns the created mnstrs in the order they were given.
+    async fn create_and_reward_batch(
+        user: &mut User,
+        new_mnstrs: &[Mnstr],
+    ) -> Result<Vec<Mnstr>, anyhow::Error> {
+        if let Some(error) = user.get_wallet().await {
             println!(
-                "[Mnstr::create_batch] Failed to update user xp: {:?}",
+                "[Mnstr::create_and_reward_batch] Failed to get wallet: {:?}",
                 error
             );
-            return Err(error.into());
-        }
-
-        let mut params: Vec<Vec<(&str, DatabaseValue)>> = Vec::new();
-        for mnstr in mnstrs.iter() {
-            let mut mnstr_params: Vec<(&str, DatabaseValue)> = Vec::new();
-            for (field, value) in mnstr.iter() {
-                if let Some(v) = value {
-                    mnstr_params.push((*field, v.clone().into()));
-                }
-            }
-            params.push(mnstr_params);
+            return Err(error);
         }
+        let wallet_id = match &user.wallet {
+            Some(wallet) => wallet.id.clone(),
+            None => return Err(anyhow::Error::msg("Wallet not found")),
+        };
 
-        match insert_resource_batch!(Mnstr, params).await {
-            Ok(mut results) => {
-                for mnstr in results.iter_mut() {
-                    if let Some(error) = user.add_coins(mnstr.coins()).await {
-                        println!("[Mnstr::create_batch] Failed to add coins: {:?}", error);
-                        return Err(error.into());
-                    }
-                    mnstr.update_experience_to_next_level();
-                }
-                Ok(results)
-            }
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
             Err(e) => {
-                println!("[Mnstr::create_batch] Failed to create mnstrs: {:?}", e);
+                println!(
+                    "[Mnstr::create_and_reward_batch] Failed to begin transaction: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        let (rewarded, (experience_level, experience_points)) =
+            match Mnstr::insert_and_reward(&mut tx, &user.id, &wallet_id, new_mnstrs).await {
+                Ok(rewarded) => rewarded,
+                Err(e) => {
+                    println!(
+                        "[Mnstr::create_and_reward_batch] Failed to create mnstrs: {:?}",
+                        e
+                    );
+                    return Err(e);
+                }
+            };
+        if let Err(e) = tx.commit().await {
+            println!(
+                "[Mnstr::create_and_reward_batch] Failed to commit transaction: {:?}",
+                e
+            );
+            return Err(e.into());
+        }
+
+        let mut created =
+            Mnstr::finish_collected(user, rewarded, (experience_level, experience_points)).await;
+        created.sort_by_key(|mnstr| {
+            new_mnstrs
+                .iter()
+                .position(|new_mnstr| new_mnstr.mnstr_qr_code == mnstr.mnstr_qr_code)
+        });
+        Ok(created)
+    }
+
+    /// Follows up on mnstrs `insert_and_reward` created once their
+    /// transaction has committed: stores the user's new experience, sends the
+    /// collect webhooks and checks collection achievements.
+    async fn finish_collected(
+        user: &mut User,
+        rewarded: Vec<(Mnstr, Option<(i32, i32)>)>,
+        (experience_level, experience_points): (i32, i32),
+    ) -> Vec<Mnstr> {
+        user.set_experience(experience_level, experience_points)
+            .await;
+        let mut created = Vec::new();
+        for (mut mnstr, award) in rewarded {
+            let (xp, coins) = award.unwrap_or((0, 0));
+            webhooks::dispatch(WebhookEvent::mnstr_collected(
+                user.id.clone(),
+                mnstr.id.clone(),
+                coins,
+                apply_xp_multiplier(xp),
+            ));
+            mnstr.update_experience_to_next_level();
+            created.push(mnstr);
+        }
+        user.check_achievements(Achievement::check_collection(user.id.clone()).await)
+            .await;
+        created
+    }
+
+    /// Inserts the mnstrs and records each one as collected by its owner, in
+    /// the caller's transaction.
+    async fn insert_collected(
+        conn: &mut PgConnection,
+        params: Vec<Vec<(&str, DatabaseValue)>>,
+    ) -> Result<Vec<Mnstr>, anyhow::Error> {
+        let created = insert_resource_batch!(Mnstr, params, &mut *conn).await?;
+        for mnstr in created.iter() {
+            OwnershipEvent::new(
+                mnstr.id.clone(),
+                OwnershipEventType::Collected,
+                None,
+                Some(mnstr.user_id.clone()),
+            )
+            .record(conn)
+            .await?;
+        }
+        Ok(created)
+    }
+
+    /// Collects every scanned QR code for `user_id`. Codes the user already
+    /// owns are reported rather than duplicated, new mnstrs are inserted in a
+    /// single statement, and each one is rewarded like a single collect. A bad
+    /// code only fails its own result. The new mnstrs, their ownership events,
+    /// cooldowns and rewards commit together. Results are in the order the
+    /// codes were given, without duplicates.
+    pub async fn collect_batch(
+        user_id: String,
+        mnstr_qr_codes: Vec<String>,
+    ) -> Result<Vec<MnstrCollectResult>, anyhow::Error> {
+        let mnstr_qr_codes = dedupe_qr_codes(mnstr_qr_codes);
+
+        let mut user = match User::find_one(user_id.clone(), false).await {
+            Ok(user) => user,
+            Err(e) => {
+                println!("[Mnstr::collect_batch] Failed to get user: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let pool = get_connection().await;
+        let owned = match sqlx::query(
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND mnstr_qr_code = ANY($2) AND archived_at IS NULL",
+        )
+        .bind(user_id.clone())
+        .bind(mnstr_qr_codes.clone())
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => match Mnstr::from_rows(&rows) {
+                Ok(mnstrs) => mnstrs,
+                Err(e) => return Err(e.into()),
+            },
+            Err(e) => {
+                println!("[Mnstr::collect_batch] Failed to get owned mnstrs: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let mut results: Vec<MnstrCollectResult> = Vec::new();
+        let mut new_mnstrs: Vec<Mnstr> = Vec::new();
+        for mnstr_qr_code in mnstr_qr_codes {
+            if mnstr_qr_code.is_empty() {
+                results.push(MnstrCollectResult::failed(
+                    mnstr_qr_code,
+                    "QR code is required",
+                ));
+                continue;
+            }
+            if let Some(mnstr) = owned
+                .iter()
+                .find(|mnstr| mnstr.mnstr_qr_code == mnstr_qr_code)
+            {
+                let mut mnstr = mnstr.clone();
+                mnstr.update_experience_to_next_level();
+                results.push(MnstrCollectResult {
+                    mnstr_qr_code,
+                    status: MnstrCollectStatus::AlreadyOwned,
+                    mnstr: Some(mnstr),
+                    error: None,
+                });
+                continue;
+            }
+            let mut mnstr = Mnstr::new(user_id.clone(), None, None, mnstr_qr_code.clone());
+            if let Err(e) = check_catalog(&mut mnstr).await {
+                results.push(MnstrCollectResult::failed(mnstr_qr_code, &e.to_string()));
+                continue;
+            }
+            // Holds the code's place in the results until the mnstr is
+            // created, and stands if it is not.
+            results.push(MnstrCollectResult::failed(
+                mnstr_qr_code,
+                "Failed to create mnstr",
+            ));
+            new_mnstrs.push(mnstr);
+        }
+
+        if new_mnstrs.is_empty() {
+            return Ok(results);
+        }
+
+        let created = match Mnstr::create_and_reward_batch(&mut user, &new_mnstrs).await {
+            Ok(created) => created,
+            Err(e) => {
+                println!("[Mnstr::collect_batch] Failed to create mnstrs: {:?}", e);
+                return Ok(results);
+            }
+        };
+        for mnstr in created {
+            if let Some(result) = results
+                .iter_mut()
+                .find(|result| result.mnstr_qr_code == mnstr.mnstr_qr_code)
+            {
+                *result = MnstrCollectResult {
+                    mnstr_qr_code: mnstr.mnstr_qr_code.clone(),
+                    status: MnstrCollectStatus::Created,
+                    mnstr: Some(mnstr),
+                    error: None,
+                };
+            }
+        }
+
+        Ok(results)
+    }
+
+    /// Inserts `new_mnstrs` for `user_id`, records them as collected and pays
+    /// for each one whose collect cooldown could be started, all in the
+    /// caller's transaction. The first becomes the user's seed if they have
+    /// no mnstrs yet. Returns
+    /// every created mnstr with the XP and coins it earned, if any, and the
+    /// user's new level and points.
+    async fn insert_and_reward(
+        conn: &mut PgConnection,
+        user_id: &str,
+        wallet_id: &str,
+        new_mnstrs: &[Mnstr],
+    ) -> Result<(Vec<(Mnstr, Option<(i32, i32)>)>, (i32, i32)), anyhow::Error> {
+        let has_any = Mnstr::lock_has_any(conn, user_id).await?;
+        let params = new_mnstrs
+            .iter()
+            .enumerate()
+            .map(|(index, mnstr)| {
+                Mnstr {
+                    is_seed: !has_any && index == 0,
+                    ..mnstr.clone()
+                }
+                .insert_params()
+            })
+            .collect::<Vec<Vec<(&str, DatabaseValue)>>>();
+        let created = Mnstr::insert_collected(conn, params).await?;
+        let rewarded = CollectCooldown::claim(
+            conn,
+            user_id.to_string(),
+            created
+                .iter()
+                .map(|mnstr| mnstr.mnstr_qr_code.clone())
+                .collect(),
+            config().collect_cooldown,
+        )
+        .await?;
+
+        // Each mnstr's award depends on the level the ones before it reached,
+        // so the levels are tracked here and the XP is written once.
+        let experience = User::lock_experience(conn, user_id).await?;
+        let (mut experience_level, mut experience_points) = experience;
+        let mut awarded = Vec::new();
+        for mnstr in created {
+            if !rewarded.contains(&mnstr.mnstr_qr_code) {
+                awarded.push((mnstr, None));
+                continue;
+            }
+            let (xp, coins) = mnstr.collect_awards(experience_level);
+            (experience_level, experience_points) = apply_xp(
+                &XP_FOR_LEVEL,
+                experience_level,
+                experience_points,
+                apply_xp_multiplier(xp),
+            );
+            Wallet::credit(
+                conn,
+                wallet_id.to_string(),
+                coins,
+                Some(collect_transaction_data(&mnstr.id)),
+            )
+            .await?;
+            awarded.push((mnstr, Some((xp, coins))));
+        }
+        let awards = awarded
+            .iter()
+            .filter_map(|(_, award)| award.map(|(xp, _)| xp))
+            .collect::<Vec<i32>>();
+        let experience = User::award_xp(conn, user_id, experience, &awards).await?;
+        Ok((awarded, experience))
+    }
+
+    /// Archives every mnstr in `ids` that `user_id` owns, all in one
+    /// transaction, and reports what happened to each id.
+    pub async fn archive_batch(
+        user_id: String,
+        ids: Vec<String>,
+    ) -> Result<Vec<MnstrArchiveResult>, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::archive_batch] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let found = match sqlx::query("SELECT * FROM mnstrs WHERE id = ANY($1) FOR UPDATE")
+            .bind(ids.clone())
+            .fetch_all(&mut *tx)
+            .await
+        {
+            Ok(rows) => Mnstr::from_rows(&rows)?,
+            Err(e) => {
+                println!("[Mnstr::archive_batch] Failed to get mnstrs: {:?}", e);
                 return Err(e.into());
             }
+        };
+
+        let results = archive_results(&user_id, ids, &found);
+        let archived_ids = results
+            .iter()
+            .filter(|result| result.status == MnstrArchiveStatus::Archived)
+            .map(|result| result.id.clone())
+            .collect::<Vec<String>>();
+        if !archived_ids.is_empty() {
+            if let Err(e) = sqlx::query(
+                "UPDATE mnstrs SET archived_at = now(), version = version + 1, updated_at = now()
+                WHERE id = ANY($1) AND user_id = $2 AND archived_at IS NULL AND NOT is_seed",
+            )
+            .bind(archived_ids)
+            .bind(user_id)
+            .execute(&mut *tx)
+            .await
+            {
+                println!("[Mnstr::archive_batch] Failed to archive mnstrs: {:?}", e);
+                return Err(e.into());
+            }
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::archive_batch] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
         }
+        Ok(results)
     }
 
     pub async fn update(&mut self) -> Option<anyhow::Error> {
@@ -462,99 +1551,404 @@ impl Mnstr {
                 return Some(e.into());
             }
         };
-        *self = mnstr;
+        *self = Mnstr {
+            tags: std::mem::take(&mut self.tags),
+            ..mnstr
+        };
 
-        self.update_experience_to_next_level();
+        None
+    }
 
+    /// Points the mnstr at a newly uploaded picture.
+    pub async fn update_image_url(&mut self, image_url: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET image_url = $1, version = version + 1, updated_at = now()
+            WHERE id = $2 RETURNING *",
+        )
+        .bind(image_url)
+        .bind(self.id.clone())
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[Mnstr::update_image_url] Failed to update mnstr: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        *self = match Mnstr::from_row(&row) {
+            Ok(mnstr) => Mnstr {
+                tags: std::mem::take(&mut self.tags),
+                ..mnstr
+            },
+            Err(e) => return Some(e.into()),
+        };
         None
     }
 
-    pub async fn update_batch(
-        user_id: String,
-        mnstrs: Vec<Vec<(&str, Option<DatabaseValue>)>>,
-    ) -> Result<Vec<Mnstr>, anyhow::Error> {
-        let mut results: Vec<Mnstr> = Vec::new();
-        let mut params: Vec<Vec<(&str, DatabaseValue)>> = Vec::new();
-        let mut new_mnstrs: Vec<Vec<(&str, DatabaseValue)>> = Vec::new();
+    /// Fills in the tags of each of `mnstrs` with one query.
+    pub async fn load_tags(mnstrs: &mut [Mnstr]) -> Result<(), anyhow::Error> {
+        if mnstrs.is_empty() {
+            return Ok(());
+        }
+        let ids = mnstrs.iter().map(|mnstr| mnstr.id.clone()).collect();
+        let mut tags = MnstrTag::find_all_by_mnstr_ids(ids).await?;
+        for mnstr in mnstrs.iter_mut() {
+            mnstr.tags = tags.remove(&mnstr.id).unwrap_or_default();
+        }
+        Ok(())
+    }
 
-        let qr_codes = mnstrs
-            .iter()
-            .map(|mnstr| {
-                mnstr
-                    .iter()
-                    .find(|(field, _)| field == &"mnstr_qr_code")
-                    .unwrap()
-                    .1
-                    .clone()
-            })
-            .collect::<Vec<Option<DatabaseValue>>>();
-        let found_mnstrs =
-            match find_all_resources_where_fields_in!(Mnstr, "mnstr_qr_code", qr_codes).await {
-                Ok(found_mnstrs) => Some(found_mnstrs),
-                Err(_) => None,
-            };
+    /// Tags the mnstr on behalf of its owner `user_id`.
+    pub async fn add_tag(&mut self, user_id: &str, tag: &str) -> Option<anyhow::Error> {
+        self.update_tags(user_id, |tags| with_tag(tags, tag)).await
+    }
 
-        for mnstr in mnstrs.iter() {
-            let qr_code = mnstr.iter().find(|(field, _)| field == &"mnstr_qr_code");
+    /// Removes a tag from the mnstr on behalf of its owner `user_id`.
+    pub async fn remove_tag(&mut self, user_id: &str, tag: &str) -> Option<anyhow::Error> {
+        self.update_tags(user_id, |tags| Ok(without_tag(tags, tag))).await
+    }
 
-            let mut found_mnstr = None;
+    /// Locks the mnstr, applies `change` to its current tags and stores the
+    /// result. Bumping `updated_at` keeps the collection ETag honest.
+    async fn update_tags(
+        &mut self,
+        user_id: &str,
+        change: impl FnOnce(&[String]) -> Result<Vec<String>, anyhow::Error>,
+    ) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::update_tags] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
 
-            if qr_code.is_some() && found_mnstrs.is_some() {
-                let qr_code: String = (qr_code.as_ref().unwrap().1.clone().unwrap()).into();
-                found_mnstr = match found_mnstrs
-                    .as_ref()
-                    .unwrap()
-                    .iter()
-                    .find(|mnstr| mnstr.mnstr_qr_code == qr_code && mnstr.user_id == user_id)
-                {
-                    Some(mnstr) => Some(mnstr.clone()),
-                    None => None,
-                };
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET version = version + 1, updated_at = now()
+            WHERE id = $1 AND user_id = $2 AND archived_at IS NULL RETURNING *",
+        )
+        .bind(self.id.clone())
+        .bind(user_id)
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(row)) => row,
+            Ok(None) => return Some(anyhow::Error::msg("Mnstr is not owned by user")),
+            Err(e) => {
+                println!("[Mnstr::update_tags] Failed to lock mnstr: {:?}", e);
+                return Some(e.into());
             }
+        };
+        let mut mnstr = match Mnstr::from_row(&row) {
+            Ok(mnstr) => mnstr,
+            Err(e) => return Some(e.into()),
+        };
 
-            let mut mnstr_params: Vec<(&str, DatabaseValue)> = Vec::new();
-            for (field, value) in mnstr.iter() {
-                if let Some(v) = value {
-                    mnstr_params.push((*field, v.clone().into()));
-                }
+        let current: Vec<String> = match sqlx::query(
+            "SELECT tag FROM mnstr_tags WHERE mnstr_id = $1 ORDER BY tag ASC",
+        )
+        .bind(mnstr.id.clone())
+        .fetch_all(&mut *tx)
+        .await
+        {
+            Ok(rows) => rows.iter().map(|row| row.get("tag")).collect(),
+            Err(e) => {
+                println!("[Mnstr::update_tags] Failed to get tags: {:?}", e);
+                return Some(e.into());
             }
+        };
+        mnstr.tags = match change(&current) {
+            Ok(tags) => tags,
+            Err(e) => return Some(e),
+        };
+        if let Err(e) = MnstrTag::replace_all(&mut tx, &mnstr.id, &mnstr.tags).await {
+            return Some(e);
+        }
 
-            if let None = found_mnstr {
-                let id_idx = mnstr_params.iter().position(|(field, _)| field == &"id");
-                if let Some(idx) = id_idx {
-                    mnstr_params.remove(idx);
-                }
-                new_mnstrs.push(mnstr_params);
-                continue;
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::update_tags] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+        *self = mnstr;
+        None
+    }
+
+    /// Writes the mnstr and bumps its version in the caller's transaction,
+    /// unless another edit already moved it past `expected_version`.
+    async fn update_versioned(
+        &mut self,
+        conn: &mut PgConnection,
+        expected_version: i32,
+    ) -> Option<anyhow::Error> {
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET
+                mnstr_name = $1, mnstr_description = $2, current_level = $3, current_experience = $4,
+                current_health = $5, max_health = $6, current_attack = $7, max_attack = $8,
+                current_defense = $9, max_defense = $10, current_speed = $11, max_speed = $12,
+                current_intelligence = $13, max_intelligence = $14, current_magic = $15, max_magic = $16,
+                version = version + 1, updated_at = now()
+            WHERE id = $17 AND version = $18
+            RETURNING *",
+        )
+        .bind(self.mnstr_name.clone())
+        .bind(self.mnstr_description.clone())
+        .bind(self.current_level)
+        .bind(self.current_experience)
+        .bind(self.current_health)
+        .bind(self.max_health)
+        .bind(self.current_attack)
+        .bind(self.max_attack)
+        .bind(self.current_defense)
+        .bind(self.max_defense)
+        .bind(self.current_speed)
+        .bind(self.max_speed)
+        .bind(self.current_intelligence)
+        .bind(self.max_intelligence)
+        .bind(self.current_magic)
+        .bind(self.max_magic)
+        .bind(self.id.clone())
+        .bind(expected_version)
+        .fetch_optional(&mut *conn)
+        .await
+        {
+            Ok(Some(row)) => row,
+            Ok(None) => return Some(anyhow::Error::msg(MNSTR_VERSION_CONFLICT)),
+            Err(e) => {
+                println!("[Mnstr::update_versioned] Failed to update mnstr: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        *self = match Mnstr::from_row(&row) {
+            Ok(mnstr) => Mnstr {
+                tags: std::mem::take(&mut self.tags),
+                ..mnstr
+            },
+            Err(e) => return Some(e.into()),
+        };
+        None
+    }
+
+    /// Updates the mnstr on behalf of `user_id`, recording any name or
+    /// description change in its edit history. The edit only applies if the
+    /// mnstr is still at `expected_version`.
+    pub async fn update_as(
+        &mut self,
+        user_id: String,
+        expected_version: i32,
+    ) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::update_as] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        let previous = match sqlx::query("SELECT * FROM mnstrs WHERE id = $1 FOR UPDATE")
+            .bind(self.id.clone())
+            .fetch_one(&mut *tx)
+            .await
+        {
+            Ok(row) => match Mnstr::from_row(&row) {
+                Ok(previous) => previous,
+                Err(e) => return Some(e.into()),
+            },
+            Err(e) => {
+                println!("[Mnstr::update_as] Failed to get mnstr: {:?}", e);
+                return Some(e.into());
             }
+        };
 
-            params.push(mnstr_params);
+        if let Some(error) = self
+            .update_from(&mut tx, &previous, user_id, expected_version)
+            .await
+        {
+            return Some(error);
         }
 
-        // TODO: use upsert_resource_batch! macro instead of insert_resource_batch! and update_resource_batch!
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::update_as] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+        None
+    }
 
-        if !new_mnstrs.is_empty() {
-            let new_results = match insert_resource_batch!(Mnstr, new_mnstrs).await {
-                Ok(results) => results,
+    /// The single-mnstr edit shared by `update_as` and `update_batch`: checks
+    /// the version and the name against `previous`, the locked row, then
+    /// writes the mnstr and records the edit in the caller's transaction.
+    async fn update_from(
+        &mut self,
+        conn: &mut PgConnection,
+        previous: &Mnstr,
+        user_id: String,
+        expected_version: i32,
+    ) -> Option<anyhow::Error> {
+        if let Err(e) = check_version(expected_version, previous.version) {
+            return Some(e);
+        }
+        if config().unique_mnstr_names
+            && normalize_mnstr_name(&self.mnstr_name) != normalize_mnstr_name(&previous.mnstr_name)
+        {
+            if let Some(error) = self.check_name_available(conn).await {
+                return Some(error);
+            }
+        }
+
+        if let Some(error) = self.update_versioned(conn, expected_version).await {
+            return Some(error);
+        }
+
+        if let Some(mut edit) = MnstrEdit::between(previous, self, user_id) {
+            if let Err(e) = edit.record(conn).await {
+                println!("[Mnstr::update_from] Failed to record edit: {:?}", e);
+                return Some(e);
+            }
+        }
+        None
+    }
+
+    /// Fails with `MNSTR_NAME_CONFLICT` when another of the owner's mnstrs
+    /// already has this mnstr's name, ignoring case and surrounding spaces.
+    async fn check_name_available(&self, conn: &mut PgConnection) -> Option<anyhow::Error> {
+        let rows = match sqlx::query(
+            "SELECT * FROM mnstrs
+            WHERE user_id = $1 AND id <> $2 AND archived_at IS NULL
+                AND lower(trim(mnstr_name)) = $3",
+        )
+        .bind(self.user_id.clone())
+        .bind(self.id.clone())
+        .bind(normalize_mnstr_name(&self.mnstr_name))
+        .fetch_all(&mut *conn)
+        .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!("[Mnstr::check_name_available] Failed to get mnstrs: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        let others = match Mnstr::from_rows(&rows) {
+            Ok(others) => others,
+            Err(e) => return Some(e.into()),
+        };
+        if is_name_taken(self, &others) {
+            return Some(anyhow::Error::msg(MNSTR_NAME_CONFLICT));
+        }
+        None
+    }
+
+    /// Applies `edits` for `user_id` in one transaction. A mnstr the user
+    /// holds is edited by the same checks as `update_as`, and a code they do
+    /// not hold yet is collected by the rules of `create_batch`. One bad edit
+    /// fails the whole batch. Returns the mnstrs in the order of `edits`.
+    pub async fn update_batch(
+        user_id: String,
+        edits: Vec<MnstrBatchEdit>,
+    ) -> Result<Vec<Mnstr>, anyhow::Error> {
+        let mut user = match User::find_one(user_id.clone(), false).await {
+            Ok(user) => user,
+            Err(e) => {
+                println!("[Mnstr::update_batch] Failed to get user: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        if let Some(error) = user.get_wallet().await {
+            println!("[Mnstr::update_batch] Failed to get wallet: {:?}", error);
+            return Err(error);
+        }
+        let wallet_id = match &user.wallet {
+            Some(wallet) => wallet.id.clone(),
+            None => return Err(anyhow::Error::msg("Wallet not found")),
+        };
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::update_batch] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let mut results: Vec<Mnstr> = Vec::new();
+        let mut new_mnstrs: Vec<Mnstr> = Vec::new();
+        for edit in edits.iter() {
+            let row = match sqlx::query(
+                "SELECT * FROM mnstrs
+                WHERE user_id = $1 AND mnstr_qr_code = $2 AND archived_at IS NULL
+                FOR UPDATE",
+            )
+            .bind(user_id.clone())
+            .bind(edit.mnstr_qr_code.clone())
+            .fetch_optional(&mut *tx)
+            .await
+            {
+                Ok(row) => row,
                 Err(e) => {
-                    println!("[Mnstr::update_batch] Failed to create mnstrs: {:?}", e);
+                    println!("[Mnstr::update_batch] Failed to get mnstr: {:?}", e);
                     return Err(e.into());
                 }
             };
-            results.extend(new_results);
-        }
 
-        if !params.is_empty() {
-            let updated_results = match update_resource_batch!(Mnstr, params).await {
-                Ok(results) => results,
-                Err(e) => {
-                    println!("[Mnstr::update_batch] Failed to update mnstrs: {:?}", e);
-                    return Err(e.into());
+            let Some(row) = row else {
+                let mut mnstr = edit.apply(&Mnstr::new(
+                    user_id.clone(),
+                    None,
+                    None,
+                    edit.mnstr_qr_code.clone(),
+                ));
+                if let Err(e) = check_catalog(&mut mnstr).await {
+                    println!("[Mnstr::update_batch] Failed to check catalog: {:?}", e);
+                    return Err(e);
                 }
+                new_mnstrs.push(mnstr);
+                continue;
             };
-            results.extend(updated_results);
+
+            let previous = Mnstr::from_row(&row)?;
+            let mut mnstr = edit.apply(&previous);
+            let expected_version = edit.version.unwrap_or(previous.version);
+            if let Some(error) = mnstr
+                .update_from(&mut tx, &previous, user_id.clone(), expected_version)
+                .await
+            {
+                println!("[Mnstr::update_batch] Failed to update mnstr: {:?}", error);
+                return Err(error);
+            }
+            mnstr.update_experience_to_next_level();
+            results.push(mnstr);
+        }
+
+        let mut rewarded = None;
+        if !new_mnstrs.is_empty() {
+            rewarded =
+                match Mnstr::insert_and_reward(&mut tx, &user_id, &wallet_id, &new_mnstrs).await {
+                    Ok(rewarded) => Some(rewarded),
+                    Err(e) => {
+                        println!("[Mnstr::update_batch] Failed to create mnstrs: {:?}", e);
+                        return Err(e);
+                    }
+                };
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!(
+                "[Mnstr::update_batch] Failed to commit transaction: {:?}",
+                e
+            );
+            return Err(e.into());
         }
 
+        if let Some((created, experience)) = rewarded {
+            results.extend(Mnstr::finish_collected(&mut user, created, experience).await);
+        }
+        results.sort_by_key(|mnstr| {
+            edits
+                .iter()
+                .position(|edit| edit.mnstr_qr_code == mnstr.mnstr_qr_code)
+        });
         Ok(results)
     }
 
@@ -578,16 +1972,124 @@ impl Mnstr {
         self.update().await
     }
 
-    pub async fn delete_permanent(&mut self) -> Option<anyhow::Error> {
-        match delete_resource_where_fields!(Mnstr, vec![("id", self.id.clone().into())], true).await
+    /// Gives the mnstr from `user_id` to `to_user_id`. The ownership change
+    /// and its audit record commit together, and the update only applies if
+    /// `user_id` still owns the mnstr.
+    pub async fn transfer_to(
+        &mut self,
+        user_id: String,
+        to_user_id: String,
+    ) -> Result<MnstrTransfer, anyhow::Error> {
+        validate_gift(self, &user_id, &to_user_id)?;
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::transfer_to] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let recipient = match sqlx::query(
+            "SELECT id FROM users WHERE id = $1 AND archived_at IS NULL",
+        )
+        .bind(to_user_id.clone())
+        .fetch_optional(&mut *tx)
+        .await
         {
-            Ok(_) => (),
-            Err(e) => return Some(e.into()),
+            Ok(row) => row,
+            Err(e) => {
+                println!("[Mnstr::transfer_to] Failed to get recipient: {:?}", e);
+                return Err(e.into());
+            }
         };
-        None
-    }
+        if recipient.is_none() {
+            return Err(anyhow::Error::msg("Recipient not found"));
+        }
 
-    pub async fn find_one(id: String, get_relationships: bool) -> Result<Self, anyhow::Error> {
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET user_id = $1, version = version + 1, updated_at = now()
+            WHERE id = $2 AND user_id = $3 AND archived_at IS NULL AND NOT is_seed
+            RETURNING *",
+        )
+        .bind(to_user_id.clone())
+        .bind(self.id.clone())
+        .bind(user_id.clone())
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(row)) => row,
+            Ok(None) => return Err(anyhow::Error::msg("Mnstr is not owned by user")),
+            Err(e) => {
+                println!("[Mnstr::transfer_to] Failed to transfer mnstr: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let mnstr = Mnstr::from_row(&row)?;
+
+        let row = match sqlx::query(
+            "INSERT INTO mnstr_transfers (id, mnstr_id, from_user_id, to_user_id, created_at)
+            VALUES ($1, $2, $3, $4, now())
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(self.id.clone())
+        .bind(user_id.clone())
+        .bind(to_user_id.clone())
+        .fetch_one(&mut *tx)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[Mnstr::transfer_to] Failed to record transfer: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let transfer = MnstrTransfer::from_row(&row)?;
+
+        OwnershipEvent::new(
+            self.id.clone(),
+            OwnershipEventType::Gifted,
+            Some(user_id),
+            Some(to_user_id),
+        )
+        .record(&mut tx)
+        .await?;
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::transfer_to] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        *self = mnstr;
+        Ok(transfer)
+    }
+
+    pub async fn delete_permanent(&mut self) -> Option<anyhow::Error> {
+        if let Some(error) = MnstrEdit::delete_permanent_by_mnstr_id(self.id.clone()).await {
+            return Some(error);
+        }
+        if let Some(error) = MnstrTransfer::delete_permanent_by_mnstr_id(self.id.clone()).await {
+            return Some(error);
+        }
+        if let Some(error) = MnstrEvolution::delete_permanent_by_mnstr_id(self.id.clone()).await {
+            return Some(error);
+        }
+        if let Some(error) = OwnershipEvent::delete_permanent_by_mnstr_id(self.id.clone()).await {
+            return Some(error);
+        }
+        if let Some(error) = MnstrTag::delete_permanent_by_mnstr_id(self.id.clone()).await {
+            return Some(error);
+        }
+        match delete_resource_where_fields!(Mnstr, vec![("id", self.id.clone().into())], true).await
+        {
+            Ok(_) => (),
+            Err(e) => return Some(e.into()),
+        };
+        None
+    }
+
+    pub async fn find_one(id: String, get_relationships: bool) -> Result<Self, anyhow::Error> {
         let mut mnstr =
             match find_one_resource_where_fields!(Mnstr, vec![("id", id.clone().into())]).await {
                 Ok(mnstr) => mnstr,
@@ -606,7 +2108,10 @@ impl Mnstr {
             }
         }
 
-        mnstr.update_experience_to_next_level();
+        if let Err(e) = Mnstr::load_tags(std::slice::from_mut(&mut mnstr)).await {
+            println!("[Mnstr::find_one] Failed to get tags: {:?}", e);
+            return Err(e);
+        }
 
         if get_relationships {
             if let Some(error) = mnstr.get_relationships().await {
@@ -617,6 +2122,23 @@ impl Mnstr {
         Ok(mnstr)
     }
 
+    /// The mnstr with `id` if `user_id` owns it. Missing mnstrs and other
+    /// users' mnstrs both fail with `MNSTR_NOT_OWNED`.
+    pub async fn find_owned(id: String, user_id: &str) -> Result<Self, anyhow::Error> {
+        let mnstr = match Mnstr::find_one(id, false).await {
+            Ok(mnstr) => mnstr,
+            Err(e) => {
+                if let Some(sqlx::Error::RowNotFound) = e.downcast_ref::<sqlx::Error>() {
+                    return Err(anyhow::Error::msg(MNSTR_NOT_OWNED));
+                }
+                println!("[Mnstr::find_owned] Failed to get mnstr: {:?}", e);
+                return Err(e);
+            }
+        };
+        check_ownership(&mnstr, user_id)?;
+        Ok(mnstr)
+    }
+
     pub async fn find_one_by(
         params: Vec<(&str, DatabaseValue)>,
         get_relationships: bool,
@@ -638,6 +2160,49 @@ impl Mnstr {
         Ok(mnstr)
     }
 
+    /// Looks up a mnstr by QR code for `user_id`. Only the user's own mnstr is
+    /// found unless `include_others` is set, in which case another user's
+    /// mnstr with the code is returned without its name or description.
+    pub async fn find_one_by_qr_code(
+        user_id: String,
+        mnstr_qr_code: String,
+        include_others: bool,
+    ) -> Result<Self, anyhow::Error> {
+        if !include_others {
+            return Mnstr::find_one_by(
+                vec![
+                    ("user_id", user_id.into()),
+                    ("mnstr_qr_code", mnstr_qr_code.into()),
+                ],
+                false,
+            )
+            .await;
+        }
+
+        let pool = get_connection().await;
+        let mnstr = match sqlx::query(
+            "SELECT * FROM mnstrs WHERE mnstr_qr_code = $1 AND archived_at IS NULL ORDER BY (user_id = $2) DESC, created_at ASC LIMIT 1",
+        )
+        .bind(mnstr_qr_code)
+        .bind(user_id.clone())
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => Mnstr::from_row(&row)?,
+            Err(e) => {
+                println!(
+                    "[Mnstr::find_one_by_qr_code] Failed to get mnstr: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        match mnstr.visible_to(&user_id, include_others) {
+            Some(mnstr) => Ok(mnstr),
+            None => Err(anyhow::Error::msg("Mnstr not found")),
+        }
+    }
+
     pub async fn find_all(
         get_relationships: bool,
         order_by: Option<MnstrOrderBy>,
@@ -668,8 +2233,6 @@ impl Mnstr {
                 }
             }
 
-            mnstr.update_experience_to_next_level();
-
             if get_relationships {
                 if let Some(error) = mnstr.get_relationships().await {
                     println!("[Mnstr::find_all] Failed to get relationships: {:?}", error);
@@ -711,8 +2274,6 @@ impl Mnstr {
                 }
             }
 
-            mnstr.update_experience_to_next_level();
-
             if get_relationships {
                 if let Some(error) = mnstr.get_relationships().await {
                     println!(
@@ -726,149 +2287,2572 @@ impl Mnstr {
         Ok(mnstrs)
     }
 
-    pub fn coins(&self) -> i32 {
-        let hash = sha2::Sha256::digest(self.mnstr_qr_code.as_bytes());
-        let coins_byte = hash[(hash.len() - 1) / 2];
-        let multiplier_hash_byte = hash[((hash.len() - 1) / 2) + 1];
+    pub async fn find_all_by_user_id(
+        user_id: String,
+        filter: MnstrFilter,
+        order_by: Option<MnstrOrderBy>,
+        order_direction: Option<MnstrOrderDirection>,
+    ) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
 
-        let mut coins = coins_byte as i32;
-        if coins <= 0 {
-            coins = 5;
-        }
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let values = filter.push_conditions(&mut query, 1);
+        query.push_str(&order_clause(order_by, order_direction));
 
-        let mut multiplier = multiplier_hash_byte as i32;
-        if multiplier <= 0 {
-            multiplier = 10;
+        let mut query = sqlx::query(sqlx::AssertSqlSafe(query)).bind(user_id);
+        for value in values.iter() {
+            query = match value {
+                MnstrFilterValue::Bool(value) => query.bind(*value),
+                MnstrFilterValue::Int(value) => query.bind(*value),
+                MnstrFilterValue::Text(value) => query.bind(value.clone()),
+                MnstrFilterValue::Timestamp(value) => query.bind(*value),
+            };
         }
 
-        if multiplier >= 251 {
-            coins = (coins * (multiplier / 100)) + 1000;
-            if coins > 2000 {
-                coins = 2000;
+        let mut mnstrs = match query.fetch_all(&pool).await {
+            Ok(rows) => Mnstr::from_readable_rows(&rows),
+            Err(e) => {
+                println!("[Mnstr::find_all_by_user_id] Failed to get mnstrs: {:?}", e);
+                return Err(e.into());
             }
-        } else if multiplier >= 242 {
-            coins = (coins * (multiplier / 100)) + 400;
-            if coins > 750 {
-                coins = 750;
+        };
+        for mnstr in mnstrs.iter_mut() {
+            if mnstr.max_health == 0 {
+                if let Some(error) = mnstr.update_with_defaults().await {
+                    println!(
+                        "[Mnstr::find_all_by_user_id] Failed to update with defaults: {:?}",
+                        error
+                    );
+                    return Err(error.into());
+                }
             }
-        } else if multiplier >= 216 {
-            coins = (coins * (multiplier / 100)) + 150;
-            if coins > 400 {
-                coins = 400;
+        }
+        if let Err(e) = Mnstr::load_tags(&mut mnstrs).await {
+            println!("[Mnstr::find_all_by_user_id] Failed to get tags: {:?}", e);
+            return Err(e);
+        }
+        Ok(mnstrs)
+    }
+
+    /// The user's most recently collected mnstr that is still theirs, if any.
+    pub async fn find_most_recent_by_user_id(user_id: String) -> Result<Option<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND archived_at IS NULL
+            ORDER BY created_at DESC, id DESC LIMIT 1",
+        )
+        .bind(user_id)
+        .fetch_optional(&pool)
+        .await
+        {
+            Ok(Some(row)) => {
+                Ok(Some(Mnstr::from_row(&row)?))
             }
-        } else {
-            if multiplier >= 85 {
-                coins = coins * (multiplier / 100);
+            Ok(None) => Ok(None),
+            Err(e) => {
+                println!(
+                    "[Mnstr::find_most_recent_by_user_id] Failed to get mnstr: {:?}",
+                    e
+                );
+                Err(e.into())
             }
-            if coins > 25 {
-                coins = coins / 10;
+        }
+    }
+
+    /// One page of the user's mnstrs, oldest first, starting after the
+    /// `after` cursor. Keyed on `(created_at, id)` so mnstrs collected while
+    /// scrolling never shift a page the way an offset would.
+    pub async fn find_page_by_user_id(
+        user_id: String,
+        filter: MnstrFilter,
+        after: Option<Cursor>,
+        limit: i64,
+    ) -> Result<MnstrPage, anyhow::Error> {
+        let pool = get_connection().await;
+
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let mut values = filter.push_conditions(&mut query, 1);
+        if let Some(after) = after {
+            values.push(MnstrFilterValue::Timestamp(after.created_at));
+            values.push(MnstrFilterValue::Text(after.id));
+            query.push_str(&format!(
+                " AND (created_at, id) > (${}, ${})",
+                values.len(),
+                values.len() + 1
+            ));
+        }
+        query.push_str(&format!(
+            " ORDER BY created_at ASC, id ASC LIMIT ${}",
+            values.len() + 2
+        ));
+
+        let mut query = sqlx::query(sqlx::AssertSqlSafe(query)).bind(user_id);
+        for value in values.iter() {
+            query = match value {
+                MnstrFilterValue::Bool(value) => query.bind(*value),
+                MnstrFilterValue::Int(value) => query.bind(*value),
+                MnstrFilterValue::Text(value) => query.bind(value.clone()),
+                MnstrFilterValue::Timestamp(value) => query.bind(*value),
+            };
+        }
+        let rows = match query.bind(limit + 1).fetch_all(&pool).await {
+            Ok(rows) => Mnstr::from_readable_rows(&rows),
+            Err(e) => {
+                println!("[Mnstr::find_page_by_user_id] Failed to get mnstrs: {:?}", e);
+                return Err(e.into());
             }
+        };
+
+        let (mut mnstrs, next_cursor) = next_page(rows, limit, |mnstr: &Mnstr| {
+            mnstr
+                .created_at
+                .map(|created_at| Cursor::new(created_at, mnstr.id.clone()))
+        });
+        if let Err(e) = Mnstr::load_tags(&mut mnstrs).await {
+            println!("[Mnstr::find_page_by_user_id] Failed to get tags: {:?}", e);
+            return Err(e);
         }
+        Ok(MnstrPage {
+            mnstrs,
+            next_cursor,
+        })
+    }
 
-        if coins < 5 {
-            coins = 5;
+    /// The ETag of `user_id`'s mnstrs as listed by
+    /// [`Mnstr::find_all_by_user_id`] with this filter and ordering.
+    pub async fn collection_etag(
+        user_id: String,
+        filter: &MnstrFilter,
+        order_by: Option<MnstrOrderBy>,
+        order_direction: Option<MnstrOrderDirection>,
+    ) -> Result<String, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT COUNT(*)::int8 AS count, MAX(updated_at) AS last_updated_at FROM mnstrs WHERE user_id = $1",
+        )
+        .bind(user_id)
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => Ok(collection_etag(
+                row.get("count"),
+                row.get("last_updated_at"),
+                &format!("{:?} {:?} {:?}", filter, order_by, order_direction),
+            )),
+            Err(e) => {
+                println!("[Mnstr::collection_etag] Failed to get etag: {:?}", e);
+                Err(e.into())
+            }
         }
+    }
+
+    /// Finds the user's mnstrs whose name or description contains `query`,
+    /// ignoring case. Name prefix matches rank first, then other name matches,
+    /// then description matches, newest first within each group.
+    pub async fn search_by_user_id(
+        user_id: String,
+        query: String,
+        limit: Option<i64>,
+        offset: Option<i64>,
+    ) -> Result<Vec<Self>, anyhow::Error> {
+        let (contains, prefix) = search_patterns(&query);
+        let (limit, offset) = search_bounds(limit, offset);
 
-        coins
+        let pool = get_connection().await;
+        let mnstrs = match sqlx::query(
+            r"SELECT * FROM mnstrs
+            WHERE user_id = $1 AND archived_at IS NULL
+            AND (mnstr_name ILIKE $2 ESCAPE '\' OR mnstr_description ILIKE $2 ESCAPE '\')
+            ORDER BY
+                CASE
+                    WHEN mnstr_name ILIKE $3 ESCAPE '\' THEN 0
+                    WHEN mnstr_name ILIKE $2 ESCAPE '\' THEN 1
+                    ELSE 2
+                END,
+                created_at DESC
+            LIMIT $4 OFFSET $5",
+        )
+        .bind(user_id)
+        .bind(contains)
+        .bind(prefix)
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Mnstr::from_readable_rows(&rows),
+            Err(e) => {
+                println!("[Mnstr::search_by_user_id] Failed to search mnstrs: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        Ok(mnstrs)
     }
 
-    pub async fn get_relationships(&mut self) -> Option<Error> {
-        None
+    /// The user's live mnstrs that share a QR code with another of their
+    /// mnstrs, grouped by code with the oldest catch first.
+    pub async fn find_duplicates_by_user_id(
+        user_id: String,
+    ) -> Result<Vec<MnstrDuplicateGroup>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM mnstrs
+            WHERE user_id = $1 AND archived_at IS NULL AND mnstr_qr_code IN (
+                SELECT mnstr_qr_code FROM mnstrs
+                WHERE user_id = $1 AND archived_at IS NULL
+                GROUP BY mnstr_qr_code HAVING count(*) > 1
+            )
+            ORDER BY mnstr_qr_code ASC, created_at ASC, id ASC",
+        )
+        .bind(user_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(duplicate_groups(Mnstr::from_readable_rows(&rows))),
+            Err(e) => {
+                println!(
+                    "[Mnstr::find_duplicates_by_user_id] Failed to get mnstrs: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
     }
 
-    pub fn update_experience_to_next_level(&mut self) {
-        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
-        let mut xp_to_next_level = XP_FOR_LEVEL[last_level_index as usize];
-        if self.current_level < last_level_index {
-            xp_to_next_level = XP_FOR_LEVEL[self.current_level as usize + 1];
+    /// Live QR codes held by at least `threshold` different users, most
+    /// widely owned first.
+    pub async fn detect_qr_collisions(threshold: i64) -> Result<Vec<QrCollision>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT mnstr_qr_code, count(DISTINCT user_id) AS owner_count, count(*) AS mnstr_count
+            FROM mnstrs
+            WHERE archived_at IS NULL
+            GROUP BY mnstr_qr_code
+            HAVING count(DISTINCT user_id) >= $1
+            ORDER BY owner_count DESC, mnstr_qr_code ASC",
+        )
+        .bind(threshold)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(|row| {
+                    Ok(QrCollision {
+                        mnstr_qr_code: row.try_get("mnstr_qr_code")?,
+                        owner_count: row.try_get("owner_count")?,
+                        mnstr_count: row.try_get("mnstr_count")?,
+                    })
+                })
+                .collect::<Result<Vec<QrCollision>, Error>>()?),
+            Err(e) => {
+                println!("[Mnstr::detect_qr_collisions] Failed to count owners: {:?}", e);
+                Err(e.into())
+            }
         }
-        self.experience_to_next_level = xp_to_next_level;
     }
 
-    pub async fn update_xp(&mut self, xp: i32) -> Option<anyhow::Error> {
-        self.current_experience += xp;
+    /// Refreshes the stored rarity and coin value of every mnstr after
+    /// `rarity_for_qr_code` or `coins_for_qr_code` changes. Mnstrs are read
+    /// `page_size` at a time in id order, each page in its own transaction.
+    pub async fn recompute_all_derived_values(
+        page_size: i64,
+    ) -> Result<MnstrRecompute, anyhow::Error> {
+        let page_size = page_size.max(1);
+        let mut recompute = MnstrRecompute::default();
+        let mut after_id = String::new();
+        loop {
+            let page = with_tx(move |conn| {
+                Box::pin(async move {
+                    let rows = sqlx::query(
+                        "SELECT * FROM mnstrs WHERE id > $1 ORDER BY id ASC LIMIT $2 FOR UPDATE",
+                    )
+                    .bind(after_id)
+                    .bind(page_size)
+                    .fetch_all(&mut *conn)
+                    .await?;
+                    let mut mnstrs = Mnstr::from_rows(&rows)?;
 
-        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
-        let mut xp_to_next_level = XP_FOR_LEVEL[last_level_index as usize];
-        if self.current_level < last_level_index {
-            xp_to_next_level = XP_FOR_LEVEL[self.current_level as usize + 1];
+                    let mut updated = 0;
+                    for mnstr in mnstrs.iter_mut() {
+                        if !mnstr.refresh_derived_values() {
+                            continue;
+                        }
+                        sqlx::query(
+                            "UPDATE mnstrs SET rarity = $1, coin_value = $2, version = version + 1, updated_at = now()
+                            WHERE id = $3",
+                        )
+                        .bind(mnstr.rarity.clone())
+                        .bind(mnstr.coin_value)
+                        .bind(mnstr.id.clone())
+                        .execute(&mut *conn)
+                        .await?;
+                        updated += 1;
+                    }
+                    let last_id = mnstrs.last().map(|mnstr| mnstr.id.clone());
+                    Ok((last_id, mnstrs.len() as i64, updated))
+                })
+            })
+            .await;
+            let (last_id, scanned, updated) = match page {
+                Ok(page) => page,
+                Err(e) => {
+                    println!(
+                        "[Mnstr::recompute_all_derived_values] Failed to refresh mnstrs: {:?}",
+                        e
+                    );
+                    return Err(e);
+                }
+            };
+
+            recompute.scanned += scanned;
+            recompute.updated += updated;
+            match last_id {
+                Some(last_id) if scanned == page_size => after_id = last_id,
+                _ => return Ok(recompute),
+            }
+        }
+    }
+
+    /// Whether `user_id` has ever had a mnstr, checked in the caller's
+    /// transaction with the user's row locked, so concurrent first collects
+    /// cannot both decide they are collecting the seed.
+    async fn lock_has_any(conn: &mut PgConnection, user_id: &str) -> Result<bool, anyhow::Error> {
+        if let Err(e) = sqlx::query("SELECT id FROM users WHERE id = $1 FOR UPDATE")
+            .bind(user_id)
+            .fetch_one(&mut *conn)
+            .await
+        {
+            println!("[Mnstr::lock_has_any] Failed to lock user: {:?}", e);
+            return Err(e.into());
+        }
+        match sqlx::query("SELECT EXISTS (SELECT 1 FROM mnstrs WHERE user_id = $1) AS has_any")
+            .bind(user_id)
+            .fetch_one(&mut *conn)
+            .await
+        {
+            Ok(row) => Ok(row.get("has_any")),
+            Err(e) => {
+                println!("[Mnstr::lock_has_any] Failed to check mnstrs: {:?}", e);
+                Err(e.into())
+            }
         }
-        let xp_overage = self.current_experience - xp_to_next_level;
+    }
+
+    /// Whether the mnstr belongs to `user_id` and has not been archived.
+    pub fn is_owned_by(&self, user_id: &str) -> bool {
+        self.user_id == user_id && self.archived_at.is_none()
+    }
+
+    /// Permanently deletes every mnstr archived at or before `older_than`,
+    /// along with its tags and its edit, transfer, evolution and ownership
+    /// history, and returns how many were removed. Mnstrs still named by a trade, pending
+    /// or not, or by a battle are kept so those records stay intact.
+    pub async fn purge_archived(older_than: OffsetDateTime) -> Result<u64, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::purge_archived] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
 
-        let mut remaining_overage = xp_overage;
-        while remaining_overage >= 0 {
-            self.current_experience = remaining_overage;
-            self.current_level += 1;
-            xp_to_next_level = XP_FOR_LEVEL[self.current_level as usize + 1];
-            remaining_overage -= xp_to_next_level;
+        let ids: Vec<String> = match sqlx::query(
+            "SELECT id FROM mnstrs
+            WHERE archived_at <= $1
+                AND NOT EXISTS (
+                    SELECT 1 FROM trades
+                    WHERE trades.offerer_mnstr_id = mnstrs.id OR trades.requested_mnstr_id = mnstrs.id
+                )
+                AND NOT EXISTS (
+                    SELECT 1 FROM battles
+                    WHERE mnstrs.id IN (battles.challenger_mnstr_id, battles.opponent_mnstr_id, battles.winner_mnstr_id)
+                )
+            FOR UPDATE",
+        )
+        .bind(older_than)
+        .fetch_all(&mut *tx)
+        .await
+        {
+            Ok(rows) => rows.iter().map(|row| row.get("id")).collect(),
+            Err(e) => {
+                println!("[Mnstr::purge_archived] Failed to get mnstrs: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        if ids.is_empty() {
+            return Ok(0);
+        }
 
-            xp_to_next_level = XP_FOR_LEVEL[self.current_level as usize + 1];
-            if remaining_overage < 0 {
-                self.current_experience = 0;
+        for query in [
+            "DELETE FROM mnstr_edits WHERE mnstr_id = ANY($1)",
+            "DELETE FROM mnstr_transfers WHERE mnstr_id = ANY($1)",
+            "DELETE FROM mnstr_evolutions WHERE mnstr_id = ANY($1) OR fodder_mnstr_id = ANY($1)",
+            "DELETE FROM ownership_events WHERE mnstr_id = ANY($1)",
+            "DELETE FROM mnstr_tags WHERE mnstr_id = ANY($1)",
+            "DELETE FROM mnstr_user_items WHERE mnstr_id = ANY($1)",
+        ] {
+            if let Err(e) = sqlx::query(query).bind(&ids).execute(&mut *tx).await {
+                println!("[Mnstr::purge_archived] Failed to delete history: {:?}", e);
+                return Err(e.into());
             }
         }
 
-        self.experience_to_next_level = xp_to_next_level;
+        let purged = match sqlx::query("DELETE FROM mnstrs WHERE id = ANY($1)")
+            .bind(&ids)
+            .execute(&mut *tx)
+            .await
+        {
+            Ok(result) => result.rows_affected(),
+            Err(e) => {
+                println!("[Mnstr::purge_archived] Failed to delete mnstrs: {:?}", e);
+                return Err(e.into());
+            }
+        };
 
-        if let Some(error) = self.update().await {
-            println!("[Mnstr::update_xp] Failed to update mnstr xp: {:?}", error);
-            return Some(error.into());
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::purge_archived] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
         }
-        None
+        Ok(purged)
     }
-}
 
-impl DatabaseResource for Mnstr {
-    fn from_row(row: &PgRow) -> Result<Self, Error> {
-        let created_at = row.get("created_at");
-        let updated_at = row.get("updated_at");
-        let archived_at = match row.get("archived_at") {
-            Some(archived_at) => archived_at,
-            None => None,
-        };
+    /// What `user_id` may see of this mnstr. Owners see all of it; anyone else
+    /// sees nothing, or with `include_others` the mnstr minus its owner, name
+    /// and description.
+    pub fn visible_to(mut self, user_id: &str, include_others: bool) -> Option<Mnstr> {
+        if self.user_id == user_id {
+            return Some(self);
+        }
+        if !include_others {
+            return None;
+        }
+        self.user_id = String::new();
+        self.mnstr_name = String::new();
+        self.mnstr_description = String::new();
+        Some(self)
+    }
 
-        Ok(Mnstr {
-            id: row.get("id"),
-            user_id: row.get("user_id"),
-            mnstr_name: row.get("mnstr_name"),
-            mnstr_description: row.get("mnstr_description"),
-            mnstr_qr_code: row.get("mnstr_qr_code"),
-            created_at,
-            updated_at,
-            archived_at,
-            current_level: row.get("current_level"),
-            current_experience: row.get("current_experience"),
-            current_health: row.get("current_health"),
-            max_health: row.get("max_health"),
-            current_attack: row.get("current_attack"),
-            max_attack: row.get("max_attack"),
-            current_defense: row.get("current_defense"),
-            max_defense: row.get("max_defense"),
-            current_speed: row.get("current_speed"),
-            max_speed: row.get("max_speed"),
-            current_intelligence: row.get("current_intelligence"),
-            max_intelligence: row.get("max_intelligence"),
-            current_magic: row.get("current_magic"),
-            max_magic: row.get("max_magic"),
-            experience_to_next_level: 0,
-        })
+    /// Coins awarded for collecting this mnstr, cached by QR code.
+    pub fn coins(&self) -> i32 {
+        match COINS_CACHE.lock() {
+            Ok(mut cache) => cache.get_or_insert_with(
+                self.mnstr_qr_code.clone(),
+                COINS_FORMULA_VERSION,
+                || coins_for_qr_code(&self.mnstr_qr_code),
+            ),
+            Err(_) => coins_for_qr_code(&self.mnstr_qr_code),
+        }
     }
-    fn has_id() -> bool {
+
+    /// Rewrites the rarity and coin value from the QR code with the current
+    /// formulas, returning whether either had gone stale.
+    pub fn refresh_derived_values(&mut self) -> bool {
+        let rarity = rarity_for_qr_code(&self.mnstr_qr_code);
+        let coin_value = coins_for_qr_code(&self.mnstr_qr_code);
+        if self.rarity == rarity && self.coin_value == coin_value {
+            return false;
+        }
+        self.rarity = rarity;
+        self.coin_value = coin_value;
         true
     }
-    fn is_archivable() -> bool {
-        true
+
+    pub fn preview(mnstr_qr_code: String) -> MnstrPreview {
+        let mnstr = Mnstr::new("".to_string(), None, None, mnstr_qr_code);
+        MnstrPreview {
+            coins: mnstr.coins(),
+            mnstr_qr_code: mnstr.mnstr_qr_code,
+        }
     }
-    fn is_updatable() -> bool {
-        true
+
+    pub async fn get_relationships(&mut self) -> Option<Error> {
+        None
     }
-    fn is_creatable() -> bool {
-        true
+
+    /// Reads every row with `from_row`, failing on the first one that cannot
+    /// be read. Anything that writes based on what it read uses this, since
+    /// quietly missing a row there could double-collect a QR code or let a
+    /// duplicate name through.
+    pub fn from_rows(rows: &[PgRow]) -> Result<Vec<Self>, Error> {
+        rows.iter().map(Mnstr::from_row).collect()
     }
-    fn is_expirable() -> bool {
-        false
+
+    /// Reads every row that can be read, logging and leaving out the rest.
+    /// Listings shown to players use this so one damaged row does not hide
+    /// the whole collection.
+    pub fn from_readable_rows(rows: &[PgRow]) -> Vec<Self> {
+        skip_unreadable(rows.iter().map(Mnstr::from_row).collect())
     }
-    fn is_verifiable() -> bool {
-        false
+
+    pub fn update_experience_to_next_level(&mut self) {
+        self.experience_to_next_level = xp_to_next_level(&XP_FOR_LEVEL, self.current_level);
+    }
+
+    /// Awards `xp` to the mnstr, locking its row so concurrent awards all
+    /// count.
+    pub async fn update_xp(&mut self, xp: i32) -> Option<anyhow::Error> {
+        let xp = apply_xp_multiplier(xp);
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::update_xp] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+
+        let (current_level, current_experience): (i32, i32) = match sqlx::query(
+            "SELECT current_level, current_experience FROM mnstrs WHERE id = $1 FOR UPDATE",
+        )
+        .bind(self.id.clone())
+        .fetch_one(&mut *tx)
+        .await
+        {
+            Ok(row) => (row.get("current_level"), row.get("current_experience")),
+            Err(e) => {
+                println!("[Mnstr::update_xp] Failed to lock mnstr: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        let (current_level, current_experience) =
+            apply_xp(&XP_FOR_LEVEL, current_level, current_experience, xp);
+
+        if let Err(e) = sqlx::query(
+            "UPDATE mnstrs SET current_level = $1, current_experience = $2, version = version + 1,
+                updated_at = now()
+            WHERE id = $3",
+        )
+        .bind(current_level)
+        .bind(current_experience)
+        .bind(self.id.clone())
+        .execute(&mut *tx)
+        .await
+        {
+            println!("[Mnstr::update_xp] Failed to update mnstr xp: {:?}", e);
+            return Some(e.into());
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::update_xp] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+
+        self.current_level = current_level;
+        self.current_experience = current_experience;
+        self.update_experience_to_next_level();
+        None
+    }
+
+    /// Raises the mnstr one level: every max stat grows, current stats are
+    /// restored to their max and experience starts over.
+    pub fn apply_level_up(&mut self) -> Result<(), anyhow::Error> {
+        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+        if self.current_level >= last_level_index {
+            return Err(anyhow::Error::msg("Mnstr is already at max level"));
+        }
+        self.current_level += 1;
+        self.current_experience = 0;
+        self.max_health += LEVEL_UP_STAT_GAIN;
+        self.max_attack += LEVEL_UP_STAT_GAIN;
+        self.max_defense += LEVEL_UP_STAT_GAIN;
+        self.max_speed += LEVEL_UP_STAT_GAIN;
+        self.max_intelligence += LEVEL_UP_STAT_GAIN;
+        self.max_magic += LEVEL_UP_STAT_GAIN;
+        self.current_health = self.max_health;
+        self.current_attack = self.max_attack;
+        self.current_defense = self.max_defense;
+        self.current_speed = self.max_speed;
+        self.current_intelligence = self.max_intelligence;
+        self.current_magic = self.max_magic;
+        self.update_experience_to_next_level();
+        Ok(())
+    }
+
+    /// Spends `user`'s coins to level the mnstr up. The debit and the level
+    /// change commit together, and the update only applies if the mnstr is
+    /// still `user`'s and at the level the cost was computed for.
+    pub async fn level_up(&mut self, user: &mut User) -> Option<anyhow::Error> {
+        if let Err(e) = check_ownership(self, &user.id) {
+            return Some(e);
+        }
+        let cost = level_up_cost(self.current_level);
+        let mut leveled = self.clone();
+        if let Err(e) = leveled.apply_level_up() {
+            return Some(e);
+        }
+
+        if let Some(error) = user.get_wallet().await {
+            println!("[Mnstr::level_up] Failed to get wallet: {:?}", error);
+            return Some(error.into());
+        }
+        let wallet_id = match &user.wallet {
+            Some(wallet) => wallet.id.clone(),
+            None => return Some(anyhow::Error::msg("Wallet not found")),
+        };
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::level_up] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        if let Err(e) = Wallet::debit(
+            &mut tx,
+            wallet_id,
+            cost,
+            Some(level_up_transaction_data(&self.id)),
+        )
+        .await
+        {
+            return Some(e);
+        }
+
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET
+                current_level = $1, current_experience = $2,
+                current_health = $3, max_health = $4,
+                current_attack = $5, max_attack = $6,
+                current_defense = $7, max_defense = $8,
+                current_speed = $9, max_speed = $10,
+                current_intelligence = $11, max_intelligence = $12,
+                current_magic = $13, max_magic = $14,
+                version = version + 1, updated_at = now()
+            WHERE id = $15 AND current_level = $16 AND user_id = $17 AND archived_at IS NULL
+            RETURNING *",
+        )
+        .bind(leveled.current_level)
+        .bind(leveled.current_experience)
+        .bind(leveled.current_health)
+        .bind(leveled.max_health)
+        .bind(leveled.current_attack)
+        .bind(leveled.max_attack)
+        .bind(leveled.current_defense)
+        .bind(leveled.max_defense)
+        .bind(leveled.current_speed)
+        .bind(leveled.max_speed)
+        .bind(leveled.current_intelligence)
+        .bind(leveled.max_intelligence)
+        .bind(leveled.current_magic)
+        .bind(leveled.max_magic)
+        .bind(self.id.clone())
+        .bind(self.current_level)
+        .bind(user.id.clone())
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(row)) => row,
+            // No row was updated: the mnstr was levelled, given away or
+            // archived since it was read, and the debit rolls back.
+            Ok(None) => return Some(anyhow::Error::msg("Mnstr level changed, try again")),
+            Err(e) => {
+                println!("[Mnstr::level_up] Failed to update mnstr: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        let mnstr = match Mnstr::from_row(&row) {
+            Ok(mnstr) => mnstr,
+            Err(e) => return Some(e.into()),
+        };
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::level_up] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+        *self = mnstr;
+
+        if let Some(error) = user.get_coins().await {
+            println!("[Mnstr::level_up] Failed to get coins: {:?}", error);
+            return Some(error);
+        }
+        None
+    }
+
+    /// Archives the mnstr and refunds `user` part of its coins. The archive
+    /// and the credit commit together, and the archive only applies if the
+    /// mnstr is still the user's, unarchived and not their seed mnstr.
+    pub async fn release(&mut self, user: &mut User) -> Result<i32, anyhow::Error> {
+        validate_release(self, &user.id)?;
+
+        if let Some(error) = user.get_wallet().await {
+            println!("[Mnstr::release] Failed to get wallet: {:?}", error);
+            return Err(error);
+        }
+        let wallet_id = match &user.wallet {
+            Some(wallet) => wallet.id.clone(),
+            None => return Err(anyhow::Error::msg("Wallet not found")),
+        };
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::release] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET archived_at = now(), version = version + 1, updated_at = now()
+            WHERE id = $1 AND user_id = $2 AND archived_at IS NULL AND NOT is_seed
+            RETURNING *",
+        )
+        .bind(self.id.clone())
+        .bind(user.id.clone())
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(row)) => row,
+            Ok(None) => return Err(anyhow::Error::msg("Mnstr not found")),
+            Err(e) => {
+                println!("[Mnstr::release] Failed to archive mnstr: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let mnstr = Mnstr::from_row(&row)?;
+        let refund = release_refund(mnstr.coin_value);
+
+        OwnershipEvent::new(
+            self.id.clone(),
+            OwnershipEventType::Released,
+            Some(user.id.clone()),
+            None,
+        )
+        .record(&mut tx)
+        .await?;
+
+        Wallet::credit(
+            &mut tx,
+            wallet_id,
+            refund,
+            Some(release_transaction_data(&self.id)),
+        )
+        .await?;
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::release] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        *self = mnstr;
+
+        if let Some(error) = user.get_coins().await {
+            println!("[Mnstr::release] Failed to get coins: {:?}", error);
+        }
+        Ok(refund)
+    }
+
+    /// Evolves the mnstr one level by absorbing `fodder`, a duplicate from
+    /// the same QR code. Archiving the fodder, levelling the mnstr and the
+    /// evolution record commit together, and each update only applies if
+    /// nothing changed underneath it.
+    pub async fn evolve(
+        &mut self,
+        fodder: &Mnstr,
+        user_id: String,
+    ) -> Result<MnstrEvolution, anyhow::Error> {
+        validate_evolution(self, fodder, &user_id)?;
+        let mut evolved = self.clone();
+        evolved.apply_level_up()?;
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Mnstr::evolve] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        match sqlx::query(
+            "UPDATE mnstrs SET archived_at = now(), version = version + 1, updated_at = now()
+            WHERE id = $1 AND user_id = $2 AND mnstr_qr_code = $3
+                AND archived_at IS NULL AND NOT is_seed
+            RETURNING id",
+        )
+        .bind(fodder.id.clone())
+        .bind(user_id.clone())
+        .bind(self.mnstr_qr_code.clone())
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(_)) => (),
+            Ok(None) => return Err(anyhow::Error::msg("Mnstr not found")),
+            Err(e) => {
+                println!("[Mnstr::evolve] Failed to archive fodder mnstr: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let row = match sqlx::query(
+            "UPDATE mnstrs SET
+                current_level = $1, current_experience = $2,
+                current_health = $3, max_health = $4,
+                current_attack = $5, max_attack = $6,
+                current_defense = $7, max_defense = $8,
+                current_speed = $9, max_speed = $10,
+                current_intelligence = $11, max_intelligence = $12,
+                current_magic = $13, max_magic = $14,
+                version = version + 1, updated_at = now()
+            WHERE id = $15 AND user_id = $16 AND current_level = $17 AND archived_at IS NULL
+            RETURNING *",
+        )
+        .bind(evolved.current_level)
+        .bind(evolved.current_experience)
+        .bind(evolved.current_health)
+        .bind(evolved.max_health)
+        .bind(evolved.current_attack)
+        .bind(evolved.max_attack)
+        .bind(evolved.current_defense)
+        .bind(evolved.max_defense)
+        .bind(evolved.current_speed)
+        .bind(evolved.max_speed)
+        .bind(evolved.current_intelligence)
+        .bind(evolved.max_intelligence)
+        .bind(evolved.current_magic)
+        .bind(evolved.max_magic)
+        .bind(self.id.clone())
+        .bind(user_id.clone())
+        .bind(self.current_level)
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(row)) => row,
+            Ok(None) => return Err(anyhow::Error::msg("Mnstr level changed, try again")),
+            Err(e) => {
+                println!("[Mnstr::evolve] Failed to update mnstr: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let mnstr = Mnstr::from_row(&row)?;
+
+        let row = match sqlx::query(
+            "INSERT INTO mnstr_evolutions
+                (id, user_id, mnstr_id, fodder_mnstr_id, from_level, to_level, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, now())
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user_id)
+        .bind(self.id.clone())
+        .bind(fodder.id.clone())
+        .bind(self.current_level)
+        .bind(mnstr.current_level)
+        .fetch_one(&mut *tx)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[Mnstr::evolve] Failed to record evolution: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let evolution = MnstrEvolution::from_row(&row)?;
+
+        if let Err(e) = tx.commit().await {
+            println!("[Mnstr::evolve] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        *self = mnstr;
+        Ok(evolution)
+    }
+}
+
+/// Checks that `user_id` may release `mnstr`. A user's seed mnstr is their
+/// starter and stays with them.
+pub fn validate_release(mnstr: &Mnstr, user_id: &str) -> Result<(), anyhow::Error> {
+    if mnstr.user_id != user_id {
+        return Err(anyhow::Error::msg("Mnstr not found"));
+    }
+    if mnstr.archived_at.is_some() {
+        return Err(anyhow::Error::msg("Mnstr has already been released"));
+    }
+    if mnstr.is_seed {
+        return Err(anyhow::Error::msg("Starter mnstrs cannot be released"));
+    }
+    Ok(())
+}
+
+/// Coins refunded for releasing a mnstr worth `coins`, never less than 1.
+pub fn release_refund(coins: i32) -> i32 {
+    (coins.max(0) * RELEASE_REFUND_PERCENT / 100).max(1)
+}
+
+/// Coins to level a mnstr up from `current_level` to the next level.
+pub fn level_up_cost(current_level: i32) -> i32 {
+    LEVEL_UP_BASE_COST * (current_level.max(0) + 1)
+}
+
+/// Checks an edit made against `expected` still applies to a mnstr at
+/// `current`.
+pub fn check_version(expected: i32, current: i32) -> Result<(), anyhow::Error> {
+    if expected != current {
+        return Err(anyhow::Error::msg(MNSTR_VERSION_CONFLICT));
+    }
+    Ok(())
+}
+
+/// Checks that `user_id` owns `mnstr` and it has not been archived. Every
+/// change to a mnstr on behalf of a user goes through this first.
+pub fn check_ownership(mnstr: &Mnstr, user_id: &str) -> Result<(), anyhow::Error> {
+    if !mnstr.is_owned_by(user_id) {
+        return Err(anyhow::Error::msg(MNSTR_NOT_OWNED));
+    }
+    Ok(())
+}
+
+pub fn is_not_owned(error: &anyhow::Error) -> bool {
+    error.to_string() == MNSTR_NOT_OWNED
+}
+
+pub fn is_version_conflict(error: &anyhow::Error) -> bool {
+    error.to_string() == MNSTR_VERSION_CONFLICT
+}
+
+pub fn is_name_conflict(error: &anyhow::Error) -> bool {
+    error.to_string() == MNSTR_NAME_CONFLICT
+}
+
+/// A mnstr name as compared for uniqueness: trimmed and lowercased.
+pub fn normalize_mnstr_name(mnstr_name: &str) -> String {
+    mnstr_name.trim().to_lowercase()
+}
+
+/// Whether another of `mnstr`'s owner's mnstrs in `others` already has its
+/// name. Unnamed mnstrs never clash.
+pub fn is_name_taken(mnstr: &Mnstr, others: &[Mnstr]) -> bool {
+    let mnstr_name = normalize_mnstr_name(&mnstr.mnstr_name);
+    if mnstr_name.is_empty() {
+        return false;
+    }
+    others.iter().any(|other| {
+        other.id != mnstr.id
+            && other.is_owned_by(&mnstr.user_id)
+            && normalize_mnstr_name(&other.mnstr_name) == mnstr_name
+    })
+}
+
+/// Coins awarded for collecting the mnstr with `mnstr_qr_code`.
+///
+/// The middle two bytes of the code's SHA-256 hash pick a base amount and a
+/// multiplier. Multipliers of 251, 242 and 216 and above land in the rare,
+/// uncommon and lucky tiers, each with a bonus and a cap. Anything lower is a
+/// common mnstr, scaled only from 85 up and cut down to single digits when
+/// large. Every mnstr is worth at least 5 coins.
+pub fn coins_for_qr_code(mnstr_qr_code: &str) -> i32 {
+    let hash = sha2::Sha256::digest(mnstr_qr_code.as_bytes());
+    let coins_byte = hash[(hash.len() - 1) / 2];
+    let multiplier_hash_byte = hash[((hash.len() - 1) / 2) + 1];
+
+    let mut coins = coins_byte as i32;
+    if coins <= 0 {
+        coins = 5;
+    }
+
+    let mut multiplier = multiplier_hash_byte as i32;
+    if multiplier <= 0 {
+        multiplier = 10;
+    }
+
+    if multiplier >= 251 {
+        coins = (coins * (multiplier / 100)) + 1000;
+        if coins > 2000 {
+            coins = 2000;
+        }
+    } else if multiplier >= 242 {
+        coins = (coins * (multiplier / 100)) + 400;
+        if coins > 750 {
+            coins = 750;
+        }
+    } else if multiplier >= 216 {
+        coins = (coins * (multiplier / 100)) + 150;
+        if coins > 400 {
+            coins = 400;
+        }
+    } else {
+        if multiplier >= 85 {
+            coins = coins * (multiplier / 100);
+        }
+        if coins > 25 {
+            coins = coins / 10;
+        }
+    }
+
+    if coins < 5 {
+        coins = 5;
+    }
+
+    coins
+}
+
+/// The rarity tier of the mnstr with `mnstr_qr_code`, picked by the same hash
+/// byte that picks its coin multiplier.
+pub fn rarity_for_qr_code(mnstr_qr_code: &str) -> String {
+    let hash = sha2::Sha256::digest(mnstr_qr_code.as_bytes());
+    let multiplier_hash_byte = hash[((hash.len() - 1) / 2) + 1];
+
+    let rarity = if multiplier_hash_byte >= LEGENDARY_RARITY_THRESHOLD {
+        "legendary"
+    } else if multiplier_hash_byte >= EPIC_RARITY_THRESHOLD {
+        "epic"
+    } else if multiplier_hash_byte >= RARE_RARITY_THRESHOLD {
+        "rare"
+    } else {
+        "common"
+    };
+    rarity.to_string()
+}
+
+impl DatabaseResource for Mnstr {
+    /// Reads a mnstr row, with its experience to the next level filled in.
+    /// Name, description and stat columns that were left NULL read as empty
+    /// and zero, and a column that cannot be read is an error rather than a
+    /// panic.
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        let stat = |column: &str| -> Result<i32, Error> {
+            Ok(row.try_get::<Option<i32>, _>(column)?.unwrap_or(0))
+        };
+
+        let mut mnstr = Mnstr {
+            id: row.try_get("id")?,
+            user_id: row.try_get("user_id")?,
+            mnstr_name: row
+                .try_get::<Option<String>, _>("mnstr_name")?
+                .unwrap_or_default(),
+            mnstr_description: row
+                .try_get::<Option<String>, _>("mnstr_description")?
+                .unwrap_or_default(),
+            mnstr_qr_code: row.try_get("mnstr_qr_code")?,
+            created_at: row.try_get("created_at")?,
+            updated_at: row.try_get("updated_at")?,
+            archived_at: row.try_get("archived_at")?,
+            current_level: row.try_get("current_level")?,
+            current_experience: row.try_get("current_experience")?,
+            current_health: stat("current_health")?,
+            max_health: stat("max_health")?,
+            current_attack: stat("current_attack")?,
+            max_attack: stat("max_attack")?,
+            current_defense: stat("current_defense")?,
+            max_defense: stat("max_defense")?,
+            current_speed: stat("current_speed")?,
+            max_speed: stat("max_speed")?,
+            current_intelligence: stat("current_intelligence")?,
+            max_intelligence: stat("max_intelligence")?,
+            current_magic: stat("current_magic")?,
+            max_magic: stat("max_magic")?,
+            is_seed: row.try_get("is_seed")?,
+            version: row.try_get("version")?,
+            rarity: row.try_get("rarity")?,
+            coin_value: row.try_get("coin_value")?,
+            image_url: row.try_get("image_url")?,
+            tags: Vec::new(),
+            experience_to_next_level: 0,
+        };
+        mnstr.update_experience_to_next_level();
+        Ok(mnstr)
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        true
+    }
+    fn is_updatable() -> bool {
+        true
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+    fn is_versioned() -> bool {
+        true
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        database::test_support::{create_test_mnstr, create_test_user, test_pool, test_wallet},
+        models::{
+            mnstr_description::descriptions_enabled, ownership_event::owner_chain,
+            wallet::check_funds,
+        },
+    };
+
+    #[test]
+    fn test_mnstr_filter_push_conditions() {
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let values = MnstrFilter::default().push_conditions(&mut query, 1);
+        assert_eq!(query, "SELECT * FROM mnstrs WHERE user_id = $1");
+        assert!(values.is_empty());
+
+        let filter = MnstrFilter {
+            is_seed: Some(true),
+            ..Default::default()
+        };
+        let values = filter.push_conditions(&mut query, 1);
+        assert_eq!(
+            query,
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND is_seed = $2"
+        );
+        assert_eq!(values, vec![MnstrFilterValue::Bool(true)]);
+    }
+
+    #[test]
+    fn test_mnstr_filter_created_range() {
+        let since = OffsetDateTime::now_utc() - time::Duration::days(7);
+        let until = OffsetDateTime::now_utc();
+        let filter = MnstrFilter {
+            is_seed: Some(false),
+            created_since: Some(since),
+            created_until: Some(until),
+            ..Default::default()
+        };
+        assert!(filter.validate().is_ok());
+
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let values = filter.push_conditions(&mut query, 1);
+        assert_eq!(
+            query,
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND is_seed = $2 AND created_at >= $3 AND created_at < $4"
+        );
+        assert_eq!(
+            values,
+            vec![
+                MnstrFilterValue::Bool(false),
+                MnstrFilterValue::Timestamp(since),
+                MnstrFilterValue::Timestamp(until),
+            ]
+        );
+
+        let reversed = MnstrFilter {
+            created_since: Some(until),
+            created_until: Some(since),
+            ..Default::default()
+        };
+        assert!(reversed.validate().is_err());
+    }
+
+    #[test]
+    fn test_mnstr_filter_rarity_and_level() {
+        let filter = MnstrFilter {
+            rarity: Some("epic".to_string()),
+            min_level: Some(5),
+            max_level: Some(10),
+            ..Default::default()
+        };
+        assert!(filter.validate().is_ok());
+
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let values = filter.push_conditions(&mut query, 1);
+        assert_eq!(
+            query,
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND rarity = $2 AND current_level >= $3 AND current_level <= $4"
+        );
+        assert_eq!(
+            values,
+            vec![
+                MnstrFilterValue::Text("epic".to_string()),
+                MnstrFilterValue::Int(5),
+                MnstrFilterValue::Int(10),
+            ]
+        );
+
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let filter = MnstrFilter {
+            min_level: Some(3),
+            ..Default::default()
+        };
+        filter.push_conditions(&mut query, 1);
+        assert_eq!(
+            query,
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND current_level >= $2"
+        );
+    }
+
+    #[test]
+    fn test_mnstr_filter_tag() {
+        let filter = MnstrFilter {
+            tag: Some(" For  Trade ".to_string()),
+            ..Default::default()
+        };
+        assert!(filter.validate().is_ok());
+
+        let mut query = "SELECT * FROM mnstrs WHERE user_id = $1".to_string();
+        let values = filter.push_conditions(&mut query, 1);
+        assert_eq!(
+            query,
+            "SELECT * FROM mnstrs WHERE user_id = $1 AND EXISTS (SELECT 1 FROM mnstr_tags WHERE mnstr_tags.mnstr_id = mnstrs.id AND mnstr_tags.tag = $2)"
+        );
+        assert_eq!(values, vec![MnstrFilterValue::Text("for trade".to_string())]);
+
+        let blank = MnstrFilter {
+            tag: Some("  ".to_string()),
+            ..Default::default()
+        };
+        assert!(blank.validate().is_err());
+    }
+
+    #[test]
+    fn test_mnstr_filter_rejects_bad_rarity_and_levels() {
+        let unknown = MnstrFilter {
+            rarity: Some("mythic".to_string()),
+            ..Default::default()
+        };
+        assert!(unknown.validate().is_err());
+
+        let negative = MnstrFilter {
+            min_level: Some(-1),
+            ..Default::default()
+        };
+        assert!(negative.validate().is_err());
+
+        let reversed = MnstrFilter {
+            min_level: Some(8),
+            max_level: Some(2),
+            ..Default::default()
+        };
+        assert!(reversed.validate().is_err());
+    }
+
+    #[test]
+    fn test_mnstr_order_columns() {
+        assert_eq!(MnstrOrderBy::CreatedAt.to_string(), "created_at");
+        assert_eq!(MnstrOrderBy::Name.to_string(), "mnstr_name");
+        assert_eq!(MnstrOrderDirection::Asc.to_string(), "asc");
+        assert_eq!(MnstrOrderDirection::Desc.to_string(), "desc");
+        assert_eq!(
+            MnstrOrderBy::from_string("created_at"),
+            Some(MnstrOrderBy::CreatedAt)
+        );
+        assert_eq!(
+            MnstrOrderBy::from_string("coin_value"),
+            Some(MnstrOrderBy::Coins)
+        );
+        assert_eq!(order_clause(None, None), " ORDER BY updated_at asc");
+    }
+
+    #[test]
+    fn test_mnstrs_sort_by_coin_value() {
+        assert_eq!(
+            order_clause(Some(MnstrOrderBy::Coins), Some(MnstrOrderDirection::Desc)),
+            " ORDER BY coin_value desc"
+        );
+
+        let mut mnstrs = ["mnstr-3", "mnstr-0", "mnstr-22", "mnstr-17"]
+            .iter()
+            .map(|mnstr_qr_code| {
+                Mnstr::new("user".to_string(), None, None, mnstr_qr_code.to_string())
+            })
+            .collect::<Vec<Mnstr>>();
+        for mnstr in mnstrs.iter() {
+            assert_eq!(mnstr.coin_value, coins_for_qr_code(&mnstr.mnstr_qr_code));
+        }
+
+        mnstrs.sort_by(|a, b| b.coin_value.cmp(&a.coin_value));
+        let sorted = mnstrs
+            .iter()
+            .map(|mnstr| mnstr.mnstr_qr_code.as_str())
+            .collect::<Vec<&str>>();
+        assert_eq!(sorted, vec!["mnstr-22", "mnstr-17", "mnstr-3", "mnstr-0"]);
+        assert!(mnstrs.windows(2).all(|pair| pair[0].coins() >= pair[1].coins()));
+    }
+
+    #[test]
+    fn test_dedupe_qr_codes() {
+        let mnstr_qr_codes = vec![
+            "b".to_string(),
+            " a ".to_string(),
+            "b".to_string(),
+            "a".to_string(),
+            "".to_string(),
+            "  ".to_string(),
+        ];
+        assert_eq!(
+            dedupe_qr_codes(mnstr_qr_codes),
+            vec!["b".to_string(), "a".to_string(), "".to_string()]
+        );
+    }
+
+    #[test]
+    fn test_visible_to() {
+        let mnstr = Mnstr::new(
+            "owner".to_string(),
+            Some("Fluffy".to_string()),
+            Some("Soft".to_string()),
+            "qr".to_string(),
+        );
+
+        let owned = mnstr.clone().visible_to("owner", false).unwrap();
+        assert_eq!(owned.user_id, "owner");
+        assert_eq!(owned.mnstr_name, "Fluffy");
+        assert_eq!(owned.mnstr_description, "Soft");
+        let owned = mnstr.clone().visible_to("owner", true).unwrap();
+        assert_eq!(owned.mnstr_name, "Fluffy");
+
+        assert!(mnstr.clone().visible_to("stranger", false).is_none());
+
+        let limited = mnstr.clone().visible_to("stranger", true).unwrap();
+        assert_eq!(limited.mnstr_qr_code, "qr");
+        assert!(limited.user_id.is_empty());
+        assert!(limited.mnstr_name.is_empty());
+        assert!(limited.mnstr_description.is_empty());
+    }
+
+    #[test]
+    fn test_coins_for_qr_code() {
+        // (qr code, coins byte, multiplier byte, expected coins)
+        let cases = [
+            ("mnstr-22", 28, 253, 1056),
+            ("mnstr-17", 37, 243, 474),
+            ("mnstr-3", 143, 235, 400),
+            ("mnstr-0", 91, 141, 9),
+            ("mnstr-2", 188, 28, 18),
+            ("mnstr-7", 4, 146, 5),
+        ];
+        for (mnstr_qr_code, coins_byte, multiplier_byte, expected) in cases {
+            let hash = sha2::Sha256::digest(mnstr_qr_code.as_bytes());
+            assert_eq!((hash[15], hash[16]), (coins_byte, multiplier_byte));
+            assert_eq!(coins_for_qr_code(mnstr_qr_code), expected, "{}", mnstr_qr_code);
+        }
+    }
+
+    #[test]
+    fn test_rarity_for_qr_code() {
+        let cases = [
+            ("mnstr-22", "legendary"),
+            ("mnstr-17", "epic"),
+            ("mnstr-3", "rare"),
+            ("mnstr-0", "common"),
+            ("mnstr-2", "common"),
+        ];
+        for (mnstr_qr_code, expected) in cases {
+            assert_eq!(rarity_for_qr_code(mnstr_qr_code), expected, "{}", mnstr_qr_code);
+            assert_eq!(rarity_for_qr_code(mnstr_qr_code), expected, "{}", mnstr_qr_code);
+        }
+
+        let mnstr = Mnstr::new("user".to_string(), None, None, "mnstr-22".to_string());
+        assert_eq!(mnstr.rarity, "legendary");
+    }
+
+    #[test]
+    fn test_mnstr_stats_from_mnstr() {
+        for mnstr_qr_code in ["mnstr-22", "mnstr-17", "mnstr-3", "mnstr-0"] {
+            let mut mnstr = Mnstr::new("user".to_string(), None, None, mnstr_qr_code.to_string());
+            mnstr.current_level = 3;
+            mnstr.current_health = 12;
+            mnstr.max_health = 16;
+            mnstr.current_attack = 14;
+            mnstr.current_defense = 11;
+
+            let stats = MnstrStats::from_mnstr(&mnstr);
+            assert_eq!(
+                stats,
+                MnstrStats {
+                    level: 3,
+                    health: 12,
+                    max_health: 16,
+                    attack: 14,
+                    defense: 11,
+                    rarity: rarity_for_qr_code(mnstr_qr_code),
+                    coins: coins_for_qr_code(mnstr_qr_code),
+                },
+                "{}",
+                mnstr_qr_code
+            );
+        }
+
+        // The stored values win over the ones the QR code would give today.
+        let mut mnstr = Mnstr::new("user".to_string(), None, None, "mnstr-22".to_string());
+        mnstr.rarity = "common".to_string();
+        mnstr.coin_value = 7;
+        let stats = MnstrStats::from_mnstr(&mnstr);
+        assert_eq!(stats.rarity, "common");
+        assert_eq!(stats.coins, 7);
+    }
+
+    #[test]
+    fn test_release_refund() {
+        assert_eq!(release_refund(coins_for_qr_code("mnstr-22")), 264);
+        assert_eq!(release_refund(coins_for_qr_code("mnstr-17")), 118);
+        assert_eq!(release_refund(coins_for_qr_code("mnstr-7")), 1);
+        assert_eq!(release_refund(0), 1);
+    }
+
+    #[test]
+    fn test_validate_release() {
+        let mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        assert!(validate_release(&mnstr, "owner").is_ok());
+        assert_eq!(
+            validate_release(&mnstr, "stranger").unwrap_err().to_string(),
+            "Mnstr not found"
+        );
+
+        let mut seed = mnstr.clone();
+        seed.is_seed = true;
+        assert_eq!(
+            validate_release(&seed, "owner").unwrap_err().to_string(),
+            "Starter mnstrs cannot be released"
+        );
+
+        let mut released = mnstr.clone();
+        released.archived_at = Some(OffsetDateTime::now_utc());
+        assert_eq!(
+            validate_release(&released, "owner").unwrap_err().to_string(),
+            "Mnstr has already been released"
+        );
+    }
+
+    #[test]
+    fn test_coins_delegates_to_coins_for_qr_code() {
+        let mnstr = Mnstr::new("user".to_string(), None, None, "mnstr-22".to_string());
+        assert_eq!(mnstr.coins(), coins_for_qr_code("mnstr-22"));
+    }
+
+    #[test]
+    fn test_search_patterns() {
+        assert_eq!(
+            search_patterns(" Fluf "),
+            ("%Fluf%".to_string(), "Fluf%".to_string())
+        );
+        assert_eq!(
+            search_patterns("50%_off"),
+            ("%50\\%\\_off%".to_string(), "50\\%\\_off%".to_string())
+        );
+    }
+
+    #[test]
+    fn test_search_bounds() {
+        assert_eq!(search_bounds(None, None), (DEFAULT_SEARCH_LIMIT, 0));
+        assert_eq!(search_bounds(Some(5), Some(10)), (5, 10));
+        assert_eq!(search_bounds(Some(0), Some(-3)), (1, 0));
+        assert_eq!(search_bounds(Some(1_000), None), (MAX_SEARCH_LIMIT, 0));
+    }
+
+    #[test]
+    fn test_collect_awards() {
+        let mnstr = Mnstr::new("user".to_string(), None, None, "mnstr-0".to_string());
+        assert_eq!(mnstr.rarity, "common");
+        assert_eq!(mnstr.collect_awards(0), (XP_FOR_LEVEL[0], mnstr.coins()));
+        assert_eq!(mnstr.collect_awards(10), (XP_FOR_LEVEL[10], mnstr.coins()));
+
+        let last_level_index = XP_FOR_LEVEL.len() - 1;
+        assert_eq!(
+            mnstr.collect_awards(i32::MAX),
+            (XP_FOR_LEVEL[last_level_index], mnstr.coins())
+        );
+        assert_eq!(mnstr.collect_awards(-1), (XP_FOR_LEVEL[0], mnstr.coins()));
+    }
+
+    #[test]
+    fn test_collect_awards_scale_with_rarity() {
+        let mut common = Mnstr::new("user".to_string(), None, None, "mnstr-22".to_string());
+        common.rarity = "common".to_string();
+        let mut legendary = common.clone();
+        legendary.rarity = "legendary".to_string();
+
+        let (common_xp, common_coins) =
+            common.collect_awards_with(10, &DEFAULT_RARITY_MULTIPLIERS);
+        let (legendary_xp, legendary_coins) =
+            legendary.collect_awards_with(10, &DEFAULT_RARITY_MULTIPLIERS);
+        assert_eq!((common_xp, common_coins), (XP_FOR_LEVEL[10], common.coins()));
+        assert!(legendary_xp > common_xp);
+        assert!(legendary_coins > common_coins);
+        assert_eq!(legendary_coins, common_coins * 2);
+
+        let flat = RarityMultipliers {
+            common: 1.0,
+            rare: 1.0,
+            epic: 1.0,
+            legendary: 1.0,
+        };
+        assert_eq!(
+            legendary.collect_awards_with(10, &flat),
+            common.collect_awards_with(10, &flat)
+        );
+    }
+
+    #[test]
+    fn test_rarity_multipliers() {
+        let mut multipliers = RarityMultipliers::default();
+        assert_eq!(multipliers.factor("legendary"), 2.0);
+        assert_eq!(multipliers.factor("unknown"), multipliers.common);
+        assert_eq!(multipliers.apply("rare", 10), 13);
+
+        assert!(multipliers.set("epic", 4.0));
+        assert_eq!(multipliers.apply("epic", 10), 40);
+        assert!(!multipliers.set("mythic", 4.0));
+    }
+
+    #[test]
+    fn test_collect_reward_already_owned_awards_nothing() {
+        let mnstr = Mnstr::new("user".to_string(), None, None, "mnstr-22".to_string());
+        let mut user = User::new(None, None, "password".to_string(), "name".to_string());
+        user.experience_level = 3;
+        user.coins = 120;
+
+        let reward = MnstrCollectReward::already_owned(mnstr.clone(), &user);
+        assert!(reward.already_owned);
+        assert_eq!((reward.xp_awarded, reward.coins_awarded), (0, 0));
+        assert_eq!((reward.experience_level, reward.coins), (3, 120));
+
+        let (xp, coins) = mnstr.collect_awards(user.experience_level);
+        let reward = MnstrCollectReward::new(mnstr, &user, xp, coins);
+        assert!(!reward.already_owned);
+        assert_eq!(
+            reward.coins_awarded,
+            DEFAULT_RARITY_MULTIPLIERS.apply("legendary", coins_for_qr_code("mnstr-22"))
+        );
+    }
+
+    #[test]
+    fn test_is_owned_by() {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        assert!(mnstr.is_owned_by("owner"));
+        assert!(!mnstr.is_owned_by("other"));
+
+        mnstr.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(!mnstr.is_owned_by("owner"));
+    }
+
+    #[test]
+    fn test_refresh_derived_values_after_formula_change() {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, "mnstr-22".to_string());
+        assert!(!mnstr.refresh_derived_values());
+
+        // Values stored by an earlier version of the formulas.
+        mnstr.rarity = "common".to_string();
+        mnstr.coin_value = 5;
+        assert!(mnstr.refresh_derived_values());
+        assert_eq!(mnstr.rarity, rarity_for_qr_code("mnstr-22"));
+        assert_eq!(mnstr.coin_value, coins_for_qr_code("mnstr-22"));
+        assert_ne!((mnstr.rarity.as_str(), mnstr.coin_value), ("common", 5));
+        assert!(!mnstr.refresh_derived_values());
+    }
+
+    #[test]
+    fn test_check_ownership_passes_for_owner() {
+        let mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        assert!(check_ownership(&mnstr, "owner").is_ok());
+    }
+
+    #[test]
+    fn test_check_ownership_rejects_non_owner() {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        let error = check_ownership(&mnstr, "stranger").unwrap_err();
+        assert!(is_not_owned(&error));
+        assert_eq!(error.to_string(), "Mnstr not found");
+
+        mnstr.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(is_not_owned(&check_ownership(&mnstr, "owner").unwrap_err()));
+        assert!(!is_not_owned(&anyhow::Error::msg(MNSTR_VERSION_CONFLICT)));
+    }
+
+    #[test]
+    fn test_apply_level_up() {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        mnstr.current_experience = 40;
+        mnstr.current_health = 1;
+        assert_eq!(level_up_cost(mnstr.current_level), LEVEL_UP_BASE_COST);
+        assert!(check_funds(LEVEL_UP_BASE_COST as i64, level_up_cost(0)).is_ok());
+
+        mnstr.apply_level_up().unwrap();
+        assert_eq!(mnstr.current_level, 1);
+        assert_eq!(mnstr.current_experience, 0);
+        assert_eq!(mnstr.max_health, DEFAULT_STAT_VALUE + LEVEL_UP_STAT_GAIN);
+        assert_eq!(mnstr.current_health, mnstr.max_health);
+        assert_eq!(mnstr.max_magic, DEFAULT_STAT_VALUE + LEVEL_UP_STAT_GAIN);
+        assert_eq!(mnstr.experience_to_next_level, XP_FOR_LEVEL[2]);
+        assert_eq!(level_up_cost(mnstr.current_level), LEVEL_UP_BASE_COST * 2);
+    }
+
+    #[test]
+    fn test_level_up_insufficient_funds() {
+        let cost = level_up_cost(4);
+        assert_eq!(
+            check_funds(cost as i64 - 1, cost).unwrap_err().to_string(),
+            "Insufficient funds"
+        );
+    }
+
+    #[test]
+    fn test_apply_level_up_at_max_level() {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        mnstr.current_level = XP_FOR_LEVEL.len() as i32 - 1;
+        let before = mnstr.clone();
+        assert!(mnstr.apply_level_up().is_err());
+        assert_eq!(mnstr.current_level, before.current_level);
+        assert_eq!(mnstr.max_health, before.max_health);
+    }
+
+    #[test]
+    fn test_stale_edit_is_a_conflict() {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, "qr".to_string());
+        assert_eq!(mnstr.version, 0);
+        assert!(check_version(0, mnstr.version).is_ok());
+
+        // Another client's edit lands first.
+        mnstr.version += 1;
+        let error = check_version(0, mnstr.version).unwrap_err();
+        assert!(is_version_conflict(&error));
+        assert!(!is_version_conflict(&anyhow::Error::msg("Mnstr not found")));
+    }
+
+    #[test]
+    fn test_duplicate_name_is_taken() {
+        let named = |id: &str, user_id: &str, mnstr_name: &str| {
+            let mut mnstr = Mnstr::new(
+                user_id.to_string(),
+                Some(mnstr_name.to_string()),
+                None,
+                "qr".to_string(),
+            );
+            mnstr.id = id.to_string();
+            mnstr
+        };
+        let collection = vec![named("a", "owner", "Fluffy"), named("b", "owner", "Spike")];
+
+        assert!(is_name_taken(&named("c", "owner", " fluffy "), &collection));
+        assert!(!is_name_taken(&named("c", "owner", "Sparky"), &collection));
+        assert!(!is_name_taken(&named("a", "owner", "Fluffy"), &collection));
+        assert!(!is_name_taken(&named("c", "owner", ""), &[named("d", "owner", "")]));
+        assert!(is_name_conflict(&anyhow::Error::msg(MNSTR_NAME_CONFLICT)));
+    }
+
+    #[test]
+    fn test_same_name_on_another_user_is_allowed() {
+        let mut other = Mnstr::new("friend".to_string(), Some("Fluffy".to_string()), None, "qr".to_string());
+        other.id = "a".to_string();
+        let mut mnstr = Mnstr::new("owner".to_string(), Some("FLUFFY".to_string()), None, "qr".to_string());
+        mnstr.id = "b".to_string();
+
+        assert!(!is_name_taken(&mnstr, &[other]));
+    }
+
+    #[test]
+    fn test_skip_unreadable_keeps_other_rows() {
+        let mnstr = |id: &str| Mnstr {
+            id: id.to_string(),
+            ..Mnstr::new("owner".to_string(), None, None, format!("{}-qr", id))
+        };
+        let rows = vec![
+            Ok(mnstr("first")),
+            Err(Error::ColumnNotFound("created_at".to_string())),
+            Ok(mnstr("second")),
+        ];
+
+        let ids = skip_unreadable(rows)
+            .iter()
+            .map(|mnstr| mnstr.id.clone())
+            .collect::<Vec<String>>();
+        assert_eq!(ids, vec!["first".to_string(), "second".to_string()]);
+    }
+
+    #[test]
+    fn test_duplicate_groups() {
+        let mnstr = |id: &str, mnstr_qr_code: &str| Mnstr {
+            id: id.to_string(),
+            ..Mnstr::new("owner".to_string(), None, None, mnstr_qr_code.to_string())
+        };
+        let archived = Mnstr {
+            archived_at: Some(OffsetDateTime::now_utc()),
+            ..mnstr("archived", "qr-2")
+        };
+        let mnstrs = vec![
+            mnstr("first", "qr-1"),
+            mnstr("single", "qr-2"),
+            mnstr("third", "qr-3"),
+            mnstr("second", "qr-1"),
+            archived,
+            mnstr("fourth", "qr-3"),
+            mnstr("fifth", "qr-3"),
+        ];
+
+        let groups = duplicate_groups(mnstrs)
+            .iter()
+            .map(|group| {
+                (
+                    group.mnstr_qr_code.clone(),
+                    group
+                        .mnstrs
+                        .iter()
+                        .map(|mnstr| mnstr.id.clone())
+                        .collect::<Vec<String>>(),
+                )
+            })
+            .collect::<Vec<(String, Vec<String>)>>();
+        assert_eq!(
+            groups,
+            vec![
+                (
+                    "qr-1".to_string(),
+                    vec!["first".to_string(), "second".to_string()]
+                ),
+                (
+                    "qr-3".to_string(),
+                    vec!["third".to_string(), "fourth".to_string(), "fifth".to_string()]
+                ),
+            ]
+        );
+        assert!(duplicate_groups(vec![mnstr("only", "qr-1")]).is_empty());
+    }
+
+    #[test]
+    fn test_archive_results() {
+        let owned = Mnstr {
+            id: "owned".to_string(),
+            ..Mnstr::new("owner".to_string(), None, None, "qr-1".to_string())
+        };
+        let archived = Mnstr {
+            id: "archived".to_string(),
+            archived_at: Some(OffsetDateTime::now_utc()),
+            ..Mnstr::new("owner".to_string(), None, None, "qr-2".to_string())
+        };
+        let other = Mnstr {
+            id: "other".to_string(),
+            ..Mnstr::new("someone".to_string(), None, None, "qr-3".to_string())
+        };
+        let starter = Mnstr {
+            id: "starter".to_string(),
+            is_seed: true,
+            ..Mnstr::new("owner".to_string(), None, None, "qr-4".to_string())
+        };
+        let ids = vec![
+            "owned".to_string(),
+            "archived".to_string(),
+            "other".to_string(),
+            "missing".to_string(),
+            "starter".to_string(),
+            "owned".to_string(),
+        ];
+
+        let results = archive_results("owner", ids, &[owned, archived, other, starter]);
+        let statuses = results
+            .iter()
+            .map(|result| (result.id.as_str(), result.status))
+            .collect::<Vec<_>>();
+        assert_eq!(
+            statuses,
+            vec![
+                ("owned", MnstrArchiveStatus::Archived),
+                ("archived", MnstrArchiveStatus::AlreadyArchived),
+                ("other", MnstrArchiveStatus::NotFound),
+                ("missing", MnstrArchiveStatus::NotFound),
+                ("starter", MnstrArchiveStatus::Starter),
+            ]
+        );
+    }
+
+    #[test]
+    fn test_collection_etag() {
+        let updated_at = OffsetDateTime::now_utc();
+        let etag = collection_etag(3, Some(updated_at), "all");
+        assert!(etag.starts_with("W/\""));
+        assert_eq!(etag, collection_etag(3, Some(updated_at), "all"));
+
+        assert_ne!(etag, collection_etag(4, Some(updated_at), "all"));
+        assert_ne!(
+            etag,
+            collection_etag(3, Some(updated_at + time::Duration::milliseconds(1)), "all")
+        );
+        assert_ne!(etag, collection_etag(3, Some(updated_at), "seeds"));
+        assert!(collection_etag(0, None, "all").starts_with("W/\"0-0-"));
+    }
+
+    #[test]
+    fn test_etag_matches() {
+        let etag = collection_etag(3, None, "all");
+        let other = collection_etag(1, None, "all");
+        assert!(etag_matches(&etag, &etag));
+        assert!(etag_matches(etag.trim_start_matches("W/"), &etag));
+        assert!(etag_matches(&format!("{}, {}", other, etag), &etag));
+        assert!(etag_matches("*", &etag));
+        assert!(!etag_matches(&other, &etag));
+        assert!(!etag_matches("", &etag));
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_from_row_reads_null_and_set_columns() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let null_id = Uuid::new_v4().to_string();
+        let set_id = Uuid::new_v4().to_string();
+        sqlx::query(
+            "INSERT INTO mnstrs (id, user_id, mnstr_name, mnstr_description, mnstr_qr_code,
+                current_health, max_health, max_attack)
+            VALUES ($1, $3, NULL, NULL, 'qr-null', NULL, NULL, NULL),
+                ($2, $3, 'Blaze', 'Hot', 'qr-set', 40, 42, 12)",
+        )
+        .bind(null_id.clone())
+        .bind(set_id.clone())
+        .bind(user.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+
+        let read = |id: String| {
+            let pool = pool.clone();
+            async move {
+                let row = sqlx::query("SELECT * FROM mnstrs WHERE id = $1")
+                    .bind(id)
+                    .fetch_one(&pool)
+                    .await
+                    .unwrap();
+                Mnstr::from_row(&row).unwrap()
+            }
+        };
+
+        let null = read(null_id).await;
+        assert_eq!((null.mnstr_name.as_str(), null.mnstr_description.as_str()), ("", ""));
+        assert_eq!((null.current_health, null.max_health, null.max_attack), (0, 0, 0));
+        assert_eq!(null.max_defense, 10);
+
+        let set = read(set_id).await;
+        assert_eq!((set.mnstr_name.as_str(), set.mnstr_description.as_str()), ("Blaze", "Hot"));
+        assert_eq!((set.current_health, set.max_health, set.max_attack), (40, 42, 12));
+        assert_eq!(set.experience_to_next_level, xp_to_next_level(&XP_FOR_LEVEL, 0));
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_listings_skip_rows_that_cannot_be_read() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        sqlx::query(
+            "INSERT INTO mnstrs (id, user_id, mnstr_name, mnstr_description, mnstr_qr_code)
+            VALUES ($1, $2, 'Moss', '', 'qr-moss')",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+
+        let rows = sqlx::query("SELECT * FROM mnstrs WHERE user_id = $1")
+            .bind(user.id.clone())
+            .fetch_all(&pool)
+            .await
+            .unwrap();
+        // A row without the stat columns stands in for a damaged one.
+        let partial = sqlx::query("SELECT id, user_id FROM mnstrs WHERE user_id = $1")
+            .bind(user.id.clone())
+            .fetch_all(&pool)
+            .await
+            .unwrap();
+
+        assert_eq!(Mnstr::from_readable_rows(&rows).len(), 1);
+        assert!(Mnstr::from_rows(&partial).is_err());
+        assert!(Mnstr::from_readable_rows(&partial).is_empty());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_edit_racing_a_level_up_is_a_conflict() {
+        let mut user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        assert!(wallet.add_coins(LEVEL_UP_BASE_COST).await.is_none());
+        let mut edited = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let read_version = edited.version;
+
+        let mut leveled = Mnstr::find_one(edited.id.clone(), false).await.unwrap();
+        assert!(leveled.level_up(&mut user).await.is_none());
+        assert!(leveled.version > read_version);
+
+        edited.mnstr_name = "Renamed".to_string();
+        let error = edited
+            .update_as(user.id.clone(), read_version)
+            .await
+            .expect("a stale edit must not apply");
+        assert!(is_version_conflict(&error));
+
+        let stored = Mnstr::find_one(edited.id.clone(), false).await.unwrap();
+        assert_eq!(stored.current_level, leveled.current_level);
+        assert_eq!(stored.max_health, leveled.max_health);
+        assert_eq!(stored.mnstr_name, "");
+
+        let mut awarded = stored.clone();
+        assert!(awarded.update_xp(1).await.is_none());
+        let stored_after_xp = Mnstr::find_one(edited.id.clone(), false).await.unwrap();
+        assert!(stored_after_xp.version > stored.version);
+    }
+
+    /// Archives `mnstr` straight in the table, as releasing it would, without
+    /// the refund.
+    async fn archive_test_mnstr(pool: &sqlx::PgPool, mnstr: &Mnstr) {
+        sqlx::query("UPDATE mnstrs SET archived_at = now() WHERE id = $1")
+            .bind(mnstr.id.clone())
+            .execute(pool)
+            .await
+            .unwrap();
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_recollect_within_cooldown_awards_nothing() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let mnstr_qr_code = Uuid::new_v4().to_string();
+
+        let first = Mnstr::collect(user.id.clone(), mnstr_qr_code.clone())
+            .await
+            .unwrap();
+        assert!(first.coins_awarded > 0);
+        archive_test_mnstr(&pool, &first.mnstr).await;
+
+        let balance = test_wallet(&user).await.coins;
+        let second = Mnstr::collect(user.id.clone(), mnstr_qr_code.clone())
+            .await
+            .unwrap();
+        assert!(!second.already_owned);
+        assert_ne!(second.mnstr.id, first.mnstr.id);
+        assert_eq!((second.coins_awarded, second.xp_awarded), (0, 0));
+        assert_eq!(test_wallet(&user).await.coins, balance);
+        archive_test_mnstr(&pool, &second.mnstr).await;
+
+        let results = Mnstr::collect_batch(user.id.clone(), vec![mnstr_qr_code.clone()])
+            .await
+            .unwrap();
+        assert_eq!(results[0].status, MnstrCollectStatus::Created);
+        assert_eq!(test_wallet(&user).await.coins, balance);
+        archive_test_mnstr(&pool, results[0].mnstr.as_ref().unwrap()).await;
+
+        sqlx::query(
+            "UPDATE collect_cooldowns SET collected_at = now() - interval '2 days'
+            WHERE user_id = $1",
+        )
+        .bind(user.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+        let after_cooldown = Mnstr::collect(user.id.clone(), mnstr_qr_code)
+            .await
+            .unwrap();
+        assert_eq!(after_cooldown.coins_awarded, first.coins_awarded);
+        assert_eq!(
+            test_wallet(&user).await.coins,
+            balance + after_cooldown.coins_awarded
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_concurrent_cooldown_claims_reward_once() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mnstr_qr_codes = vec![Uuid::new_v4().to_string()];
+        let cooldown = config().collect_cooldown;
+
+        let mut first = pool.begin().await.unwrap();
+        let mut second = pool.begin().await.unwrap();
+        let claimed = CollectCooldown::claim(
+            &mut first,
+            user.id.clone(),
+            mnstr_qr_codes.clone(),
+            cooldown,
+        )
+        .await
+        .unwrap();
+        assert_eq!(claimed, mnstr_qr_codes);
+
+        // The second claim waits on the first one's row until it commits.
+        let (claimed, committed) = tokio::join!(
+            CollectCooldown::claim(&mut second, user.id.clone(), mnstr_qr_codes, cooldown),
+            async {
+                tokio::time::sleep(std::time::Duration::from_millis(100)).await;
+                first.commit().await
+            }
+        );
+        committed.unwrap();
+        assert!(claimed.unwrap().is_empty());
+        second.commit().await.unwrap();
+    }
+
+    async fn archive_test_mnstr_days_ago(pool: &sqlx::PgPool, mnstr: &Mnstr, days: i64) {
+        sqlx::query("UPDATE mnstrs SET archived_at = $2 WHERE id = $1")
+            .bind(mnstr.id.clone())
+            .bind(OffsetDateTime::now_utc() - time::Duration::days(days))
+            .execute(pool)
+            .await
+            .unwrap();
+    }
+
+    async fn test_mnstr_exists(pool: &sqlx::PgPool, mnstr: &Mnstr) -> bool {
+        sqlx::query_scalar::<_, bool>("SELECT EXISTS (SELECT 1 FROM mnstrs WHERE id = $1)")
+            .bind(mnstr.id.clone())
+            .fetch_one(pool)
+            .await
+            .unwrap()
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_purge_archived_keeps_recent_and_referenced_mnstrs() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let old = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let recent = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let traded = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let battled = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let live = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+
+        let purge_after = MNSTR_PURGE_AFTER_DAYS;
+        archive_test_mnstr_days_ago(&pool, &old, purge_after + 1).await;
+        archive_test_mnstr_days_ago(&pool, &recent, purge_after - 1).await;
+        archive_test_mnstr_days_ago(&pool, &traded, purge_after + 1).await;
+        archive_test_mnstr_days_ago(&pool, &battled, purge_after + 1).await;
+
+        sqlx::query(
+            "INSERT INTO trades (id, offerer_user_id, offerer_mnstr_id, target_user_id, \
+             requested_mnstr_id, trade_status) VALUES ($1, $2, $3, $2, $4, 'declined')",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user.id.clone())
+        .bind(traded.id.clone())
+        .bind(live.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+        sqlx::query(
+            "INSERT INTO battles (id, challenger_id, challenger_name, challenger_mnstr_id, \
+             opponent_id, opponent_name) VALUES ($1, $2, $3, $4, $2, $3)",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user.id.clone())
+        .bind(user.display_name.clone())
+        .bind(battled.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+
+        let cutoff = OffsetDateTime::now_utc() - time::Duration::days(purge_after);
+        let purged = Mnstr::purge_archived(cutoff).await.unwrap();
+        assert!(purged >= 1);
+
+        assert!(!test_mnstr_exists(&pool, &old).await);
+        assert!(test_mnstr_exists(&pool, &recent).await);
+        assert!(test_mnstr_exists(&pool, &traded).await);
+        assert!(test_mnstr_exists(&pool, &battled).await);
+        assert!(test_mnstr_exists(&pool, &live).await);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_batch_collected_mnstr_has_full_ownership_history() {
+        let user = create_test_user().await;
+        let friend = create_test_user().await;
+        create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+
+        let results = Mnstr::collect_batch(user.id.clone(), vec![Uuid::new_v4().to_string()])
+            .await
+            .unwrap();
+        let mut mnstr = results[0].mnstr.clone().unwrap();
+        assert_eq!(results[0].status, MnstrCollectStatus::Created);
+        mnstr
+            .transfer_to(user.id.clone(), friend.id.clone())
+            .await
+            .unwrap();
+
+        let events = OwnershipEvent::find_all_by_mnstr_id(mnstr.id.clone())
+            .await
+            .unwrap();
+        assert_eq!(
+            events
+                .iter()
+                .map(|event| event.event_type)
+                .collect::<Vec<OwnershipEventType>>(),
+            vec![OwnershipEventType::Collected, OwnershipEventType::Gifted]
+        );
+        assert_eq!(
+            owner_chain(&events),
+            vec![user.id.clone(), friend.id.clone()]
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_gift_moves_ownership() {
+        let user = create_test_user().await;
+        let friend = create_test_user().await;
+        let mut mnstr = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+
+        let transfer = mnstr
+            .transfer_to(user.id.clone(), friend.id.clone())
+            .await
+            .unwrap();
+        assert_eq!(transfer.mnstr_id, mnstr.id);
+        assert_eq!(transfer.from_user_id, user.id);
+        assert_eq!(transfer.to_user_id, friend.id);
+        assert_eq!(mnstr.user_id, friend.id);
+
+        assert!(
+            Mnstr::find_owned(mnstr.id.clone(), &friend.id)
+                .await
+                .is_ok()
+        );
+        assert!(Mnstr::find_owned(mnstr.id.clone(), &user.id).await.is_err());
+        assert!(
+            mnstr
+                .transfer_to(user.id.clone(), friend.id.clone())
+                .await
+                .is_err()
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_evolve_levels_up_and_archives_the_fodder() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mnstr_qr_code = Uuid::new_v4().to_string();
+        let mut mnstr = create_test_mnstr(&user, &mnstr_qr_code).await;
+        let fodder = create_test_mnstr(&user, &mnstr_qr_code).await;
+        let mut expected = mnstr.clone();
+        expected.apply_level_up().unwrap();
+
+        let evolution = mnstr.evolve(&fodder, user.id.clone()).await.unwrap();
+        assert_eq!(evolution.mnstr_id, mnstr.id);
+        assert_eq!(evolution.fodder_mnstr_id, fodder.id);
+        assert_eq!(evolution.from_level, expected.current_level - 1);
+        assert_eq!(evolution.to_level, expected.current_level);
+
+        let evolved = Mnstr::find_owned(mnstr.id.clone(), &user.id).await.unwrap();
+        assert_eq!(evolved.current_level, expected.current_level);
+        assert_eq!(evolved.max_health, expected.max_health);
+        assert_eq!(evolved.current_attack, expected.current_attack);
+        assert_eq!(evolved.version, expected.version + 1);
+        assert!(
+            sqlx::query_scalar::<_, bool>(
+                "SELECT archived_at IS NOT NULL FROM mnstrs WHERE id = $1"
+            )
+            .bind(fodder.id.clone())
+            .fetch_one(&pool)
+            .await
+            .unwrap()
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_archive_batch_archives_rows_and_keeps_the_seed() {
+        let user = create_test_user().await;
+        let other = create_test_user().await;
+        let mut seed = Mnstr::new(user.id.clone(), None, None, Uuid::new_v4().to_string());
+        assert!(seed.create().await.is_none());
+        assert!(seed.is_seed);
+        let first = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let second = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let others = create_test_mnstr(&other, &Uuid::new_v4().to_string()).await;
+
+        let results = Mnstr::archive_batch(
+            user.id.clone(),
+            vec![
+                seed.id.clone(),
+                first.id.clone(),
+                second.id.clone(),
+                others.id.clone(),
+            ],
+        )
+        .await
+        .unwrap();
+        assert_eq!(
+            results
+                .iter()
+                .map(|result| result.status)
+                .collect::<Vec<MnstrArchiveStatus>>(),
+            vec![
+                MnstrArchiveStatus::Starter,
+                MnstrArchiveStatus::Archived,
+                MnstrArchiveStatus::Archived,
+                MnstrArchiveStatus::NotFound,
+            ]
+        );
+
+        for mnstr in [&first, &second] {
+            assert!(Mnstr::find_owned(mnstr.id.clone(), &user.id).await.is_err());
+        }
+        assert!(Mnstr::find_owned(seed.id.clone(), &user.id).await.is_ok());
+        assert!(
+            Mnstr::find_owned(others.id.clone(), &other.id)
+                .await
+                .is_ok()
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_create_batch_follows_collect_rules() {
+        let user = create_test_user().await;
+        let mnstrs = (0..3)
+            .map(|_| Mnstr::new(user.id.clone(), None, None, Uuid::new_v4().to_string()))
+            .collect::<Vec<Mnstr>>();
+
+        let created = Mnstr::create_batch(user.id.clone(), mnstrs.clone())
+            .await
+            .unwrap();
+        assert_eq!(
+            created
+                .iter()
+                .map(|mnstr| mnstr.mnstr_qr_code.clone())
+                .collect::<Vec<String>>(),
+            mnstrs
+                .iter()
+                .map(|mnstr| mnstr.mnstr_qr_code.clone())
+                .collect::<Vec<String>>()
+        );
+        assert_eq!(
+            created
+                .iter()
+                .map(|mnstr| mnstr.is_seed)
+                .collect::<Vec<bool>>(),
+            vec![true, false, false]
+        );
+        for mnstr in created.iter() {
+            assert_eq!(mnstr.rarity, rarity_for_qr_code(&mnstr.mnstr_qr_code));
+            assert_eq!(mnstr.coin_value, coins_for_qr_code(&mnstr.mnstr_qr_code));
+            assert!(!mnstr.mnstr_description.is_empty() || !descriptions_enabled());
+        }
+
+        let coins = created
+            .iter()
+            .map(|mnstr| mnstr.collect_awards(0).1)
+            .sum::<i32>();
+        assert_eq!(test_wallet(&user).await.coins, coins);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_collect_batch_keeps_input_order() {
+        let user = create_test_user().await;
+        let owned = Uuid::new_v4().to_string();
+        create_test_mnstr(&user, &owned).await;
+        let first = Uuid::new_v4().to_string();
+        let second = Uuid::new_v4().to_string();
+
+        let results = Mnstr::collect_batch(
+            user.id.clone(),
+            vec![
+                first.clone(),
+                owned.clone(),
+                "".to_string(),
+                second.clone(),
+                first.clone(),
+            ],
+        )
+        .await
+        .unwrap();
+        assert_eq!(
+            results
+                .iter()
+                .map(|result| (result.mnstr_qr_code.clone(), result.status))
+                .collect::<Vec<(String, MnstrCollectStatus)>>(),
+            vec![
+                (first, MnstrCollectStatus::Created),
+                (owned, MnstrCollectStatus::AlreadyOwned),
+                ("".to_string(), MnstrCollectStatus::Failed),
+                (second, MnstrCollectStatus::Created),
+            ]
+        );
+
+        let coins = [&results[0], &results[3]]
+            .iter()
+            .map(|result| result.mnstr.as_ref().unwrap().collect_awards(0).1)
+            .sum::<i32>();
+        assert_eq!(test_wallet(&user).await.coins, coins);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_update_batch_follows_update_rules() {
+        let user = create_test_user().await;
+        let owned = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let new_qr_code = Uuid::new_v4().to_string();
+
+        let updated = Mnstr::update_batch(
+            user.id.clone(),
+            vec![
+                MnstrBatchEdit {
+                    mnstr_qr_code: owned.mnstr_qr_code.clone(),
+                    version: Some(owned.version),
+                    mnstr_name: Some("Renamed".to_string()),
+                    ..Default::default()
+                },
+                MnstrBatchEdit {
+                    mnstr_qr_code: new_qr_code.clone(),
+                    ..Default::default()
+                },
+            ],
+        )
+        .await
+        .unwrap();
+        assert_eq!(updated.len(), 2);
+        assert_eq!(updated[0].id, owned.id);
+        assert_eq!(updated[0].mnstr_name, "Renamed");
+        assert_eq!(updated[0].version, owned.version + 1);
+        assert_eq!(updated[0].max_health, owned.max_health);
+        let edits = MnstrEdit::find_all_by_mnstr_id(owned.id.clone())
+            .await
+            .unwrap();
+        assert_eq!(edits.len(), 1);
+        assert_eq!(updated[1].mnstr_qr_code, new_qr_code);
+        assert_eq!(updated[1].rarity, rarity_for_qr_code(&new_qr_code));
+        assert_eq!(updated[1].coin_value, coins_for_qr_code(&new_qr_code));
+
+        // A stale version fails the batch, including the edits before it.
+        let error = Mnstr::update_batch(
+            user.id.clone(),
+            vec![
+                MnstrBatchEdit {
+                    mnstr_qr_code: new_qr_code.clone(),
+                    mnstr_name: Some("Untouched".to_string()),
+                    ..Default::default()
+                },
+                MnstrBatchEdit {
+                    mnstr_qr_code: owned.mnstr_qr_code.clone(),
+                    version: Some(owned.version),
+                    mnstr_name: Some("Stale".to_string()),
+                    ..Default::default()
+                },
+            ],
+        )
+        .await
+        .unwrap_err();
+        assert!(is_version_conflict(&error));
+        let untouched = Mnstr::find_owned(updated[1].id.clone(), &user.id)
+            .await
+            .unwrap();
+        assert_eq!(untouched.mnstr_name, updated[1].mnstr_name);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_find_most_recent_by_user_id() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let recent = Mnstr::find_most_recent_by_user_id(user.id.clone())
+            .await
+            .unwrap();
+        assert!(recent.is_none());
+
+        let older = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let newer = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let newest = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        for (mnstr, days_ago) in [(&older, 3), (&newer, 2), (&newest, 1)] {
+            sqlx::query("UPDATE mnstrs SET created_at = $2 WHERE id = $1")
+                .bind(mnstr.id.clone())
+                .bind(OffsetDateTime::now_utc() - time::Duration::days(days_ago))
+                .execute(&pool)
+                .await
+                .unwrap();
+        }
+
+        let recent = Mnstr::find_most_recent_by_user_id(user.id.clone())
+            .await
+            .unwrap();
+        assert_eq!(recent.map(|mnstr| mnstr.id), Some(newest.id.clone()));
+
+        archive_test_mnstr(&pool, &newest).await;
+        let recent = Mnstr::find_most_recent_by_user_id(user.id.clone())
+            .await
+            .unwrap();
+        assert_eq!(recent.map(|mnstr| mnstr.id), Some(newer.id.clone()));
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_concurrent_first_collects_make_one_seed() {
+        let user = create_test_user().await;
+        let collects = (0..4).map(|_| {
+            let mut mnstr = Mnstr::new(user.id.clone(), None, None, Uuid::new_v4().to_string());
+            async move {
+                assert!(mnstr.create().await.is_none());
+                mnstr
+            }
+        });
+        let created = futures::future::join_all(collects).await;
+        let seeds = created
+            .iter()
+            .filter(|mnstr| mnstr.is_seed)
+            .collect::<Vec<&Mnstr>>();
+        assert_eq!(seeds.len(), 1);
+
+        let listed = Mnstr::find_all_by_user_id(
+            user.id.clone(),
+            MnstrFilter {
+                is_seed: Some(true),
+                ..MnstrFilter::default()
+            },
+            None,
+            None,
+        )
+        .await
+        .unwrap();
+        assert_eq!(listed.len(), 1);
+        assert_eq!(listed[0].id, seeds[0].id);
+    }
+
+    async fn name_test_mnstr(pool: &sqlx::PgPool, user: &User, mnstr_name: &str) -> Mnstr {
+        let mnstr = create_test_mnstr(user, &Uuid::new_v4().to_string()).await;
+        sqlx::query("UPDATE mnstrs SET mnstr_name = $1 WHERE id = $2")
+            .bind(mnstr_name)
+            .bind(mnstr.id.clone())
+            .execute(pool)
+            .await
+            .unwrap();
+        mnstr
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_search_by_user_id() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let other = create_test_user().await;
+        let dragon = name_test_mnstr(&pool, &user, "Fluffy Dragon").await;
+        name_test_mnstr(&pool, &user, "Sea Serpent").await;
+        name_test_mnstr(&pool, &other, "Dragonfly").await;
+
+        for query in ["drag", "DRAGON", "ffy dr"] {
+            let found = Mnstr::search_by_user_id(user.id.clone(), query.to_string(), None, None)
+                .await
+                .unwrap();
+            assert_eq!(
+                found
+                    .iter()
+                    .map(|mnstr| mnstr.id.clone())
+                    .collect::<Vec<String>>(),
+                vec![dragon.id.clone()]
+            );
+        }
+
+        let found = Mnstr::search_by_user_id(user.id.clone(), "griffin".to_string(), None, None)
+            .await
+            .unwrap();
+        assert!(found.is_empty());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_release_archives_and_refunds_the_stored_coin_value() {
+        let pool = test_pool().await;
+        let mut user = create_test_user().await;
+        let mut mnstr = create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        sqlx::query("UPDATE mnstrs SET coin_value = 40 WHERE id = $1")
+            .bind(mnstr.id.clone())
+            .execute(&pool)
+            .await
+            .unwrap();
+
+        let refund = mnstr.release(&mut user).await.unwrap();
+        assert_eq!(refund, release_refund(40));
+        assert!(mnstr.archived_at.is_some());
+        assert!(Mnstr::find_owned(mnstr.id.clone(), &user.id).await.is_err());
+        assert_eq!(test_wallet(&user).await.coins, refund);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_collection_etag_depends_on_the_listing() {
+        let user = create_test_user().await;
+        create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        let all = MnstrFilter::default();
+        let seeds = MnstrFilter {
+            is_seed: Some(true),
+            ..MnstrFilter::default()
+        };
+
+        let etag = Mnstr::collection_etag(user.id.clone(), &all, None, None)
+            .await
+            .unwrap();
+        assert_eq!(
+            etag,
+            Mnstr::collection_etag(user.id.clone(), &all, None, None)
+                .await
+                .unwrap()
+        );
+        assert_ne!(
+            etag,
+            Mnstr::collection_etag(user.id.clone(), &seeds, None, None)
+                .await
+                .unwrap()
+        );
+        assert_ne!(
+            etag,
+            Mnstr::collection_etag(
+                user.id.clone(),
+                &all,
+                Some(MnstrOrderBy::CreatedAt),
+                Some(MnstrOrderDirection::Desc),
+            )
+            .await
+            .unwrap()
+        );
+
+        create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        assert_ne!(
+            etag,
+            Mnstr::collection_etag(user.id.clone(), &all, None, None)
+                .await
+                .unwrap()
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_detect_qr_collisions_flags_shared_codes() {
+        let pool = test_pool().await;
+        let shared_qr_code = Uuid::new_v4().to_string();
+        let common_qr_code = Uuid::new_v4().to_string();
+        let mut owners = Vec::new();
+        for _ in 0..DEFAULT_QR_COLLISION_THRESHOLD {
+            owners.push(create_test_user().await);
+        }
+        for owner in &owners {
+            create_test_mnstr(owner, &shared_qr_code).await;
+        }
+        create_test_mnstr(&owners[0], &shared_qr_code).await;
+        for owner in &owners[..3] {
+            create_test_mnstr(owner, &common_qr_code).await;
+        }
+        let archived_owner = create_test_user().await;
+        let archived = create_test_mnstr(&archived_owner, &shared_qr_code).await;
+        archive_test_mnstr(&pool, &archived).await;
+
+        let ours = |collisions: Vec<QrCollision>| {
+            collisions
+                .into_iter()
+                .filter(|collision| {
+                    collision.mnstr_qr_code == shared_qr_code
+                        || collision.mnstr_qr_code == common_qr_code
+                })
+                .collect::<Vec<QrCollision>>()
+        };
+        let collisions = Mnstr::detect_qr_collisions(DEFAULT_QR_COLLISION_THRESHOLD)
+            .await
+            .unwrap();
+        assert_eq!(
+            ours(collisions),
+            vec![QrCollision {
+                mnstr_qr_code: shared_qr_code.clone(),
+                owner_count: DEFAULT_QR_COLLISION_THRESHOLD,
+                mnstr_count: DEFAULT_QR_COLLISION_THRESHOLD + 1,
+            }]
+        );
+
+        let codes = ours(Mnstr::detect_qr_collisions(3).await.unwrap())
+            .into_iter()
+            .map(|collision| collision.mnstr_qr_code)
+            .collect::<Vec<String>>();
+        assert_eq!(codes, vec![shared_qr_code.clone(), common_qr_code.clone()]);
     }
 }
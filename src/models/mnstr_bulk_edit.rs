@@ -0,0 +1,384 @@
+use serde::{Deserialize, Serialize};
+
+use crate::{
+    config::config,
+    database::{traits::DatabaseResource, transaction::with_tx},
+    models::{
+        mnstr::{Mnstr, is_name_taken, normalize_mnstr_name},
+        mnstr_edit::MnstrEdit,
+    },
+    utils::validation::{
+        sanitize_mnstr_description, validate_mnstr_description, validate_mnstr_name,
+    },
+};
+
+pub const MAX_BULK_EDIT_SIZE: usize = 100;
+/// Replaced with each mnstr's name in a bulk edit description, so one
+/// template can describe many mnstrs.
+pub const MNSTR_NAME_PLACEHOLDER: &str = "{name}";
+
+/// The same name and/or description applied to many of a user's mnstrs.
+#[derive(Debug, Serialize, Deserialize, Clone, Default, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrBulkEdit {
+    pub ids: Vec<String>,
+    #[serde(default)]
+    pub mnstr_name: Option<String>,
+    #[serde(default)]
+    pub mnstr_description: Option<String>,
+}
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub enum MnstrBulkEditStatus {
+    Updated,
+    /// The mnstr already had the requested name and description.
+    Unchanged,
+    NotFound,
+    /// The edited name or description breaks the validation rules.
+    Invalid,
+    /// Another of the user's mnstrs already has the requested name.
+    NameConflict,
+}
+
+/// The outcome of editing a single mnstr in a bulk edit.
+#[derive(Debug, Serialize, Deserialize, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrBulkEditResult {
+    pub id: String,
+    pub status: MnstrBulkEditStatus,
+    pub error: Option<String>,
+    pub mnstr: Option<Mnstr>,
+}
+
+impl MnstrBulkEditResult {
+    fn new(id: String, status: MnstrBulkEditStatus) -> Self {
+        Self {
+            id,
+            status,
+            error: None,
+            mnstr: None,
+        }
+    }
+}
+
+impl MnstrBulkEdit {
+    /// Checks the request as a whole. Problems with single mnstrs are
+    /// reported in their results instead.
+    pub fn validate(&self) -> Result<(), anyhow::Error> {
+        if self.ids.is_empty() {
+            return Err(anyhow::Error::msg("No mnstrs to edit"));
+        }
+        if self.ids.len() > MAX_BULK_EDIT_SIZE {
+            return Err(anyhow::Error::msg(format!(
+                "At most {} mnstrs can be edited at once",
+                MAX_BULK_EDIT_SIZE
+            )));
+        }
+        if self.mnstr_name.is_none() && self.mnstr_description.is_none() {
+            return Err(anyhow::Error::msg("Nothing to edit"));
+        }
+        Ok(())
+    }
+
+    /// `mnstr` with the edit applied. `{name}` in the description becomes
+    /// the mnstr's name after the edit, and the result is sanitized.
+    pub fn apply(&self, mnstr: &Mnstr) -> Mnstr {
+        let mut edited = mnstr.clone();
+        if let Some(mnstr_name) = self.mnstr_name.as_ref() {
+            edited.mnstr_name = mnstr_name.clone();
+        }
+        if let Some(mnstr_description) = self.mnstr_description.as_ref() {
+            edited.mnstr_description = sanitize_mnstr_description(
+                &mnstr_description.replace(MNSTR_NAME_PLACEHOLDER, &edited.mnstr_name),
+            );
+        }
+        edited
+    }
+
+    /// Works out what happens to each requested id. `found` holds the
+    /// requested mnstrs and `others` the rest of the user's live mnstrs,
+    /// which are only checked for name clashes when `unique_names` is set.
+    /// Mnstrs owned by someone else are reported as not found so ids of other
+    /// users' mnstrs are not revealed. Duplicate ids are reported once.
+    pub fn plan(
+        &self,
+        user_id: &str,
+        found: &[Mnstr],
+        others: &[Mnstr],
+        unique_names: bool,
+    ) -> Vec<MnstrBulkEditResult> {
+        let mut taken = others.to_vec();
+        let mut results: Vec<MnstrBulkEditResult> = Vec::new();
+        for id in self.ids.iter() {
+            if results.iter().any(|result| &result.id == id) {
+                continue;
+            }
+            let mnstr = match found.iter().find(|mnstr| &mnstr.id == id) {
+                Some(mnstr) if mnstr.is_owned_by(user_id) => mnstr,
+                _ => {
+                    results.push(MnstrBulkEditResult::new(
+                        id.clone(),
+                        MnstrBulkEditStatus::NotFound,
+                    ));
+                    continue;
+                }
+            };
+
+            let edited = self.apply(mnstr);
+            let invalid = match self.mnstr_name {
+                Some(_) => validate_mnstr_name(&edited.mnstr_name).err(),
+                None => None,
+            }
+            .or_else(|| match self.mnstr_description {
+                Some(_) => validate_mnstr_description(&edited.mnstr_description).err(),
+                None => None,
+            });
+            if let Some(error) = invalid {
+                let mut result = MnstrBulkEditResult::new(id.clone(), MnstrBulkEditStatus::Invalid);
+                result.error = Some(error.to_string());
+                results.push(result);
+                continue;
+            }
+
+            if edited.mnstr_name == mnstr.mnstr_name
+                && edited.mnstr_description == mnstr.mnstr_description
+            {
+                let mut result =
+                    MnstrBulkEditResult::new(id.clone(), MnstrBulkEditStatus::Unchanged);
+                result.mnstr = Some(mnstr.clone());
+                results.push(result);
+                continue;
+            }
+
+            if unique_names
+                && normalize_mnstr_name(&edited.mnstr_name)
+                    != normalize_mnstr_name(&mnstr.mnstr_name)
+                && is_name_taken(&edited, &taken)
+            {
+                results.push(MnstrBulkEditResult::new(
+                    id.clone(),
+                    MnstrBulkEditStatus::NameConflict,
+                ));
+                continue;
+            }
+
+            taken.retain(|other| other.id != edited.id);
+            taken.push(edited.clone());
+            let mut result = MnstrBulkEditResult::new(id.clone(), MnstrBulkEditStatus::Updated);
+            result.mnstr = Some(edited);
+            results.push(result);
+        }
+        results
+    }
+
+    /// Applies the edit to every mnstr in `ids` that `user_id` owns, all in
+    /// one transaction, recording each change in the mnstr's edit history.
+    pub async fn save(&self, user_id: String) -> Result<Vec<MnstrBulkEditResult>, anyhow::Error> {
+        self.validate()?;
+        let edit = self.clone();
+        let unique_names = config().unique_mnstr_names;
+        let results = with_tx(move |conn| {
+            Box::pin(async move {
+                let rows = sqlx::query(
+                    "SELECT * FROM mnstrs WHERE id = ANY($1) AND archived_at IS NULL FOR UPDATE",
+                )
+                .bind(edit.ids.clone())
+                .fetch_all(&mut *conn)
+                .await?;
+                let found = Mnstr::from_rows(&rows)?;
+                let mut others: Vec<Mnstr> = Vec::new();
+                if unique_names {
+                    let rows = sqlx::query(
+                        "SELECT * FROM mnstrs WHERE user_id = $1 AND archived_at IS NULL",
+                    )
+                    .bind(user_id.clone())
+                    .fetch_all(&mut *conn)
+                    .await?;
+                    others = Mnstr::from_rows(&rows)?;
+                }
+
+                let mut results = edit.plan(&user_id, &found, &others, unique_names);
+                for result in results.iter_mut() {
+                    if result.status != MnstrBulkEditStatus::Updated {
+                        continue;
+                    }
+                    let previous = match found.iter().find(|mnstr| mnstr.id == result.id) {
+                        Some(previous) => previous,
+                        None => continue,
+                    };
+                    let edited = edit.apply(previous);
+                    let row = sqlx::query(
+                        "UPDATE mnstrs SET mnstr_name = $1, mnstr_description = $2,
+                            version = version + 1, updated_at = now()
+                        WHERE id = $3 AND user_id = $4
+                        RETURNING *",
+                    )
+                    .bind(edited.mnstr_name)
+                    .bind(edited.mnstr_description)
+                    .bind(result.id.clone())
+                    .bind(user_id.clone())
+                    .fetch_one(&mut *conn)
+                    .await?;
+                    let mnstr = Mnstr::from_row(&row)?;
+
+                    if let Some(mut mnstr_edit) =
+                        MnstrEdit::between(previous, &mnstr, user_id.clone())
+                    {
+                        mnstr_edit.record(&mut *conn).await?;
+                    }
+                    result.mnstr = Some(mnstr);
+                }
+                Ok(results)
+            })
+        })
+        .await;
+        if let Err(e) = results.as_ref() {
+            println!("[MnstrBulkEdit::save] Failed to edit mnstrs: {:?}", e);
+        }
+        results
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn mnstr(id: &str, user_id: &str, mnstr_name: &str) -> Mnstr {
+        let mut mnstr = Mnstr::new(
+            user_id.to_string(),
+            Some(mnstr_name.to_string()),
+            Some("Old description".to_string()),
+            format!("{}-qr", id),
+        );
+        mnstr.id = id.to_string();
+        mnstr
+    }
+
+    fn edit(
+        ids: &[&str],
+        mnstr_name: Option<&str>,
+        mnstr_description: Option<&str>,
+    ) -> MnstrBulkEdit {
+        MnstrBulkEdit {
+            ids: ids.iter().map(|id| id.to_string()).collect(),
+            mnstr_name: mnstr_name.map(str::to_string),
+            mnstr_description: mnstr_description.map(str::to_string),
+        }
+    }
+
+    fn statuses(results: &[MnstrBulkEditResult]) -> Vec<(&str, MnstrBulkEditStatus)> {
+        results
+            .iter()
+            .map(|result| (result.id.as_str(), result.status))
+            .collect()
+    }
+
+    #[test]
+    fn test_validate() {
+        assert!(edit(&["a"], None, Some("New")).validate().is_ok());
+        assert_eq!(
+            edit(&[], None, Some("New"))
+                .validate()
+                .unwrap_err()
+                .to_string(),
+            "No mnstrs to edit"
+        );
+        assert_eq!(
+            edit(&["a"], None, None).validate().unwrap_err().to_string(),
+            "Nothing to edit"
+        );
+        let ids = vec!["a"; MAX_BULK_EDIT_SIZE + 1];
+        assert!(edit(&ids, None, Some("New")).validate().is_err());
+    }
+
+    #[test]
+    fn test_plan_updates_every_owned_mnstr() {
+        let found = vec![mnstr("a", "owner", "Blaze"), mnstr("b", "owner", "Moss")];
+        let results = edit(&["a", "b"], None, Some("{name} guards the camp")).plan(
+            "owner",
+            &found,
+            &[],
+            false,
+        );
+
+        assert_eq!(
+            statuses(&results),
+            vec![
+                ("a", MnstrBulkEditStatus::Updated),
+                ("b", MnstrBulkEditStatus::Updated),
+            ]
+        );
+        let descriptions = results
+            .iter()
+            .map(|result| result.mnstr.as_ref().unwrap().mnstr_description.as_str())
+            .collect::<Vec<&str>>();
+        assert_eq!(
+            descriptions,
+            vec!["Blaze guards the camp", "Moss guards the camp"]
+        );
+        assert_eq!(results[0].mnstr.as_ref().unwrap().mnstr_name, "Blaze");
+    }
+
+    #[test]
+    fn test_plan_partial_ownership() {
+        let found = vec![mnstr("a", "owner", "Blaze"), mnstr("b", "stranger", "Moss")];
+        let results = edit(&["a", "b", "missing", "a"], None, Some("Shared")).plan(
+            "owner",
+            &found,
+            &[],
+            false,
+        );
+
+        assert_eq!(
+            statuses(&results),
+            vec![
+                ("a", MnstrBulkEditStatus::Updated),
+                ("b", MnstrBulkEditStatus::NotFound),
+                ("missing", MnstrBulkEditStatus::NotFound),
+            ]
+        );
+        assert!(results[1].mnstr.is_none());
+    }
+
+    #[test]
+    fn test_plan_reports_invalid_and_unchanged() {
+        let found = vec![mnstr("a", "owner", "Blaze")];
+
+        let results = edit(&["a"], Some(" "), None).plan("owner", &found, &[], false);
+        assert_eq!(results[0].status, MnstrBulkEditStatus::Invalid);
+        assert_eq!(results[0].error.as_deref(), Some("Name is required"));
+
+        let long = "x".repeat(300);
+        let results = edit(&["a"], None, Some(&long)).plan("owner", &found, &[], false);
+        assert_eq!(results[0].status, MnstrBulkEditStatus::Invalid);
+
+        let results =
+            edit(&["a"], Some("Blaze"), Some("Old description")).plan("owner", &found, &[], false);
+        assert_eq!(results[0].status, MnstrBulkEditStatus::Unchanged);
+    }
+
+    #[test]
+    fn test_plan_name_conflicts_with_unique_names() {
+        let found = vec![mnstr("a", "owner", "Blaze"), mnstr("b", "owner", "Moss")];
+        let others = vec![
+            found[0].clone(),
+            found[1].clone(),
+            mnstr("c", "owner", "Pebble"),
+        ];
+
+        let results = edit(&["a", "b"], Some("Sprout"), None).plan("owner", &found, &others, true);
+        assert_eq!(
+            statuses(&results),
+            vec![
+                ("a", MnstrBulkEditStatus::Updated),
+                ("b", MnstrBulkEditStatus::NameConflict),
+            ]
+        );
+
+        let results = edit(&["a"], Some("pebble"), None).plan("owner", &found, &others, true);
+        assert_eq!(results[0].status, MnstrBulkEditStatus::NameConflict);
+
+        let results = edit(&["a"], Some("pebble"), None).plan("owner", &found, &others, false);
+        assert_eq!(results[0].status, MnstrBulkEditStatus::Updated);
+    }
+}
@@ -0,0 +1,156 @@
+use sqlx::{Row, postgres::PgRow};
+
+use crate::{config::config, database::connection::get_connection, models::mnstr::Mnstr};
+
+pub const NOT_IN_CATALOG: &str = "Mnstr is not in the catalog";
+
+/// The canonical name and stats of a mnstr printed on a physical card.
+#[derive(Debug, Clone, PartialEq)]
+pub struct MnstrCatalogEntry {
+    pub mnstr_qr_code: String,
+    pub mnstr_name: String,
+    pub mnstr_description: String,
+    pub max_health: i32,
+    pub max_attack: i32,
+    pub max_defense: i32,
+    pub max_speed: i32,
+    pub max_intelligence: i32,
+    pub max_magic: i32,
+}
+
+/// The catalog entry for `mnstr_qr_code`. Always `None` without a query when
+/// REQUIRE_MNSTR_CATALOG is off.
+pub async fn lookup_catalog_entry(
+    mnstr_qr_code: &str,
+) -> Result<Option<MnstrCatalogEntry>, anyhow::Error> {
+    if !config().require_mnstr_catalog {
+        return Ok(None);
+    }
+    let pool = get_connection().await;
+    match sqlx::query("SELECT * FROM mnstr_catalog WHERE mnstr_qr_code = $1")
+        .bind(mnstr_qr_code)
+        .fetch_optional(&pool)
+        .await
+    {
+        Ok(row) => Ok(row.as_ref().map(MnstrCatalogEntry::from_row)),
+        Err(e) => {
+            println!("[lookup_catalog_entry] Failed to get catalog entry: {:?}", e);
+            Err(e.into())
+        }
+    }
+}
+
+/// Gives `mnstr` its catalog stats, and its catalog name and description
+/// unless the player chose their own. Without an entry the mnstr is only
+/// allowed when the catalog is not `required`.
+pub fn apply_catalog(
+    mnstr: &mut Mnstr,
+    required: bool,
+    entry: Option<&MnstrCatalogEntry>,
+) -> Result<(), anyhow::Error> {
+    let entry = match entry {
+        Some(entry) => entry,
+        None if required => return Err(anyhow::Error::msg(NOT_IN_CATALOG)),
+        None => return Ok(()),
+    };
+    if mnstr.mnstr_name.is_empty() {
+        mnstr.mnstr_name = entry.mnstr_name.clone();
+    }
+    if mnstr.mnstr_description.is_empty() {
+        mnstr.mnstr_description = entry.mnstr_description.clone();
+    }
+    mnstr.max_health = entry.max_health;
+    mnstr.current_health = entry.max_health;
+    mnstr.max_attack = entry.max_attack;
+    mnstr.current_attack = entry.max_attack;
+    mnstr.max_defense = entry.max_defense;
+    mnstr.current_defense = entry.max_defense;
+    mnstr.max_speed = entry.max_speed;
+    mnstr.current_speed = entry.max_speed;
+    mnstr.max_intelligence = entry.max_intelligence;
+    mnstr.current_intelligence = entry.max_intelligence;
+    mnstr.max_magic = entry.max_magic;
+    mnstr.current_magic = entry.max_magic;
+    Ok(())
+}
+
+/// Looks `mnstr` up in the catalog and applies what it finds.
+pub async fn check_catalog(mnstr: &mut Mnstr) -> Result<(), anyhow::Error> {
+    let entry = lookup_catalog_entry(&mnstr.mnstr_qr_code).await?;
+    apply_catalog(mnstr, config().require_mnstr_catalog, entry.as_ref())
+}
+
+impl MnstrCatalogEntry {
+    fn from_row(row: &PgRow) -> Self {
+        Self {
+            mnstr_qr_code: row.get("mnstr_qr_code"),
+            mnstr_name: row.get("mnstr_name"),
+            mnstr_description: row.get("mnstr_description"),
+            max_health: row.get("max_health"),
+            max_attack: row.get("max_attack"),
+            max_defense: row.get("max_defense"),
+            max_speed: row.get("max_speed"),
+            max_intelligence: row.get("max_intelligence"),
+            max_magic: row.get("max_magic"),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::models::mnstr::DEFAULT_STAT_VALUE;
+
+    fn entry() -> MnstrCatalogEntry {
+        MnstrCatalogEntry {
+            mnstr_qr_code: "card-001".to_string(),
+            mnstr_name: "Emberpup".to_string(),
+            mnstr_description: "A small dog with a warm nose".to_string(),
+            max_health: 14,
+            max_attack: 12,
+            max_defense: 9,
+            max_speed: 11,
+            max_intelligence: 8,
+            max_magic: 13,
+        }
+    }
+
+    fn mnstr(mnstr_qr_code: &str) -> Mnstr {
+        Mnstr::new("user".to_string(), None, None, mnstr_qr_code.to_string())
+    }
+
+    #[test]
+    fn test_catalog_hit_uses_canonical_name_and_stats() {
+        let mut collected = mnstr("card-001");
+        apply_catalog(&mut collected, true, Some(&entry())).unwrap();
+        assert_eq!(collected.mnstr_name, "Emberpup");
+        assert_eq!(collected.mnstr_description, "A small dog with a warm nose");
+        assert_eq!((collected.current_health, collected.max_health), (14, 14));
+        assert_eq!(collected.max_magic, 13);
+
+        let mut named = Mnstr::new(
+            "user".to_string(),
+            Some("Sparky".to_string()),
+            None,
+            "card-001".to_string(),
+        );
+        apply_catalog(&mut named, true, Some(&entry())).unwrap();
+        assert_eq!(named.mnstr_name, "Sparky");
+        assert_eq!(named.max_attack, 12);
+    }
+
+    #[test]
+    fn test_catalog_miss_is_rejected_when_required() {
+        let mut collected = mnstr("not-a-card");
+        let error = apply_catalog(&mut collected, true, None).unwrap_err();
+        assert_eq!(error.to_string(), NOT_IN_CATALOG);
+    }
+
+    #[test]
+    fn test_disabled_catalog_passes_through() {
+        let mut collected = mnstr("anything");
+        apply_catalog(&mut collected, false, None).unwrap();
+        assert!(collected.mnstr_name.is_empty());
+        assert_eq!(collected.max_health, DEFAULT_STAT_VALUE);
+    }
+}
@@ -0,0 +1,122 @@
+use sha2::{Digest, Sha256};
+
+use crate::{config::config, models::mnstr::Mnstr};
+
+const TEMPERAMENTS: [&str; 8] = [
+    "curious", "grumpy", "playful", "shy", "fearless", "sleepy", "mischievous", "loyal",
+];
+
+const HABITATS: [&str; 8] = [
+    "mossy caves",
+    "windswept cliffs",
+    "city rooftops",
+    "sunken ruins",
+    "glowing marshes",
+    "frozen peaks",
+    "old libraries",
+    "thunderclouds",
+];
+
+const QUIRKS: [&str; 8] = [
+    "hoards shiny buttons",
+    "hums when it is happy",
+    "naps in teacups",
+    "chases its own shadow",
+    "collects lost socks",
+    "sneezes sparks",
+    "counts the stars every night",
+    "cannot resist a puddle",
+];
+
+/// Descriptions are generated for new mnstrs unless
+/// `GENERATE_MNSTR_DESCRIPTIONS` is set to `false`.
+pub fn descriptions_enabled() -> bool {
+    config().generate_mnstr_descriptions
+}
+
+/// Flavor text for `mnstr` built from its QR code, strongest stat and
+/// level. The same mnstr always gets the same description.
+pub fn generate_description(mnstr: &Mnstr) -> String {
+    let hash = Sha256::digest(mnstr.mnstr_qr_code.as_bytes());
+    let temperament = TEMPERAMENTS[hash[0] as usize % TEMPERAMENTS.len()];
+    let habitat = HABITATS[hash[1] as usize % HABITATS.len()];
+    let quirk = QUIRKS[hash[3] as usize % QUIRKS.len()];
+
+    let stats = [
+        (mnstr.max_health, "shrugs off blows that would fell a giant"),
+        (mnstr.max_attack, "hits far harder than it looks"),
+        (mnstr.max_defense, "hides behind a hide like stone"),
+        (mnstr.max_speed, "is gone before you can blink"),
+        (mnstr.max_intelligence, "outwits anyone who underestimates it"),
+        (mnstr.max_magic, "hums with strange magic"),
+    ];
+    // New mnstrs start with every stat equal, so the QR code picks where
+    // ties start and the text only changes when the stats do.
+    let first = hash[2] as usize % stats.len();
+    let strength = (0..stats.len())
+        .map(|offset| stats[(first + offset) % stats.len()])
+        .fold(
+            stats[first],
+            |best, stat| if stat.0 > best.0 { stat } else { best },
+        )
+        .1;
+
+    format!(
+        "A {} mnstr from the {} that {} and {}. Level {} and still growing.",
+        temperament, habitat, strength, quirk, mnstr.current_level
+    )
+}
+
+/// The description to store for a new mnstr: the user's own, or generated
+/// flavor text when they left it empty.
+pub fn description_for_insert(mnstr: &Mnstr) -> String {
+    if !mnstr.mnstr_description.trim().is_empty() || !descriptions_enabled() {
+        return mnstr.mnstr_description.clone();
+    }
+    generate_description(mnstr)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn mnstr(qr_code: &str) -> Mnstr {
+        Mnstr::new("user".to_string(), None, None, qr_code.to_string())
+    }
+
+    #[test]
+    fn test_generate_description_is_deterministic() {
+        let description = generate_description(&mnstr("mnstr-22"));
+        assert_eq!(description, generate_description(&mnstr("mnstr-22")));
+        assert!(description.ends_with("Level 0 and still growing."));
+        assert_ne!(description, generate_description(&mnstr("mnstr-23")));
+    }
+
+    #[test]
+    fn test_generate_description_varies_by_qr_code() {
+        let descriptions = (0..50)
+            .map(|n| generate_description(&mnstr(&format!("mnstr-{}", n))))
+            .collect::<std::collections::HashSet<String>>();
+        assert!(descriptions.len() > 40);
+
+        let strengths = (0..50)
+            .map(|n| generate_description(&mnstr(&format!("mnstr-{}", n))))
+            .filter(|description| description.contains("gone before you can blink"))
+            .count();
+        assert!(strengths > 0 && strengths < 50);
+    }
+
+    #[test]
+    fn test_generate_description_uses_strongest_stat() {
+        let mut fast = mnstr("mnstr-22");
+        fast.max_speed = 99;
+        assert!(generate_description(&fast).contains("gone before you can blink"));
+    }
+
+    #[test]
+    fn test_description_for_insert_keeps_user_text() {
+        let mut edited = mnstr("mnstr-22");
+        edited.mnstr_description = "My best friend".to_string();
+        assert_eq!(description_for_insert(&edited), "My best friend");
+    }
+}
@@ -0,0 +1,217 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use sqlx::{Error, PgConnection, Row, postgres::PgRow};
+use time::OffsetDateTime;
+use uuid::Uuid;
+
+use crate::{
+    database::{connection::get_connection, traits::DatabaseResource},
+    insert_resource,
+    models::mnstr::Mnstr,
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+/// A change to a mnstr's name or description, kept for moderation.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrEdit {
+    pub id: String,
+    pub mnstr_id: String,
+    pub user_id: String,
+    pub previous_name: String,
+    pub new_name: String,
+    pub previous_description: String,
+    pub new_description: String,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+}
+
+impl MnstrEdit {
+    /// The edit `user_id` made by turning `previous` into `current`, or `None`
+    /// if neither the name nor the description changed.
+    pub fn between(previous: &Mnstr, current: &Mnstr, user_id: String) -> Option<Self> {
+        if previous.mnstr_name == current.mnstr_name
+            && previous.mnstr_description == current.mnstr_description
+        {
+            return None;
+        }
+        Some(Self {
+            id: "".to_string(),
+            mnstr_id: current.id.clone(),
+            user_id,
+            previous_name: previous.mnstr_name.clone(),
+            new_name: current.mnstr_name.clone(),
+            previous_description: previous.mnstr_description.clone(),
+            new_description: current.mnstr_description.clone(),
+            created_at: None,
+        })
+    }
+
+    pub async fn create(&mut self) -> Option<anyhow::Error> {
+        let params = vec![
+            ("mnstr_id", self.mnstr_id.clone().into()),
+            ("user_id", self.user_id.clone().into()),
+            ("previous_name", self.previous_name.clone().into()),
+            ("new_name", self.new_name.clone().into()),
+            ("previous_description", self.previous_description.clone().into()),
+            ("new_description", self.new_description.clone().into()),
+        ];
+        let edit = match insert_resource!(MnstrEdit, params).await {
+            Ok(edit) => edit,
+            Err(e) => {
+                println!("[MnstrEdit::create] Failed to create mnstr edit: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        *self = edit;
+        None
+    }
+
+    /// Records the edit as part of the caller's transaction, so it commits
+    /// with the change it describes.
+    pub async fn record(&mut self, conn: &mut PgConnection) -> Result<(), anyhow::Error> {
+        let row = match sqlx::query(
+            "INSERT INTO mnstr_edits (id, mnstr_id, user_id, previous_name, new_name,
+                previous_description, new_description, created_at)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, now())
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(self.mnstr_id.clone())
+        .bind(self.user_id.clone())
+        .bind(self.previous_name.clone())
+        .bind(self.new_name.clone())
+        .bind(self.previous_description.clone())
+        .bind(self.new_description.clone())
+        .fetch_one(conn)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[MnstrEdit::record] Failed to record mnstr edit: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        *self = MnstrEdit::from_row(&row)?;
+        Ok(())
+    }
+
+    pub async fn find_all_by_mnstr_id(mnstr_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query("SELECT * FROM mnstr_edits WHERE mnstr_id = $1 ORDER BY created_at DESC")
+            .bind(mnstr_id)
+            .fetch_all(&pool)
+            .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(MnstrEdit::from_row)
+                .collect::<Result<Vec<MnstrEdit>, _>>()?),
+            Err(e) => {
+                println!(
+                    "[MnstrEdit::find_all_by_mnstr_id] Failed to get mnstr edits: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_mnstr_id(mnstr_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM mnstr_edits WHERE mnstr_id = $1")
+            .bind(mnstr_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[MnstrEdit::delete_permanent_by_mnstr_id] Failed to delete mnstr edits: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM mnstr_edits WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[MnstrEdit::delete_permanent_by_user_id] Failed to delete mnstr edits: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+impl DatabaseResource for MnstrEdit {
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        Ok(MnstrEdit {
+            id: row.get("id"),
+            mnstr_id: row.get("mnstr_id"),
+            user_id: row.get("user_id"),
+            previous_name: row.get("previous_name"),
+            new_name: row.get("new_name"),
+            previous_description: row.get("previous_description"),
+            new_description: row.get("new_description"),
+            created_at: row.get("created_at"),
+        })
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        false
+    }
+    fn is_updatable() -> bool {
+        false
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_between() {
+        let mut previous = Mnstr::new(
+            "owner".to_string(),
+            Some("Fluffy".to_string()),
+            Some("Soft".to_string()),
+            "qr".to_string(),
+        );
+        previous.id = "mnstr".to_string();
+
+        let mut current = previous.clone();
+        current.max_health += 5;
+        assert_eq!(MnstrEdit::between(&previous, &current, "owner".to_string()), None);
+
+        current.mnstr_name = "Spike".to_string();
+        let edit = MnstrEdit::between(&previous, &current, "owner".to_string()).unwrap();
+        assert_eq!(edit.mnstr_id, "mnstr");
+        assert_eq!(edit.user_id, "owner");
+        assert_eq!(edit.previous_name, "Fluffy");
+        assert_eq!(edit.new_name, "Spike");
+        assert_eq!(edit.previous_description, "Soft");
+        assert_eq!(edit.new_description, "Soft");
+    }
+}
@@ -0,0 +1,179 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use sqlx::{Error, Row, postgres::PgRow};
+use time::OffsetDateTime;
+
+use crate::{
+    database::{connection::get_connection, traits::DatabaseResource},
+    models::mnstr::Mnstr,
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+/// A mnstr evolving by absorbing a duplicate of itself, kept for auditing.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrEvolution {
+    pub id: String,
+    pub user_id: String,
+    pub mnstr_id: String,
+    pub fodder_mnstr_id: String,
+    pub from_level: i32,
+    pub to_level: i32,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+}
+
+/// Checks that `user_id` may evolve `mnstr` by absorbing `fodder`. Both must
+/// be theirs and come from the same QR code, and a seed mnstr is never fodder.
+pub fn validate_evolution(mnstr: &Mnstr, fodder: &Mnstr, user_id: &str) -> Result<(), anyhow::Error> {
+    if mnstr.id == fodder.id {
+        return Err(anyhow::Error::msg("Cannot evolve a mnstr with itself"));
+    }
+    if !mnstr.is_owned_by(user_id) || !fodder.is_owned_by(user_id) {
+        return Err(anyhow::Error::msg("Mnstr not found"));
+    }
+    if mnstr.mnstr_qr_code != fodder.mnstr_qr_code {
+        return Err(anyhow::Error::msg("Mnstrs are not compatible"));
+    }
+    if fodder.is_seed {
+        return Err(anyhow::Error::msg("Starter mnstrs cannot be used to evolve"));
+    }
+    Ok(())
+}
+
+impl MnstrEvolution {
+    pub async fn find_all_by_mnstr_id(mnstr_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM mnstr_evolutions WHERE mnstr_id = $1 ORDER BY created_at DESC",
+        )
+        .bind(mnstr_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(MnstrEvolution::from_row)
+                .collect::<Result<Vec<MnstrEvolution>, _>>()?),
+            Err(e) => {
+                println!(
+                    "[MnstrEvolution::find_all_by_mnstr_id] Failed to get mnstr evolutions: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_mnstr_id(mnstr_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) =
+            sqlx::query("DELETE FROM mnstr_evolutions WHERE mnstr_id = $1 OR fodder_mnstr_id = $1")
+                .bind(mnstr_id)
+                .execute(&pool)
+                .await
+        {
+            println!(
+                "[MnstrEvolution::delete_permanent_by_mnstr_id] Failed to delete mnstr evolutions: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM mnstr_evolutions WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[MnstrEvolution::delete_permanent_by_user_id] Failed to delete mnstr evolutions: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+impl DatabaseResource for MnstrEvolution {
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        Ok(MnstrEvolution {
+            id: row.get("id"),
+            user_id: row.get("user_id"),
+            mnstr_id: row.get("mnstr_id"),
+            fodder_mnstr_id: row.get("fodder_mnstr_id"),
+            from_level: row.get("from_level"),
+            to_level: row.get("to_level"),
+            created_at: row.get("created_at"),
+        })
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        false
+    }
+    fn is_updatable() -> bool {
+        false
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn mnstr(id: &str, mnstr_qr_code: &str) -> Mnstr {
+        let mut mnstr = Mnstr::new("owner".to_string(), None, None, mnstr_qr_code.to_string());
+        mnstr.id = id.to_string();
+        mnstr
+    }
+
+    #[test]
+    fn test_validate_evolution() {
+        assert!(validate_evolution(&mnstr("a", "qr"), &mnstr("b", "qr"), "owner").is_ok());
+    }
+
+    #[test]
+    fn test_validate_evolution_incompatible() {
+        let error = validate_evolution(&mnstr("a", "qr"), &mnstr("b", "other"), "owner").unwrap_err();
+        assert_eq!(error.to_string(), "Mnstrs are not compatible");
+
+        let error = validate_evolution(&mnstr("a", "qr"), &mnstr("a", "qr"), "owner").unwrap_err();
+        assert_eq!(error.to_string(), "Cannot evolve a mnstr with itself");
+
+        let mut seed = mnstr("b", "qr");
+        seed.is_seed = true;
+        assert!(validate_evolution(&mnstr("a", "qr"), &seed, "owner").is_err());
+    }
+
+    #[test]
+    fn test_validate_evolution_ownership() {
+        let error = validate_evolution(&mnstr("a", "qr"), &mnstr("b", "qr"), "stranger").unwrap_err();
+        assert_eq!(error.to_string(), "Mnstr not found");
+
+        let mut fodder = mnstr("b", "qr");
+        fodder.user_id = "stranger".to_string();
+        assert!(validate_evolution(&mnstr("a", "qr"), &fodder, "owner").is_err());
+
+        let mut archived = mnstr("b", "qr");
+        archived.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(validate_evolution(&mnstr("a", "qr"), &archived, "owner").is_err());
+    }
+}
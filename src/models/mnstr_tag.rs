@@ -0,0 +1,181 @@
+use std::collections::HashMap;
+
+use sqlx::{PgConnection, Row};
+use uuid::Uuid;
+
+use crate::database::connection::get_connection;
+
+/// Most tags a single mnstr can carry.
+pub const MAX_TAGS_PER_MNSTR: usize = 10;
+pub const MAX_TAG_LENGTH: usize = 32;
+
+/// The stored form of `tag`: trimmed, lowercased and with runs of whitespace
+/// collapsed, so "For  Trade" and "for trade" are the same tag.
+pub fn tag_key(tag: &str) -> String {
+    tag.split_whitespace()
+        .collect::<Vec<_>>()
+        .join(" ")
+        .to_lowercase()
+}
+
+/// `tag` in its stored form, or why it cannot be used.
+pub fn normalize_tag(tag: &str) -> Result<String, anyhow::Error> {
+    let tag = tag_key(tag);
+    if tag.is_empty() {
+        return Err(anyhow::Error::msg("Tag is required"));
+    }
+    if tag.chars().count() > MAX_TAG_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Tags must be at most {} characters",
+            MAX_TAG_LENGTH
+        )));
+    }
+    Ok(tag)
+}
+
+/// `tags` with `tag` added. Adding a tag the mnstr already has changes
+/// nothing; adding one past the cap is an error.
+pub fn with_tag(tags: &[String], tag: &str) -> Result<Vec<String>, anyhow::Error> {
+    let tag = normalize_tag(tag)?;
+    let mut tags = tags.to_vec();
+    if tags.contains(&tag) {
+        return Ok(tags);
+    }
+    if tags.len() >= MAX_TAGS_PER_MNSTR {
+        return Err(anyhow::Error::msg(format!(
+            "A mnstr can have at most {} tags",
+            MAX_TAGS_PER_MNSTR
+        )));
+    }
+    tags.push(tag);
+    tags.sort();
+    Ok(tags)
+}
+
+/// `tags` without `tag`.
+pub fn without_tag(tags: &[String], tag: &str) -> Vec<String> {
+    let tag = tag_key(tag);
+    tags.iter().filter(|existing| **existing != tag).cloned().collect()
+}
+
+/// A label a user has put on one of their mnstrs.
+pub struct MnstrTag;
+
+impl MnstrTag {
+    /// The tags of each of `mnstr_ids`, sorted. Mnstrs without tags are left
+    /// out.
+    pub async fn find_all_by_mnstr_ids(
+        mnstr_ids: Vec<String>,
+    ) -> Result<HashMap<String, Vec<String>>, anyhow::Error> {
+        let pool = get_connection().await;
+        let rows = match sqlx::query(
+            "SELECT mnstr_id, tag FROM mnstr_tags WHERE mnstr_id = ANY($1) ORDER BY tag ASC",
+        )
+        .bind(mnstr_ids)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!(
+                    "[MnstrTag::find_all_by_mnstr_ids] Failed to get mnstr tags: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        let mut tags: HashMap<String, Vec<String>> = HashMap::new();
+        for row in rows {
+            tags.entry(row.get("mnstr_id"))
+                .or_default()
+                .push(row.get("tag"));
+        }
+        Ok(tags)
+    }
+
+    /// Replaces the stored tags of `mnstr_id` with `tags`.
+    pub async fn replace_all(
+        conn: &mut PgConnection,
+        mnstr_id: &str,
+        tags: &[String],
+    ) -> Result<(), anyhow::Error> {
+        if let Err(e) =
+            sqlx::query("DELETE FROM mnstr_tags WHERE mnstr_id = $1 AND NOT (tag = ANY($2))")
+                .bind(mnstr_id)
+                .bind(tags)
+                .execute(&mut *conn)
+                .await
+        {
+            println!("[MnstrTag::replace_all] Failed to delete mnstr tags: {:?}", e);
+            return Err(e.into());
+        }
+        for tag in tags {
+            if let Err(e) = sqlx::query(
+                "INSERT INTO mnstr_tags (id, mnstr_id, tag, created_at) VALUES ($1, $2, $3, now())
+                ON CONFLICT (mnstr_id, tag) DO NOTHING",
+            )
+            .bind(Uuid::new_v4().to_string())
+            .bind(mnstr_id)
+            .bind(tag)
+            .execute(&mut *conn)
+            .await
+            {
+                println!("[MnstrTag::replace_all] Failed to insert mnstr tag: {:?}", e);
+                return Err(e.into());
+            }
+        }
+        Ok(())
+    }
+
+    pub async fn delete_permanent_by_mnstr_id(mnstr_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM mnstr_tags WHERE mnstr_id = $1")
+            .bind(mnstr_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[MnstrTag::delete_permanent_by_mnstr_id] Failed to delete mnstr tags: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_normalize_tag() {
+        assert_eq!(normalize_tag("  For   Trade ").unwrap(), "for trade");
+        assert_eq!(normalize_tag("FAVORITES").unwrap(), "favorites");
+        assert!(normalize_tag("   ").is_err());
+        assert!(normalize_tag(&"x".repeat(MAX_TAG_LENGTH + 1)).is_err());
+    }
+
+    #[test]
+    fn test_add_and_remove_tag() {
+        let tags = with_tag(&[], "Favorites").unwrap();
+        assert_eq!(tags, vec!["favorites"]);
+
+        let tags = with_tag(&tags, "for trade").unwrap();
+        assert_eq!(tags, vec!["favorites", "for trade"]);
+        assert_eq!(with_tag(&tags, "FAVORITES").unwrap(), tags);
+
+        assert_eq!(without_tag(&tags, " Favorites "), vec!["for trade"]);
+        assert_eq!(without_tag(&tags, "missing"), tags);
+    }
+
+    #[test]
+    fn test_tags_are_capped() {
+        let mut tags = Vec::new();
+        for i in 0..MAX_TAGS_PER_MNSTR {
+            tags = with_tag(&tags, &format!("tag {}", i)).unwrap();
+        }
+        assert!(with_tag(&tags, "one too many").is_err());
+        assert!(with_tag(&tags, "tag 3").is_ok());
+    }
+}
@@ -0,0 +1,166 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use sqlx::{Error, Row, postgres::PgRow};
+use time::OffsetDateTime;
+
+use crate::{
+    database::{connection::get_connection, traits::DatabaseResource},
+    models::mnstr::Mnstr,
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+/// A mnstr changing hands outside of a trade, kept for auditing.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct MnstrTransfer {
+    pub id: String,
+    pub mnstr_id: String,
+    pub from_user_id: String,
+    pub to_user_id: String,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+}
+
+/// Checks that `user_id` may gift `mnstr` to `to_user_id`.
+pub fn validate_gift(mnstr: &Mnstr, user_id: &str, to_user_id: &str) -> Result<(), anyhow::Error> {
+    if user_id == to_user_id {
+        return Err(anyhow::Error::msg("Cannot gift a mnstr to yourself"));
+    }
+    if !mnstr.is_owned_by(user_id) {
+        return Err(anyhow::Error::msg("Mnstr is not owned by user"));
+    }
+    if mnstr.is_seed {
+        return Err(anyhow::Error::msg("Starter mnstrs cannot be gifted"));
+    }
+    Ok(())
+}
+
+impl MnstrTransfer {
+    pub async fn find_all_by_mnstr_id(mnstr_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM mnstr_transfers WHERE mnstr_id = $1 ORDER BY created_at DESC",
+        )
+        .bind(mnstr_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(MnstrTransfer::from_row)
+                .collect::<Result<Vec<MnstrTransfer>, _>>()?),
+            Err(e) => {
+                println!(
+                    "[MnstrTransfer::find_all_by_mnstr_id] Failed to get mnstr transfers: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_mnstr_id(mnstr_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM mnstr_transfers WHERE mnstr_id = $1")
+            .bind(mnstr_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[MnstrTransfer::delete_permanent_by_mnstr_id] Failed to delete mnstr transfers: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) =
+            sqlx::query("DELETE FROM mnstr_transfers WHERE from_user_id = $1 OR to_user_id = $1")
+                .bind(user_id)
+                .execute(&pool)
+                .await
+        {
+            println!(
+                "[MnstrTransfer::delete_permanent_by_user_id] Failed to delete mnstr transfers: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+impl DatabaseResource for MnstrTransfer {
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        Ok(MnstrTransfer {
+            id: row.get("id"),
+            mnstr_id: row.get("mnstr_id"),
+            from_user_id: row.get("from_user_id"),
+            to_user_id: row.get("to_user_id"),
+            created_at: row.get("created_at"),
+        })
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        false
+    }
+    fn is_updatable() -> bool {
+        false
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn mnstr() -> Mnstr {
+        Mnstr::new("owner".to_string(), None, None, "qr".to_string())
+    }
+
+    #[test]
+    fn test_validate_gift() {
+        assert!(validate_gift(&mnstr(), "owner", "friend").is_ok());
+    }
+
+    #[test]
+    fn test_validate_gift_not_owned() {
+        let error = validate_gift(&mnstr(), "stranger", "friend").unwrap_err();
+        assert_eq!(error.to_string(), "Mnstr is not owned by user");
+
+        let mut archived = mnstr();
+        archived.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(validate_gift(&archived, "owner", "friend").is_err());
+    }
+
+    #[test]
+    fn test_validate_gift_to_self() {
+        let error = validate_gift(&mnstr(), "owner", "owner").unwrap_err();
+        assert_eq!(error.to_string(), "Cannot gift a mnstr to yourself");
+    }
+
+    #[test]
+    fn test_validate_gift_seed() {
+        let mut seed = mnstr();
+        seed.is_seed = true;
+        let error = validate_gift(&seed, "owner", "friend").unwrap_err();
+        assert_eq!(error.to_string(), "Starter mnstrs cannot be gifted");
+    }
+}
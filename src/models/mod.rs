@@ -1,14 +1,33 @@
+pub mod achievement;
+pub mod api_token;
 pub mod battle;
 pub mod battle_log;
 pub mod battle_status;
+pub mod collect_cooldown;
+pub mod daily_reward;
 pub mod effect;
+pub mod experience;
+pub mod game_stats;
 pub mod generated;
+pub mod idempotency_key;
 pub mod item;
 pub mod item_effect;
+pub mod login_throttle;
 pub mod mnstr;
+pub mod mnstr_bulk_edit;
+pub mod mnstr_catalog;
+pub mod mnstr_description;
+pub mod mnstr_edit;
+pub mod mnstr_evolution;
+pub mod mnstr_tag;
+pub mod mnstr_transfer;
 pub mod mnstr_user_item;
+pub mod ownership_event;
 pub mod session;
+pub mod share_link;
+pub mod trade;
 pub mod transaction;
 pub mod user;
 pub mod user_item;
 pub mod wallet;
+pub mod xp_multiplier;
@@ -0,0 +1,274 @@
+use juniper::{GraphQLEnum, GraphQLObject};
+use serde::{Deserialize, Serialize};
+use sqlx::{
+    Error, PgConnection, Postgres, Row,
+    postgres::{PgRow, PgValueRef},
+};
+use time::OffsetDateTime;
+use uuid::Uuid;
+
+use crate::{
+    database::{connection::get_connection, traits::DatabaseResource},
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+#[derive(Debug, Serialize, Deserialize, GraphQLEnum, Clone, Copy, PartialEq, Eq)]
+pub enum OwnershipEventType {
+    Collected,
+    Gifted,
+    Traded,
+    Released,
+}
+
+impl std::fmt::Display for OwnershipEventType {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            OwnershipEventType::Collected => write!(f, "collected"),
+            OwnershipEventType::Gifted => write!(f, "gifted"),
+            OwnershipEventType::Traded => write!(f, "traded"),
+            OwnershipEventType::Released => write!(f, "released"),
+        }
+    }
+}
+
+impl From<&str> for OwnershipEventType {
+    fn from(event_type: &str) -> Self {
+        match event_type {
+            "gifted" => OwnershipEventType::Gifted,
+            "traded" => OwnershipEventType::Traded,
+            "released" => OwnershipEventType::Released,
+            _ => OwnershipEventType::Collected,
+        }
+    }
+}
+
+impl sqlx::Decode<'_, Postgres> for OwnershipEventType {
+    fn decode(
+        value: PgValueRef,
+    ) -> Result<Self, Box<dyn std::error::Error + Send + Sync + 'static>> {
+        Ok(OwnershipEventType::from(value.as_str()?))
+    }
+}
+
+impl sqlx::Type<Postgres> for OwnershipEventType {
+    fn type_info() -> sqlx::postgres::PgTypeInfo {
+        sqlx::postgres::PgTypeInfo::with_name("VARCHAR")
+    }
+}
+
+/// A mnstr gaining or losing an owner. Collecting has no previous owner and
+/// releasing has no next one.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct OwnershipEvent {
+    pub id: String,
+    pub mnstr_id: String,
+    pub event_type: OwnershipEventType,
+    pub from_user_id: Option<String>,
+    pub to_user_id: Option<String>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+}
+
+/// Every user who has owned the mnstr, oldest first, read from its events in
+/// the order they happened.
+pub fn owner_chain(events: &[OwnershipEvent]) -> Vec<String> {
+    let mut owners: Vec<String> = Vec::new();
+    for event in events {
+        for user_id in [&event.from_user_id, &event.to_user_id].into_iter().flatten() {
+            if owners.last() != Some(user_id) {
+                owners.push(user_id.clone());
+            }
+        }
+    }
+    owners
+}
+
+impl OwnershipEvent {
+    pub fn new(
+        mnstr_id: String,
+        event_type: OwnershipEventType,
+        from_user_id: Option<String>,
+        to_user_id: Option<String>,
+    ) -> Self {
+        Self {
+            id: Uuid::new_v4().to_string(),
+            mnstr_id,
+            event_type,
+            from_user_id,
+            to_user_id,
+            created_at: None,
+        }
+    }
+
+    /// Records the event as part of the caller's transaction, so it commits
+    /// with the ownership change it describes.
+    pub async fn record(&mut self, conn: &mut PgConnection) -> Result<(), anyhow::Error> {
+        let row = match sqlx::query(
+            "INSERT INTO ownership_events (id, mnstr_id, event_type, from_user_id, to_user_id, created_at)
+            VALUES ($1, $2, $3, $4, $5, now())
+            RETURNING *",
+        )
+        .bind(self.id.clone())
+        .bind(self.mnstr_id.clone())
+        .bind(self.event_type.to_string())
+        .bind(self.from_user_id.clone())
+        .bind(self.to_user_id.clone())
+        .fetch_one(conn)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[OwnershipEvent::record] Failed to record event: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        *self = OwnershipEvent::from_row(&row)?;
+        Ok(())
+    }
+
+    /// The mnstr's ownership history, oldest first.
+    pub async fn find_all_by_mnstr_id(mnstr_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM ownership_events WHERE mnstr_id = $1 ORDER BY created_at ASC, id ASC",
+        )
+        .bind(mnstr_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(OwnershipEvent::from_row)
+                .collect::<Result<Vec<OwnershipEvent>, _>>()?),
+            Err(e) => {
+                println!(
+                    "[OwnershipEvent::find_all_by_mnstr_id] Failed to get ownership events: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_mnstr_id(mnstr_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM ownership_events WHERE mnstr_id = $1")
+            .bind(mnstr_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[OwnershipEvent::delete_permanent_by_mnstr_id] Failed to delete ownership events: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) =
+            sqlx::query("DELETE FROM ownership_events WHERE from_user_id = $1 OR to_user_id = $1")
+                .bind(user_id)
+                .execute(&pool)
+                .await
+        {
+            println!(
+                "[OwnershipEvent::delete_permanent_by_user_id] Failed to delete ownership events: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+impl DatabaseResource for OwnershipEvent {
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        Ok(OwnershipEvent {
+            id: row.get("id"),
+            mnstr_id: row.get("mnstr_id"),
+            event_type: row.get("event_type"),
+            from_user_id: row.get("from_user_id"),
+            to_user_id: row.get("to_user_id"),
+            created_at: row.get("created_at"),
+        })
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        false
+    }
+    fn is_updatable() -> bool {
+        false
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn event(
+        event_type: OwnershipEventType,
+        from_user_id: Option<&str>,
+        to_user_id: Option<&str>,
+    ) -> OwnershipEvent {
+        OwnershipEvent::new(
+            "mnstr".to_string(),
+            event_type,
+            from_user_id.map(|id| id.to_string()),
+            to_user_id.map(|id| id.to_string()),
+        )
+    }
+
+    #[test]
+    fn test_owner_chain_gifted() {
+        let events = vec![
+            event(OwnershipEventType::Collected, None, Some("owner")),
+            event(OwnershipEventType::Gifted, Some("owner"), Some("friend")),
+        ];
+        assert_eq!(owner_chain(&events), vec!["owner", "friend"]);
+    }
+
+    #[test]
+    fn test_owner_chain_traded_and_released() {
+        let events = vec![
+            event(OwnershipEventType::Collected, None, Some("owner")),
+            event(OwnershipEventType::Traded, Some("owner"), Some("friend")),
+            event(OwnershipEventType::Gifted, Some("friend"), Some("owner")),
+            event(OwnershipEventType::Released, Some("owner"), None),
+        ];
+        assert_eq!(owner_chain(&events), vec!["owner", "friend", "owner"]);
+    }
+
+    #[test]
+    fn test_ownership_event_type_round_trip() {
+        for event_type in [
+            OwnershipEventType::Collected,
+            OwnershipEventType::Gifted,
+            OwnershipEventType::Traded,
+            OwnershipEventType::Released,
+        ] {
+            assert_eq!(
+                OwnershipEventType::from(event_type.to_string().as_str()),
+                event_type
+            );
+        }
+    }
+}
@@ -1,19 +1,26 @@
 use juniper::GraphQLObject;
 use serde::{Deserialize, Serialize};
 use sqlx::{Row, postgres::PgRow};
-use time::OffsetDateTime;
+use time::{Duration, OffsetDateTime};
 use uuid::Uuid;
 
 use crate::{
-    database::{traits::DatabaseResource, values::DatabaseValue},
+    config::config,
+    database::{connection::get_connection, traits::DatabaseResource, values::DatabaseValue},
     delete_resource_where_fields, find_all_resources_where_fields, find_one_resource_where_fields,
-    insert_resource,
-    models::user::User,
+    find_one_unarchived_resource_where_fields, insert_resource,
+    models::{api_token::ApiToken, user::User},
     proto::Session as GrpcSession,
     update_resource,
-    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+    utils::{
+        client::{RequestClient, device_label},
+        time::{deserialize_offset_date_time, serialize_offset_date_time},
+    },
 };
 
+/// Expired and archived sessions are kept this long before they are purged.
+pub const SESSION_PURGE_AFTER_DAYS: i64 = 30;
+
 #[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
 pub struct Session {
     pub id: String,
@@ -44,10 +51,99 @@ pub struct Session {
     )]
     pub expires_at: Option<OffsetDateTime>,
 
+    pub remember_me: bool,
+
+    #[graphql(skip)]
+    pub user_agent: Option<String>,
+    #[graphql(skip)]
+    pub ip_address: Option<String>,
+
     // Relationships
     pub user: Option<User>,
 }
 
+/// How long a session lasts between uses.
+pub const DEFAULT_SESSION_TTL: Duration = Duration::days(7);
+/// How long a "remember me" session lasts between uses.
+pub const REMEMBER_ME_SESSION_TTL: Duration = Duration::days(30);
+
+/// The configured lifetime of a session, `SESSION_TTL_DAYS` or
+/// `REMEMBER_ME_SESSION_TTL_DAYS`.
+pub fn session_ttl(remember_me: bool) -> Duration {
+    if remember_me {
+        config().remember_me_session_ttl
+    } else {
+        config().session_ttl
+    }
+}
+
+/// A session along with its timestamps, for admin and debugging clients. The
+/// token is never included.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct SessionDetails {
+    pub id: String,
+    pub user_id: String,
+    pub remember_me: bool,
+    pub created_at: Option<OffsetDateTime>,
+    pub updated_at: Option<OffsetDateTime>,
+    pub archived_at: Option<OffsetDateTime>,
+    pub expires_at: Option<OffsetDateTime>,
+}
+
+impl SessionDetails {
+    pub fn from_session(session: &Session) -> Self {
+        Self {
+            id: session.id.clone(),
+            user_id: session.user_id.clone(),
+            remember_me: session.remember_me,
+            created_at: session.created_at,
+            updated_at: session.updated_at,
+            archived_at: session.archived_at,
+            expires_at: session.expires_at,
+        }
+    }
+}
+
+/// A session as shown to its user. The token is never included.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct SessionSummary {
+    pub id: String,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub expires_at: Option<OffsetDateTime>,
+
+    /// Where the session signed in from, such as "Safari on iOS".
+    pub device: String,
+    pub ip_address: Option<String>,
+
+    /// Whether this is the session making the request.
+    pub current: bool,
+}
+
+impl SessionSummary {
+    pub fn from_session(session: &Session, current_session_id: &str) -> Self {
+        Self {
+            id: session.id.clone(),
+            created_at: session.created_at,
+            expires_at: session.expires_at,
+            device: device_label(session.user_agent.as_deref()),
+            ip_address: session.ip_address.clone(),
+            current: session.id == current_session_id,
+        }
+    }
+}
+
 impl Session {
     pub fn new(user_id: String) -> Self {
         Self {
@@ -58,10 +154,36 @@ impl Session {
             updated_at: None,
             archived_at: None,
             expires_at: None,
+            remember_me: false,
+            user_agent: None,
+            ip_address: None,
             user: None,
         }
     }
 
+    /// A new session for `user_id` signed in from `client`.
+    pub fn new_with_client(user_id: String, client: &RequestClient) -> Self {
+        let mut session = Session::new(user_id);
+        session.user_agent = client.user_agent.clone();
+        session.ip_address = client.ip_address.clone();
+        session
+    }
+
+    /// A stand-in session for a request signed with an API token. It is never
+    /// stored, and carries the token's id and the raw token.
+    pub fn from_api_token(api_token: &ApiToken, token: String) -> Self {
+        let mut session = Session::new(api_token.user_id.clone());
+        session.id = api_token.id.clone();
+        session.session_token = token;
+        session.created_at = api_token.created_at;
+        session
+    }
+
+    /// When the session expires if it is used at `now`.
+    pub fn expires_at_from(&self, now: OffsetDateTime) -> OffsetDateTime {
+        now + session_ttl(self.remember_me)
+    }
+
     pub fn to_grpc(&self) -> GrpcSession {
         GrpcSession {
             id: self.id.clone(),
@@ -76,6 +198,13 @@ impl Session {
         let params = vec![
             ("user_id", self.user_id.clone().into()),
             ("session_token", token.into()),
+            ("remember_me", self.remember_me.into()),
+            (
+                "expires_at",
+                self.expires_at_from(OffsetDateTime::now_utc()).into(),
+            ),
+            ("user_agent", self.user_agent.clone().into()),
+            ("ip_address", self.ip_address.clone().into()),
         ];
         let mut session = match insert_resource!(Session, params).await {
             Ok(session) => session,
@@ -90,7 +219,11 @@ impl Session {
     }
 
     pub async fn update(&mut self) -> Option<anyhow::Error> {
-        let mut session = match update_resource!(Session, self.id.clone(), vec![]).await {
+        let params = vec![(
+            "expires_at",
+            self.expires_at_from(OffsetDateTime::now_utc()).into(),
+        )];
+        let mut session = match update_resource!(Session, self.id.clone(), params).await {
             Ok(session) => session,
             Err(e) => return Some(e.into()),
         };
@@ -102,15 +235,28 @@ impl Session {
         None
     }
 
+    /// Revokes the session by archiving it. Fails unless the stored session
+    /// is actually archived afterwards, so callers never report a logout that
+    /// left the token usable.
     pub async fn delete(&mut self) -> Option<anyhow::Error> {
         match delete_resource_where_fields!(Session, vec![("id", self.id.clone().into())]).await {
             Ok(_) => (),
-            Err(e) => return Some(e.into()),
+            Err(e) => {
+                println!("[Session::delete] Failed to archive session: {:?}", e);
+                return Some(e.into());
+            }
         };
         let session = match Self::find_one(self.id.clone()).await {
             Ok(session) => session,
-            Err(e) => return Some(e.into()),
+            Err(e) => {
+                println!("[Session::delete] Failed to get session: {:?}", e);
+                return Some(e.into());
+            }
         };
+        if session.archived_at.is_none() {
+            println!("[Session::delete] Session was not archived: {:?}", session.id);
+            return Some(anyhow::Error::msg("Session was not revoked"));
+        }
 
         *self = session;
         None
@@ -141,7 +287,7 @@ impl Session {
     #[allow(dead_code)]
     pub async fn find_one_by_token(token: String) -> Result<Self, anyhow::Error> {
         let params = vec![("session_token", token.clone().into())];
-        let mut session = match find_one_resource_where_fields!(Session, params).await {
+        let mut session = match find_one_unarchived_resource_where_fields!(Session, params).await {
             Ok(session) => session,
             Err(e) => return Err(e.into()),
         };
@@ -170,8 +316,90 @@ impl Session {
         Ok(sessions)
     }
 
+    /// The user's sessions that are neither revoked nor expired, newest first.
+    pub async fn find_active_by_user_id(user_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        let rows = match sqlx::query(
+            "SELECT * FROM sessions WHERE user_id = $1 AND archived_at IS NULL ORDER BY created_at DESC",
+        )
+        .bind(user_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!(
+                    "[Session::find_active_by_user_id] Failed to get sessions: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        let sessions = rows
+            .iter()
+            .map(Session::from_row)
+            .collect::<Result<Vec<Session>, _>>()?;
+        let now = OffsetDateTime::now_utc();
+        Ok(sessions
+            .into_iter()
+            .filter(|session| session.is_active(now))
+            .collect())
+    }
+
+    /// Revokes one of the user's sessions, leaving the others signed in.
+    pub async fn revoke_for_user(id: String, user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "UPDATE sessions SET archived_at = now(), updated_at = now() WHERE id = $1 AND user_id = $2 AND archived_at IS NULL",
+        )
+        .bind(id)
+        .bind(user_id)
+        .execute(&pool)
+        .await
+        {
+            Ok(result) if result.rows_affected() == 0 => {
+                Some(anyhow::Error::msg("Session not found"))
+            }
+            Ok(_) => None,
+            Err(e) => {
+                println!("[Session::revoke_for_user] Failed to revoke session: {:?}", e);
+                Some(e.into())
+            }
+        }
+    }
+
+    pub fn is_active(&self, now: OffsetDateTime) -> bool {
+        self.archived_at.is_none() && self.expires_at.map_or(true, |expires_at| expires_at > now)
+    }
+
+    /// Whether the session expired or was archived at or before `older_than`.
+    /// Matches what `purge_expired` deletes.
+    pub fn is_purgeable(&self, older_than: OffsetDateTime) -> bool {
+        self.expires_at.is_some_and(|expires_at| expires_at <= older_than)
+            || self.archived_at.is_some_and(|archived_at| archived_at <= older_than)
+    }
+
+    /// Deletes every session that expired or was archived at or before
+    /// `older_than` and returns how many were removed.
+    pub async fn purge_expired(older_than: OffsetDateTime) -> Result<u64, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query("DELETE FROM sessions WHERE expires_at <= $1 OR archived_at <= $1")
+            .bind(older_than)
+            .execute(&pool)
+            .await
+        {
+            Ok(result) => Ok(result.rows_affected()),
+            Err(e) => {
+                println!("[Session::purge_expired] Failed to delete sessions: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+
     pub async fn get_relationships(&mut self) -> Option<anyhow::Error> {
-        self.get_user().await?;
+        if let Some(error) = self.get_user().await {
+            return Some(error);
+        }
         None
     }
 
@@ -206,6 +434,9 @@ impl DatabaseResource for Session {
             updated_at,
             archived_at,
             expires_at,
+            remember_me: row.get("remember_me"),
+            user_agent: row.get("user_agent"),
+            ip_address: row.get("ip_address"),
             user: None,
         })
     }
@@ -226,8 +457,9 @@ impl DatabaseResource for Session {
         true
     }
 
+    // Sessions set their own expiry from `remember_me`.
     fn is_expirable() -> bool {
-        true
+        false
     }
 
     fn is_verifiable() -> bool {
@@ -249,7 +481,7 @@ impl crate::utils::sessions::SessionTrait<Session> for Session {
 
     async fn find_one_by_token(token: String) -> Result<Self, anyhow::Error> {
         let params = vec![("session_token", token.clone().into())];
-        match find_one_resource_where_fields!(Session, params).await {
+        match find_one_unarchived_resource_where_fields!(Session, params).await {
             Ok(session) => Ok(session),
             Err(e) => Err(e.into()),
         }
@@ -262,3 +494,157 @@ impl crate::utils::sessions::SessionTrait<Session> for Session {
         }
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{database::test_support::create_test_user, utils::sessions::get_user_from_token};
+
+    fn session(id: &str) -> Session {
+        let mut session = Session::new("user".to_string());
+        session.id = id.to_string();
+        session.session_token = format!("token-{}", id);
+        session.expires_at = Some(OffsetDateTime::now_utc() + Duration::days(1));
+        session
+    }
+
+    #[test]
+    fn test_only_expired_sessions_are_purged() {
+        let now = OffsetDateTime::now_utc();
+        let older_than = now - Duration::days(SESSION_PURGE_AFTER_DAYS);
+        let mut expired = session("expired");
+        expired.expires_at = Some(older_than - Duration::minutes(1));
+        let mut revoked = session("revoked");
+        revoked.archived_at = Some(older_than - Duration::days(1));
+        let mut recently_revoked = session("recently-revoked");
+        recently_revoked.archived_at = Some(now);
+        let sessions = vec![session("active"), expired, revoked, recently_revoked];
+
+        let purged: Vec<&str> = sessions
+            .iter()
+            .filter(|session| session.is_purgeable(older_than))
+            .map(|session| session.id.as_str())
+            .collect();
+        assert_eq!(purged, vec!["expired", "revoked"]);
+    }
+
+    #[test]
+    fn test_active_sessions_listed_without_tokens() {
+        let now = OffsetDateTime::now_utc();
+        let mut expired = session("expired");
+        expired.expires_at = Some(now - Duration::minutes(1));
+        let mut revoked = session("revoked");
+        revoked.archived_at = Some(now);
+        let sessions = vec![session("phone"), session("laptop"), expired, revoked];
+
+        let summaries: Vec<SessionSummary> = sessions
+            .iter()
+            .filter(|session| session.is_active(now))
+            .map(|session| SessionSummary::from_session(session, "laptop"))
+            .collect();
+
+        let ids: Vec<&str> = summaries.iter().map(|s| s.id.as_str()).collect();
+        assert_eq!(ids, vec!["phone", "laptop"]);
+        assert!(!summaries[0].current);
+        assert!(summaries[1].current);
+        let json = serde_json::to_string(&summaries).unwrap();
+        assert!(!json.contains("token-"));
+    }
+
+    #[test]
+    fn test_new_with_client_records_user_agent() {
+        let client = RequestClient::new(
+            Some("Dart/3.5 (dart:io)"),
+            Some("203.0.113.7".to_string()),
+        );
+        let session = Session::new_with_client("user".to_string(), &client);
+        assert_eq!(session.user_agent.as_deref(), Some("Dart/3.5 (dart:io)"));
+        assert_eq!(session.ip_address.as_deref(), Some("203.0.113.7"));
+
+        let summary = SessionSummary::from_session(&session, "");
+        assert_eq!(summary.device, "mnstr app");
+        assert_eq!(summary.ip_address.as_deref(), Some("203.0.113.7"));
+    }
+
+    #[test]
+    fn test_remember_me_session_expiry() {
+        let now = OffsetDateTime::now_utc();
+        let mut session = Session::new("user".to_string());
+        assert_eq!(session.expires_at_from(now), now + DEFAULT_SESSION_TTL);
+
+        session.remember_me = true;
+        assert_eq!(session.expires_at_from(now), now + Duration::days(30));
+        assert!(REMEMBER_ME_SESSION_TTL > DEFAULT_SESSION_TTL);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_revoking_one_session_leaves_others_active() {
+        let user = create_test_user().await;
+        let mut sessions = Vec::new();
+        for _ in 0..3 {
+            let mut session = Session::new(user.id.clone());
+            assert!(session.create().await.is_none());
+            sessions.push(session);
+        }
+        let revoked = sessions.remove(1);
+
+        let stranger = create_test_user().await;
+        let error = Session::revoke_for_user(revoked.id.clone(), stranger.id).await;
+        assert!(error.is_some());
+
+        let error = Session::revoke_for_user(revoked.id.clone(), user.id.clone()).await;
+        assert!(error.is_none());
+        let signed_out = get_user_from_token::<Session>(revoked.session_token).await;
+        assert!(signed_out.is_err());
+        for session in sessions.iter() {
+            let signed_in = get_user_from_token::<Session>(session.session_token.clone())
+                .await
+                .unwrap();
+            assert_eq!(signed_in.id, user.id);
+        }
+
+        let mut active = Session::find_active_by_user_id(user.id)
+            .await
+            .unwrap()
+            .into_iter()
+            .map(|session| session.id)
+            .collect::<Vec<String>>();
+        active.sort();
+        let mut expected = sessions
+            .into_iter()
+            .map(|session| session.id)
+            .collect::<Vec<String>>();
+        expected.sort();
+        assert_eq!(active, expected);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_logout_revokes_the_token() {
+        let user = create_test_user().await;
+        let mut session = Session::new(user.id.clone());
+        assert!(session.create().await.is_none());
+
+        assert!(session.delete().await.is_none());
+        assert!(session.archived_at.is_some());
+        let signed_out = get_user_from_token::<Session>(session.session_token.clone()).await;
+        assert!(signed_out.is_err());
+        assert!(
+            Session::find_one_by_token(session.session_token)
+                .await
+                .is_err()
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_failed_revocation_is_reported() {
+        let user = create_test_user().await;
+        let mut session = Session::new(user.id);
+        session.id = Uuid::new_v4().to_string();
+
+        assert!(session.delete().await.is_some());
+        assert!(session.archived_at.is_none());
+    }
+}
@@ -0,0 +1,336 @@
+use juniper::GraphQLObject;
+use serde::{Deserialize, Serialize};
+use sqlx::{Row, postgres::PgRow};
+use time::OffsetDateTime;
+use uuid::Uuid;
+
+use crate::{
+    database::connection::get_connection,
+    models::{
+        mnstr::{Mnstr, MnstrFilter, RARITIES},
+        user::User,
+    },
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+pub const SHARE_LINK_NOT_FOUND: &str = "Share link not found";
+const SHARE_TOKEN_LENGTH: usize = 64;
+
+/// A public, read-only link to a user's collection. Anyone holding the token
+/// can view the collection until the link is revoked.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct ShareLink {
+    pub id: String,
+    pub user_id: String,
+    pub token: String,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub archived_at: Option<OffsetDateTime>,
+}
+
+/// A new random share token. It says nothing about the user it belongs to.
+pub fn generate_share_token() -> String {
+    format!("{}{}", Uuid::new_v4().simple(), Uuid::new_v4().simple())
+}
+
+/// Whether `token` could have come from `generate_share_token`, so obviously
+/// bad tokens are turned away without a query.
+pub fn is_share_token(token: &str) -> bool {
+    token.len() == SHARE_TOKEN_LENGTH && token.chars().all(|c| c.is_ascii_hexdigit())
+}
+
+/// A mnstr as the viewers of a share link see it.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct SharedMnstr {
+    pub mnstr_name: String,
+    pub rarity: String,
+    pub level: i32,
+}
+
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct RarityCount {
+    pub rarity: String,
+    pub count: i64,
+}
+
+/// The read-only view of a collection behind a share link. It carries no
+/// ids, contact details or QR codes.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct SharedCollection {
+    pub display_name: String,
+    pub mnstr_count: i64,
+    pub rarity_counts: Vec<RarityCount>,
+    pub mnstrs: Vec<SharedMnstr>,
+}
+
+impl SharedCollection {
+    /// The view of `user`'s live `mnstrs`, with a count for every rarity.
+    pub fn new(user: &User, mnstrs: &[Mnstr]) -> Self {
+        let mnstrs = mnstrs
+            .iter()
+            .filter(|mnstr| mnstr.archived_at.is_none())
+            .map(|mnstr| SharedMnstr {
+                mnstr_name: mnstr.mnstr_name.clone(),
+                rarity: mnstr.rarity.clone(),
+                level: mnstr.current_level,
+            })
+            .collect::<Vec<SharedMnstr>>();
+        let rarity_counts = RARITIES
+            .iter()
+            .map(|rarity| RarityCount {
+                rarity: rarity.to_string(),
+                count: mnstrs.iter().filter(|mnstr| mnstr.rarity == *rarity).count() as i64,
+            })
+            .collect();
+        Self {
+            display_name: user.display_name.clone(),
+            mnstr_count: mnstrs.len() as i64,
+            rarity_counts,
+            mnstrs,
+        }
+    }
+
+    /// The collection shared by `token`. Unknown and revoked tokens are not
+    /// found.
+    pub async fn find_by_token(token: String) -> Result<Self, anyhow::Error> {
+        let share_link = ShareLink::find_active_by_token(token).await?;
+        let user = match User::find_one(share_link.user_id.clone(), false).await {
+            Ok(user) => user,
+            Err(_) => return Err(anyhow::Error::msg(SHARE_LINK_NOT_FOUND)),
+        };
+        let mnstrs =
+            Mnstr::find_all_by_user_id(user.id.clone(), MnstrFilter::default(), None, None)
+                .await?;
+        Ok(SharedCollection::new(&user, &mnstrs))
+    }
+}
+
+impl ShareLink {
+    pub async fn create(user_id: String) -> Result<Self, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "INSERT INTO share_links (id, user_id, token, created_at)
+            VALUES ($1, $2, $3, now())
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(user_id)
+        .bind(generate_share_token())
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => Ok(ShareLink::from_row(&row)?),
+            Err(e) => {
+                println!("[ShareLink::create] Failed to create share link: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+
+    /// The unrevoked link for `token`.
+    pub async fn find_active_by_token(token: String) -> Result<Self, anyhow::Error> {
+        if !is_share_token(&token) {
+            return Err(anyhow::Error::msg(SHARE_LINK_NOT_FOUND));
+        }
+        let pool = get_connection().await;
+        match sqlx::query("SELECT * FROM share_links WHERE token = $1")
+            .bind(token)
+            .fetch_optional(&pool)
+            .await
+        {
+            Ok(Some(row)) => {
+                let share_link = ShareLink::from_row(&row)?;
+                if !share_link.is_active() {
+                    return Err(anyhow::Error::msg(SHARE_LINK_NOT_FOUND));
+                }
+                Ok(share_link)
+            }
+            Ok(None) => Err(anyhow::Error::msg(SHARE_LINK_NOT_FOUND)),
+            Err(e) => {
+                println!(
+                    "[ShareLink::find_active_by_token] Failed to get share link: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    /// The user's unrevoked links, newest first.
+    pub async fn find_active_by_user_id(user_id: String) -> Result<Vec<Self>, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT * FROM share_links WHERE user_id = $1 AND archived_at IS NULL ORDER BY created_at DESC",
+        )
+        .bind(user_id)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(ShareLink::from_row)
+                .collect::<Result<Vec<ShareLink>, _>>()?),
+            Err(e) => {
+                println!(
+                    "[ShareLink::find_active_by_user_id] Failed to get share links: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    /// Revokes one of the user's links. It stops working at once.
+    pub async fn revoke_for_user(id: String, user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "UPDATE share_links SET archived_at = now() WHERE id = $1 AND user_id = $2 AND archived_at IS NULL",
+        )
+        .bind(id)
+        .bind(user_id)
+        .execute(&pool)
+        .await
+        {
+            Ok(result) if result.rows_affected() == 0 => {
+                Some(anyhow::Error::msg(SHARE_LINK_NOT_FOUND))
+            }
+            Ok(_) => None,
+            Err(e) => {
+                println!("[ShareLink::revoke_for_user] Failed to revoke share link: {:?}", e);
+                Some(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM share_links WHERE user_id = $1")
+            .bind(user_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[ShareLink::delete_permanent_by_user_id] Failed to delete share links: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+
+    /// Whether the link still shows the collection.
+    pub fn is_active(&self) -> bool {
+        self.archived_at.is_none()
+    }
+
+    fn from_row(row: &PgRow) -> Result<Self, sqlx::Error> {
+        Ok(ShareLink {
+            id: row.get("id"),
+            user_id: row.get("user_id"),
+            token: row.get("token"),
+            created_at: row.get("created_at"),
+            archived_at: row.get("archived_at"),
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn user() -> User {
+        User::new(
+            Some("owner@mnstr.app".to_string()),
+            Some("+15550100".to_string()),
+            "password".to_string(),
+            "Owner".to_string(),
+        )
+    }
+
+    fn mnstr(mnstr_qr_code: &str, mnstr_name: &str) -> Mnstr {
+        let mut mnstr = Mnstr::new(
+            "owner".to_string(),
+            Some(mnstr_name.to_string()),
+            Some("A secret description".to_string()),
+            mnstr_qr_code.to_string(),
+        );
+        mnstr.id = format!("{}-id", mnstr_qr_code);
+        mnstr
+    }
+
+    #[test]
+    fn test_generated_tokens_are_share_tokens() {
+        let token = generate_share_token();
+        assert!(is_share_token(&token));
+        assert_ne!(token, generate_share_token());
+        assert!(!is_share_token("not-a-token"));
+        assert!(!is_share_token(&"z".repeat(SHARE_TOKEN_LENGTH)));
+    }
+
+    #[test]
+    fn test_shared_collection_counts() {
+        let mut archived = mnstr("mnstr-3", "Gone");
+        archived.archived_at = Some(OffsetDateTime::now_utc());
+        let mnstrs = vec![
+            mnstr("mnstr-22", "Blaze"),
+            mnstr("mnstr-0", "Pebble"),
+            mnstr("mnstr-2", "Moss"),
+            archived,
+        ];
+
+        let collection = SharedCollection::new(&user(), &mnstrs);
+        assert_eq!(collection.display_name, "Owner");
+        assert_eq!(collection.mnstr_count, 3);
+        let counts = collection
+            .rarity_counts
+            .iter()
+            .map(|count| (count.rarity.as_str(), count.count))
+            .collect::<Vec<(&str, i64)>>();
+        assert_eq!(
+            counts,
+            vec![("common", 2), ("rare", 0), ("epic", 0), ("legendary", 1)]
+        );
+        assert_eq!(
+            collection.mnstrs[0],
+            SharedMnstr {
+                mnstr_name: "Blaze".to_string(),
+                rarity: "legendary".to_string(),
+                level: 0,
+            }
+        );
+    }
+
+    #[test]
+    fn test_shared_collection_omits_sensitive_fields() {
+        let collection = SharedCollection::new(&user(), &[mnstr("mnstr-22", "Blaze")]);
+        let json = serde_json::to_string(&collection).unwrap();
+
+        for sensitive in [
+            "owner@mnstr.app",
+            "+15550100",
+            "mnstr-22",
+            "A secret description",
+            "email",
+            "phone",
+            "userId",
+            "mnstrQrCode",
+            "\"id\"",
+        ] {
+            assert!(!json.contains(sensitive), "{} leaked in {}", sensitive, json);
+        }
+        assert!(json.contains("Blaze"));
+    }
+}
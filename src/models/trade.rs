@@ -0,0 +1,430 @@
+use juniper::{GraphQLEnum, GraphQLObject};
+use serde::{Deserialize, Serialize};
+use sqlx::{
+    Error, Postgres, Row,
+    postgres::{PgRow, PgValueRef},
+};
+use time::OffsetDateTime;
+
+use crate::{
+    database::{connection::get_connection, traits::DatabaseResource},
+    find_one_resource_where_fields, insert_resource,
+    models::{
+        achievement::Achievement,
+        mnstr::Mnstr,
+        ownership_event::{OwnershipEvent, OwnershipEventType},
+    },
+    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+};
+
+#[derive(Debug, Serialize, Deserialize, GraphQLEnum, Clone, Copy, PartialEq, Eq)]
+pub enum TradeStatus {
+    Pending,
+    Completed,
+}
+
+impl std::fmt::Display for TradeStatus {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        match self {
+            TradeStatus::Pending => write!(f, "pending"),
+            TradeStatus::Completed => write!(f, "completed"),
+        }
+    }
+}
+
+impl From<&str> for TradeStatus {
+    fn from(trade_status: &str) -> Self {
+        match trade_status {
+            "pending" => TradeStatus::Pending,
+            "completed" => TradeStatus::Completed,
+            _ => TradeStatus::Pending,
+        }
+    }
+}
+
+impl sqlx::Decode<'_, Postgres> for TradeStatus {
+    fn decode(
+        value: PgValueRef,
+    ) -> Result<Self, Box<dyn std::error::Error + Send + Sync + 'static>> {
+        Ok(TradeStatus::from(value.as_str()?))
+    }
+}
+
+impl sqlx::Type<Postgres> for TradeStatus {
+    fn type_info() -> sqlx::postgres::PgTypeInfo {
+        sqlx::postgres::PgTypeInfo::with_name("VARCHAR")
+    }
+}
+
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct Trade {
+    pub id: String,
+    pub offerer_user_id: String,
+    pub offerer_mnstr_id: String,
+    pub target_user_id: String,
+    pub requested_mnstr_id: String,
+    pub trade_status: TradeStatus,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub updated_at: Option<OffsetDateTime>,
+}
+
+/// Checks that `mnstr` can be put up in a trade by `user_id`.
+pub fn validate_tradeable(mnstr: &Mnstr, user_id: &str) -> Result<(), anyhow::Error> {
+    if mnstr.user_id != user_id || mnstr.archived_at.is_some() {
+        return Err(anyhow::Error::msg("Mnstr is not owned by user"));
+    }
+    if mnstr.is_seed {
+        return Err(anyhow::Error::msg("Starter mnstrs cannot be traded"));
+    }
+    Ok(())
+}
+
+impl Trade {
+    pub fn new(
+        offerer_user_id: String,
+        offerer_mnstr_id: String,
+        target_user_id: String,
+        requested_mnstr_id: String,
+    ) -> Self {
+        Self {
+            id: "".to_string(),
+            offerer_user_id,
+            offerer_mnstr_id,
+            target_user_id,
+            requested_mnstr_id,
+            trade_status: TradeStatus::Pending,
+            created_at: None,
+            updated_at: None,
+        }
+    }
+
+    /// Checks that `user_id` may accept this trade.
+    pub fn validate_accept(&self, user_id: &str) -> Result<(), anyhow::Error> {
+        if self.trade_status != TradeStatus::Pending {
+            return Err(anyhow::Error::msg("Trade is already resolved"));
+        }
+        if self.target_user_id != user_id {
+            return Err(anyhow::Error::msg("Trade is not addressed to user"));
+        }
+        Ok(())
+    }
+
+    pub async fn create(&mut self) -> Option<anyhow::Error> {
+        if self.offerer_user_id == self.target_user_id {
+            return Some(anyhow::Error::msg("Cannot trade with yourself"));
+        }
+
+        let offered = match Mnstr::find_one(self.offerer_mnstr_id.clone(), false).await {
+            Ok(mnstr) => mnstr,
+            Err(e) => {
+                println!("[Trade::create] Failed to get offered mnstr: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        if let Err(e) = validate_tradeable(&offered, &self.offerer_user_id) {
+            return Some(e);
+        }
+
+        let requested = match Mnstr::find_one(self.requested_mnstr_id.clone(), false).await {
+            Ok(mnstr) => mnstr,
+            Err(e) => {
+                println!("[Trade::create] Failed to get requested mnstr: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        if let Err(e) = validate_tradeable(&requested, &self.target_user_id) {
+            return Some(e);
+        }
+
+        let params = vec![
+            ("offerer_user_id", self.offerer_user_id.clone().into()),
+            ("offerer_mnstr_id", self.offerer_mnstr_id.clone().into()),
+            ("target_user_id", self.target_user_id.clone().into()),
+            ("requested_mnstr_id", self.requested_mnstr_id.clone().into()),
+            ("trade_status", TradeStatus::Pending.to_string().into()),
+        ];
+        let trade = match insert_resource!(Trade, params).await {
+            Ok(trade) => trade,
+            Err(e) => {
+                println!("[Trade::create] Failed to create trade: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        *self = trade;
+        None
+    }
+
+    /// Swaps the owners of both mnstrs and completes the trade in a single
+    /// database transaction. The trade row is locked so a second accept
+    /// sees the completed status and fails.
+    pub async fn accept(&mut self, user_id: String) -> Option<anyhow::Error> {
+        if let Err(e) = self.validate_accept(&user_id) {
+            return Some(e);
+        }
+
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Trade::accept] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+
+        let row = match sqlx::query("SELECT * FROM trades WHERE id = $1 FOR UPDATE")
+            .bind(self.id.clone())
+            .fetch_one(&mut *tx)
+            .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[Trade::accept] Failed to lock trade: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        let locked = match Trade::from_row(&row) {
+            Ok(trade) => trade,
+            Err(e) => return Some(e.into()),
+        };
+        if let Err(e) = locked.validate_accept(&user_id) {
+            return Some(e);
+        }
+
+        let swaps = [
+            (
+                &locked.offerer_mnstr_id,
+                &locked.offerer_user_id,
+                &locked.target_user_id,
+            ),
+            (
+                &locked.requested_mnstr_id,
+                &locked.target_user_id,
+                &locked.offerer_user_id,
+            ),
+        ];
+        for (mnstr_id, from_user_id, to_user_id) in swaps {
+            let result = match sqlx::query(
+                "UPDATE mnstrs SET user_id = $1, version = version + 1, updated_at = now()
+                WHERE id = $2 AND user_id = $3 AND archived_at IS NULL AND NOT is_seed",
+            )
+            .bind(to_user_id)
+            .bind(mnstr_id)
+            .bind(from_user_id)
+            .execute(&mut *tx)
+            .await
+            {
+                Ok(result) => result,
+                Err(e) => {
+                    println!("[Trade::accept] Failed to transfer mnstr: {:?}", e);
+                    return Some(e.into());
+                }
+            };
+            if result.rows_affected() != 1 {
+                return Some(anyhow::Error::msg("Mnstr is not owned by user"));
+            }
+            if let Err(e) = OwnershipEvent::new(
+                mnstr_id.clone(),
+                OwnershipEventType::Traded,
+                Some(from_user_id.clone()),
+                Some(to_user_id.clone()),
+            )
+            .record(&mut tx)
+            .await
+            {
+                return Some(e);
+            }
+        }
+
+        let row = match sqlx::query(
+            "UPDATE trades SET trade_status = $1, updated_at = now() WHERE id = $2 RETURNING *",
+        )
+        .bind(TradeStatus::Completed.to_string())
+        .bind(self.id.clone())
+        .fetch_one(&mut *tx)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[Trade::accept] Failed to complete trade: {:?}", e);
+                return Some(e.into());
+            }
+        };
+        let trade = match Trade::from_row(&row) {
+            Ok(trade) => trade,
+            Err(e) => return Some(e.into()),
+        };
+
+        if let Err(e) = tx.commit().await {
+            println!("[Trade::accept] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+        for user_id in [&trade.offerer_user_id, &trade.target_user_id] {
+            if let Err(e) = Achievement::check_trades(user_id.clone()).await {
+                println!("[Trade::accept] Failed to check achievements: {:?}", e);
+            }
+        }
+        *self = trade;
+        None
+    }
+
+    pub async fn find_one(id: String) -> Result<Self, anyhow::Error> {
+        match find_one_resource_where_fields!(Trade, vec![("id", id.clone().into())]).await {
+            Ok(trade) => Ok(trade),
+            Err(e) => {
+                println!("[Trade::find_one] Failed to get trade: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+
+    pub async fn delete_permanent_by_user_id(user_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) =
+            sqlx::query("DELETE FROM trades WHERE offerer_user_id = $1 OR target_user_id = $1")
+                .bind(user_id)
+                .execute(&pool)
+                .await
+        {
+            println!(
+                "[Trade::delete_permanent_by_user_id] Failed to delete trades: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
+}
+
+impl DatabaseResource for Trade {
+    fn from_row(row: &PgRow) -> Result<Self, Error> {
+        Ok(Trade {
+            id: row.get("id"),
+            offerer_user_id: row.get("offerer_user_id"),
+            offerer_mnstr_id: row.get("offerer_mnstr_id"),
+            target_user_id: row.get("target_user_id"),
+            requested_mnstr_id: row.get("requested_mnstr_id"),
+            trade_status: row.get("trade_status"),
+            created_at: row.get("created_at"),
+            updated_at: row.get("updated_at"),
+        })
+    }
+    fn has_id() -> bool {
+        true
+    }
+    fn is_archivable() -> bool {
+        false
+    }
+    fn is_updatable() -> bool {
+        true
+    }
+    fn is_creatable() -> bool {
+        true
+    }
+    fn is_expirable() -> bool {
+        false
+    }
+    fn is_verifiable() -> bool {
+        false
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use uuid::Uuid;
+
+    use super::*;
+    use crate::database::test_support::{create_test_mnstr, create_test_user};
+
+    fn trade() -> Trade {
+        Trade::new(
+            "offerer".to_string(),
+            "offered-mnstr".to_string(),
+            "target".to_string(),
+            "requested-mnstr".to_string(),
+        )
+    }
+
+    #[test]
+    fn test_validate_accept() {
+        let mut trade = trade();
+        assert!(trade.validate_accept("target").is_ok());
+        assert!(trade.validate_accept("offerer").is_err());
+
+        trade.trade_status = TradeStatus::Completed;
+        assert!(trade.validate_accept("target").is_err());
+    }
+
+    #[test]
+    fn test_validate_tradeable() {
+        let mut mnstr = Mnstr::new("offerer".to_string(), None, None, "qr".to_string());
+        assert!(validate_tradeable(&mnstr, "offerer").is_ok());
+        assert!(validate_tradeable(&mnstr, "target").is_err());
+
+        mnstr.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(validate_tradeable(&mnstr, "offerer").is_err());
+
+        mnstr.archived_at = None;
+        mnstr.is_seed = true;
+        assert!(validate_tradeable(&mnstr, "offerer").is_err());
+    }
+
+    /// Creates a pending trade between two new users, each offering one
+    /// mnstr.
+    async fn test_trade() -> Trade {
+        let offerer = create_test_user().await;
+        let target = create_test_user().await;
+        let offered = create_test_mnstr(&offerer, &Uuid::new_v4().to_string()).await;
+        let requested = create_test_mnstr(&target, &Uuid::new_v4().to_string()).await;
+        let mut trade = Trade::new(offerer.id, offered.id, target.id, requested.id);
+        assert!(trade.create().await.is_none());
+        trade
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_accept_swaps_owners() {
+        let mut trade = test_trade().await;
+        assert!(trade.accept(trade.target_user_id.clone()).await.is_none());
+        assert_eq!(trade.trade_status, TradeStatus::Completed);
+
+        let offered = Mnstr::find_one(trade.offerer_mnstr_id.clone(), false)
+            .await
+            .unwrap();
+        let requested = Mnstr::find_one(trade.requested_mnstr_id.clone(), false)
+            .await
+            .unwrap();
+        assert_eq!(offered.user_id, trade.target_user_id);
+        assert_eq!(requested.user_id, trade.offerer_user_id);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_second_accept_swaps_nothing() {
+        let mut trade = test_trade().await;
+        // A copy taken while pending passes the in-memory check, so only
+        // the locked row can stop it.
+        let mut stale = trade.clone();
+        assert!(trade.accept(trade.target_user_id.clone()).await.is_none());
+        assert!(stale.accept(stale.target_user_id.clone()).await.is_some());
+
+        let offered = Mnstr::find_one(trade.offerer_mnstr_id.clone(), false)
+            .await
+            .unwrap();
+        let requested = Mnstr::find_one(trade.requested_mnstr_id.clone(), false)
+            .await
+            .unwrap();
+        assert_eq!(offered.user_id, trade.target_user_id);
+        assert_eq!(requested.user_id, trade.offerer_user_id);
+    }
+}
@@ -1,3 +1,5 @@
+use std::collections::BTreeMap;
+
 use juniper::{GraphQLEnum, GraphQLObject};
 use serde::{Deserialize, Serialize};
 use sqlx::{
@@ -5,14 +7,19 @@ use sqlx::{
     postgres::{PgRow, PgValueRef},
 };
 use time::OffsetDateTime;
+use uuid::Uuid;
 
 use crate::{
-    database::{traits::DatabaseResource, values::DatabaseValue},
+    config::config,
+    database::{connection::get_connection, traits::DatabaseResource, values::DatabaseValue},
     delete_resource_where_fields, find_all_resources_where_fields, find_one_resource_where_fields,
     insert_resource,
     proto::Transaction as GrpcTransaction,
     update_resource,
-    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+    utils::{
+        cursor::{Cursor, next_page},
+        time::{deserialize_offset_date_time, serialize_offset_date_time},
+    },
 };
 
 #[derive(Debug, Serialize, Deserialize, GraphQLEnum, Clone)]
@@ -63,7 +70,7 @@ impl sqlx::Type<Postgres> for TransactionType {
     }
 }
 
-#[derive(Debug, Serialize, Deserialize, GraphQLEnum, Clone)]
+#[derive(Debug, Serialize, Deserialize, GraphQLEnum, Clone, PartialEq)]
 pub enum TransactionStatus {
     Preparing,
     Pending,
@@ -105,6 +112,38 @@ impl Into<i32> for TransactionStatus {
     }
 }
 
+impl TransactionStatus {
+    /// Whether a transaction may move from this status to `next`. Completed
+    /// and failed are final, so a settled transaction can never be undone.
+    pub fn can_transition_to(&self, next: &TransactionStatus) -> bool {
+        match (self, next) {
+            (TransactionStatus::Preparing, TransactionStatus::Pending)
+            | (TransactionStatus::Preparing, TransactionStatus::Completed)
+            | (TransactionStatus::Preparing, TransactionStatus::Failed)
+            | (TransactionStatus::Pending, TransactionStatus::Completed)
+            | (TransactionStatus::Pending, TransactionStatus::Failed) => true,
+            _ => false,
+        }
+    }
+}
+
+pub const TRANSACTION_STATUS_NOT_EDITABLE: &str =
+    "Transaction status can only change through update_status";
+
+/// Checks that a transaction may move from `from` to `to`.
+pub fn validate_status_transition(
+    from: &TransactionStatus,
+    to: &TransactionStatus,
+) -> Result<(), anyhow::Error> {
+    if !from.can_transition_to(to) {
+        return Err(anyhow::Error::msg(format!(
+            "Cannot move a {} transaction to {}",
+            from, to
+        )));
+    }
+    Ok(())
+}
+
 impl sqlx::Decode<'_, Postgres> for TransactionStatus {
     fn decode(
         value: PgValueRef,
@@ -119,6 +158,102 @@ impl sqlx::Type<Postgres> for TransactionStatus {
     }
 }
 
+/// Completed transactions older than this many days are archived unless
+/// `TRANSACTION_RETENTION_DAYS` says otherwise.
+pub const DEFAULT_RETENTION_DAYS: i64 = 365;
+
+/// `transaction_data` of the entry that replaces archived transactions.
+pub const OPENING_BALANCE_DATA: &str = r#"{"source":"opening_balance"}"#;
+
+/// `transaction_data` of the coins awarded for collecting `mnstr_id`.
+pub fn collect_transaction_data(mnstr_id: &str) -> String {
+    serde_json::json!({ "source": "collect", "mnstr_id": mnstr_id }).to_string()
+}
+
+/// `transaction_data` of coins spent for `reason`.
+pub fn spend_transaction_data(reason: &str) -> String {
+    serde_json::json!({ "source": "spend", "reason": reason }).to_string()
+}
+
+/// `transaction_data` of coins spent levelling up `mnstr_id`.
+pub fn level_up_transaction_data(mnstr_id: &str) -> String {
+    serde_json::json!({ "source": "level_up", "mnstr_id": mnstr_id }).to_string()
+}
+
+/// `transaction_data` of the refund for releasing `mnstr_id`.
+pub fn release_transaction_data(mnstr_id: &str) -> String {
+    serde_json::json!({ "source": "release", "mnstr_id": mnstr_id }).to_string()
+}
+
+/// `transaction_data` of both sides of coin transfer `transfer_id`.
+pub fn transfer_transaction_data(transfer_id: &str, from_user_id: &str, to_user_id: &str) -> String {
+    serde_json::json!({
+        "source": "transfer",
+        "transfer_id": transfer_id,
+        "from_user_id": from_user_id,
+        "to_user_id": to_user_id,
+    })
+    .to_string()
+}
+
+/// `transaction_data` of the bonus for unlocking achievement `key`.
+pub fn achievement_transaction_data(key: &str) -> String {
+    serde_json::json!({ "source": "achievement", "achievement": key }).to_string()
+}
+
+pub fn retention_days() -> i64 {
+    config().transaction_retention_days
+}
+
+pub const MAX_CLIENT_REFERENCE_LENGTH: usize = 64;
+pub const CLIENT_REFERENCE_CONFLICT: &str =
+    "Client reference was already used for a different transaction";
+
+/// Trims a client reference and checks it fits the column.
+pub fn validate_client_reference(client_reference: &str) -> Result<String, anyhow::Error> {
+    let client_reference = client_reference.trim();
+    if client_reference.is_empty() {
+        return Err(anyhow::Error::msg("Client reference must not be blank"));
+    }
+    if client_reference.chars().count() > MAX_CLIENT_REFERENCE_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Client reference must be at most {} characters",
+            MAX_CLIENT_REFERENCE_LENGTH
+        )));
+    }
+    Ok(client_reference.to_string())
+}
+
+/// What to do with a request carrying a client reference, given the
+/// transaction already recorded under that reference, if any. A retry of
+/// the same request gets the recorded transaction back; `None` means there
+/// is nothing recorded yet and the new transaction should be inserted. A
+/// reference reused for a different type or amount is refused.
+pub fn replayed_transaction(
+    existing: Option<Transaction>,
+    transaction_type: &TransactionType,
+    amount: i32,
+) -> Result<Option<Transaction>, anyhow::Error> {
+    match existing {
+        Some(existing)
+            if existing.transaction_type.to_string() != transaction_type.to_string()
+                || existing.transaction_amount != amount =>
+        {
+            Err(anyhow::Error::msg(CLIENT_REFERENCE_CONFLICT))
+        }
+        existing => Ok(existing),
+    }
+}
+
+/// Sums archived `(wallet_id, amount)` pairs into one opening balance per wallet.
+pub fn opening_balances(archived: &[(String, i32)]) -> BTreeMap<String, i32> {
+    let mut balances = BTreeMap::new();
+    for (wallet_id, amount) in archived {
+        *balances.entry(wallet_id.clone()).or_insert(0) += amount;
+    }
+    balances
+}
+
 #[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
 pub struct Transaction {
     pub id: String,
@@ -129,6 +264,11 @@ pub struct Transaction {
     pub transaction_data: Option<String>,
     pub error_message: Option<String>,
 
+    /// Set by the client so a retried request reuses this transaction
+    /// instead of recording another. Unique per wallet.
+    #[serde(default)]
+    pub client_reference: Option<String>,
+
     #[serde(
         serialize_with = "serialize_offset_date_time",
         deserialize_with = "deserialize_offset_date_time"
@@ -142,6 +282,25 @@ pub struct Transaction {
     pub updated_at: Option<OffsetDateTime>,
 }
 
+/// Every transaction created in `[$1, $2)`, archived or not, oldest first.
+/// Run with `fetch` so a long range streams instead of loading at once.
+pub const EXPORT_TRANSACTIONS_QUERY: &str = "SELECT id, wallet_id, transaction_type, transaction_amount, transaction_status,
+        transaction_data, error_message, created_at, updated_at
+    FROM transactions WHERE created_at >= $1 AND created_at < $2
+    UNION ALL
+    SELECT id, wallet_id, transaction_type, transaction_amount, transaction_status,
+        transaction_data, error_message, created_at, updated_at
+    FROM archived_transactions WHERE created_at >= $1 AND created_at < $2
+    ORDER BY created_at ASC, id ASC";
+
+/// A page of transactions and the cursor for the next one, if there is one.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct TransactionPage {
+    pub transactions: Vec<Transaction>,
+    pub next_cursor: Option<String>,
+}
+
 impl Transaction {
     pub fn new(wallet_id: String) -> Self {
         Self {
@@ -152,6 +311,7 @@ impl Transaction {
             transaction_status: TransactionStatus::Preparing,
             transaction_data: None,
             error_message: None,
+            client_reference: None,
             created_at: None,
             updated_at: None,
         }
@@ -209,7 +369,19 @@ impl Transaction {
         None
     }
 
+    /// Saves everything but the status, which only changes through
+    /// `update_status`. A changed status is rejected rather than dropped.
     pub async fn update(&mut self) -> Option<anyhow::Error> {
+        let stored = match Transaction::find_one(self.id.clone()).await {
+            Ok(stored) => stored,
+            Err(e) => {
+                println!("[Transaction::update] Failed to get transaction: {:?}", e);
+                return Some(e);
+            }
+        };
+        if stored.transaction_status != self.transaction_status {
+            return Some(anyhow::Error::msg(TRANSACTION_STATUS_NOT_EDITABLE));
+        }
         let params = vec![
             (
                 "transaction_type",
@@ -219,10 +391,6 @@ impl Transaction {
                 "transaction_amount",
                 self.transaction_amount.clone().to_string().into(),
             ),
-            (
-                "transaction_status",
-                self.transaction_status.clone().to_string().into(),
-            ),
             (
                 "transaction_data",
                 self.transaction_data
@@ -249,6 +417,82 @@ impl Transaction {
         None
     }
 
+    /// Moves the transaction to `status`. Illegal moves are rejected, and the
+    /// update only applies if the stored status is still the one checked.
+    /// Completing a transaction adds its amount to the wallet's coin balance
+    /// in the same database transaction.
+    pub async fn update_status(
+        &mut self,
+        status: TransactionStatus,
+        error_message: Option<String>,
+    ) -> Option<anyhow::Error> {
+        if let Err(e) = validate_status_transition(&self.transaction_status, &status) {
+            return Some(e);
+        }
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!(
+                    "[Transaction::update_status] Failed to begin transaction: {:?}",
+                    e
+                );
+                return Some(e.into());
+            }
+        };
+        let row = match sqlx::query(
+            "UPDATE transactions SET transaction_status = $1, error_message = $2, updated_at = now()
+            WHERE id = $3 AND transaction_status = $4
+            RETURNING *",
+        )
+        .bind(status.to_string())
+        .bind(error_message.or(self.error_message.clone()).unwrap_or_default())
+        .bind(self.id.clone())
+        .bind(self.transaction_status.to_string())
+        .fetch_optional(&mut *tx)
+        .await
+        {
+            Ok(Some(row)) => row,
+            Ok(None) => return Some(anyhow::Error::msg("Transaction status changed, try again")),
+            Err(e) => {
+                println!(
+                    "[Transaction::update_status] Failed to update transaction: {:?}",
+                    e
+                );
+                return Some(e.into());
+            }
+        };
+        let transaction = match Transaction::from_row(&row) {
+            Ok(transaction) => transaction,
+            Err(e) => return Some(e.into()),
+        };
+        if status == TransactionStatus::Completed {
+            if let Err(e) = sqlx::query(
+                "UPDATE wallets SET coin_balance = coin_balance + $1, updated_at = now() WHERE id = $2",
+            )
+            .bind(transaction.transaction_amount)
+            .bind(transaction.wallet_id.clone())
+            .execute(&mut *tx)
+            .await
+            {
+                println!(
+                    "[Transaction::update_status] Failed to update coin balance: {:?}",
+                    e
+                );
+                return Some(e.into());
+            }
+        }
+        if let Err(e) = tx.commit().await {
+            println!(
+                "[Transaction::update_status] Failed to commit transaction: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        *self = transaction;
+        None
+    }
+
     pub async fn delete_permanent(&mut self) -> Option<anyhow::Error> {
         match delete_resource_where_fields!(Transaction, vec![("id", self.id.clone().into())], true)
             .await
@@ -361,6 +605,164 @@ impl Transaction {
     pub async fn get_relationships(&mut self) -> Option<anyhow::Error> {
         None
     }
+
+    /// One page of the wallet's transactions, newest first, starting after
+    /// the `after` cursor. New transactions land before the first page, so
+    /// scrolling back through history never repeats or skips a row.
+    pub async fn find_page_by_wallet_id(
+        wallet_id: String,
+        after: Option<Cursor>,
+        limit: i64,
+    ) -> Result<TransactionPage, anyhow::Error> {
+        let pool = get_connection().await;
+        let query = match after {
+            Some(after) => sqlx::query(
+                "SELECT * FROM transactions
+                WHERE wallet_id = $1 AND (created_at, id) < ($2, $3)
+                ORDER BY created_at DESC, id DESC LIMIT $4",
+            )
+            .bind(wallet_id)
+            .bind(after.created_at)
+            .bind(after.id),
+            None => sqlx::query(
+                "SELECT * FROM transactions
+                WHERE wallet_id = $1
+                ORDER BY created_at DESC, id DESC LIMIT $2",
+            )
+            .bind(wallet_id),
+        };
+        let rows = match query.bind(limit + 1).fetch_all(&pool).await {
+            Ok(rows) => rows
+                .iter()
+                .map(Transaction::from_row)
+                .collect::<Result<Vec<Transaction>, _>>()?,
+            Err(e) => {
+                println!(
+                    "[Transaction::find_page_by_wallet_id] Failed to get transactions: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+
+        let (transactions, next_cursor) = next_page(rows, limit, |transaction: &Transaction| {
+            transaction
+                .created_at
+                .map(|created_at| Cursor::new(created_at, transaction.id.clone()))
+        });
+        Ok(TransactionPage {
+            transactions,
+            next_cursor,
+        })
+    }
+
+    /// Moves completed transactions created before `cutoff` into
+    /// `archived_transactions` and replaces them with a single opening balance
+    /// per wallet, so wallet balances are unchanged. Returns the number of
+    /// transactions archived.
+    pub async fn archive_completed_before(cutoff: OffsetDateTime) -> Result<usize, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!(
+                    "[Transaction::archive_completed_before] Failed to begin transaction: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+
+        let rows = match sqlx::query(
+            "WITH archived AS (
+                DELETE FROM transactions
+                WHERE transaction_status = 'completed' AND created_at < $1
+                RETURNING *
+            )
+            INSERT INTO archived_transactions (
+                id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                transaction_data, error_message, client_reference, created_at, updated_at
+            )
+            SELECT id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                transaction_data, error_message, client_reference, created_at, updated_at
+            FROM archived
+            RETURNING wallet_id, transaction_amount",
+        )
+        .bind(cutoff)
+        .fetch_all(&mut *tx)
+        .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!(
+                    "[Transaction::archive_completed_before] Failed to archive transactions: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        let archived: Vec<(String, i32)> = rows
+            .iter()
+            .map(|row| (row.get("wallet_id"), row.get("transaction_amount")))
+            .collect();
+
+        // Opening balances are dated at the cutoff but written now, so a
+        // wallet sync delivers them.
+        for (wallet_id, amount) in opening_balances(&archived) {
+            let transaction_type = if amount < 0 {
+                TransactionType::Debit
+            } else {
+                TransactionType::Credit
+            };
+            if let Err(e) = sqlx::query(
+                "INSERT INTO transactions (
+                    id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                    transaction_data, error_message, created_at, updated_at
+                ) VALUES ($1, $2, $3, $4, $5, $6, '', $7, now())",
+            )
+            .bind(Uuid::new_v4().to_string())
+            .bind(wallet_id)
+            .bind(transaction_type.to_string())
+            .bind(amount)
+            .bind(TransactionStatus::Completed.to_string())
+            .bind(OPENING_BALANCE_DATA)
+            .bind(cutoff)
+            .execute(&mut *tx)
+            .await
+            {
+                println!(
+                    "[Transaction::archive_completed_before] Failed to create opening balance: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!(
+                "[Transaction::archive_completed_before] Failed to commit transaction: {:?}",
+                e
+            );
+            return Err(e.into());
+        }
+        Ok(archived.len())
+    }
+
+    pub async fn delete_archived_by_wallet_id(wallet_id: String) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        if let Err(e) = sqlx::query("DELETE FROM archived_transactions WHERE wallet_id = $1")
+            .bind(wallet_id)
+            .execute(&pool)
+            .await
+        {
+            println!(
+                "[Transaction::delete_archived_by_wallet_id] Failed to delete archived transactions: {:?}",
+                e
+            );
+            return Some(e.into());
+        }
+        None
+    }
 }
 
 impl DatabaseResource for Transaction {
@@ -376,6 +778,8 @@ impl DatabaseResource for Transaction {
             transaction_status: row.get("transaction_status"),
             transaction_data: row.get("transaction_data"),
             error_message: row.get("error_message"),
+            // Exports do not carry the column.
+            client_reference: row.try_get("client_reference").unwrap_or(None),
             created_at,
             updated_at,
         })
@@ -399,3 +803,162 @@ impl DatabaseResource for Transaction {
         false
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::database::test_support::{create_test_user, test_pool, test_wallet};
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_archive_preserves_wallet_totals() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        assert!(wallet.add_coins(50).await.is_none());
+        assert!(wallet.remove_coins(15).await.is_none());
+        sqlx::query(
+            "UPDATE transactions SET created_at = now() - interval '2 days' WHERE wallet_id = $1",
+        )
+        .bind(wallet.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+        assert!(wallet.add_coins(5).await.is_none());
+
+        let archived = Transaction::archive_completed_before(
+            OffsetDateTime::now_utc() - time::Duration::days(1),
+        )
+        .await
+        .unwrap();
+        assert!(archived >= 2);
+
+        let amounts: Vec<(i32, Option<String>)> = sqlx::query(
+            "SELECT transaction_amount, transaction_data FROM transactions
+            WHERE wallet_id = $1 ORDER BY created_at ASC",
+        )
+        .bind(wallet.id.clone())
+        .fetch_all(&pool)
+        .await
+        .unwrap()
+        .iter()
+        .map(|row| (row.get("transaction_amount"), row.get("transaction_data")))
+        .collect();
+        assert_eq!(amounts.len(), 2);
+        assert_eq!(amounts[0], (35, Some(OPENING_BALANCE_DATA.to_string())));
+        assert_eq!(amounts[1].0, 5);
+
+        assert_eq!(test_wallet(&user).await.coins, 40);
+        let reconciliation = wallet.reconcile(false).await.unwrap();
+        assert_eq!(reconciliation.ledger_coins, 40);
+        assert_eq!(reconciliation.drift, 0);
+    }
+
+    fn debit(id: &str, amount: i32, client_reference: &str) -> Transaction {
+        let mut transaction = Transaction::new("wallet".to_string());
+        transaction.id = id.to_string();
+        transaction.transaction_type = TransactionType::Debit;
+        transaction.transaction_amount = amount;
+        transaction.client_reference = Some(client_reference.to_string());
+        transaction
+    }
+
+    #[test]
+    fn test_reused_client_reference_must_match() {
+        let existing = debit("transaction-1", -25, "spend-1");
+        let error =
+            replayed_transaction(Some(existing.clone()), &TransactionType::Debit, -30).unwrap_err();
+        assert_eq!(error.to_string(), CLIENT_REFERENCE_CONFLICT);
+        assert!(replayed_transaction(Some(existing), &TransactionType::Credit, -25).is_err());
+        assert!(
+            replayed_transaction(None, &TransactionType::Debit, -25)
+                .unwrap()
+                .is_none()
+        );
+    }
+
+    #[test]
+    fn test_validate_client_reference() {
+        assert_eq!(validate_client_reference("  spend-1 ").unwrap(), "spend-1");
+        assert!(validate_client_reference("   ").is_err());
+        assert!(validate_client_reference(&"x".repeat(MAX_CLIENT_REFERENCE_LENGTH + 1)).is_err());
+    }
+
+    #[test]
+    fn test_opening_balances_empty() {
+        assert!(opening_balances(&[]).is_empty());
+    }
+
+    #[test]
+    fn test_collect_transaction_data() {
+        let mut transaction = Transaction::new("wallet".to_string());
+        transaction.transaction_data = Some(collect_transaction_data("mnstr-1"));
+
+        let data: serde_json::Value =
+            serde_json::from_str(transaction.transaction_data.as_deref().unwrap()).unwrap();
+        assert_eq!(data["source"], "collect");
+        assert_eq!(data["mnstr_id"], "mnstr-1");
+        assert_eq!(transaction.to_grpc().data, collect_transaction_data("mnstr-1"));
+    }
+
+    #[test]
+    fn test_status_transitions() {
+        use TransactionStatus::*;
+
+        assert!(validate_status_transition(&Pending, &Completed).is_ok());
+        assert!(validate_status_transition(&Pending, &Failed).is_ok());
+        assert!(validate_status_transition(&Preparing, &Pending).is_ok());
+
+        let error = validate_status_transition(&Completed, &Pending).unwrap_err();
+        assert_eq!(error.to_string(), "Cannot move a completed transaction to pending");
+        assert!(validate_status_transition(&Completed, &Failed).is_err());
+        assert!(validate_status_transition(&Failed, &Completed).is_err());
+        assert!(validate_status_transition(&Pending, &Preparing).is_err());
+        assert!(validate_status_transition(&Pending, &Pending).is_err());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_completing_a_transaction_moves_the_balance() {
+        let user = create_test_user().await;
+        let wallet = test_wallet(&user).await;
+        let mut transaction = Transaction::new(wallet.id.clone());
+        transaction.transaction_amount = 40;
+        assert!(transaction.create().await.is_none());
+        assert!(
+            transaction
+                .update_status(TransactionStatus::Pending, None)
+                .await
+                .is_none()
+        );
+        assert_eq!(test_wallet(&user).await.coins, 0);
+
+        transaction.transaction_status = TransactionStatus::Completed;
+        let error = transaction.update().await.expect("status edits must be rejected");
+        assert_eq!(error.to_string(), TRANSACTION_STATUS_NOT_EDITABLE);
+        transaction.transaction_status = TransactionStatus::Pending;
+
+        assert!(
+            transaction
+                .update_status(TransactionStatus::Completed, None)
+                .await
+                .is_none()
+        );
+        assert_eq!(test_wallet(&user).await.coins, 40);
+        assert!(
+            transaction
+                .update_status(TransactionStatus::Pending, None)
+                .await
+                .is_some()
+        );
+        assert_eq!(test_wallet(&user).await.coins, 40);
+    }
+
+    #[test]
+    fn test_spend_transaction_data() {
+        let data: serde_json::Value =
+            serde_json::from_str(&spend_transaction_data("naming fee")).unwrap();
+        assert_eq!(data["source"], "spend");
+        assert_eq!(data["reason"], "naming fee");
+    }
+}
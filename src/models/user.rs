@@ -1,18 +1,46 @@
+use std::collections::HashMap;
+
 use juniper::GraphQLObject;
 use serde::{Deserialize, Serialize};
-use sqlx::{Row, postgres::PgRow};
-use time::OffsetDateTime;
+use sqlx::{PgConnection, Row, postgres::PgRow};
+use time::{Duration, OffsetDateTime};
+use uuid::Uuid;
 
 use crate::{
-    database::{traits::DatabaseResource, values::DatabaseValue},
+    config::config,
+    database::{
+        connection::get_connection, traits::DatabaseResource, transaction::with_tx,
+        values::DatabaseValue,
+    },
     delete_resource_where_fields, find_all_resources_where_fields, find_one_resource_where_fields,
-    insert_resource,
-    models::{generated::level_xp::XP_FOR_LEVEL, mnstr::Mnstr, session::Session, wallet::Wallet},
+    models::{
+        achievement::Achievement,
+        api_token::ApiToken,
+        collect_cooldown::CollectCooldown,
+        experience::{
+            INACTIVITY_GRACE_DAYS, apply_xp_batch, clamp_level, decay_start, decay_xp,
+            repair_level, xp_to_next_level,
+        },
+        generated::level_xp::XP_FOR_LEVEL,
+        idempotency_key::IdempotencyKey,
+        login_throttle::{record_login_success, start_login},
+        mnstr::{Mnstr, search_bounds, search_patterns},
+        mnstr_edit::MnstrEdit,
+        mnstr_evolution::MnstrEvolution,
+        mnstr_transfer::MnstrTransfer,
+        ownership_event::OwnershipEvent,
+        session::Session,
+        share_link::ShareLink,
+        trade::Trade,
+        wallet::Wallet,
+        xp_multiplier::apply_xp_multiplier,
+    },
     proto::User as GrpcUser,
     update_resource,
     utils::{
-        passwords::hash_password,
+        passwords::{hash_password, verify_password},
         time::{deserialize_offset_date_time, serialize_offset_date_time},
+        validation::validate_display_name,
     },
 };
 
@@ -30,7 +58,11 @@ pub struct User {
     pub experience_level: i32,
     pub experience_points: i32,
     pub experience_to_next_level: i32, // calculated based on the experience_level
+    pub experience_remaining: i32,     // calculated based on the experience_level
+    pub level_progress: f64,           // calculated based on the experience_level
     pub coins: i32,                    // calculated based on transaction history
+    #[serde(default)]
+    pub mnstr_count: i32, // calculated from the user's unarchived mnstrs
 
     #[serde(
         serialize_with = "serialize_offset_date_time",
@@ -50,11 +82,42 @@ pub struct User {
     )]
     pub archived_at: Option<OffsetDateTime>,
 
+    #[serde(
+        default,
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub last_daily_reward_at: Option<OffsetDateTime>,
+
+    #[serde(default)]
+    pub daily_reward_streak: i32,
+
     // Relationships
     pub wallet: Option<Wallet>,
     pub mnstrs: Vec<Mnstr>,
 }
 
+/// A user along with their timestamps, for admin and debugging clients.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct UserDetails {
+    pub user: User,
+    pub created_at: Option<OffsetDateTime>,
+    pub updated_at: Option<OffsetDateTime>,
+    pub archived_at: Option<OffsetDateTime>,
+}
+
+impl UserDetails {
+    pub fn from_user(user: User) -> Self {
+        Self {
+            created_at: user.created_at,
+            updated_at: user.updated_at,
+            archived_at: user.archived_at,
+            user,
+        }
+    }
+}
+
 impl User {
     pub fn new(
         email: Option<String>,
@@ -76,10 +139,15 @@ impl User {
             experience_level: 0,
             experience_points: 0,
             experience_to_next_level: 0,
+            experience_remaining: 0,
+            level_progress: 0.0,
             coins: 0,
+            mnstr_count: 0,
             created_at: None,
             updated_at: None,
             archived_at: None,
+            last_daily_reward_at: None,
+            daily_reward_streak: 0,
             wallet: None,
             mnstrs: Vec::new(),
         }
@@ -100,32 +168,63 @@ impl User {
         }
     }
 
+    /// Inserts the user along with their wallet. Both are written in one
+    /// transaction so a failed wallet never leaves a user without one.
     pub async fn create(&mut self) -> Option<anyhow::Error> {
+        self.create_and_then(|_| async { Ok(()) }).await
+    }
+
+    /// Creates the user like [`User::create`], running `then` with the new
+    /// user before the transaction commits. If `then` fails nothing is kept,
+    /// so the same email can be used to register again. `then` runs while the
+    /// transaction is open, so it must not do anything that cannot be rolled
+    /// back, such as sending email.
+    pub async fn create_and_then<F, Fut>(&mut self, then: F) -> Option<anyhow::Error>
+    where
+        F: FnOnce(User) -> Fut + Send + 'static,
+        Fut: Future<Output = Result<(), anyhow::Error>> + Send + 'static,
+    {
         println!(
             "[User::create] Creating user: {:?}",
             self.display_name.clone()
         );
-        let params = vec![
-            ("password_hash", self.password_hash.clone().into()),
-            ("phone", self.phone.clone().into()),
-            ("email", self.email.clone().into()),
-            ("display_name ", self.display_name.clone().into()),
-            ("email_verified", self.email_verified.clone().into()),
-            ("phone_verified", self.phone_verified.clone().into()),
-            (
-                "email_verification_code",
-                self.email_verification_code.clone().into(),
-            ),
-            (
-                "phone_verification_code",
-                self.phone_verification_code.clone().into(),
-            ),
-        ];
-        let mut user = match insert_resource!(User, params).await {
+        let new_user = self.clone();
+        let mut user = match with_tx(move |conn| {
+            Box::pin(async move {
+                let row = sqlx::query(
+                    "INSERT INTO users (id, password_hash, phone, email, display_name, email_verified,
+                        phone_verified, email_verification_code, phone_verification_code, created_at, updated_at)
+                    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now(), now()) RETURNING *",
+                )
+                .bind(Uuid::new_v4().to_string())
+                .bind(new_user.password_hash)
+                .bind(new_user.phone)
+                .bind(new_user.email)
+                .bind(new_user.display_name)
+                .bind(new_user.email_verified)
+                .bind(new_user.phone_verified)
+                .bind(new_user.email_verification_code)
+                .bind(new_user.phone_verification_code)
+                .fetch_one(&mut *conn)
+                .await?;
+                let user = User::from_row(&row)?;
+                sqlx::query(
+                    "INSERT INTO wallets (id, user_id, created_at, updated_at) VALUES ($1, $2, now(), now())",
+                )
+                .bind(Uuid::new_v4().to_string())
+                .bind(user.id.clone())
+                .execute(&mut *conn)
+                .await?;
+                then(user.clone()).await?;
+                Ok(user)
+            })
+        })
+        .await
+        {
             Ok(user) => user,
             Err(e) => {
                 println!("[User::create] Failed to create user: {:?}", e);
-                return Some(e.into());
+                return Some(e);
             }
         };
 
@@ -176,6 +275,38 @@ impl User {
         None
     }
 
+    /// Renames the user. Only the display name column is written, so nothing
+    /// else about the user or their mnstrs changes.
+    pub async fn update_display_name(&mut self, display_name: String) -> Option<anyhow::Error> {
+        let display_name = display_name.trim().to_string();
+        if let Err(e) = validate_display_name(&display_name) {
+            return Some(e);
+        }
+
+        let params = vec![("display_name", display_name.into())];
+        let mut user = match update_resource!(User, self.id.clone(), params).await {
+            Ok(user) => user,
+            Err(e) => {
+                println!(
+                    "[User::update_display_name] Failed to update display name: {:?}",
+                    e
+                );
+                return Some(e.into());
+            }
+        };
+
+        if let Some(error) = user.get_relationships().await {
+            println!(
+                "[User::update_display_name] Failed to get relationships: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        *self = user;
+        None
+    }
+
     pub async fn delete_permanent(&mut self) -> Option<anyhow::Error> {
         let user = match Self::find_one(self.id.clone(), false).await {
             Ok(user) => user,
@@ -187,6 +318,86 @@ impl User {
 
         *self = user;
 
+        if let Some(error) = IdempotencyKey::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete idempotency keys: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = MnstrEdit::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete mnstr edits: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = MnstrTransfer::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete mnstr transfers: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = MnstrEvolution::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete mnstr evolutions: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = OwnershipEvent::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete ownership events: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = CollectCooldown::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete collect cooldowns: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = Trade::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete trades: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = Achievement::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete achievements: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = ApiToken::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete api tokens: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
+        if let Some(error) = ShareLink::delete_permanent_by_user_id(self.id.clone()).await {
+            println!(
+                "[User::delete_permanent] Failed to delete share links: {:?}",
+                error
+            );
+            return Some(error);
+        }
+
         for mnstr in self.mnstrs.iter_mut() {
             if let Some(error) = mnstr.delete_permanent().await {
                 println!(
@@ -235,6 +446,52 @@ impl User {
         None
     }
 
+    /// Archives the user along with their mnstrs and wallet and revokes every
+    /// session and API token, all in one transaction. Nothing is deleted, so support can
+    /// still restore the account.
+    pub async fn archive(&mut self) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[User::archive] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+
+        let archived_at = OffsetDateTime::now_utc();
+        for query in [
+            "UPDATE users SET archived_at = $1, updated_at = $1 WHERE id = $2 AND archived_at IS NULL",
+            "UPDATE mnstrs SET archived_at = $1, version = version + 1, updated_at = $1 WHERE user_id = $2 AND archived_at IS NULL",
+            "UPDATE wallets SET archived_at = $1, updated_at = $1 WHERE user_id = $2 AND archived_at IS NULL",
+            "UPDATE sessions SET archived_at = $1, updated_at = $1 WHERE user_id = $2 AND archived_at IS NULL",
+            "UPDATE api_tokens SET archived_at = $1 WHERE user_id = $2 AND archived_at IS NULL",
+            "UPDATE share_links SET archived_at = $1 WHERE user_id = $2 AND archived_at IS NULL",
+        ] {
+            if let Err(e) = sqlx::query(query)
+                .bind(archived_at)
+                .bind(self.id.clone())
+                .execute(&mut *tx)
+                .await
+            {
+                println!("[User::archive] Failed to archive user: {:?}", e);
+                return Some(e.into());
+            }
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[User::archive] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+        self.archived_at = Some(archived_at);
+        None
+    }
+
+    /// Archived users can no longer log in.
+    pub fn is_active(&self) -> bool {
+        self.archived_at.is_none()
+    }
+
     pub async fn find_one(id: String, get_relationships: bool) -> Result<Self, anyhow::Error> {
         let params = vec![("id", id.clone().into())];
         let mut user = match find_one_resource_where_fields!(User, params).await {
@@ -249,6 +506,9 @@ impl User {
                 println!("[User::find_one] Failed to get relationships: {:?}", error);
                 return Err(error.into());
             }
+        } else if let Some(error) = user.get_mnstr_count().await {
+            println!("[User::find_one] Failed to get mnstr count: {:?}", error);
+            return Err(error.into());
         }
         user.update_experience_to_next_level();
         Ok(user)
@@ -278,6 +538,30 @@ impl User {
         Ok(user)
     }
 
+    /// The active user `email` and `password` sign in as, if any. Every
+    /// failure looks the same to the caller so logins cannot be used to find
+    /// out which emails are registered. After repeated failures for an email
+    /// each attempt waits a little longer before it is checked.
+    pub async fn authenticate(email: String, password: &str) -> Option<Self> {
+        let delay = start_login(&email);
+        if !delay.is_zero() {
+            tokio::time::sleep(delay).await;
+        }
+
+        let user = match User::find_one_by(vec![("email", email.clone().into())], false).await {
+            Ok(user) => Some(user),
+            Err(e) => {
+                println!("[User::authenticate] Failed to get user by email: {:?}", e);
+                None
+            }
+        };
+        let user = check_credentials(user, password);
+        if user.is_some() {
+            record_login_success(&email);
+        }
+        user
+    }
+
     pub async fn find_all(get_relationships: bool) -> Result<Vec<Self>, anyhow::Error> {
         let mut users = match find_all_resources_where_fields!(User, vec![], None, None).await {
             Ok(users) => users,
@@ -324,6 +608,69 @@ impl User {
         Ok(users)
     }
 
+    /// The users with the given ids in one query, keyed by id. Ids with no
+    /// user are simply absent from the map.
+    pub async fn find_all_by_ids(ids: Vec<String>) -> Result<HashMap<String, Self>, anyhow::Error> {
+        if ids.is_empty() {
+            return Ok(HashMap::new());
+        }
+        let pool = get_connection().await;
+        let rows = match sqlx::query("SELECT * FROM users WHERE id = ANY($1)")
+            .bind(ids)
+            .fetch_all(&pool)
+            .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!("[User::find_all_by_ids] Failed to get users: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let users = rows
+            .iter()
+            .map(User::from_row)
+            .collect::<Result<Vec<User>, _>>()?;
+        Ok(users_by_id(users))
+    }
+
+    /// Users whose display name or email contains `query`, ignoring case,
+    /// for admins. Archived users are included so they can be found too.
+    pub async fn search(
+        query: String,
+        limit: Option<i64>,
+        offset: Option<i64>,
+    ) -> Result<Vec<UserSearchResult>, anyhow::Error> {
+        let (contains, _) = search_patterns(&query);
+        let (limit, offset) = search_bounds(limit, offset);
+
+        let pool = get_connection().await;
+        match sqlx::query(
+            r"SELECT users.id, users.display_name, users.email, users.experience_level,
+                users.created_at, users.archived_at,
+                (SELECT count(*) FROM mnstrs
+                    WHERE mnstrs.user_id = users.id AND mnstrs.archived_at IS NULL) AS mnstr_count
+            FROM users
+            WHERE users.display_name ILIKE $1 ESCAPE '\' OR users.email ILIKE $1 ESCAPE '\'
+            ORDER BY users.display_name ASC, users.id ASC
+            LIMIT $2 OFFSET $3",
+        )
+        .bind(contains)
+        .bind(limit)
+        .bind(offset)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(rows
+                .iter()
+                .map(UserSearchResult::from_row)
+                .collect::<Result<Vec<UserSearchResult>, _>>()?),
+            Err(e) => {
+                println!("[User::search] Failed to search users: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+
     pub async fn get_relationships(&mut self) -> Option<anyhow::Error> {
         if let Some(error) = self.get_wallet().await {
             println!(
@@ -378,10 +725,30 @@ impl User {
                 return Some(e.into());
             }
         };
+        self.mnstr_count = unarchived_count(&mnstrs);
         self.mnstrs = mnstrs;
         None
     }
 
+    /// Counts the user's unarchived mnstrs without loading them.
+    pub async fn get_mnstr_count(&mut self) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT COUNT(*)::int4 AS count FROM mnstrs WHERE user_id = $1 AND archived_at IS NULL",
+        )
+        .bind(self.id.clone())
+        .fetch_one(&pool)
+        .await
+        {
+            Ok(row) => self.mnstr_count = row.get("count"),
+            Err(e) => {
+                println!("[User::get_mnstr_count] Failed to count mnstrs: {:?}", e);
+                return Some(e.into());
+            }
+        }
+        None
+    }
+
     pub async fn get_coins(&mut self) -> Option<anyhow::Error> {
         if let Some(error) = self.get_wallet().await {
             return Some(error.into());
@@ -436,54 +803,361 @@ impl User {
     }
 
     pub fn update_experience_to_next_level(&mut self) {
-        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
-        let mut xp_to_next_level = XP_FOR_LEVEL[last_level_index as usize];
-        if self.experience_level < last_level_index {
-            xp_to_next_level = XP_FOR_LEVEL[self.experience_level as usize + 1];
-        }
+        let xp_to_next_level = xp_to_next_level(&XP_FOR_LEVEL, self.experience_level);
         self.experience_to_next_level = xp_to_next_level;
+        self.experience_remaining = (xp_to_next_level - self.experience_points).max(0);
+        self.level_progress = self.level_progress();
+    }
+
+    /// Progress through the current level as a ratio in `[0, 1]`.
+    pub fn level_progress(&self) -> f64 {
+        level_progress(self.experience_level, self.experience_points)
     }
 
+    /// Awards `xp` to the user. The row is locked while the new level is
+    /// worked out from the stored values, so concurrent awards all count.
     pub async fn update_xp(&mut self, xp: i32) -> Option<anyhow::Error> {
-        self.experience_points += xp;
+        self.add_xp_batch(&[xp]).await
+    }
 
-        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
-        let mut xp_to_next_level = XP_FOR_LEVEL[last_level_index as usize];
-        if self.experience_level < last_level_index {
-            xp_to_next_level = XP_FOR_LEVEL[self.experience_level as usize + 1];
+    /// Awards every grant in `awards` with one locked read and one write, as
+    /// if each had been passed to `update_xp` in turn. Batch operations use
+    /// this so a run of level ups is settled once.
+    pub async fn add_xp_batch(&mut self, awards: &[i32]) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[User::add_xp_batch] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+
+        let experience = match User::lock_experience(&mut tx, &self.id).await {
+            Ok(experience) => experience,
+            Err(e) => return Some(e),
+        };
+        let (experience_level, experience_points) =
+            match User::award_xp(&mut tx, &self.id, experience, awards).await {
+                Ok(experience) => experience,
+                Err(e) => return Some(e),
+            };
+
+        if let Err(e) = tx.commit().await {
+            println!("[User::add_xp_batch] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
         }
-        let xp_overage = self.experience_points - xp_to_next_level;
 
-        let mut remaining_overage = xp_overage;
-        while remaining_overage >= 0 {
-            self.experience_points = remaining_overage;
-            self.experience_level += 1;
-            xp_to_next_level = XP_FOR_LEVEL[self.experience_level as usize + 1];
-            remaining_overage -= xp_to_next_level;
+        self.set_experience(experience_level, experience_points)
+            .await;
+        None
+    }
 
-            xp_to_next_level = XP_FOR_LEVEL[self.experience_level as usize + 1];
-            if remaining_overage < 0 {
-                self.experience_points = 0;
+    /// Locks the user's row until the caller's transaction ends and returns
+    /// their stored level and points.
+    pub async fn lock_experience(
+        conn: &mut PgConnection,
+        user_id: &str,
+    ) -> Result<(i32, i32), anyhow::Error> {
+        match sqlx::query(
+            "SELECT experience_level, experience_points FROM users WHERE id = $1 FOR UPDATE",
+        )
+        .bind(user_id)
+        .fetch_one(&mut *conn)
+        .await
+        {
+            Ok(row) => Ok((row.get("experience_level"), row.get("experience_points"))),
+            Err(e) => {
+                println!("[User::lock_experience] Failed to lock user: {:?}", e);
+                Err(e.into())
             }
         }
+    }
 
-        self.experience_to_next_level = xp_to_next_level;
+    /// Applies `awards`, with any running XP event, to `experience` as read
+    /// by `lock_experience` and writes the result in the caller's
+    /// transaction. Returns the new level and points.
+    pub async fn award_xp(
+        conn: &mut PgConnection,
+        user_id: &str,
+        experience: (i32, i32),
+        awards: &[i32],
+    ) -> Result<(i32, i32), anyhow::Error> {
+        let awards = awards
+            .iter()
+            .map(|xp| apply_xp_multiplier(*xp))
+            .collect::<Vec<i32>>();
+        let (experience_level, experience_points) =
+            apply_xp_batch(&XP_FOR_LEVEL, experience.0, experience.1, &awards);
+
+        if let Err(e) = sqlx::query(
+            "UPDATE users SET experience_level = $1, experience_points = $2, updated_at = now() WHERE id = $3",
+        )
+        .bind(experience_level)
+        .bind(experience_points)
+        .bind(user_id)
+        .execute(&mut *conn)
+        .await
+        {
+            println!("[User::award_xp] Failed to update user xp: {:?}", e);
+            return Err(e.into());
+        }
+        Ok((experience_level, experience_points))
+    }
 
-        if let Some(error) = self.update().await {
-            println!("[User::update_xp] Failed to update user xp: {:?}", error);
+    /// Takes on a level and points written by `award_xp`, checking the level
+    /// achievements when it is a level up.
+    pub async fn set_experience(&mut self, experience_level: i32, experience_points: i32) {
+        let levelled_up = experience_level > self.experience_level;
+        self.experience_level = experience_level;
+        self.experience_points = experience_points;
+        self.update_experience_to_next_level();
+
+        if levelled_up {
+            self.check_achievements(
+                Achievement::check_level(self.id.clone(), experience_level).await,
+            )
+            .await;
+        }
+    }
+
+    /// Rewrites a stored level or point total that is out of range for the XP
+    /// table, returning whether anything needed fixing.
+    pub async fn repair_experience_level(user_id: String) -> Result<bool, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[User::repair_experience_level] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let (experience_level, experience_points): (i32, i32) = match sqlx::query(
+            "SELECT experience_level, experience_points FROM users WHERE id = $1 FOR UPDATE",
+        )
+        .bind(user_id.clone())
+        .fetch_one(&mut *tx)
+        .await
+        {
+            Ok(row) => (row.get("experience_level"), row.get("experience_points")),
+            Err(e) => {
+                println!("[User::repair_experience_level] Failed to lock user: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let Some((experience_level, experience_points)) =
+            repair_level(&XP_FOR_LEVEL, experience_level, experience_points)
+        else {
+            return Ok(false);
+        };
+
+        if let Err(e) = sqlx::query(
+            "UPDATE users SET experience_level = $1, experience_points = $2, updated_at = now() WHERE id = $3",
+        )
+        .bind(experience_level)
+        .bind(experience_points)
+        .bind(user_id)
+        .execute(&mut *tx)
+        .await
+        {
+            println!("[User::repair_experience_level] Failed to repair user xp: {:?}", e);
+            return Err(e.into());
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[User::repair_experience_level] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        Ok(true)
+    }
+
+    /// Decays the user's progress within their current level for every whole
+    /// day they have been away past the grace period that no earlier run
+    /// already decayed, and returns the points removed. Running it again
+    /// removes nothing until another day passes. Does nothing unless
+    /// XP_DECAY_ENABLED is set. The decay is written without touching
+    /// `updated_at`, so it does not count as activity.
+    pub async fn apply_inactivity_decay(user_id: String) -> Result<i32, anyhow::Error> {
+        if !config().xp_decay_enabled {
+            return Ok(0);
+        }
+        User::decay_experience(user_id).await
+    }
+
+    async fn decay_experience(user_id: String) -> Result<i32, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!(
+                    "[User::decay_experience] Failed to begin transaction: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+
+        let row = match sqlx::query(
+            "SELECT COALESCE(experience_points, 0) AS experience_points, updated_at, xp_decayed_at
+            FROM users WHERE id = $1 FOR UPDATE",
+        )
+        .bind(user_id.clone())
+        .fetch_one(&mut *tx)
+        .await
+        {
+            Ok(row) => row,
+            Err(e) => {
+                println!("[User::decay_experience] Failed to lock user: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let experience_points: i32 = row.get("experience_points");
+        let start = decay_start(row.get("updated_at"), row.get("xp_decayed_at"));
+        let decay_days = (OffsetDateTime::now_utc() - start).whole_days();
+        if decay_days <= 0 {
+            return Ok(0);
+        }
+        let decayed = decay_xp(experience_points, decay_days);
+
+        if let Err(e) =
+            sqlx::query("UPDATE users SET experience_points = $1, xp_decayed_at = $2 WHERE id = $3")
+                .bind(decayed)
+                .bind(start + Duration::days(decay_days))
+                .bind(user_id)
+                .execute(&mut *tx)
+                .await
+        {
+            println!("[User::decay_experience] Failed to update user xp: {:?}", e);
+            return Err(e.into());
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!(
+                "[User::decay_experience] Failed to commit transaction: {:?}",
+                e
+            );
+            return Err(e.into());
+        }
+        Ok(experience_points - decayed)
+    }
+
+    /// Applies [`User::apply_inactivity_decay`] to every live user who has
+    /// been away longer than the grace period, and returns how many lost
+    /// points. Does nothing unless XP_DECAY_ENABLED is set.
+    pub async fn apply_inactivity_decay_all() -> Result<u64, anyhow::Error> {
+        if !config().xp_decay_enabled {
+            return Ok(0);
+        }
+        let pool = get_connection().await;
+        let user_ids: Vec<String> = match sqlx::query_scalar(
+            "SELECT id FROM users WHERE archived_at IS NULL AND experience_points > 0 AND updated_at <= $1",
+        )
+        .bind(OffsetDateTime::now_utc() - Duration::days(INACTIVITY_GRACE_DAYS))
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(user_ids) => user_ids,
+            Err(e) => {
+                println!(
+                    "[User::apply_inactivity_decay_all] Failed to get inactive users: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+
+        let mut decayed = 0;
+        for user_id in user_ids {
+            match User::decay_experience(user_id.clone()).await {
+                Ok(0) => {}
+                Ok(_) => decayed += 1,
+                Err(e) => println!(
+                    "[User::apply_inactivity_decay_all] Failed to decay user {}: {:?}",
+                    user_id, e
+                ),
+            }
+        }
+        Ok(decayed)
+    }
+
+    /// Refreshes the balance after `result` unlocked anything and returns
+    /// what it unlocked. Failures are logged, never returned.
+    pub async fn check_achievements(
+        &mut self,
+        result: Result<Vec<Achievement>, anyhow::Error>,
+    ) -> Vec<Achievement> {
+        match result {
+            Ok(unlocked) => {
+                if !unlocked.is_empty() {
+                    if let Some(error) = self.get_coins().await {
+                        println!("[User::check_achievements] Failed to get coins: {:?}", error);
+                    }
+                }
+                unlocked
+            }
+            Err(e) => {
+                println!(
+                    "[User::check_achievements] Failed to check achievements: {:?}",
+                    e
+                );
+                vec![]
+            }
+        }
+    }
+
+    pub async fn spend_coins(
+        &mut self,
+        coins: i32,
+        reason: String,
+        client_reference: Option<String>,
+    ) -> Option<anyhow::Error> {
+        if let Some(error) = self.get_wallet().await {
+            println!("[User::spend_coins] Failed to get wallet: {:?}", error);
             return Some(error.into());
         }
+        match &mut self.wallet {
+            Some(wallet) => {
+                if let Some(error) = wallet.spend(coins, reason, client_reference).await {
+                    println!("[User::spend_coins] Failed to spend coins: {:?}", error);
+                    return Some(error);
+                }
+                self.coins = wallet.coins;
+            }
+            None => return Some(anyhow::Error::msg("Wallet not found")),
+        }
+        None
+    }
+
+    /// Sends `coins` to `to_user_id` and refreshes this user's balance.
+    pub async fn send_coins(&mut self, to_user_id: String, coins: i32) -> Option<anyhow::Error> {
+        if let Err(e) = Wallet::transfer(self.id.clone(), to_user_id, coins).await {
+            println!("[User::send_coins] Failed to send coins: {:?}", e);
+            return Some(e);
+        }
+        if let Some(error) = self.get_coins().await {
+            println!("[User::send_coins] Failed to get coins: {:?}", error);
+            return Some(error);
+        }
         None
     }
 
     pub async fn add_coins(&mut self, coins: i32) -> Option<anyhow::Error> {
+        self.add_coins_with_data(coins, None).await
+    }
+
+    pub async fn add_coins_with_data(
+        &mut self,
+        coins: i32,
+        transaction_data: Option<String>,
+    ) -> Option<anyhow::Error> {
         println!("[User::add_coins] Adding coins: {:?}", coins);
         if let Some(error) = self.get_wallet().await {
             println!("[User::add_coins] Failed to get wallet: {:?}", error);
             return Some(error.into());
         }
         if let Some(wallet) = &mut self.wallet {
-            if let Some(error) = wallet.add_coins(coins).await {
+            if let Some(error) = wallet.add_coins_with_data(coins, transaction_data).await {
                 println!("[User::add_coins] Failed to add coins: {:?}", error);
                 return Some(error.into());
             }
@@ -493,6 +1167,59 @@ impl User {
     }
 }
 
+/// Returns `experience_points / XP_FOR_LEVEL[experience_level + 1]` clamped to
+/// `[0, 1]`. Users at the last level always report `1.0`.
+pub fn level_progress(experience_level: i32, experience_points: i32) -> f64 {
+    let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+    let experience_level = clamp_level(&XP_FOR_LEVEL, experience_level);
+    if experience_level >= last_level_index {
+        return 1.0;
+    }
+    let xp_for_next_level = XP_FOR_LEVEL[experience_level as usize + 1];
+    if xp_for_next_level <= 0 {
+        return 1.0;
+    }
+    (experience_points as f64 / xp_for_next_level as f64).clamp(0.0, 1.0)
+}
+
+/// The only message a failed login gets, whatever the cause.
+pub const INVALID_CREDENTIALS: &str = "Invalid email or password";
+
+/// Shown when an email or phone number is already in use, without saying
+/// which, so registering cannot confirm that an account exists.
+pub const REGISTRATION_CONFLICT: &str = "Unable to register with these details";
+
+/// The user `password` signs in as, if any. An unknown email, a wrong
+/// password and an archived account all fail the same way.
+pub fn check_credentials(user: Option<User>, password: &str) -> Option<User> {
+    let user = user?;
+    if !user.is_active() || !verify_password(password, &user.password_hash) {
+        return None;
+    }
+    Some(user)
+}
+
+/// The unique constraints on users and the message shown when one is hit.
+const UNIQUE_CONSTRAINT_MESSAGES: [(&str, &str); 3] = [
+    ("users_email_key", REGISTRATION_CONFLICT),
+    ("users_phone_key", REGISTRATION_CONFLICT),
+    ("users_display_name_key", "Display name already taken"),
+];
+
+/// A user facing message if `error` is a unique violation on a users
+/// constraint. Database errors reach the models as text, so the constraint is
+/// matched by name.
+pub fn unique_violation_message(error: &anyhow::Error) -> Option<&'static str> {
+    let error = error.to_string();
+    if !error.contains("duplicate key value violates unique constraint") {
+        return None;
+    }
+    UNIQUE_CONSTRAINT_MESSAGES
+        .iter()
+        .find(|(constraint, _)| error.contains(&format!("\"{}\"", constraint)))
+        .map(|(_, message)| *message)
+}
+
 impl DatabaseResource for User {
     fn from_row(row: &PgRow) -> Result<Self, sqlx::Error> {
         let created_at = row.get("created_at");
@@ -533,10 +1260,15 @@ impl DatabaseResource for User {
             experience_level,
             experience_points,
             experience_to_next_level: 0,
+            experience_remaining: 0,
+            level_progress: 0.0,
             coins: 0,
+            mnstr_count: 0,
             created_at,
             updated_at,
             archived_at,
+            last_daily_reward_at: row.get("last_daily_reward_at"),
+            daily_reward_streak: row.get("daily_reward_streak"),
             wallet: None,
             mnstrs: Vec::new(),
         })
@@ -560,3 +1292,361 @@ impl DatabaseResource for User {
         false
     }
 }
+
+/// What an admin user search shows about a user. It leaves out the password
+/// hash, phone number and verification codes.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct UserSearchResult {
+    pub id: String,
+    pub display_name: String,
+    pub email: Option<String>,
+    pub experience_level: i32,
+    pub mnstr_count: i64,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub created_at: Option<OffsetDateTime>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub archived_at: Option<OffsetDateTime>,
+}
+
+impl UserSearchResult {
+    fn from_row(row: &PgRow) -> Result<Self, sqlx::Error> {
+        Ok(UserSearchResult {
+            id: row.try_get("id")?,
+            display_name: row.try_get("display_name")?,
+            email: row.try_get("email")?,
+            experience_level: row.try_get("experience_level")?,
+            mnstr_count: row.try_get("mnstr_count")?,
+            created_at: row.try_get("created_at")?,
+            archived_at: row.try_get("archived_at")?,
+        })
+    }
+}
+
+/// The number of `mnstrs` that are not archived.
+pub fn unarchived_count(mnstrs: &[Mnstr]) -> i32 {
+    mnstrs
+        .iter()
+        .filter(|mnstr| mnstr.archived_at.is_none())
+        .count() as i32
+}
+
+/// Keys `users` by id, with their level progress filled in.
+pub fn users_by_id(users: Vec<User>) -> HashMap<String, User> {
+    users
+        .into_iter()
+        .map(|mut user| {
+            user.update_experience_to_next_level();
+            (user.id.clone(), user)
+        })
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        database::test_support::{create_test_mnstr, create_test_user, test_pool},
+        models::experience::INACTIVITY_GRACE_DAYS,
+    };
+
+    #[test]
+    fn test_users_by_id() {
+        let user = |id: &str| {
+            let mut user = User::new(None, None, "password".to_string(), id.to_string());
+            user.id = id.to_string();
+            user
+        };
+        let users = users_by_id(vec![user("a"), user("b")]);
+
+        assert_eq!(users.len(), 2);
+        for id in ["a", "b"] {
+            assert_eq!(users.get(id).map(|user| user.display_name.as_str()), Some(id));
+        }
+        assert!(users.get("missing").is_none());
+        assert!(users_by_id(vec![]).is_empty());
+    }
+
+    #[test]
+    fn test_level_progress_at_level_zero() {
+        let xp_for_next_level = XP_FOR_LEVEL[1];
+        assert_eq!(level_progress(0, 0), 0.0);
+        assert_eq!(level_progress(0, xp_for_next_level / 2), 0.5);
+    }
+
+    #[test]
+    fn test_level_progress_mid_level() {
+        let xp_for_next_level = XP_FOR_LEVEL[51];
+        let progress = level_progress(50, xp_for_next_level / 4);
+        assert!((progress - 0.25).abs() < 0.01);
+        assert_eq!(level_progress(50, xp_for_next_level * 2), 1.0);
+        assert_eq!(level_progress(50, -10), 0.0);
+    }
+
+    #[test]
+    fn test_level_progress_at_max_level() {
+        let last_level_index = XP_FOR_LEVEL.len() as i32 - 1;
+        assert_eq!(level_progress(last_level_index, 0), 1.0);
+        assert_eq!(level_progress(last_level_index, 12345), 1.0);
+        assert_eq!(level_progress(last_level_index + 100, 0), 1.0);
+        assert_eq!(level_progress(-4, 0), 0.0);
+    }
+
+    #[test]
+    fn test_is_active() {
+        let mut user = User::new(None, None, "password".to_string(), "name".to_string());
+        assert!(user.is_active());
+
+        user.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(!user.is_active());
+    }
+
+    #[test]
+    fn test_check_credentials_success() {
+        let user = User::new(
+            Some("player@example.com".to_string()),
+            None,
+            "correct horse".to_string(),
+            "player".to_string(),
+        );
+        let user = check_credentials(Some(user), "correct horse").unwrap();
+        assert_eq!(user.email, Some("player@example.com".to_string()));
+    }
+
+    #[test]
+    fn test_check_credentials_failures_are_alike() {
+        let user = User::new(
+            Some("player@example.com".to_string()),
+            None,
+            "correct horse".to_string(),
+            "player".to_string(),
+        );
+        let unknown_email = check_credentials(None, "correct horse");
+        let wrong_password = check_credentials(Some(user.clone()), "wrong password");
+        assert!(unknown_email.is_none());
+        assert!(wrong_password.is_none());
+
+        let mut archived = user;
+        archived.archived_at = Some(OffsetDateTime::now_utc());
+        assert!(check_credentials(Some(archived), "correct horse").is_none());
+    }
+
+    #[test]
+    fn test_unique_violation_message() {
+        let duplicate_email = anyhow::Error::msg(
+            "error returned from database: duplicate key value violates unique constraint \"users_email_key\"",
+        );
+        assert_eq!(
+            unique_violation_message(&duplicate_email),
+            Some(REGISTRATION_CONFLICT)
+        );
+
+        let duplicate_phone = anyhow::Error::msg(
+            "error returned from database: duplicate key value violates unique constraint \"users_phone_key\"",
+        );
+        assert_eq!(
+            unique_violation_message(&duplicate_phone),
+            unique_violation_message(&duplicate_email)
+        );
+
+        let other = anyhow::Error::msg("error returned from database: connection reset");
+        assert_eq!(unique_violation_message(&other), None);
+    }
+
+    async fn test_experience(pool: &sqlx::PgPool, user: &User) -> (i32, OffsetDateTime) {
+        let row = sqlx::query("SELECT experience_points, updated_at FROM users WHERE id = $1")
+            .bind(user.id.clone())
+            .fetch_one(pool)
+            .await
+            .unwrap();
+        (row.get("experience_points"), row.get("updated_at"))
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_inactivity_decay_only_counts_each_day_once() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let last_active_at = OffsetDateTime::now_utc() - Duration::days(INACTIVITY_GRACE_DAYS + 10);
+        sqlx::query("UPDATE users SET experience_points = 200, updated_at = $2 WHERE id = $1")
+            .bind(user.id.clone())
+            .bind(last_active_at)
+            .execute(&pool)
+            .await
+            .unwrap();
+        let (_, last_active_at) = test_experience(&pool, &user).await;
+
+        assert_eq!(User::decay_experience(user.id.clone()).await.unwrap(), 20);
+        assert_eq!(User::decay_experience(user.id.clone()).await.unwrap(), 0);
+        let (points, updated_at) = test_experience(&pool, &user).await;
+        assert_eq!(points, 180);
+        assert_eq!(updated_at, last_active_at);
+
+        // A day later only that day decays.
+        sqlx::query(
+            "UPDATE users SET xp_decayed_at = xp_decayed_at - interval '1 day' WHERE id = $1",
+        )
+        .bind(user.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+        assert_eq!(User::decay_experience(user.id.clone()).await.unwrap(), 2);
+        assert_eq!(test_experience(&pool, &user).await.0, 178);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_concurrent_xp_awards_all_count() {
+        test_pool().await;
+        let user = create_test_user().await;
+        let handles = (0..20)
+            .map(|_| {
+                let mut user = user.clone();
+                tokio::spawn(async move { user.update_xp(25).await })
+            })
+            .collect::<Vec<_>>();
+        for handle in handles {
+            assert!(handle.await.unwrap().is_none());
+        }
+
+        let awards = vec![apply_xp_multiplier(25); 20];
+        let awarded = User::find_one(user.id.clone(), false).await.unwrap();
+        assert_eq!(
+            (awarded.experience_level, awarded.experience_points),
+            apply_xp_batch(
+                &XP_FOR_LEVEL,
+                user.experience_level,
+                user.experience_points,
+                &awards
+            )
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_failed_registration_leaves_no_user() {
+        let pool = test_pool().await;
+        let email = format!("{}@test.mnstr.app", Uuid::new_v4());
+        let mut user = User::new(
+            Some(email.clone()),
+            None,
+            "password".to_string(),
+            format!("test-{}", Uuid::new_v4()),
+        );
+
+        let error = user
+            .create_and_then(|_| async { Err(anyhow::anyhow!("forced failure")) })
+            .await;
+        assert!(error.is_some());
+
+        let users: i64 = sqlx::query_scalar("SELECT COUNT(*) FROM users WHERE email = $1")
+            .bind(email.clone())
+            .fetch_one(&pool)
+            .await
+            .unwrap();
+        assert_eq!(users, 0);
+
+        assert!(user.create().await.is_none());
+        let wallets: i64 = sqlx::query_scalar("SELECT COUNT(*) FROM wallets WHERE user_id = $1")
+            .bind(user.id.clone())
+            .fetch_one(&pool)
+            .await
+            .unwrap();
+        assert_eq!(wallets, 1);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_search_matches_part_of_a_name_in_any_case() {
+        let pool = test_pool().await;
+        let token = Uuid::new_v4().simple().to_string();
+        let mut ids = Vec::new();
+        for suffix in ["a", "b", "c"] {
+            let user = create_test_user().await;
+            sqlx::query("UPDATE users SET display_name = $1 WHERE id = $2")
+                .bind(format!("Searcher-{}-{}", token, suffix))
+                .bind(user.id.clone())
+                .execute(&pool)
+                .await
+                .unwrap();
+            ids.push(user.id);
+        }
+        let found_ids = |results: Vec<UserSearchResult>| {
+            results
+                .into_iter()
+                .map(|result| result.id)
+                .collect::<Vec<String>>()
+        };
+
+        let query = format!("ARCHER-{}", token.to_uppercase());
+        let results = User::search(query.clone(), None, None).await.unwrap();
+        assert_eq!(found_ids(results), ids);
+
+        let first_page = User::search(query.clone(), Some(2), Some(0)).await.unwrap();
+        assert_eq!(found_ids(first_page), ids[..2]);
+        let second_page = User::search(query.clone(), Some(2), Some(2)).await.unwrap();
+        assert_eq!(found_ids(second_page), ids[2..]);
+
+        let results = User::search(format!("{}-d", token), None, None)
+            .await
+            .unwrap();
+        assert!(results.is_empty());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_archived_user_cannot_log_in() {
+        let pool = test_pool().await;
+        let mut user = create_test_user().await;
+        sqlx::query("UPDATE users SET password_hash = $1 WHERE id = $2")
+            .bind(hash_password("secret"))
+            .bind(user.id.clone())
+            .execute(&pool)
+            .await
+            .unwrap();
+        for _ in 0..2 {
+            create_test_mnstr(&user, &Uuid::new_v4().to_string()).await;
+        }
+        let email = user.email.clone().unwrap();
+        assert!(User::authenticate(email.clone(), "secret").await.is_some());
+
+        assert!(user.archive().await.is_none());
+        assert!(User::authenticate(email, "secret").await.is_none());
+        let archived: i64 = sqlx::query_scalar(
+            "SELECT COUNT(*) FROM mnstrs WHERE user_id = $1 AND archived_at IS NOT NULL",
+        )
+        .bind(user.id.clone())
+        .fetch_one(&pool)
+        .await
+        .unwrap();
+        assert_eq!(archived, 2);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_mnstr_count_skips_archived_mnstrs() {
+        let pool = test_pool().await;
+        let mut user = create_test_user().await;
+        assert_eq!(user.mnstr_count, 0);
+        let mut mnstrs = Vec::new();
+        for _ in 0..3 {
+            mnstrs.push(create_test_mnstr(&user, &Uuid::new_v4().to_string()).await);
+        }
+        sqlx::query("UPDATE mnstrs SET archived_at = now() WHERE id = $1")
+            .bind(mnstrs[0].id.clone())
+            .execute(&pool)
+            .await
+            .unwrap();
+
+        assert!(user.get_mnstr_count().await.is_none());
+        assert_eq!(user.mnstr_count, 2);
+    }
+}
@@ -1,17 +1,121 @@
 use juniper::GraphQLObject;
 use serde::{Deserialize, Serialize};
-use sqlx::{Error, Row, postgres::PgRow};
-use time::OffsetDateTime;
+use sqlx::{Error, PgConnection, Row, postgres::PgRow};
+use time::{Duration, OffsetDateTime};
+
+use uuid::Uuid;
 
 use crate::{
-    database::{traits::DatabaseResource, values::DatabaseValue},
+    database::{
+        connection::get_connection, retry::with_write_retry, traits::DatabaseResource,
+        values::DatabaseValue,
+    },
     delete_resource_where_fields, find_all_resources_where_fields, find_one_resource_where_fields,
     insert_resource,
-    models::transaction::{Transaction, TransactionStatus, TransactionType},
+    models::transaction::{
+        OPENING_BALANCE_DATA, Transaction, TransactionStatus, TransactionType,
+        replayed_transaction, spend_transaction_data, transfer_transaction_data,
+        validate_client_reference,
+    },
     proto::Wallet as GrpcWallet,
-    utils::time::{deserialize_offset_date_time, serialize_offset_date_time},
+    utils::{
+        cursor::{Cursor, next_page},
+        time::{deserialize_offset_date_time, serialize_offset_date_time},
+    },
 };
 
+/// How many of a wallet's transactions have one type and status.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct TransactionCount {
+    pub transaction_type: String,
+    pub transaction_status: String,
+    pub count: i32,
+}
+
+/// Lifetime coins earned and spent by a wallet. Totals only include
+/// completed transactions; counts include every status.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct WalletSummary {
+    pub total_credits: i32,
+    pub total_debits: i32,
+    pub net: i32,
+    pub counts: Vec<TransactionCount>,
+}
+
+/// One row of the grouped query behind `Wallet::summary`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct TransactionGroup {
+    pub transaction_type: String,
+    pub transaction_status: String,
+    pub count: i64,
+    pub total: i64,
+}
+
+/// How far before `since` a sync looks again. See
+/// `Wallet::get_transactions_since`.
+pub const SYNC_OVERLAP_SECS: i64 = 60;
+
+/// The transactions written since a client's last sync, oldest write first,
+/// and the time to pass as `since` on its next sync. Rows may repeat ones
+/// the client holds and replace them by id. An opening balance replaces
+/// every completed transaction created before it, which were archived.
+#[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
+#[serde(rename_all = "camelCase")]
+pub struct TransactionSync {
+    pub transactions: Vec<Transaction>,
+
+    #[serde(
+        serialize_with = "serialize_offset_date_time",
+        deserialize_with = "deserialize_offset_date_time"
+    )]
+    pub synced_at: Option<OffsetDateTime>,
+
+    /// Set when more rows follow; pass it as `after` with the same `since`.
+    pub next_cursor: Option<String>,
+}
+
+/// A wallet's cached balance checked against its ledger of completed
+/// transactions. `fixed` is set when the cached balance was rewritten.
+#[derive(Debug, Serialize, Deserialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct WalletReconciliation {
+    pub wallet_id: String,
+    pub user_id: String,
+    pub cached_coins: i32,
+    pub ledger_coins: i32,
+    pub drift: i32,
+    pub fixed: bool,
+}
+
+impl WalletReconciliation {
+    /// Compares `cached` with the completed `transactions` of `wallet`;
+    /// pending and failed ones never move the cached balance. With `fix`, a
+    /// drifted wallet is reported as fixed; a balanced one never is.
+    pub fn new(wallet: &Wallet, cached: i32, transactions: &[Transaction], fix: bool) -> Self {
+        let completed = transactions
+            .iter()
+            .filter(|t| t.transaction_status == TransactionStatus::Completed)
+            .cloned()
+            .collect::<Vec<Transaction>>();
+        let ledger_coins = balance(&completed);
+        let drift = balance_drift(cached, ledger_coins);
+        Self {
+            wallet_id: wallet.id.clone(),
+            user_id: wallet.user_id.clone(),
+            cached_coins: cached,
+            ledger_coins,
+            drift,
+            fixed: fix && drift != 0,
+        }
+    }
+
+    pub fn is_balanced(&self) -> bool {
+        self.drift == 0
+    }
+}
+
 #[derive(Debug, Serialize, Deserialize, GraphQLObject, Clone)]
 pub struct Wallet {
     pub id: String,
@@ -86,6 +190,10 @@ impl Wallet {
             }
         }
 
+        if let Some(error) = Transaction::delete_archived_by_wallet_id(self.id.clone()).await {
+            return Some(error);
+        }
+
         match delete_resource_where_fields!(Wallet, vec![("id", self.id.clone().into())], true)
             .await
         {
@@ -166,10 +274,31 @@ impl Wallet {
         if let Some(error) = self.get_coins().await {
             return Some(error.into());
         }
+        if let Some(error) = self.get_transactions().await {
+            return Some(error.into());
+        }
         None
     }
 
+    /// Reads the cached balance, which is kept in step with the ledger by
+    /// every credit and debit. Use `reconcile_coins` to rebuild it.
     pub async fn get_coins(&mut self) -> Option<anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query("SELECT coin_balance FROM wallets WHERE id = $1")
+            .bind(self.id.clone())
+            .fetch_one(&pool)
+            .await
+        {
+            Ok(row) => self.coins = row.get("coin_balance"),
+            Err(e) => {
+                println!("[Wallet::get_coins] Failed to get coin balance: {:?}", e);
+                return Some(e.into());
+            }
+        }
+        None
+    }
+
+    pub async fn get_transactions(&mut self) -> Option<anyhow::Error> {
         let transactions = match find_all_resources_where_fields!(
             Transaction,
             vec![("wallet_id", self.id.clone().into())],
@@ -180,24 +309,194 @@ impl Wallet {
         {
             Ok(transactions) => transactions,
             Err(e) => {
-                println!("[Wallet::get_coins] Failed to get transactions: {:?}", e);
+                println!(
+                    "[Wallet::get_transactions] Failed to get transactions: {:?}",
+                    e
+                );
                 return Some(e.into());
             }
         };
-        self.transactions = transactions.clone();
-        self.coins = transactions.iter().map(|t| t.transaction_amount).sum();
+        self.transactions = transactions;
         None
     }
 
+    /// One page of the wallet's transactions written since `since`, oldest
+    /// write first, starting after the `after` cursor. A status change counts
+    /// as a write, so a client replaces the rows it already holds by id. The
+    /// window reaches back `SYNC_OVERLAP_SECS` before `since`, so a row from
+    /// a database transaction that began before the last sync but committed
+    /// after it is still delivered. `synced_at` is the database time to pass
+    /// as `since` once `next_cursor` runs out.
+    pub async fn get_transactions_since(
+        &self,
+        since: OffsetDateTime,
+        after: Option<Cursor>,
+        limit: i64,
+    ) -> Result<TransactionSync, anyhow::Error> {
+        let pool = get_connection().await;
+        let synced_at: OffsetDateTime = match sqlx::query("SELECT now() AS synced_at")
+            .fetch_one(&pool)
+            .await
+        {
+            Ok(row) => row.try_get("synced_at")?,
+            Err(e) => {
+                println!(
+                    "[Wallet::get_transactions_since] Failed to get sync time: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+        let from = since - Duration::seconds(SYNC_OVERLAP_SECS);
+        let query = match after {
+            Some(after) => sqlx::query(
+                "SELECT * FROM transactions
+                WHERE wallet_id = $1 AND updated_at > $2 AND updated_at <= $3
+                    AND (updated_at, id) > ($4, $5)
+                ORDER BY updated_at ASC, id ASC LIMIT $6",
+            )
+            .bind(self.id.clone())
+            .bind(from)
+            .bind(synced_at)
+            .bind(after.created_at)
+            .bind(after.id),
+            None => sqlx::query(
+                "SELECT * FROM transactions
+                WHERE wallet_id = $1 AND updated_at > $2 AND updated_at <= $3
+                ORDER BY updated_at ASC, id ASC LIMIT $4",
+            )
+            .bind(self.id.clone())
+            .bind(from)
+            .bind(synced_at),
+        };
+        let rows = match query.bind(limit + 1).fetch_all(&pool).await {
+            Ok(rows) => rows
+                .iter()
+                .map(Transaction::from_row)
+                .collect::<Result<Vec<Transaction>, _>>()?,
+            Err(e) => {
+                println!(
+                    "[Wallet::get_transactions_since] Failed to get transactions: {:?}",
+                    e
+                );
+                return Err(e.into());
+            }
+        };
+
+        let (transactions, next_cursor) = next_page(rows, limit, |transaction: &Transaction| {
+            transaction
+                .updated_at
+                .map(|updated_at| Cursor::new(updated_at, transaction.id.clone()))
+        });
+        Ok(TransactionSync {
+            transactions,
+            synced_at: Some(synced_at),
+            next_cursor,
+        })
+    }
+
+    /// Recomputes the cached balance from the ledger, correcting any drift.
+    pub async fn reconcile_coins(&mut self) -> Option<anyhow::Error> {
+        self.reconcile(true).await.err()
+    }
+
+    /// Checks the cached balance against the wallet's completed transactions.
+    /// Drift is only written back when `fix` is set; otherwise nothing
+    /// changes.
+    pub async fn reconcile(&mut self, fix: bool) -> Result<WalletReconciliation, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Wallet::reconcile] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let cached: i32 =
+            match sqlx::query("SELECT coin_balance FROM wallets WHERE id = $1 FOR UPDATE")
+                .bind(self.id.clone())
+                .fetch_one(&mut *tx)
+                .await
+            {
+                Ok(row) => row.get("coin_balance"),
+                Err(e) => {
+                    println!("[Wallet::reconcile] Failed to lock wallet: {:?}", e);
+                    return Err(e.into());
+                }
+            };
+        let transactions = match sqlx::query("SELECT * FROM transactions WHERE wallet_id = $1")
+            .bind(self.id.clone())
+            .fetch_all(&mut *tx)
+            .await
+        {
+            Ok(rows) => rows
+                .iter()
+                .map(Transaction::from_row)
+                .collect::<Result<Vec<Transaction>, _>>()?,
+            Err(e) => {
+                println!("[Wallet::reconcile] Failed to get transactions: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let reconciliation = WalletReconciliation::new(self, cached, &transactions, fix);
+        if !reconciliation.is_balanced() {
+            println!(
+                "[Wallet::reconcile] Wallet {} cached {} coins, ledger holds {}",
+                self.id, cached, reconciliation.ledger_coins
+            );
+        }
+        if reconciliation.fixed {
+            if let Err(e) = sqlx::query(
+                "UPDATE wallets SET coin_balance = $1, updated_at = now() WHERE id = $2",
+            )
+            .bind(reconciliation.ledger_coins)
+            .bind(self.id.clone())
+            .execute(&mut *tx)
+            .await
+            {
+                println!("[Wallet::reconcile] Failed to update coin balance: {:?}", e);
+                return Err(e.into());
+            }
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Wallet::reconcile] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        self.coins = if fix { reconciliation.ledger_coins } else { cached };
+        self.transactions = transactions;
+        Ok(reconciliation)
+    }
+
     pub async fn add_coins(&mut self, coins: i32) -> Option<anyhow::Error> {
+        self.add_coins_with_data(coins, None).await
+    }
+
+    /// Credits `coins` with `transaction_data` describing where they came from.
+    pub async fn add_coins_with_data(
+        &mut self,
+        coins: i32,
+        transaction_data: Option<String>,
+    ) -> Option<anyhow::Error> {
         println!("[Wallet::add_coins] Adding coins: {:?}", coins);
-        let mut transaction = Transaction::new(self.id.clone());
-        transaction.transaction_amount = coins;
-        transaction.transaction_type = TransactionType::Credit;
-        transaction.transaction_status = TransactionStatus::Completed;
-        if let Some(error) = transaction.create().await {
-            println!("Failed to create transaction: {:?}", error);
-            return Some(error.into());
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Wallet::add_coins] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+
+        if let Err(e) = Wallet::credit(&mut tx, self.id.clone(), coins, transaction_data).await {
+            return Some(e);
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Wallet::add_coins] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
         }
         if let Some(error) = self.get_coins().await {
             println!("Failed to get coins: {:?}", error);
@@ -205,6 +504,424 @@ impl Wallet {
         }
         None
     }
+
+    /// Debits `coins` from the wallet. The wallet row is locked while the
+    /// balance is checked so concurrent spends cannot overdraw it.
+    pub async fn remove_coins(&mut self, coins: i32) -> Option<anyhow::Error> {
+        self.remove_coins_with_data(coins, None).await
+    }
+
+    /// Spends `coins` on `reason`, which is kept with the transaction. A
+    /// retried spend with the same `client_reference` is only charged once.
+    pub async fn spend(
+        &mut self,
+        coins: i32,
+        reason: String,
+        client_reference: Option<String>,
+    ) -> Option<anyhow::Error> {
+        if let Err(e) = validate_spend(coins, &reason) {
+            return Some(e);
+        }
+        let client_reference =
+            match client_reference.as_deref().map(validate_client_reference).transpose() {
+                Ok(client_reference) => client_reference,
+                Err(e) => return Some(e),
+            };
+        self.remove_coins_with_reference(
+            coins,
+            Some(spend_transaction_data(reason.trim())),
+            client_reference,
+        )
+        .await
+    }
+
+    pub async fn remove_coins_with_data(
+        &mut self,
+        coins: i32,
+        transaction_data: Option<String>,
+    ) -> Option<anyhow::Error> {
+        self.remove_coins_with_reference(coins, transaction_data, None)
+            .await
+    }
+
+    async fn remove_coins_with_reference(
+        &mut self,
+        coins: i32,
+        transaction_data: Option<String>,
+        client_reference: Option<String>,
+    ) -> Option<anyhow::Error> {
+        println!("[Wallet::remove_coins] Removing coins: {:?}", coins);
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Wallet::remove_coins] Failed to begin transaction: {:?}", e);
+                return Some(e.into());
+            }
+        };
+
+        if let Err(e) = Wallet::debit_with_reference(
+            &mut tx,
+            self.id.clone(),
+            coins,
+            transaction_data,
+            client_reference,
+        )
+        .await
+        {
+            return Some(e);
+        }
+
+        if let Err(e) = tx.commit().await {
+            println!("[Wallet::remove_coins] Failed to commit transaction: {:?}", e);
+            return Some(e.into());
+        }
+        if let Some(error) = self.get_coins().await {
+            println!("[Wallet::remove_coins] Failed to get coins: {:?}", error);
+            return Some(error);
+        }
+        None
+    }
+
+    /// Lifetime totals across live and archived transactions. Opening
+    /// balances only restate archived rows, so they are left out.
+    pub async fn summary(&self) -> Result<WalletSummary, anyhow::Error> {
+        let pool = get_connection().await;
+        match sqlx::query(
+            "SELECT transaction_type, transaction_status,
+                COUNT(*)::int8 AS count, COALESCE(SUM(transaction_amount), 0)::int8 AS total
+            FROM (
+                SELECT transaction_type, transaction_status, transaction_amount, transaction_data
+                FROM transactions WHERE wallet_id = $1
+                UNION ALL
+                SELECT transaction_type, transaction_status, transaction_amount, transaction_data
+                FROM archived_transactions WHERE wallet_id = $1
+            ) AS ledger
+            WHERE transaction_data IS DISTINCT FROM $2
+            GROUP BY transaction_type, transaction_status
+            ORDER BY transaction_type, transaction_status",
+        )
+        .bind(self.id.clone())
+        .bind(OPENING_BALANCE_DATA)
+        .fetch_all(&pool)
+        .await
+        {
+            Ok(rows) => Ok(summarize(
+                rows.iter()
+                    .map(|row| TransactionGroup {
+                        transaction_type: row.get("transaction_type"),
+                        transaction_status: row.get("transaction_status"),
+                        count: row.get("count"),
+                        total: row.get("total"),
+                    })
+                    .collect(),
+            )),
+            Err(e) => {
+                println!("[Wallet::summary] Failed to get transaction totals: {:?}", e);
+                Err(e.into())
+            }
+        }
+    }
+
+    /// Moves `coins` from `from_user_id` to `to_user_id` and returns the
+    /// transfer id both sides are recorded with. Both wallets are locked
+    /// before the sender's balance is checked, and the debit and credit
+    /// commit together. The whole transaction is retried on transient errors.
+    pub async fn transfer(
+        from_user_id: String,
+        to_user_id: String,
+        coins: i32,
+    ) -> Result<String, anyhow::Error> {
+        validate_transfer(&from_user_id, &to_user_id, coins)?;
+        with_write_retry(|| Wallet::transfer_once(from_user_id.clone(), to_user_id.clone(), coins))
+            .await
+    }
+
+    async fn transfer_once(
+        from_user_id: String,
+        to_user_id: String,
+        coins: i32,
+    ) -> Result<String, anyhow::Error> {
+        let pool = get_connection().await;
+        let mut tx = match pool.begin().await {
+            Ok(tx) => tx,
+            Err(e) => {
+                println!("[Wallet::transfer] Failed to begin transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        let rows = match sqlx::query(
+            "SELECT wallets.id, wallets.user_id FROM wallets
+            JOIN users ON users.id = wallets.user_id
+            WHERE wallets.user_id = ANY($1) AND users.archived_at IS NULL
+            ORDER BY wallets.id
+            FOR UPDATE OF wallets",
+        )
+        .bind(vec![from_user_id.clone(), to_user_id.clone()])
+        .fetch_all(&mut *tx)
+        .await
+        {
+            Ok(rows) => rows,
+            Err(e) => {
+                println!("[Wallet::transfer] Failed to lock wallets: {:?}", e);
+                return Err(e.into());
+            }
+        };
+        let wallet_id = |user_id: &str| {
+            rows.iter()
+                .find(|row| row.get::<String, _>("user_id") == user_id)
+                .map(|row| row.get::<String, _>("id"))
+        };
+        let from_wallet_id = wallet_id(&from_user_id).ok_or(anyhow::Error::msg("Wallet not found"))?;
+        let to_wallet_id = wallet_id(&to_user_id).ok_or(anyhow::Error::msg("Recipient not found"))?;
+
+        let transfer_id = Uuid::new_v4().to_string();
+        let data = transfer_transaction_data(&transfer_id, &from_user_id, &to_user_id);
+        Wallet::debit(&mut tx, from_wallet_id, coins, Some(data.clone())).await?;
+        Wallet::credit(&mut tx, to_wallet_id, coins, Some(data)).await?;
+
+        if let Err(e) = tx.commit().await {
+            println!("[Wallet::transfer] Failed to commit transaction: {:?}", e);
+            return Err(e.into());
+        }
+        Ok(transfer_id)
+    }
+
+    /// Credits `coins` to `wallet_id` as part of the caller's transaction.
+    pub async fn credit(
+        conn: &mut PgConnection,
+        wallet_id: String,
+        coins: i32,
+        transaction_data: Option<String>,
+    ) -> Result<(), anyhow::Error> {
+        Wallet::record(conn, wallet_id, TransactionType::Credit, coins, transaction_data, None)
+            .await
+            .map(|_| ())
+    }
+
+    /// Debits `coins` from `wallet_id` as part of the caller's transaction,
+    /// locking the wallet row until it commits.
+    pub async fn debit(
+        conn: &mut PgConnection,
+        wallet_id: String,
+        coins: i32,
+        transaction_data: Option<String>,
+    ) -> Result<(), anyhow::Error> {
+        Wallet::debit_with_reference(conn, wallet_id, coins, transaction_data, None)
+            .await
+            .map(|_| ())
+    }
+
+    /// Like `debit`, but when a debit with `client_reference` was already
+    /// recorded for the wallet that transaction is returned and nothing is
+    /// charged. The wallet lock keeps concurrent retries from both charging.
+    pub async fn debit_with_reference(
+        conn: &mut PgConnection,
+        wallet_id: String,
+        coins: i32,
+        transaction_data: Option<String>,
+        client_reference: Option<String>,
+    ) -> Result<Transaction, anyhow::Error> {
+        let current_balance: i32 =
+            match sqlx::query("SELECT coin_balance FROM wallets WHERE id = $1 FOR UPDATE")
+                .bind(wallet_id.clone())
+                .fetch_one(&mut *conn)
+                .await
+            {
+                Ok(row) => row.get("coin_balance"),
+                Err(e) => {
+                    println!("[Wallet::debit] Failed to lock wallet: {:?}", e);
+                    return Err(e.into());
+                }
+            };
+        if let Some(client_reference) = &client_reference {
+            let existing =
+                Wallet::find_by_client_reference(conn, &wallet_id, client_reference).await?;
+            if let Some(existing) =
+                replayed_transaction(existing, &TransactionType::Debit, -coins)?
+            {
+                return Ok(existing);
+            }
+        }
+        check_funds(current_balance as i64, coins)?;
+
+        Wallet::record(
+            conn,
+            wallet_id,
+            TransactionType::Debit,
+            -coins,
+            transaction_data,
+            client_reference,
+        )
+        .await
+    }
+
+    /// The wallet's transaction recorded under `client_reference`, live or
+    /// archived, so a retry is never charged again after archival.
+    async fn find_by_client_reference(
+        conn: &mut PgConnection,
+        wallet_id: &str,
+        client_reference: &str,
+    ) -> Result<Option<Transaction>, anyhow::Error> {
+        match sqlx::query(
+            "SELECT id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                transaction_data, error_message, client_reference, created_at, updated_at
+            FROM transactions WHERE wallet_id = $1 AND client_reference = $2
+            UNION ALL
+            SELECT id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                transaction_data, error_message, client_reference, created_at, updated_at
+            FROM archived_transactions WHERE wallet_id = $1 AND client_reference = $2
+            LIMIT 1",
+        )
+        .bind(wallet_id)
+        .bind(client_reference)
+        .fetch_optional(&mut *conn)
+        .await
+        {
+            Ok(row) => Ok(row.map(|row| Transaction::from_row(&row)).transpose()?),
+            Err(e) => {
+                println!(
+                    "[Wallet::find_by_client_reference] Failed to get transaction: {:?}",
+                    e
+                );
+                Err(e.into())
+            }
+        }
+    }
+
+    /// Inserts a completed transaction for `amount` and moves the cached
+    /// balance by the same amount, so the two never disagree.
+    async fn record(
+        conn: &mut PgConnection,
+        wallet_id: String,
+        transaction_type: TransactionType,
+        amount: i32,
+        transaction_data: Option<String>,
+        client_reference: Option<String>,
+    ) -> Result<Transaction, anyhow::Error> {
+        let transaction = match sqlx::query(
+            "INSERT INTO transactions (
+                id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                transaction_data, error_message, client_reference, created_at, updated_at
+            ) VALUES ($1, $2, $3, $4, $5, $6, '', $7, now(), now())
+            RETURNING *",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(wallet_id.clone())
+        .bind(transaction_type.to_string())
+        .bind(amount)
+        .bind(TransactionStatus::Completed.to_string())
+        .bind(transaction_data)
+        .bind(client_reference)
+        .fetch_one(&mut *conn)
+        .await
+        {
+            Ok(row) => Transaction::from_row(&row)?,
+            Err(e) => {
+                println!("[Wallet::record] Failed to create transaction: {:?}", e);
+                return Err(e.into());
+            }
+        };
+
+        if let Err(e) = sqlx::query(
+            "UPDATE wallets SET coin_balance = coin_balance + $1, updated_at = now() WHERE id = $2",
+        )
+        .bind(amount)
+        .bind(wallet_id)
+        .execute(&mut *conn)
+        .await
+        {
+            println!("[Wallet::record] Failed to update coin balance: {:?}", e);
+            return Err(e.into());
+        }
+        Ok(transaction)
+    }
+}
+
+/// The coin balance of a wallet with `transactions`; an empty wallet holds 0.
+pub fn balance(transactions: &[Transaction]) -> i32 {
+    transactions.iter().map(|t| t.transaction_amount).sum()
+}
+
+/// How far the `cached` balance is from the `ledger` balance.
+pub fn balance_drift(cached: i32, ledger: i32) -> i32 {
+    ledger - cached
+}
+
+/// Folds grouped transaction totals into a summary. Debits are stored as
+/// negative amounts and reported as a positive total.
+pub fn summarize(groups: Vec<TransactionGroup>) -> WalletSummary {
+    let completed = TransactionStatus::Completed.to_string();
+    let total_for = |transaction_type: TransactionType| -> i64 {
+        let transaction_type = transaction_type.to_string();
+        groups
+            .iter()
+            .filter(|group| {
+                group.transaction_type == transaction_type && group.transaction_status == completed
+            })
+            .map(|group| group.total.abs())
+            .sum()
+    };
+    let total_credits = total_for(TransactionType::Credit);
+    let total_debits = total_for(TransactionType::Debit);
+
+    WalletSummary {
+        total_credits: total_credits.clamp(0, i32::MAX as i64) as i32,
+        total_debits: total_debits.clamp(0, i32::MAX as i64) as i32,
+        net: (total_credits - total_debits).clamp(i32::MIN as i64, i32::MAX as i64) as i32,
+        counts: groups
+            .into_iter()
+            .map(|group| TransactionCount {
+                transaction_type: group.transaction_type,
+                transaction_status: group.transaction_status,
+                count: group.count.clamp(0, i32::MAX as i64) as i32,
+            })
+            .collect(),
+    }
+}
+
+pub const MAX_SPEND_REASON_LENGTH: usize = 64;
+
+/// Checks a spend is a positive amount with a short, non-empty reason. The
+/// balance is checked separately once the wallet is locked.
+pub fn validate_spend(coins: i32, reason: &str) -> Result<(), anyhow::Error> {
+    if coins <= 0 {
+        return Err(anyhow::Error::msg("Amount must be positive"));
+    }
+    if reason.trim().is_empty() {
+        return Err(anyhow::Error::msg("Reason is required"));
+    }
+    if reason.trim().chars().count() > MAX_SPEND_REASON_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Reason must be at most {} characters",
+            MAX_SPEND_REASON_LENGTH
+        )));
+    }
+    Ok(())
+}
+
+/// Checks a transfer goes to someone else and is a positive amount. The
+/// balance is checked separately once the wallets are locked.
+pub fn validate_transfer(from_user_id: &str, to_user_id: &str, coins: i32) -> Result<(), anyhow::Error> {
+    if from_user_id == to_user_id {
+        return Err(anyhow::Error::msg("Cannot send coins to yourself"));
+    }
+    if coins <= 0 {
+        return Err(anyhow::Error::msg("Amount must be positive"));
+    }
+    Ok(())
+}
+
+/// Checks `coins` is a positive amount no larger than `balance`.
+pub fn check_funds(balance: i64, coins: i32) -> Result<(), anyhow::Error> {
+    if coins <= 0 {
+        return Err(anyhow::Error::msg("Amount must be positive"));
+    }
+    if (coins as i64) > balance {
+        return Err(anyhow::Error::msg("Insufficient funds"));
+    }
+    Ok(())
 }
 
 impl DatabaseResource for Wallet {
@@ -222,7 +939,7 @@ impl DatabaseResource for Wallet {
             created_at,
             updated_at,
             archived_at,
-            coins: 0,
+            coins: row.get("coin_balance"),
             transactions: Vec::new(),
         })
     }
@@ -246,3 +963,413 @@ impl DatabaseResource for Wallet {
         false
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::database::test_support::{create_test_user, test_pool, test_wallet};
+
+    #[test]
+    fn test_balance_of_empty_wallet_is_zero() {
+        assert_eq!(balance(&[]), 0);
+    }
+
+    #[test]
+    fn test_balance_sums_credits_and_debits() {
+        let mut credit = Transaction::new("wallet".to_string());
+        credit.transaction_amount = 50;
+        let mut debit = Transaction::new("wallet".to_string());
+        debit.transaction_type = TransactionType::Debit;
+        debit.transaction_amount = -20;
+        assert_eq!(balance(&[credit, debit]), 30);
+    }
+
+    /// The sum of the wallet's completed transactions.
+    async fn ledger_balance(pool: &sqlx::PgPool, wallet: &Wallet) -> i64 {
+        sqlx::query_scalar(
+            "SELECT COALESCE(SUM(transaction_amount), 0) FROM transactions
+            WHERE wallet_id = $1 AND transaction_status = $2",
+        )
+        .bind(wallet.id.clone())
+        .bind(TransactionStatus::Completed.to_string())
+        .fetch_one(pool)
+        .await
+        .unwrap()
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_cached_balance_matches_ledger() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        for amount in [100, -30, 45, -115, 20] {
+            let error = if amount > 0 {
+                wallet.add_coins(amount).await
+            } else {
+                wallet.remove_coins(-amount).await
+            };
+            assert!(error.is_none());
+            assert_eq!(wallet.coins as i64, ledger_balance(&pool, &wallet).await);
+        }
+        assert_eq!(wallet.coins, 20);
+        assert!(wallet.remove_coins(21).await.is_some());
+        assert_eq!(test_wallet(&user).await.coins, 20);
+
+        sqlx::query("UPDATE wallets SET coin_balance = coin_balance + 999 WHERE id = $1")
+            .bind(wallet.id.clone())
+            .execute(&pool)
+            .await
+            .unwrap();
+        assert!(wallet.reconcile_coins().await.is_none());
+        assert_eq!(test_wallet(&user).await.coins, 20);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_reconcile_only_rewrites_the_balance_when_fixing() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        assert!(wallet.add_coins(50).await.is_none());
+        sqlx::query("UPDATE wallets SET coin_balance = 80 WHERE id = $1")
+            .bind(wallet.id.clone())
+            .execute(&pool)
+            .await
+            .unwrap();
+
+        let reconciliation = wallet.reconcile(false).await.unwrap();
+        assert_eq!(reconciliation.cached_coins, 80);
+        assert_eq!(reconciliation.ledger_coins, 50);
+        assert_eq!(reconciliation.drift, -30);
+        assert!(!reconciliation.fixed);
+        assert_eq!(test_wallet(&user).await.coins, 80);
+
+        let reconciliation = wallet.reconcile(true).await.unwrap();
+        assert_eq!(reconciliation.ledger_coins, 50);
+        assert!(reconciliation.fixed);
+        assert_eq!(test_wallet(&user).await.coins, 50);
+
+        let reconciliation = wallet.reconcile(true).await.unwrap();
+        assert_eq!(reconciliation.drift, 0);
+        assert!(!reconciliation.fixed);
+    }
+
+    fn completed(amount: i32) -> Transaction {
+        let mut transaction = Transaction::new("wallet".to_string());
+        transaction.transaction_amount = amount;
+        transaction.transaction_status = TransactionStatus::Completed;
+        transaction
+    }
+
+    fn wallet() -> Wallet {
+        let mut wallet = Wallet::new("owner".to_string());
+        wallet.id = "wallet".to_string();
+        wallet
+    }
+
+    #[test]
+    fn test_reconciliation_of_matching_wallet() {
+        let ledger = vec![completed(100), completed(-30), completed(45)];
+        for fix in [false, true] {
+            let reconciliation = WalletReconciliation::new(&wallet(), 115, &ledger, fix);
+            assert!(reconciliation.is_balanced());
+            assert_eq!(
+                reconciliation,
+                WalletReconciliation {
+                    wallet_id: "wallet".to_string(),
+                    user_id: "owner".to_string(),
+                    cached_coins: 115,
+                    ledger_coins: 115,
+                    drift: 0,
+                    fixed: false,
+                }
+            );
+        }
+    }
+
+    #[test]
+    fn test_reconciliation_reports_corrupted_cache() {
+        let mut pending = completed(500);
+        pending.transaction_status = TransactionStatus::Pending;
+        let mut failed = completed(-70);
+        failed.transaction_status = TransactionStatus::Failed;
+        let ledger = vec![completed(100), pending, failed, completed(-30)];
+
+        let reported = WalletReconciliation::new(&wallet(), 999, &ledger, false);
+        assert!(!reported.is_balanced());
+        assert_eq!((reported.ledger_coins, reported.drift), (70, -929));
+        assert!(!reported.fixed);
+
+        let fixed = WalletReconciliation::new(&wallet(), 999, &ledger, true);
+        assert_eq!((fixed.ledger_coins, fixed.drift), (70, -929));
+        assert!(fixed.fixed);
+    }
+
+    #[test]
+    fn test_summarize_mixed_transactions() {
+        let group = |transaction_type: &str, transaction_status: &str, count, total| {
+            TransactionGroup {
+                transaction_type: transaction_type.to_string(),
+                transaction_status: transaction_status.to_string(),
+                count,
+                total,
+            }
+        };
+        let summary = summarize(vec![
+            group("credit", "completed", 3, 450),
+            group("credit", "failed", 1, 100),
+            group("debit", "completed", 2, -120),
+            group("debit", "pending", 1, -30),
+        ]);
+
+        assert_eq!(summary.total_credits, 450);
+        assert_eq!(summary.total_debits, 120);
+        assert_eq!(summary.net, 330);
+        assert_eq!(summary.counts.len(), 4);
+        assert_eq!(
+            summary.counts[1],
+            TransactionCount {
+                transaction_type: "credit".to_string(),
+                transaction_status: "failed".to_string(),
+                count: 1,
+            }
+        );
+    }
+
+    #[test]
+    fn test_summarize_empty_wallet() {
+        let summary = summarize(vec![]);
+        assert_eq!((summary.total_credits, summary.total_debits, summary.net), (0, 0, 0));
+        assert!(summary.counts.is_empty());
+    }
+
+    #[test]
+    fn test_check_funds() {
+        assert!(check_funds(100, 100).is_ok());
+        assert!(check_funds(100, 101).is_err());
+        assert!(check_funds(0, 1).is_err());
+        assert!(check_funds(100, 0).is_err());
+        assert!(check_funds(100, -5).is_err());
+    }
+
+    #[test]
+    fn test_validate_transfer() {
+        assert!(validate_transfer("sender", "friend", 25).is_ok());
+        assert_eq!(
+            validate_transfer("sender", "sender", 25).unwrap_err().to_string(),
+            "Cannot send coins to yourself"
+        );
+        assert!(validate_transfer("sender", "friend", 0).is_err());
+        assert!(validate_transfer("sender", "friend", -5).is_err());
+        assert_eq!(
+            check_funds(20, 25).unwrap_err().to_string(),
+            "Insufficient funds"
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_summary_matches_seeded_transactions() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        assert!(wallet.add_coins(100).await.is_none());
+        assert!(wallet.add_coins(40).await.is_none());
+        assert!(wallet.remove_coins(30).await.is_none());
+        for (table, transaction_type, amount, status, data) in [
+            ("transactions", "debit", -500, "failed", None),
+            ("archived_transactions", "credit", 25, "completed", None),
+            (
+                "archived_transactions",
+                "credit",
+                999,
+                "completed",
+                Some(OPENING_BALANCE_DATA),
+            ),
+        ] {
+            sqlx::query(sqlx::AssertSqlSafe(format!(
+                "INSERT INTO {} (id, wallet_id, transaction_type, transaction_amount,
+                    transaction_status, transaction_data, created_at, updated_at)
+                VALUES ($1, $2, $3, $4, $5, $6, now(), now())",
+                table
+            )))
+            .bind(Uuid::new_v4().to_string())
+            .bind(wallet.id.clone())
+            .bind(transaction_type)
+            .bind(amount)
+            .bind(status)
+            .bind(data)
+            .execute(&pool)
+            .await
+            .unwrap();
+        }
+
+        let summary = wallet.summary().await.unwrap();
+        assert_eq!(summary.total_credits, 165);
+        assert_eq!(summary.total_debits, 30);
+        assert_eq!(summary.net, 135);
+        assert_eq!(
+            summary
+                .counts
+                .iter()
+                .map(|count| (
+                    count.transaction_type.as_str(),
+                    count.transaction_status.as_str(),
+                    count.count
+                ))
+                .collect::<Vec<_>>(),
+            vec![
+                ("credit", "completed", 3),
+                ("debit", "completed", 1),
+                ("debit", "failed", 1),
+            ]
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_transfer_moves_the_same_amount() {
+        let pool = test_pool().await;
+        let sender = create_test_user().await;
+        let friend = create_test_user().await;
+        let mut sender_wallet = test_wallet(&sender).await;
+        assert!(sender_wallet.add_coins(100).await.is_none());
+        let friend_wallet = test_wallet(&friend).await;
+
+        let transfer_id = Wallet::transfer(sender.id.clone(), friend.id.clone(), 25)
+            .await
+            .unwrap();
+        assert_eq!(test_wallet(&sender).await.coins, 75);
+        assert_eq!(test_wallet(&friend).await.coins, 25);
+
+        let data = transfer_transaction_data(&transfer_id, &sender.id, &friend.id);
+        let recorded: Vec<(String, i32)> = sqlx::query_as(
+            "SELECT wallet_id, transaction_amount FROM transactions
+            WHERE transaction_data = $1 ORDER BY transaction_amount",
+        )
+        .bind(data)
+        .fetch_all(&pool)
+        .await
+        .unwrap();
+        assert_eq!(
+            recorded,
+            vec![(sender_wallet.id, -25), (friend_wallet.id, 25)]
+        );
+
+        let overdraft = Wallet::transfer(sender.id.clone(), friend.id.clone(), 76).await;
+        assert_eq!(overdraft.unwrap_err().to_string(), "Insufficient funds");
+        assert_eq!(test_wallet(&sender).await.coins, 75);
+        assert_eq!(test_wallet(&friend).await.coins, 25);
+    }
+
+    #[test]
+    fn test_validate_spend() {
+        assert!(validate_spend(25, "naming fee").is_ok());
+        assert!(check_funds(30, 25).is_ok());
+
+        assert_eq!(
+            validate_spend(0, "naming fee").unwrap_err().to_string(),
+            "Amount must be positive"
+        );
+        assert!(validate_spend(25, " ").is_err());
+        assert!(validate_spend(25, &"a".repeat(MAX_SPEND_REASON_LENGTH + 1)).is_err());
+        assert_eq!(
+            check_funds(20, 25).unwrap_err().to_string(),
+            "Insufficient funds"
+        );
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_sync_delivers_new_and_changed_transactions() {
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        let an_hour_ago = OffsetDateTime::now_utc() - Duration::hours(1);
+        let empty = wallet.get_transactions_since(an_hour_ago, None, 10).await.unwrap();
+        assert!(empty.transactions.is_empty());
+
+        assert!(wallet.add_coins(10).await.is_none());
+        let mut pending = Transaction::new(wallet.id.clone());
+        pending.transaction_amount = 5;
+        assert!(pending.create().await.is_none());
+
+        let since = empty.synced_at.unwrap();
+        let first = wallet.get_transactions_since(since, None, 1).await.unwrap();
+        assert_eq!(first.transactions.len(), 1);
+        let after = Cursor::decode(first.next_cursor.as_deref().unwrap()).unwrap();
+        let second = wallet.get_transactions_since(since, Some(after), 1).await.unwrap();
+        assert_eq!(second.transactions.len(), 1);
+        assert!(second.next_cursor.is_none());
+        assert_ne!(first.transactions[0].id, second.transactions[0].id);
+
+        assert!(
+            pending
+                .update_status(TransactionStatus::Completed, None)
+                .await
+                .is_none()
+        );
+        let resync = wallet
+            .get_transactions_since(second.synced_at.unwrap(), None, 10)
+            .await
+            .unwrap();
+        let completed = resync
+            .transactions
+            .iter()
+            .find(|transaction| transaction.id == pending.id)
+            .expect("a status change must be synced");
+        assert_eq!(completed.transaction_status, TransactionStatus::Completed);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_same_client_reference_records_one_transaction() {
+        let pool = test_pool().await;
+        let user = create_test_user().await;
+        let mut wallet = test_wallet(&user).await;
+        assert!(wallet.add_coins(100).await.is_none());
+
+        let mut ids = Vec::new();
+        for _ in 0..2 {
+            let mut tx = pool.begin().await.unwrap();
+            let transaction = Wallet::debit_with_reference(
+                &mut *tx,
+                wallet.id.clone(),
+                25,
+                None,
+                Some("spend-1".to_string()),
+            )
+            .await
+            .unwrap();
+            tx.commit().await.unwrap();
+            ids.push(transaction.id);
+        }
+        assert_eq!(ids[0], ids[1]);
+        assert_eq!(test_wallet(&user).await.coins, 75);
+
+        sqlx::query(
+            "INSERT INTO archived_transactions (
+                id, wallet_id, transaction_type, transaction_amount, transaction_status,
+                transaction_data, error_message, client_reference, created_at, updated_at
+            ) VALUES ($1, $2, 'debit', -25, 'completed', '', '', 'spend-2', now(), now())",
+        )
+        .bind(Uuid::new_v4().to_string())
+        .bind(wallet.id.clone())
+        .execute(&pool)
+        .await
+        .unwrap();
+        let mut tx = pool.begin().await.unwrap();
+        let replayed = Wallet::debit_with_reference(
+            &mut *tx,
+            wallet.id.clone(),
+            25,
+            None,
+            Some("spend-2".to_string()),
+        )
+        .await
+        .unwrap();
+        tx.commit().await.unwrap();
+        assert_eq!(replayed.client_reference.as_deref(), Some("spend-2"));
+        assert_eq!(test_wallet(&user).await.coins, 75);
+    }
+}
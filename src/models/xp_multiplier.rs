@@ -0,0 +1,111 @@
+use std::sync::{LazyLock, RwLock};
+
+use time::OffsetDateTime;
+
+use crate::config::Config;
+
+/// A factor applied to every XP grant, optionally only until `ends_at`.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct XpMultiplier {
+    pub factor: f64,
+    pub ends_at: Option<OffsetDateTime>,
+}
+
+impl Default for XpMultiplier {
+    fn default() -> Self {
+        Self {
+            factor: 1.0,
+            ends_at: None,
+        }
+    }
+}
+
+impl XpMultiplier {
+    /// The factor in effect at `now`; 1.0 once the event window has ended.
+    pub fn factor_at(&self, now: OffsetDateTime) -> f64 {
+        match self.ends_at {
+            Some(ends_at) if now >= ends_at => 1.0,
+            _ => self.factor,
+        }
+    }
+
+    pub fn apply(&self, xp: i32, now: OffsetDateTime) -> i32 {
+        (xp as f64 * self.factor_at(now)).round() as i32
+    }
+}
+
+static XP_MULTIPLIER: LazyLock<RwLock<XpMultiplier>> =
+    LazyLock::new(|| RwLock::new(XpMultiplier::default()));
+
+/// Multiplies XP grants by `factor` until `ends_at`, or indefinitely when
+/// `ends_at` is `None`. Factors that are not positive are ignored.
+pub fn set_xp_multiplier(factor: f64, ends_at: Option<OffsetDateTime>) {
+    if !(factor > 0.0) {
+        println!("[set_xp_multiplier] Ignoring invalid factor: {:?}", factor);
+        return;
+    }
+    if let Ok(mut multiplier) = XP_MULTIPLIER.write() {
+        *multiplier = XpMultiplier { factor, ends_at };
+    }
+}
+
+pub fn current_xp_multiplier() -> XpMultiplier {
+    match XP_MULTIPLIER.read() {
+        Ok(multiplier) => *multiplier,
+        Err(_) => XpMultiplier::default(),
+    }
+}
+
+/// `xp` scaled by the multiplier currently in effect.
+pub fn apply_xp_multiplier(xp: i32) -> i32 {
+    current_xp_multiplier().apply(xp, OffsetDateTime::now_utc())
+}
+
+/// Starts the event configured by XP_MULTIPLIER and the optional
+/// XP_MULTIPLIER_ENDS_AT.
+pub fn load_xp_multiplier(config: &Config) {
+    set_xp_multiplier(config.xp_multiplier, config.xp_multiplier_ends_at);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use time::Duration;
+
+    #[test]
+    fn test_default_multiplier_leaves_xp_unchanged() {
+        let now = OffsetDateTime::now_utc();
+        assert_eq!(XpMultiplier::default().apply(150, now), 150);
+    }
+
+    #[test]
+    fn test_multiplier_doubles_xp_during_window() {
+        let now = OffsetDateTime::now_utc();
+        let multiplier = XpMultiplier {
+            factor: 2.0,
+            ends_at: Some(now + Duration::hours(1)),
+        };
+        assert_eq!(multiplier.apply(150, now), 300);
+    }
+
+    #[test]
+    fn test_multiplier_reverts_after_window() {
+        let now = OffsetDateTime::now_utc();
+        let multiplier = XpMultiplier {
+            factor: 2.0,
+            ends_at: Some(now - Duration::seconds(1)),
+        };
+        assert_eq!(multiplier.factor_at(now), 1.0);
+        assert_eq!(multiplier.apply(150, now), 150);
+    }
+
+    #[test]
+    fn test_multiplier_rounds() {
+        let now = OffsetDateTime::now_utc();
+        let multiplier = XpMultiplier {
+            factor: 1.5,
+            ends_at: None,
+        };
+        assert_eq!(multiplier.apply(5, now), 8);
+    }
+}
@@ -0,0 +1,87 @@
+use std::io::Cursor;
+
+use image::{ImageFormat, Luma, imageops::FilterType};
+use qrcode::QrCode;
+use rocket::{Responder, Route, get, http::Header, http::Status};
+
+use crate::{
+    models::{mnstr::Mnstr, session::Session},
+    utils::{sessions::get_user_from_token, token::RawToken},
+};
+
+pub const DEFAULT_QR_SIZE: u32 = 256;
+pub const MIN_QR_SIZE: u32 = 64;
+pub const MAX_QR_SIZE: u32 = 1024;
+
+pub fn routes() -> Vec<Route> {
+    routes![mnstr_qr_png]
+}
+
+#[derive(Responder)]
+#[response(content_type = "image/png")]
+pub struct QrPng {
+    body: Vec<u8>,
+    cache_control: Header<'static>,
+}
+
+/// The mnstr's QR code as a `size` pixel square PNG. A mnstr's code never
+/// changes, so clients may cache the image.
+#[get("/<mnstr_id>/qr.png?<size>")]
+pub async fn mnstr_qr_png(
+    mnstr_id: String,
+    size: Option<u32>,
+    token: RawToken,
+) -> Result<QrPng, Status> {
+    let size = size.unwrap_or(DEFAULT_QR_SIZE);
+    if !(MIN_QR_SIZE..=MAX_QR_SIZE).contains(&size) {
+        return Err(Status::BadRequest);
+    }
+    if token.value.is_empty() {
+        return Err(Status::Unauthorized);
+    }
+    let user = match get_user_from_token::<Session>(token.value).await {
+        Ok(user) => user,
+        Err(_) => return Err(Status::Unauthorized),
+    };
+
+    let mnstr = match Mnstr::find_one(mnstr_id, false).await {
+        Ok(mnstr) if mnstr.is_owned_by(&user.id) => mnstr,
+        _ => return Err(Status::NotFound),
+    };
+
+    match render_qr_png(&mnstr.mnstr_qr_code, size) {
+        Ok(body) => Ok(QrPng {
+            body,
+            cache_control: Header::new("Cache-Control", "private, max-age=86400"),
+        }),
+        Err(e) => {
+            println!("[mnstr_qr_png] Failed to render QR code: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+/// Renders `value` as a QR code PNG exactly `size` pixels square.
+pub fn render_qr_png(value: &str, size: u32) -> Result<Vec<u8>, anyhow::Error> {
+    let code = QrCode::new(value.as_bytes())?;
+    let image = code.render::<Luma<u8>>().min_dimensions(size, size).build();
+    let image = image::imageops::resize(&image, size, size, FilterType::Nearest);
+
+    let mut png = Vec::new();
+    image.write_to(&mut Cursor::new(&mut png), ImageFormat::Png)?;
+    Ok(png)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_render_qr_png() {
+        let png = render_qr_png("mnstr-22", 300).unwrap();
+        assert!(png.starts_with(&[0x89, b'P', b'N', b'G', b'\r', b'\n', 0x1a, b'\n']));
+
+        let image = image::load_from_memory_with_format(&png, ImageFormat::Png).unwrap();
+        assert_eq!((image.width(), image.height()), (300, 300));
+    }
+}
@@ -0,0 +1,102 @@
+use std::time::Duration;
+
+use time::OffsetDateTime;
+
+use crate::models::{
+    idempotency_key::IdempotencyKey,
+    session::{SESSION_PURGE_AFTER_DAYS, Session},
+    transaction::{Transaction, retention_days},
+    user::User,
+};
+
+const TRANSACTION_ARCHIVAL_INTERVAL: Duration = Duration::from_secs(60 * 60 * 24);
+const IDEMPOTENCY_KEY_CLEANUP_INTERVAL: Duration = Duration::from_secs(60 * 60);
+const SESSION_CLEANUP_INTERVAL: Duration = Duration::from_secs(60 * 60 * 24);
+const XP_DECAY_INTERVAL: Duration = Duration::from_secs(60 * 60 * 24);
+
+/// Spawns the background jobs. Each job runs once at startup and then on its
+/// own interval for the lifetime of the server.
+pub fn spawn() {
+    tokio::spawn(async {
+        let mut interval = tokio::time::interval(TRANSACTION_ARCHIVAL_INTERVAL);
+        loop {
+            interval.tick().await;
+            archive_transactions().await;
+        }
+    });
+
+    tokio::spawn(async {
+        let mut interval = tokio::time::interval(IDEMPOTENCY_KEY_CLEANUP_INTERVAL);
+        loop {
+            interval.tick().await;
+            delete_expired_idempotency_keys().await;
+        }
+    });
+
+    tokio::spawn(async {
+        let mut interval = tokio::time::interval(SESSION_CLEANUP_INTERVAL);
+        loop {
+            interval.tick().await;
+            purge_expired_sessions().await;
+        }
+    });
+
+    tokio::spawn(async {
+        let mut interval = tokio::time::interval(XP_DECAY_INTERVAL);
+        loop {
+            interval.tick().await;
+            decay_inactive_xp().await;
+        }
+    });
+}
+
+async fn archive_transactions() {
+    let cutoff = OffsetDateTime::now_utc() - time::Duration::days(retention_days());
+    match Transaction::archive_completed_before(cutoff).await {
+        Ok(archived) => println!(
+            "[scheduler::archive_transactions] Archived {} transactions older than {}",
+            archived, cutoff
+        ),
+        Err(e) => println!(
+            "[scheduler::archive_transactions] Failed to archive transactions: {:?}",
+            e
+        ),
+    }
+}
+
+async fn delete_expired_idempotency_keys() {
+    match IdempotencyKey::delete_expired().await {
+        Ok(deleted) => println!(
+            "[scheduler::delete_expired_idempotency_keys] Deleted {} expired keys",
+            deleted
+        ),
+        Err(e) => println!(
+            "[scheduler::delete_expired_idempotency_keys] Failed to delete keys: {:?}",
+            e
+        ),
+    }
+}
+
+async fn purge_expired_sessions() {
+    let cutoff = OffsetDateTime::now_utc() - time::Duration::days(SESSION_PURGE_AFTER_DAYS);
+    match Session::purge_expired(cutoff).await {
+        Ok(purged) => println!(
+            "[scheduler::purge_expired_sessions] Purged {} sessions older than {}",
+            purged, cutoff
+        ),
+        Err(e) => println!(
+            "[scheduler::purge_expired_sessions] Failed to purge sessions: {:?}",
+            e
+        ),
+    }
+}
+
+async fn decay_inactive_xp() {
+    match User::apply_inactivity_decay_all().await {
+        Ok(decayed) => println!(
+            "[scheduler::decay_inactive_xp] Decayed XP for {} inactive users",
+            decayed
+        ),
+        Err(e) => println!("[scheduler::decay_inactive_xp] Failed to decay XP: {:?}", e),
+    }
+}
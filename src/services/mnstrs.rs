@@ -1,16 +1,21 @@
 use tonic::{Request, Response, Status};
 
 use crate::{
-    database::values::DatabaseValue,
-    models::mnstr::{DEFAULT_STAT_VALUE, Mnstr, MnstrOrderBy, MnstrOrderDirection},
+    models::mnstr::{
+        DEFAULT_STAT_VALUE, Mnstr, MnstrBatchEdit, MnstrOrderBy, MnstrOrderDirection,
+        is_name_conflict, is_not_owned,
+    },
     proto::{
         CollectMnstrRequest, CollectMnstrResponse, CreateMnstrBatchRequest,
         CreateMnstrBatchResponse, CreateMnstrRequest, CreateMnstrResponse, GetMnstrByQrCodeRequest,
-        GetMnstrByQrCodeResponse, ListMnstrsRequest, ListMnstrsResponse, Mnstr as GrpcMnstr, MnstrInput,
+        GetMnstrByQrCodeResponse, ListMnstrsRequest, ListMnstrsResponse, Mnstr as GrpcMnstr,
         MnstrOrderBy as GrpcMnstrOrderBy, MnstrOrderDirection as GrpcMnstrOrderDirection, UpdateMnstrBatchRequest, UpdateMnstrBatchResponse,
         UpdateMnstrRequest, UpdateMnstrResponse, mnstr_service_server::MnstrService,
     },
     services::helpers::get_user_from_token,
+    utils::validation::{
+        sanitize_mnstr_description, validate_mnstr_description, validate_mnstr_name,
+    },
 };
 
 #[derive(Debug, Default, Clone)]
@@ -35,14 +40,8 @@ impl MnstrService for MnstrServiceImpl {
             }
         };
 
-        let mnstr = match Mnstr::find_one_by(
-            vec![
-                ("user_id", user.id.clone().into()),
-                ("mnstr_qr_code", request.mnstr_qr_code.into()),
-            ],
-            false,
-        )
-        .await
+        let mnstr = match Mnstr::find_one_by_qr_code(user.id.clone(), request.mnstr_qr_code, false)
+            .await
         {
             Ok(mnstr) => mnstr,
             Err(e) => {
@@ -160,101 +159,32 @@ impl MnstrService for MnstrServiceImpl {
 
         let mnstrs = request
             .mnstrs
-            .map_or(vec![], |batch_mnstr_input| {
-                batch_mnstr_input
-                    .mnstrs
-                    .into_iter()
-                    .collect::<Vec<MnstrInput>>()
-            })
-            .iter()
-            .filter(|mnstr| mnstr.mnstr_qr_code.is_some())
-            .map(|mnstr| {
-                let mut mnstr_params: Vec<(&str, Option<DatabaseValue>)> = Vec::new();
-                mnstr_params.push(("user_id", Some(user.id.clone().into())));
-                mnstr_params.push(("mnstr_name", mnstr.mnstr_name.as_ref().map(|s| s.into())));
-                mnstr_params.push((
-                    "mnstr_description",
-                    mnstr.mnstr_description.as_ref().map(|s| s.into()),
-                ));
-                mnstr_params.push((
-                    "mnstr_qr_code",
-                    mnstr.mnstr_qr_code.as_ref().map(|s| s.into()),
-                ));
-                mnstr_params.push((
-                    "current_health",
-                    mnstr
-                        .current_health
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_health",
-                    mnstr
-                        .max_health
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_attack",
-                    mnstr
-                        .current_attack
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_attack",
-                    mnstr
-                        .max_attack
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_defense",
-                    mnstr
-                        .current_defense
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_defense",
-                    mnstr
-                        .max_defense
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_speed",
-                    mnstr
-                        .current_speed
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_speed",
-                    mnstr
-                        .max_speed
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_intelligence",
-                    mnstr
-                        .current_intelligence
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_intelligence",
-                    mnstr
-                        .max_intelligence
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_magic",
-                    mnstr
-                        .current_magic
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_magic",
-                    mnstr
-                        .max_magic
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params
+            .map_or(vec![], |batch_mnstr_input| batch_mnstr_input.mnstrs)
+            .into_iter()
+            .filter_map(|mnstr_input| {
+                let mut mnstr = Mnstr::new(
+                    user.id.clone(),
+                    mnstr_input.mnstr_name,
+                    mnstr_input.mnstr_description,
+                    mnstr_input.mnstr_qr_code?,
+                );
+                mnstr.current_health = mnstr_input.current_health.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.max_health = mnstr_input.max_health.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.current_attack = mnstr_input.current_attack.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.max_attack = mnstr_input.max_attack.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.current_defense = mnstr_input.current_defense.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.max_defense = mnstr_input.max_defense.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.current_speed = mnstr_input.current_speed.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.max_speed = mnstr_input.max_speed.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.current_intelligence = mnstr_input
+                    .current_intelligence
+                    .unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.max_intelligence = mnstr_input.max_intelligence.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.current_magic = mnstr_input.current_magic.unwrap_or(DEFAULT_STAT_VALUE);
+                mnstr.max_magic = mnstr_input.max_magic.unwrap_or(DEFAULT_STAT_VALUE);
+                Some(mnstr)
             })
-            .collect::<Vec<Vec<(&str, Option<DatabaseValue>)>>>();
+            .collect::<Vec<Mnstr>>();
 
         let mnstrs = match Mnstr::create_batch(user.id.clone(), mnstrs).await {
             Ok(mnstrs) => mnstrs,
@@ -278,21 +208,42 @@ impl MnstrService for MnstrServiceImpl {
     ) -> Result<Response<UpdateMnstrResponse>, Status> {
         let request = request.into_inner();
 
-        if let Err(e) = get_user_from_token(request.token).await {
-            println!("[MnstrServiceImpl::Update] Failed to get user: {:?}", e);
-            return Err(Status::from_error(e.into()));
+        let user = match get_user_from_token(request.token).await {
+            Ok(user) => user,
+            Err(e) => {
+                println!("[MnstrServiceImpl::Update] Failed to get user: {:?}", e);
+                return Err(Status::from_error(e.into()));
+            }
         };
 
-        let mut mnstr = match Mnstr::find_one(request.id, false).await {
+        if let Some(mnstr_name) = request.mnstr_name.as_ref() {
+            if let Err(e) = validate_mnstr_name(mnstr_name) {
+                return Err(Status::invalid_argument(e.to_string()));
+            }
+        }
+        let mnstr_description = request
+            .mnstr_description
+            .as_deref()
+            .map(sanitize_mnstr_description);
+        if let Some(mnstr_description) = mnstr_description.as_ref() {
+            if let Err(e) = validate_mnstr_description(mnstr_description) {
+                return Err(Status::invalid_argument(e.to_string()));
+            }
+        }
+
+        let mut mnstr = match Mnstr::find_owned(request.id, &user.id).await {
             Ok(mnstr) => mnstr,
             Err(e) => {
                 println!("[MnstrServiceImpl::Update] Failed to find mnstr: {:?}", e);
+                if is_not_owned(&e) {
+                    return Err(Status::not_found(e.to_string()));
+                }
                 return Err(Status::from_error(e.into()));
             }
         };
 
         mnstr.mnstr_name = request.mnstr_name.unwrap_or(mnstr.mnstr_name);
-        mnstr.mnstr_description = request.mnstr_description.unwrap_or(mnstr.mnstr_description);
+        mnstr.mnstr_description = mnstr_description.unwrap_or(mnstr.mnstr_description);
         mnstr.current_health = request.current_health.unwrap_or(mnstr.current_health);
         mnstr.max_health = request.max_health.unwrap_or(mnstr.max_health);
         mnstr.current_attack = request.current_attack.unwrap_or(mnstr.current_attack);
@@ -308,12 +259,18 @@ impl MnstrService for MnstrServiceImpl {
         mnstr.current_magic = request.current_magic.unwrap_or(mnstr.current_magic);
         mnstr.max_magic = request.max_magic.unwrap_or(mnstr.max_magic);
 
-        let mnstr = match mnstr.update().await {
+        // UpdateMnstrRequest carries no version, so gRPC edits apply to the
+        // version just read.
+        let version = mnstr.version;
+        let mnstr = match mnstr.update_as(user.id.clone(), version).await {
             Some(error) => {
                 println!(
                     "[MnstrServiceImpl::Update] Failed to update mnstr: {:?}",
                     error
                 );
+                if is_name_conflict(&error) {
+                    return Err(Status::already_exists(error.to_string()));
+                }
                 return Err(Status::from_error(error.into()));
             }
             None => mnstr,
@@ -341,108 +298,61 @@ impl MnstrService for MnstrServiceImpl {
             }
         };
 
-        let mnstrs = request
+        let mnstr_inputs = request
             .mnstrs
-            .map_or(vec![], |batch_mnstr_input| {
-                batch_mnstr_input
-                    .mnstrs
-                    .into_iter()
-                    .collect::<Vec<MnstrInput>>()
-            })
-            .iter()
-            .filter(|mnstr| mnstr.mnstr_qr_code.is_some())
-            .map(|mnstr| {
-                let mut mnstr_params: Vec<(&str, Option<DatabaseValue>)> = Vec::new();
-                mnstr_params.push(("user_id", Some(user.id.clone().into())));
-                mnstr_params.push(("id", mnstr.id.as_ref().map(|s| s.into())));
-                mnstr_params.push(("mnstr_name", mnstr.mnstr_name.as_ref().map(|s| s.into())));
-                mnstr_params.push((
-                    "mnstr_description",
-                    mnstr.mnstr_description.as_ref().map(|s| s.into()),
-                ));
-                mnstr_params.push((
-                    "current_health",
-                    mnstr
-                        .current_health
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_health",
-                    mnstr
-                        .max_health
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_attack",
-                    mnstr
-                        .current_attack
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_attack",
-                    mnstr
-                        .max_attack
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_defense",
-                    mnstr
-                        .current_defense
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_defense",
-                    mnstr
-                        .max_defense
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_speed",
-                    mnstr
-                        .current_speed
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_speed",
-                    mnstr
-                        .max_speed
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_intelligence",
-                    mnstr
-                        .current_intelligence
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_intelligence",
-                    mnstr
-                        .max_intelligence
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "current_magic",
-                    mnstr
-                        .current_magic
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params.push((
-                    "max_magic",
-                    mnstr
-                        .max_magic
-                        .map_or(Some(DEFAULT_STAT_VALUE.into()), |i| Some(i.into())),
-                ));
-                mnstr_params
-            })
-            .collect::<Vec<Vec<(&str, Option<DatabaseValue>)>>>();
-
-        let mnstrs = match Mnstr::update_batch(user.id.clone(), mnstrs).await {
+            .map_or(vec![], |batch_mnstr_input| batch_mnstr_input.mnstrs);
+        let mut edits = Vec::new();
+        for mnstr_input in mnstr_inputs {
+            if let Some(mnstr_name) = mnstr_input.mnstr_name.as_ref() {
+                if let Err(e) = validate_mnstr_name(mnstr_name) {
+                    return Err(Status::invalid_argument(e.to_string()));
+                }
+            }
+            let mnstr_description = mnstr_input
+                .mnstr_description
+                .as_deref()
+                .map(sanitize_mnstr_description);
+            if let Some(mnstr_description) = mnstr_description.as_ref() {
+                if let Err(e) = validate_mnstr_description(mnstr_description) {
+                    return Err(Status::invalid_argument(e.to_string()));
+                }
+            }
+            let Some(mnstr_qr_code) = mnstr_input.mnstr_qr_code else {
+                continue;
+            };
+
+            // MnstrInput carries no version, so gRPC edits apply to the
+            // version the batch reads.
+            edits.push(MnstrBatchEdit {
+                mnstr_qr_code,
+                mnstr_name: mnstr_input.mnstr_name,
+                mnstr_description,
+                current_health: mnstr_input.current_health,
+                max_health: mnstr_input.max_health,
+                current_attack: mnstr_input.current_attack,
+                max_attack: mnstr_input.max_attack,
+                current_defense: mnstr_input.current_defense,
+                max_defense: mnstr_input.max_defense,
+                current_speed: mnstr_input.current_speed,
+                max_speed: mnstr_input.max_speed,
+                current_intelligence: mnstr_input.current_intelligence,
+                max_intelligence: mnstr_input.max_intelligence,
+                current_magic: mnstr_input.current_magic,
+                max_magic: mnstr_input.max_magic,
+                ..Default::default()
+            });
+        }
+
+        let mnstrs = match Mnstr::update_batch(user.id.clone(), edits).await {
             Ok(mnstrs) => mnstrs,
             Err(e) => {
                 println!(
                     "[MnstrServiceImpl::UpdateBatch] Failed to update mnstrs: {:?}",
                     e
                 );
+                if is_name_conflict(&e) {
+                    return Err(Status::already_exists(e.to_string()));
+                }
                 return Err(Status::from_error(e.into()));
             }
         };
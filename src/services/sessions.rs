@@ -1,10 +1,14 @@
 use crate::{
-    models::{session::Session, user::User},
+    models::{
+        session::Session,
+        user::{INVALID_CREDENTIALS, User, unique_violation_message},
+    },
     proto::{
         ForgotPasswordRequest, ForgotPasswordResponse, LoginRequest, LoginResponse, LogoutRequest, LogoutResponse, RegisterRequest, RegisterResponse, ResetPasswordRequest, ResetPasswordResponse, UnregisterRequest, UnregisterResponse, VerifyEmailRequest, VerifyEmailResponse, VerifyPhoneRequest, VerifyPhoneResponse, session_service_server::SessionService
     },
     services::helpers::get_user_from_token,
     utils::{
+        client::RequestClient,
         emails::send_email_verification_code,
         passwords::{generate_verification_code, hash_password},
     },
@@ -43,21 +47,23 @@ impl SessionService for SessionServiceImpl {
         );
         user.email_verification_code = Some(code.clone());
         if let Some(error) = user.create().await {
-            return Err(Status::internal(error.to_string()));
+            println!(
+                "[SessionServiceImpl::register] Failed to register user: {:?}",
+                error
+            );
+            if let Some(message) = unique_violation_message(&error) {
+                return Err(Status::already_exists(message));
+            }
+            return Err(Status::internal("Failed to register user"));
         }
 
-        if let Err(error) = send_email_verification_code(
-            request.display_name.as_str(),
-            email.as_str(),
-            code.as_str(),
-        )
-        .await
-        {
+        // Sent only once the user is committed. If it fails the account
+        // stays, and forgot_password sends a new code.
+        if let Err(error) = send_email_verification_code(&user.display_name, &email, &code).await {
             println!(
                 "[SessionServiceImpl::register] Failed to send email verification code: {:?}",
                 error
             );
-            return Err(Status::internal(error.to_string()));
         }
 
         Ok(Response::new(RegisterResponse { success: true }))
@@ -67,6 +73,13 @@ impl SessionService for SessionServiceImpl {
         &self,
         _request: Request<LoginRequest>,
     ) -> Result<Response<LoginResponse>, Status> {
+        let client = RequestClient::new(
+            _request
+                .metadata()
+                .get("user-agent")
+                .and_then(|user_agent| user_agent.to_str().ok()),
+            _request.remote_addr().map(|addr| addr.ip().to_string()),
+        );
         let request = _request.into_inner();
         let email = request.email;
         if email.clone().is_empty() {
@@ -78,23 +91,11 @@ impl SessionService for SessionServiceImpl {
             return Err(Status::invalid_argument("Password is required"));
         }
 
-        let user = User::new(Some(email.clone()), None, password.clone(), "".to_string());
-
-        let params = vec![
-            ("email", user.email.clone().unwrap().into()),
-            ("password_hash", user.password_hash.clone().into()),
-        ];
-        let user = match User::find_one_by(params, false).await {
-            Ok(user) => user,
-            Err(e) => {
-                println!(
-                    "[SessionServiceImpl::login] Failed to get user by email: {:?}",
-                    e
-                );
-                return Err(Status::not_found("Unable to login"));
-            }
+        let user = match User::authenticate(email, &password).await {
+            Some(user) => user,
+            None => return Err(Status::unauthenticated(INVALID_CREDENTIALS)),
         };
-        let mut session = Session::new(user.id.clone());
+        let mut session = Session::new_with_client(user.id.clone(), &client);
         if let Some(error) = session.create().await {
             println!(
                 "[SessionServiceImpl::login] Failed to create session: {:?}",
@@ -319,11 +320,11 @@ impl SessionService for SessionServiceImpl {
             Ok(user) => user,
             Err(e) => {
                 println!("[SessionServiceImpl::unregister] Failed to get user: {:?}", e);
-                return Err(Status::not_found("Unable to unregister"));
+                return Err(Status::unauthenticated("Unable to unregister"));
             }
         };
-        if let Some(error) = user.delete_permanent().await {
-            println!("[SessionServiceImpl::unregister] Failed to delete user: {:?}", error);
+        if let Some(error) = user.archive().await {
+            println!("[SessionServiceImpl::unregister] Failed to archive user: {:?}", error);
             return Err(Status::internal(error.to_string()));
         }
         Ok(Response::new(UnregisterResponse { success: true }))
@@ -20,7 +20,7 @@ impl UserService for UserServiceImpl {
             Ok(user) => user,
             Err(e) => {
                 println!("[UserServiceImpl::my_user] Failed to get user: {:?}", e);
-                return Err(Status::not_found("User not found"));
+                return Err(Status::unauthenticated("Invalid session"));
             }
         };
         let user = match User::find_one(user.id.clone(), true).await {
@@ -35,3 +35,41 @@ impl UserService for UserServiceImpl {
         }))
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{database::test_support::create_test_user, models::session::Session};
+
+    fn my_user_request(token: String) -> Request<MyUserRequest> {
+        Request::new(MyUserRequest {
+            token,
+            ..Default::default()
+        })
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_my_user_is_the_token_user() {
+        let user = create_test_user().await;
+        let mut session = Session::new(user.id.clone());
+        assert!(session.create().await.is_none());
+
+        let response = UserServiceImpl
+            .my_user(my_user_request(session.session_token))
+            .await
+            .unwrap()
+            .into_inner();
+        assert_eq!(response.user.unwrap().id, user.id);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_my_user_rejects_an_invalid_token() {
+        let error = UserServiceImpl
+            .my_user(my_user_request("not-a-session".to_string()))
+            .await
+            .unwrap_err();
+        assert_eq!(error.code(), tonic::Code::Unauthenticated);
+    }
+}
@@ -0,0 +1,80 @@
+use rocket::{Route, get, http::Status, serde::json::Json};
+
+use crate::{
+    models::share_link::{SHARE_LINK_NOT_FOUND, SharedCollection},
+    utils::response::Envelope,
+};
+
+pub fn routes() -> Vec<Route> {
+    routes![shared_collection]
+}
+
+/// The read-only collection behind a share link. Needs no session; unknown
+/// and revoked links are not found.
+#[get("/<token>")]
+pub async fn shared_collection(token: String) -> Result<Json<Envelope<SharedCollection>>, Status> {
+    match SharedCollection::find_by_token(token).await {
+        Ok(collection) => Ok(Envelope::ok(collection)),
+        Err(e) if e.to_string() == SHARE_LINK_NOT_FOUND => Err(Status::NotFound),
+        Err(e) => {
+            println!("[shared_collection] Failed to get shared collection: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        catchers::catchers,
+        database::test_support::{create_test_mnstr, create_test_user},
+        models::share_link::ShareLink,
+    };
+    use rocket::local::asynchronous::Client;
+
+    async fn client() -> Client {
+        let rocket = rocket::build()
+            .mount("/share", routes())
+            .register("/", catchers());
+        Client::untracked(rocket).await.unwrap()
+    }
+
+    #[tokio::test]
+    async fn test_malformed_token_is_not_found() {
+        let client = client().await;
+        let response = client.get("/share/not-a-token").dispatch().await;
+        assert_eq!(response.status(), Status::NotFound);
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_revoked_link_is_not_found() {
+        let user = create_test_user().await;
+        let mnstr = create_test_mnstr(&user, &uuid::Uuid::new_v4().to_string()).await;
+        let share_link = ShareLink::create(user.id.clone()).await.unwrap();
+        let client = client().await;
+        let path = format!("/share/{}", share_link.token);
+
+        let response = client.get(path.clone()).dispatch().await;
+        assert_eq!(response.status(), Status::Ok);
+        let body = response.into_string().await.unwrap();
+        assert!(body.contains(&user.display_name));
+        for sensitive in [user.email.clone().unwrap(), mnstr.mnstr_qr_code] {
+            assert!(!body.contains(&sensitive), "{} leaked in {}", sensitive, body);
+        }
+
+        let stranger = create_test_user().await;
+        let error = ShareLink::revoke_for_user(share_link.id.clone(), stranger.id.clone()).await;
+        assert!(error.is_some());
+        let response = client.get(path.clone()).dispatch().await;
+        assert_eq!(response.status(), Status::Ok);
+
+        let error = ShareLink::revoke_for_user(share_link.id.clone(), user.id.clone()).await;
+        assert!(error.is_none());
+        let response = client.get(path).dispatch().await;
+        assert_eq!(response.status(), Status::NotFound);
+        let body = response.into_string().await.unwrap();
+        assert!(body.contains("Not found"));
+    }
+}
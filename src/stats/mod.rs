@@ -0,0 +1,125 @@
+use rocket::{Route, get, http::Status, serde::json::Json};
+
+use crate::{
+    models::{
+        game_stats::GameStats,
+        mnstr::{Mnstr, MnstrStats, is_not_owned},
+        session::Session,
+    },
+    utils::{response::Envelope, sessions::get_user_from_token, token::RawToken},
+};
+
+pub fn routes() -> Vec<Route> {
+    routes![stats]
+}
+
+pub fn mnstr_routes() -> Vec<Route> {
+    routes![mnstr_stats]
+}
+
+/// Public game wide totals, refreshed at most once a minute.
+#[get("/stats")]
+pub async fn stats() -> Result<Json<Envelope<GameStats>>, Status> {
+    match GameStats::current().await {
+        Ok(stats) => Ok(Envelope::ok(stats)),
+        Err(_) => Err(Status::ServiceUnavailable),
+    }
+}
+
+/// The level, battle stats, rarity and coin value of one of the session
+/// user's mnstrs. Mnstrs the user does not own are not found.
+#[get("/<mnstr_id>/stats")]
+pub async fn mnstr_stats(
+    mnstr_id: String,
+    token: RawToken,
+) -> Result<Json<Envelope<MnstrStats>>, Status> {
+    if token.value.is_empty() {
+        return Err(Status::Unauthorized);
+    }
+    let user = match get_user_from_token::<Session>(token.value).await {
+        Ok(user) => user,
+        Err(_) => return Err(Status::Unauthorized),
+    };
+
+    match Mnstr::find_owned(mnstr_id, &user.id).await {
+        Ok(mnstr) => Ok(Envelope::ok(MnstrStats::from_mnstr(&mnstr))),
+        Err(e) if is_not_owned(&e) => Err(Status::NotFound),
+        Err(e) => {
+            println!("[mnstr_stats] Failed to get mnstr: {:?}", e);
+            Err(Status::InternalServerError)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use std::time::Instant;
+
+    use super::*;
+    use crate::{
+        database::test_support::{create_test_mnstr, create_test_user},
+        models::game_stats::cache_game_stats,
+    };
+    use rocket::{http::Header, local::asynchronous::Client};
+
+    #[tokio::test]
+    async fn test_stats_serves_cached_totals() {
+        let seeded = GameStats {
+            users: 2,
+            mnstrs_collected: 5,
+            coins_in_circulation: 1_250,
+            transactions_processed: 9,
+        };
+        cache_game_stats(seeded, Instant::now());
+
+        let client = Client::untracked(rocket::build().mount("/", routes()))
+            .await
+            .unwrap();
+        let response = client.get("/stats").dispatch().await;
+        assert_eq!(response.status(), Status::Ok);
+
+        let body: serde_json::Value = response.into_json().await.unwrap();
+        assert_eq!(body["data"]["users"], 2);
+        assert_eq!(body["data"]["mnstrsCollected"], 5);
+        assert_eq!(body["data"]["coinsInCirculation"], 1_250);
+        assert_eq!(body["data"]["transactionsProcessed"], 9);
+        assert!(body["error"].is_null());
+    }
+
+    #[tokio::test]
+    #[ignore = "needs DATABASE_URL"]
+    async fn test_mnstr_stats_only_finds_owned_mnstrs() {
+        let user = create_test_user().await;
+        let mut session = Session::new(user.id.clone());
+        assert!(session.create().await.is_none());
+        let mnstr = create_test_mnstr(&user, &uuid::Uuid::new_v4().to_string()).await;
+        let stranger = create_test_user().await;
+        let strangers_mnstr = create_test_mnstr(&stranger, &uuid::Uuid::new_v4().to_string()).await;
+
+        let client = Client::untracked(rocket::build().mount("/mnstrs", mnstr_routes()))
+            .await
+            .unwrap();
+        let get = |mnstr_id: String| {
+            client
+                .get(format!("/mnstrs/{}/stats", mnstr_id))
+                .header(Header::new(
+                    "Authorization",
+                    format!("Bearer {}", session.session_token),
+                ))
+                .dispatch()
+        };
+
+        let response = get(mnstr.id.clone()).await;
+        assert_eq!(response.status(), Status::Ok);
+        let body: serde_json::Value = response.into_json().await.unwrap();
+        let stats = MnstrStats::from_mnstr(&mnstr);
+        assert_eq!(body["data"]["level"], stats.level);
+        assert_eq!(body["data"]["rarity"], stats.rarity);
+        assert_eq!(body["data"]["coins"], stats.coins);
+
+        let response = get(strangers_mnstr.id.clone()).await;
+        assert_eq!(response.status(), Status::NotFound);
+        let response = get(uuid::Uuid::new_v4().to_string()).await;
+        assert_eq!(response.status(), Status::NotFound);
+    }
+}
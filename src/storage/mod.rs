@@ -0,0 +1,69 @@
+use std::path::PathBuf;
+
+use crate::config::Config;
+
+pub const DEFAULT_IMAGE_DIR: &str = "static/mnstrs";
+pub const DEFAULT_IMAGE_BASE_URL: &str = "/static/mnstrs";
+
+/// Somewhere uploaded files can be kept and served from. The local store is
+/// the only backend so far; an S3 compatible one only needs to implement
+/// `put` and be returned from `blob_store`.
+#[rocket::async_trait]
+pub trait BlobStore: Send + Sync {
+    /// Stores `bytes` under `key` and returns the URL they are served from.
+    async fn put(&self, key: &str, bytes: &[u8]) -> Result<String, anyhow::Error>;
+}
+
+/// Writes blobs to a directory that is served as static files.
+#[derive(Debug, Clone, PartialEq)]
+pub struct LocalBlobStore {
+    pub dir: PathBuf,
+    pub base_url: String,
+}
+
+impl LocalBlobStore {
+    pub fn new(dir: impl Into<PathBuf>, base_url: impl Into<String>) -> Self {
+        Self {
+            dir: dir.into(),
+            base_url: base_url.into(),
+        }
+    }
+}
+
+#[rocket::async_trait]
+impl BlobStore for LocalBlobStore {
+    async fn put(&self, key: &str, bytes: &[u8]) -> Result<String, anyhow::Error> {
+        if key.is_empty() || key.contains(['/', '\\']) || key.starts_with('.') {
+            return Err(anyhow::Error::msg("Invalid blob key"));
+        }
+        tokio::fs::create_dir_all(&self.dir).await?;
+        tokio::fs::write(self.dir.join(key), bytes).await?;
+        Ok(format!("{}/{}", self.base_url.trim_end_matches('/'), key))
+    }
+}
+
+/// The blob store uploads go to, as set up by IMAGE_DIR and IMAGE_BASE_URL.
+pub fn blob_store(config: &Config) -> Box<dyn BlobStore> {
+    Box::new(LocalBlobStore::new(
+        config.image_dir.clone(),
+        config.image_base_url.clone(),
+    ))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    async fn test_local_blob_store_put() {
+        let dir = std::env::temp_dir().join(format!("mnstr-blobs-{}", uuid::Uuid::new_v4()));
+        let store = LocalBlobStore::new(dir.clone(), "/static/mnstrs/");
+
+        let url = store.put("mnstr.png", b"image").await.unwrap();
+        assert_eq!(url, "/static/mnstrs/mnstr.png");
+        assert_eq!(std::fs::read(dir.join("mnstr.png")).unwrap(), b"image");
+
+        assert!(store.put("../escape.png", b"image").await.is_err());
+        std::fs::remove_dir_all(dir).unwrap();
+    }
+}
@@ -0,0 +1,54 @@
+use rocket::{
+    Request,
+    request::{FromRequest, Outcome},
+};
+use sha2::{Digest, Sha256};
+
+pub const ADMIN_TOKEN_HEADER: &str = "X-Admin-Token";
+
+/// The client supplied X-Admin-Token header, if any
+#[derive(Debug, Clone)]
+pub struct RawAdminToken {
+    pub value: Option<String>,
+}
+
+/// Implements Rocket's FromRequest trait to extract the token from the X-Admin-Token header
+#[rocket::async_trait]
+impl<'r> FromRequest<'r> for RawAdminToken {
+    type Error = ();
+
+    async fn from_request(request: &'r Request<'_>) -> Outcome<Self, Self::Error> {
+        let value = request
+            .headers()
+            .get_one(ADMIN_TOKEN_HEADER)
+            .map(|header| header.trim())
+            .filter(|header| !header.is_empty())
+            .map(|header| header.to_string());
+        Outcome::Success(RawAdminToken { value })
+    }
+}
+
+/// Whether `candidate` is the configured `admin_token`. Admin access is off
+/// while no token is configured. Digests are compared so the time taken says
+/// nothing about how much of the token matched.
+pub fn is_admin_token(candidate: Option<&str>, admin_token: &str) -> bool {
+    match candidate {
+        Some(candidate) if !admin_token.is_empty() => {
+            Sha256::digest(candidate.as_bytes()) == Sha256::digest(admin_token.as_bytes())
+        }
+        _ => false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_is_admin_token() {
+        assert!(is_admin_token(Some("secret"), "secret"));
+        assert!(!is_admin_token(Some("guess"), "secret"));
+        assert!(!is_admin_token(None, "secret"));
+        assert!(!is_admin_token(Some(""), ""));
+    }
+}
@@ -0,0 +1,250 @@
+use juniper::http::{GraphQLBatchRequest, GraphQLRequest};
+use rocket::{
+    Data, Request,
+    data::{self, ByteUnit, FromData, ToByteUnit},
+    http::Status,
+    outcome::Outcome,
+};
+use sha2::{Digest, Sha256};
+
+/// Body limit used when Rocket.toml does not set `limits.graphql`.
+pub const DEFAULT_GRAPHQL_LIMIT: ByteUnit = ByteUnit::Mebibyte(1);
+
+/// A GraphQL request body read under the `graphql` limit. Oversized bodies
+/// are rejected with 413 rather than truncated, and malformed JSON with 400.
+#[derive(Debug)]
+pub struct GraphQLBody(pub GraphQLBatchRequest);
+
+#[rocket::async_trait]
+impl<'r> FromData<'r> for GraphQLBody {
+    type Error = String;
+
+    async fn from_data(request: &'r Request<'_>, data: Data<'r>) -> data::Outcome<'r, Self> {
+        let is_graphql = request
+            .content_type()
+            .is_some_and(|content_type| content_type.sub() == "graphql");
+        let limit = request
+            .limits()
+            .get("graphql")
+            .unwrap_or(DEFAULT_GRAPHQL_LIMIT);
+
+        let body = match data.open(limit).into_string().await {
+            Ok(body) if body.is_complete() => body.into_inner(),
+            Ok(_) => {
+                return Outcome::Error((
+                    Status::PayloadTooLarge,
+                    format!("Request body is larger than {}", limit),
+                ));
+            }
+            Err(e) => return Outcome::Error((Status::BadRequest, e.to_string())),
+        };
+
+        if is_graphql {
+            return Outcome::Success(GraphQLBody(GraphQLBatchRequest::Single(
+                GraphQLRequest::new(body, None, None),
+            )));
+        }
+        match serde_json::from_str(&body) {
+            Ok(request) => Outcome::Success(GraphQLBody(request)),
+            Err(e) => Outcome::Error((Status::BadRequest, format!("Invalid request body: {}", e))),
+        }
+    }
+}
+
+impl GraphQLBody {
+    /// Hex SHA-256 of the operations, names and variables in the body, so a
+    /// retry can be told apart from a different request.
+    pub fn fingerprint(&self) -> String {
+        let body = serde_json::to_string(&self.0).unwrap_or_default();
+        Sha256::digest(body.as_bytes())
+            .iter()
+            .map(|byte| format!("{:02x}", byte))
+            .collect()
+    }
+
+    /// Whether every operation in the body is a query, so running it writes
+    /// nothing.
+    pub fn is_read_only(&self) -> bool {
+        match &self.0 {
+            GraphQLBatchRequest::Single(request) => is_query_document(&request.query),
+            GraphQLBatchRequest::Batch(requests) => requests
+                .iter()
+                .all(|request| is_query_document(&request.query)),
+        }
+    }
+}
+
+/// Whether a GraphQL document holds no mutation or subscription, going by
+/// the keyword that starts each top-level operation. Comments and strings
+/// are skipped so braces or keywords inside them are not counted.
+pub fn is_query_document(document: &str) -> bool {
+    let mut depth = 0usize;
+    let mut word = String::new();
+    let mut chars = document.chars().peekable();
+    while let Some(c) = chars.next() {
+        if c.is_ascii_alphanumeric() || c == '_' {
+            if depth == 0 {
+                word.push(c);
+            }
+            continue;
+        }
+        if word == "mutation" || word == "subscription" {
+            return false;
+        }
+        word.clear();
+        match c {
+            '#' => {
+                while chars.next_if(|c| *c != '\n' && *c != '\r').is_some() {}
+            }
+            '"' => skip_string(&mut chars),
+            '{' | '(' | '[' => depth += 1,
+            '}' | ')' | ']' => depth = depth.saturating_sub(1),
+            _ => {}
+        }
+    }
+    word != "mutation" && word != "subscription"
+}
+
+/// Skips the rest of a string whose opening `"` was just read, either a
+/// `"..."` string or a `"""..."""` block string.
+fn skip_string(chars: &mut std::iter::Peekable<std::str::Chars>) {
+    if chars.next_if_eq(&'"').is_some() {
+        if chars.next_if_eq(&'"').is_none() {
+            return;
+        }
+        let mut quotes = 0;
+        while let Some(c) = chars.next() {
+            match c {
+                '\\' if chars.peek() == Some(&'"') => {
+                    chars.next();
+                    quotes = 0;
+                }
+                '"' => {
+                    quotes += 1;
+                    if quotes == 3 {
+                        return;
+                    }
+                }
+                _ => quotes = 0,
+            }
+        }
+        return;
+    }
+    while let Some(c) = chars.next() {
+        match c {
+            '\\' => {
+                chars.next();
+            }
+            '"' | '\n' => return,
+            _ => {}
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rocket::{
+        Config,
+        data::Limits,
+        http::ContentType,
+        local::asynchronous::Client,
+        post,
+    };
+
+    #[post("/", data = "<body>")]
+    fn graphql(body: GraphQLBody) -> &'static str {
+        match body.0 {
+            GraphQLBatchRequest::Single(_) => "single",
+            GraphQLBatchRequest::Batch(_) => "batch",
+        }
+    }
+
+    async fn client() -> Client {
+        let figment = Config::figment().merge(("limits", Limits::new().limit("graphql", 64.bytes())));
+        let rocket = rocket::custom(figment).mount("/", routes![graphql]);
+        Client::untracked(rocket).await.unwrap()
+    }
+
+    #[tokio::test]
+    async fn test_graphql_body_within_limit() {
+        let client = client().await;
+        let response = client
+            .post("/")
+            .header(ContentType::JSON)
+            .body(r#"{"query":"{ __typename }"}"#)
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::Ok);
+        assert_eq!(response.into_string().await.unwrap(), "single");
+    }
+
+    #[tokio::test]
+    async fn test_graphql_body_too_large() {
+        let client = client().await;
+        let query = format!(r#"{{"query":"{{ __typename }}","padding":"{}"}}"#, "a".repeat(128));
+        let response = client
+            .post("/")
+            .header(ContentType::JSON)
+            .body(query)
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::PayloadTooLarge);
+    }
+
+    #[tokio::test]
+    async fn test_graphql_body_malformed() {
+        let client = client().await;
+        let response = client
+            .post("/")
+            .header(ContentType::JSON)
+            .body(r#"{"query":"#)
+            .dispatch()
+            .await;
+        assert_eq!(response.status(), Status::BadRequest);
+    }
+
+    #[test]
+    fn test_is_query_document() {
+        assert!(is_query_document("{ __typename }"));
+        assert!(is_query_document("query Mnstrs { mnstrs { list { id } } }"));
+        assert!(is_query_document(
+            r#"query { mnstrs { search(name: "mutation { x }") { id } } } # mutation"#
+        ));
+        assert!(is_query_document("fragment F on Mnstr { id } query { mnstrs { list { ...F } } }"));
+
+        assert!(!is_query_document("mutation { mnstrs { collect(qrCode: \"x\") { id } } }"));
+        assert!(!is_query_document("query A { __typename }\nmutation B($id: String) { x }"));
+        assert!(!is_query_document(r#"query { a(b: """ } """) } mutation { c }"#));
+        assert!(!is_query_document("subscription { hello }"));
+    }
+
+    #[test]
+    fn test_is_read_only() {
+        let query = GraphQLRequest::new("{ __typename }".to_string(), None, None);
+        let mutation = GraphQLRequest::new("mutation { __typename }".to_string(), None, None);
+        assert!(GraphQLBody(GraphQLBatchRequest::Single(query.clone())).is_read_only());
+        assert!(!GraphQLBody(GraphQLBatchRequest::Batch(vec![query, mutation])).is_read_only());
+    }
+
+    #[test]
+    fn test_fingerprint() {
+        let body = |query: &str| {
+            GraphQLBody(GraphQLBatchRequest::Single(GraphQLRequest::new(
+                query.to_string(),
+                None,
+                None,
+            )))
+        };
+        let spend = body("mutation { users { spendCoins(amount: 5, reason: \"x\") } }");
+        assert_eq!(spend.fingerprint().len(), 64);
+        assert_eq!(
+            spend.fingerprint(),
+            body("mutation { users { spendCoins(amount: 5, reason: \"x\") } }").fingerprint()
+        );
+        assert_ne!(
+            spend.fingerprint(),
+            body("mutation { users { spendCoins(amount: 6, reason: \"x\") } }").fingerprint()
+        );
+    }
+}
@@ -0,0 +1,119 @@
+use std::{
+    collections::{HashMap, VecDeque},
+    hash::Hash,
+};
+
+/// A small least-recently-used cache. Entries are tagged with the version of
+/// the code that computed them; reading or writing with a different version
+/// drops everything cached under the old one.
+#[derive(Debug)]
+pub struct LruCache<K, V> {
+    capacity: usize,
+    version: u32,
+    entries: HashMap<K, V>,
+    order: VecDeque<K>,
+}
+
+impl<K: Eq + Hash + Clone, V: Clone> LruCache<K, V> {
+    pub fn new(capacity: usize) -> Self {
+        Self {
+            capacity: capacity.max(1),
+            version: 0,
+            entries: HashMap::new(),
+            order: VecDeque::new(),
+        }
+    }
+
+    pub fn len(&self) -> usize {
+        self.entries.len()
+    }
+
+    pub fn get(&mut self, key: &K, version: u32) -> Option<V> {
+        self.sync_version(version);
+        let value = self.entries.get(key).cloned()?;
+        self.touch(key);
+        Some(value)
+    }
+
+    pub fn insert(&mut self, key: K, value: V, version: u32) {
+        self.sync_version(version);
+        if self.entries.insert(key.clone(), value).is_some() {
+            self.touch(&key);
+            return;
+        }
+        self.order.push_back(key);
+        while self.order.len() > self.capacity {
+            if let Some(oldest) = self.order.pop_front() {
+                self.entries.remove(&oldest);
+            }
+        }
+    }
+
+    pub fn get_or_insert_with(&mut self, key: K, version: u32, compute: impl FnOnce() -> V) -> V {
+        if let Some(value) = self.get(&key, version) {
+            return value;
+        }
+        let value = compute();
+        self.insert(key, value.clone(), version);
+        value
+    }
+
+    fn sync_version(&mut self, version: u32) {
+        if self.version != version {
+            self.entries.clear();
+            self.order.clear();
+            self.version = version;
+        }
+    }
+
+    fn touch(&mut self, key: &K) {
+        if let Some(position) = self.order.iter().position(|k| k == key) {
+            if let Some(key) = self.order.remove(position) {
+                self.order.push_back(key);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_get_or_insert_with_returns_cached_value() {
+        let mut cache = LruCache::new(2);
+        let mut computed = 0;
+        let first = cache.get_or_insert_with("qr".to_string(), 1, || {
+            computed += 1;
+            42
+        });
+        let second = cache.get_or_insert_with("qr".to_string(), 1, || {
+            computed += 1;
+            0
+        });
+        assert_eq!(first, second);
+        assert_eq!(computed, 1);
+    }
+
+    #[test]
+    fn test_evicts_least_recently_used() {
+        let mut cache = LruCache::new(2);
+        cache.insert("a", 1, 1);
+        cache.insert("b", 2, 1);
+        assert_eq!(cache.get(&"a", 1), Some(1));
+        cache.insert("c", 3, 1);
+        assert_eq!(cache.get(&"b", 1), None);
+        assert_eq!(cache.get(&"a", 1), Some(1));
+        assert_eq!(cache.get(&"c", 1), Some(3));
+        assert_eq!(cache.len(), 2);
+    }
+
+    #[test]
+    fn test_version_bump_invalidates() {
+        let mut cache = LruCache::new(2);
+        cache.insert("qr", 10, 1);
+        assert_eq!(cache.get(&"qr", 2), None);
+        assert_eq!(cache.get_or_insert_with("qr", 2, || 20), 20);
+        assert_eq!(cache.get(&"qr", 2), Some(20));
+    }
+}
@@ -0,0 +1,135 @@
+use rocket::{
+    Request,
+    request::{FromRequest, Outcome},
+};
+
+/// Longest user agent stored with a session.
+pub const MAX_USER_AGENT_LENGTH: usize = 255;
+
+/// The device making the request, as recorded on new sessions
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct RequestClient {
+    pub user_agent: Option<String>,
+    pub ip_address: Option<String>,
+}
+
+impl RequestClient {
+    pub fn new(user_agent: Option<&str>, ip_address: Option<String>) -> Self {
+        let user_agent = user_agent
+            .map(|user_agent| user_agent.trim())
+            .filter(|user_agent| !user_agent.is_empty())
+            .map(|user_agent| user_agent.chars().take(MAX_USER_AGENT_LENGTH).collect());
+        Self {
+            user_agent,
+            ip_address,
+        }
+    }
+}
+
+/// Implements Rocket's FromRequest trait to extract the User-Agent header and client IP
+#[rocket::async_trait]
+impl<'r> FromRequest<'r> for RequestClient {
+    type Error = ();
+
+    async fn from_request(request: &'r Request<'_>) -> Outcome<Self, Self::Error> {
+        Outcome::Success(RequestClient::new(
+            request.headers().get_one("User-Agent"),
+            request.client_ip().map(|ip| ip.to_string()),
+        ))
+    }
+}
+
+/// A short human readable label for a user agent, such as "Safari on iOS".
+pub fn device_label(user_agent: Option<&str>) -> String {
+    let user_agent = match user_agent {
+        Some(user_agent) if !user_agent.is_empty() => user_agent,
+        _ => return "Unknown device".to_string(),
+    };
+
+    let platform = if user_agent.contains("iPhone") || user_agent.contains("iPad") {
+        Some("iOS")
+    } else if user_agent.contains("Android") {
+        Some("Android")
+    } else if user_agent.contains("Windows") {
+        Some("Windows")
+    } else if user_agent.contains("Mac OS X") || user_agent.contains("Macintosh") {
+        Some("macOS")
+    } else if user_agent.contains("Linux") {
+        Some("Linux")
+    } else {
+        None
+    };
+
+    let browser = if user_agent.contains("Edg/") {
+        Some("Edge")
+    } else if user_agent.contains("Firefox/") {
+        Some("Firefox")
+    } else if user_agent.contains("Chrome/") {
+        Some("Chrome")
+    } else if user_agent.contains("Safari/") {
+        Some("Safari")
+    } else if user_agent.starts_with("Dart/") {
+        Some("mnstr app")
+    } else {
+        None
+    };
+
+    match (browser, platform) {
+        (Some(browser), Some(platform)) => format!("{} on {}", browser, platform),
+        (Some(browser), None) => browser.to_string(),
+        (None, Some(platform)) => platform.to_string(),
+        (None, None) => "Unknown device".to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use rocket::{get, http::Header, local::asynchronous::Client};
+
+    #[get("/client")]
+    fn client(client: RequestClient) -> String {
+        client.user_agent.unwrap_or_default()
+    }
+
+    #[tokio::test]
+    async fn test_request_client_reads_user_agent() {
+        let rocket = rocket::build().mount("/", routes![client]);
+        let client = Client::untracked(rocket).await.unwrap();
+
+        let response = client
+            .get("/client")
+            .header(Header::new("User-Agent", "Dart/3.5 (dart:io)"))
+            .dispatch()
+            .await;
+        assert_eq!(response.into_string().await.unwrap(), "Dart/3.5 (dart:io)");
+    }
+
+    #[test]
+    fn test_request_client_new() {
+        assert_eq!(RequestClient::new(Some("  "), None).user_agent, None);
+        let long = "a".repeat(MAX_USER_AGENT_LENGTH + 10);
+        assert_eq!(
+            RequestClient::new(Some(&long), None).user_agent.unwrap().len(),
+            MAX_USER_AGENT_LENGTH
+        );
+    }
+
+    #[test]
+    fn test_device_label() {
+        assert_eq!(
+            device_label(Some(
+                "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+            )),
+            "Safari on iOS"
+        );
+        assert_eq!(
+            device_label(Some(
+                "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/128.0.0.0 Safari/537.36"
+            )),
+            "Chrome on Windows"
+        );
+        assert_eq!(device_label(Some("Dart/3.5 (dart:io)")), "mnstr app");
+        assert_eq!(device_label(None), "Unknown device");
+    }
+}
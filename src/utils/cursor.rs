@@ -0,0 +1,145 @@
+use time::OffsetDateTime;
+
+pub const DEFAULT_PAGE_SIZE: i64 = 20;
+pub const MAX_PAGE_SIZE: i64 = 100;
+
+/// A position in a list ordered by `(created_at, id)`. Clients only see it
+/// as the opaque string from `encode`.
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord)]
+pub struct Cursor {
+    pub created_at: OffsetDateTime,
+    pub id: String,
+}
+
+impl Cursor {
+    pub fn new(created_at: OffsetDateTime, id: String) -> Self {
+        Self { created_at, id }
+    }
+
+    /// Hex of `<unix nanos>:<id>`, so clients are not tempted to build one.
+    pub fn encode(&self) -> String {
+        format!("{}:{}", self.created_at.unix_timestamp_nanos(), self.id)
+            .bytes()
+            .map(|byte| format!("{:02x}", byte))
+            .collect()
+    }
+
+    pub fn decode(value: &str) -> Result<Self, anyhow::Error> {
+        let invalid = || anyhow::Error::msg("Invalid cursor");
+        if value.len() % 2 != 0 {
+            return Err(invalid());
+        }
+        let bytes = (0..value.len())
+            .step_by(2)
+            .map(|i| u8::from_str_radix(value.get(i..i + 2).ok_or_else(invalid)?, 16))
+            .collect::<Result<Vec<u8>, _>>()
+            .map_err(|_| invalid())?;
+        let decoded = String::from_utf8(bytes).map_err(|_| invalid())?;
+        let (nanos, id) = decoded.split_once(':').ok_or_else(invalid)?;
+        let nanos = nanos.parse::<i128>().map_err(|_| invalid())?;
+        let created_at = OffsetDateTime::from_unix_timestamp_nanos(nanos).map_err(|_| invalid())?;
+        if id.is_empty() {
+            return Err(invalid());
+        }
+        Ok(Self::new(created_at, id.to_string()))
+    }
+}
+
+/// Clamps a requested page size into `1..=MAX_PAGE_SIZE`.
+pub fn page_size(limit: Option<i32>) -> i64 {
+    limit
+        .map(i64::from)
+        .unwrap_or(DEFAULT_PAGE_SIZE)
+        .clamp(1, MAX_PAGE_SIZE)
+}
+
+/// Trims `rows`, fetched with one extra row past `limit`, down to the page
+/// and returns the cursor of its last row when more rows follow.
+pub fn next_page<T>(
+    mut rows: Vec<T>,
+    limit: i64,
+    cursor: impl Fn(&T) -> Option<Cursor>,
+) -> (Vec<T>, Option<String>) {
+    let limit = limit.max(0) as usize;
+    if rows.len() <= limit {
+        return (rows, None);
+    }
+    rows.truncate(limit);
+    let next_cursor = rows.last().and_then(cursor).map(|cursor| cursor.encode());
+    (rows, next_cursor)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn at(seconds: i64) -> OffsetDateTime {
+        OffsetDateTime::from_unix_timestamp(1_760_000_000 + seconds).unwrap()
+    }
+
+    /// Mirrors `WHERE (created_at, id) > cursor ORDER BY created_at, id
+    /// LIMIT limit + 1`.
+    fn fetch(rows: &[Cursor], after: Option<&Cursor>, limit: i64) -> Vec<Cursor> {
+        let mut rows = rows
+            .iter()
+            .filter(|row| after.is_none_or(|after| *row > after))
+            .cloned()
+            .collect::<Vec<Cursor>>();
+        rows.sort();
+        rows.truncate(limit as usize + 1);
+        rows
+    }
+
+    #[test]
+    fn test_cursor_round_trip() {
+        let cursor = Cursor::new(at(0) + time::Duration::microseconds(123), "id-1".to_string());
+        let encoded = cursor.encode();
+        assert!(encoded.chars().all(|c| c.is_ascii_hexdigit()));
+        assert_eq!(Cursor::decode(&encoded).unwrap(), cursor);
+    }
+
+    #[test]
+    fn test_cursor_rejects_garbage() {
+        assert!(Cursor::decode("").is_err());
+        assert!(Cursor::decode("abc").is_err());
+        assert!(Cursor::decode("zz").is_err());
+        assert!(Cursor::decode(&Cursor::new(at(0), "x".to_string()).encode()[2..]).is_err());
+    }
+
+    #[test]
+    fn test_page_size() {
+        assert_eq!(page_size(None), DEFAULT_PAGE_SIZE);
+        assert_eq!(page_size(Some(0)), 1);
+        assert_eq!(page_size(Some(5_000)), MAX_PAGE_SIZE);
+    }
+
+    #[test]
+    fn test_insert_between_pages_neither_skips_nor_repeats() {
+        let mut rows = vec![
+            Cursor::new(at(1), "a".to_string()),
+            Cursor::new(at(2), "b".to_string()),
+            Cursor::new(at(2), "c".to_string()),
+            Cursor::new(at(3), "d".to_string()),
+            Cursor::new(at(4), "e".to_string()),
+        ];
+
+        let (first, next_cursor) = next_page(fetch(&rows, None, 2), 2, |row| Some(row.clone()));
+        assert_eq!(first.len(), 2);
+        let next_cursor = next_cursor.unwrap();
+
+        rows.push(Cursor::new(at(5), "f".to_string()));
+        rows.push(Cursor::new(at(0), "early".to_string()));
+
+        let mut seen = first;
+        let mut after = Some(Cursor::decode(&next_cursor).unwrap());
+        while let Some(cursor) = after {
+            let (page, next_cursor) =
+                next_page(fetch(&rows, Some(&cursor), 2), 2, |row| Some(row.clone()));
+            seen.extend(page);
+            after = next_cursor.map(|next| Cursor::decode(&next).unwrap());
+        }
+
+        let ids = seen.iter().map(|row| row.id.as_str()).collect::<Vec<&str>>();
+        assert_eq!(ids, vec!["a", "b", "c", "d", "e", "f"]);
+    }
+}
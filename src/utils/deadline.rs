@@ -0,0 +1,73 @@
+use std::{future::Future, time::Duration};
+
+use crate::config::config;
+
+pub const DEFAULT_REQUEST_TIMEOUT_SECS: u64 = 30;
+
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct DeadlineExceeded;
+
+impl std::fmt::Display for DeadlineExceeded {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(f, "Request deadline exceeded")
+    }
+}
+
+impl std::error::Error for DeadlineExceeded {}
+
+/// How long a single API request may run, from `REQUEST_TIMEOUT_SECS`.
+pub fn request_timeout() -> Duration {
+    config().request_timeout
+}
+
+/// Runs `future` until it finishes or `timeout` elapses. On timeout the
+/// future is dropped, which cancels every model call and query it has in
+/// flight instead of letting them run to completion.
+pub async fn with_deadline<F: Future>(
+    timeout: Duration,
+    future: F,
+) -> Result<F::Output, DeadlineExceeded> {
+    tokio::time::timeout(timeout, future)
+        .await
+        .map_err(|_| DeadlineExceeded)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::{
+        Arc,
+        atomic::{AtomicBool, Ordering},
+    };
+
+    struct DropFlag(Arc<AtomicBool>);
+
+    impl Drop for DropFlag {
+        fn drop(&mut self) {
+            self.0.store(true, Ordering::SeqCst);
+        }
+    }
+
+    #[tokio::test]
+    async fn test_with_deadline_cancels_slow_future() {
+        let dropped = Arc::new(AtomicBool::new(false));
+        let flag = DropFlag(dropped.clone());
+        let started = std::time::Instant::now();
+
+        let result = with_deadline(Duration::from_millis(20), async move {
+            let _flag = flag;
+            std::future::pending::<()>().await
+        })
+        .await;
+
+        assert_eq!(result, Err(DeadlineExceeded));
+        assert!(dropped.load(Ordering::SeqCst));
+        assert!(started.elapsed() < Duration::from_secs(1));
+    }
+
+    #[tokio::test]
+    async fn test_with_deadline_returns_output() {
+        let result = with_deadline(Duration::from_secs(1), async { 42 }).await;
+        assert_eq!(result, Ok(42));
+    }
+}
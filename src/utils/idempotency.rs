@@ -0,0 +1,30 @@
+use rocket::{
+    Request,
+    request::{FromRequest, Outcome},
+};
+
+use crate::models::idempotency_key::MAX_IDEMPOTENCY_KEY_LENGTH;
+
+pub const IDEMPOTENCY_KEY_HEADER: &str = "Idempotency-Key";
+
+/// The client supplied Idempotency-Key header, if any
+#[derive(Debug, Clone)]
+pub struct RawIdempotencyKey {
+    pub value: Option<String>,
+}
+
+/// Implements Rocket's FromRequest trait to extract the key from the Idempotency-Key header
+#[rocket::async_trait]
+impl<'r> FromRequest<'r> for RawIdempotencyKey {
+    type Error = ();
+
+    async fn from_request(request: &'r Request<'_>) -> Outcome<Self, Self::Error> {
+        let value = request
+            .headers()
+            .get_one(IDEMPOTENCY_KEY_HEADER)
+            .map(|header| header.trim())
+            .filter(|header| !header.is_empty() && header.len() <= MAX_IDEMPOTENCY_KEY_LENGTH)
+            .map(|header| header.to_string());
+        Outcome::Success(RawIdempotencyKey { value })
+    }
+}
@@ -1,6 +1,15 @@
+pub mod admin;
+pub mod body;
+pub mod cache;
+pub mod client;
+pub mod deadline;
 pub mod passwords;
+pub mod response;
 pub mod sessions;
 pub mod strings;
 pub mod time;
 pub mod token;
-pub mod emails;
\ No newline at end of file
+pub mod emails;
+pub mod idempotency;
+pub mod validation;
+pub mod cursor;
@@ -0,0 +1,69 @@
+use rocket::serde::json::Json;
+use serde::Serialize;
+
+/// The body of every JSON response outside of GraphQL. `data` is set on
+/// success and `error` on failure; all three fields are always present so
+/// clients have one way to read a response.
+#[derive(Debug, Serialize, Clone, PartialEq)]
+pub struct Envelope<T> {
+    pub data: Option<T>,
+    pub error: Option<String>,
+    pub meta: Option<serde_json::Value>,
+}
+
+impl<T: Serialize> Envelope<T> {
+    pub fn ok(data: T) -> Json<Self> {
+        Json(Self {
+            data: Some(data),
+            error: None,
+            meta: None,
+        })
+    }
+
+    pub fn ok_with_meta(data: T, meta: serde_json::Value) -> Json<Self> {
+        Json(Self {
+            data: Some(data),
+            error: None,
+            meta: Some(meta),
+        })
+    }
+}
+
+impl Envelope<()> {
+    pub fn error(error: &str) -> Json<Self> {
+        Json(Self {
+            data: None,
+            error: Some(error.to_string()),
+            meta: None,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_success_envelope() {
+        let json = serde_json::to_value(Envelope::ok(vec![1, 2]).into_inner()).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!({ "data": [1, 2], "error": null, "meta": null })
+        );
+
+        let json = serde_json::to_value(
+            Envelope::ok_with_meta("page", serde_json::json!({ "count": 2 })).into_inner(),
+        )
+        .unwrap();
+        assert_eq!(json["meta"]["count"], 2);
+    }
+
+    #[test]
+    fn test_error_envelope() {
+        let json = serde_json::to_value(Envelope::error("Not found").into_inner()).unwrap();
+        assert_eq!(
+            json,
+            serde_json::json!({ "data": null, "error": "Not found", "meta": null })
+        );
+    }
+}
@@ -1,6 +1,9 @@
 use anyhow::Error;
 
-use crate::models::user::User;
+use crate::models::{
+    api_token::{ApiToken, is_api_token},
+    user::User,
+};
 pub trait SessionTrait<T> {
     fn expired(&self) -> bool;
     async fn update_expired(&mut self) -> Option<anyhow::Error>;
@@ -8,11 +11,20 @@ pub trait SessionTrait<T> {
     async fn get_user(&mut self) -> Result<User, Error>;
 }
 
+/// Rejects expired sessions and extends the expiry of live ones.
 pub async fn validate_session<T: SessionTrait<T>>(session: &mut T) -> Option<anyhow::Error> {
+    if session.expired() {
+        return Some(anyhow::Error::msg("Session expired"));
+    }
     session.update_expired().await
 }
 
+/// The user signed in with `token`, which may be a session token or a
+/// personal API token.
 pub async fn get_user_from_token<T: SessionTrait<T> >(token: String) -> Result<User, Error> {
+    if is_api_token(&token) {
+        return ApiToken::authenticate(token).await;
+    }
     let mut session = match T::find_one_by_token(token).await {
         Ok(session) => session,
         Err(e) => return Err(e.into()),
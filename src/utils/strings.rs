@@ -50,6 +50,27 @@ pub fn camel_to_snake_case(camel: String) -> String {
     snake
 }
 
+/// Escapes `\`, `%` and `_` so `value` matches literally inside a LIKE or
+/// ILIKE pattern using `ESCAPE '\'`.
+///
+/// # Examples
+///
+/// ```
+/// use crate::utils::strings::escape_like;
+///
+/// assert_eq!(escape_like("100%_done"), "100\\%\\_done");
+/// ```
+pub fn escape_like(value: &str) -> String {
+    let mut escaped = String::with_capacity(value.len());
+    for c in value.chars() {
+        if matches!(c, '\\' | '%' | '_') {
+            escaped.push('\\');
+        }
+        escaped.push(c);
+    }
+    escaped
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -65,4 +86,13 @@ mod tests {
         assert_eq!(camel_to_snake_case("simple".to_string()), "simple");
         assert_eq!(camel_to_snake_case("".to_string()), "");
     }
+
+    #[test]
+    fn test_escape_like() {
+        assert_eq!(escape_like("fluffy"), "fluffy");
+        assert_eq!(escape_like("100%"), "100\\%");
+        assert_eq!(escape_like("a_b"), "a\\_b");
+        assert_eq!(escape_like("back\\slash"), "back\\\\slash");
+        assert_eq!(escape_like(""), "");
+    }
 }
@@ -1,5 +1,6 @@
 use rocket::{
     Request,
+    http::Status,
     request::{FromParam, FromRequest, Outcome},
 };
 use serde::{Deserialize, Serialize};
@@ -12,23 +13,51 @@ pub struct RawToken {
     pub value: String,
 }
 
-/// Implements Rocket's FromRequest trait to extract the token from the Authorization header
+/// Why the Authorization header of a request was refused, kept in the request
+/// so the 401 catcher can answer with it.
+#[derive(Debug, Clone, Default)]
+pub struct AuthorizationError(pub Option<&'static str>);
+
+/// Extracts the token from an Authorization header of the form
+/// `Bearer <token>`. The scheme is matched case-insensitively and surrounding
+/// whitespace is ignored.
+pub fn parse_bearer(header: &str) -> Result<String, &'static str> {
+    let header = header.trim();
+    let (scheme, token) = match header.split_once(char::is_whitespace) {
+        Some((scheme, token)) => (scheme, token.trim()),
+        None => (header, ""),
+    };
+    if !scheme.eq_ignore_ascii_case("Bearer") {
+        return Err("Authorization header must use the Bearer scheme");
+    }
+    if token.is_empty() {
+        return Err("Authorization header is missing a bearer token");
+    }
+    if token.contains(char::is_whitespace) {
+        return Err("Authorization header has a malformed bearer token");
+    }
+    Ok(token.to_string())
+}
+
+/// Implements Rocket's FromRequest trait to extract the token from the
+/// Authorization header. A missing header gives an empty token, a malformed
+/// one is refused with a 401.
 #[rocket::async_trait]
 impl<'r> FromRequest<'r> for RawToken {
     type Error = ();
 
     async fn from_request(request: &'r Request<'_>) -> rocket::request::Outcome<Self, Self::Error> {
-        let token = request
-            .headers()
-            .get_one("Authorization")
-            .map(|header| header.split(" ").nth(1).unwrap_or(""));
-        Outcome::Success(
-            request
-                .local_cache(|| RawToken {
-                    value: token.unwrap_or("").to_string(),
-                })
-                .clone(),
-        )
+        let value = match request.headers().get_one("Authorization") {
+            Some(header) => match parse_bearer(header) {
+                Ok(token) => token,
+                Err(message) => {
+                    request.local_cache(|| AuthorizationError(Some(message)));
+                    return Outcome::Error((Status::Unauthorized, ()));
+                }
+            },
+            None => String::new(),
+        };
+        Outcome::Success(request.local_cache(|| RawToken { value }).clone())
     }
 }
 
@@ -42,3 +71,52 @@ impl<'r> FromParam<'r> for RawToken {
         })
     }
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_bearer() {
+        assert_eq!(parse_bearer("Bearer abc123"), Ok("abc123".to_string()));
+        assert_eq!(parse_bearer("bearer abc123"), Ok("abc123".to_string()));
+        assert_eq!(parse_bearer("BEARER abc123"), Ok("abc123".to_string()));
+    }
+
+    #[test]
+    fn test_parse_bearer_extra_spaces() {
+        assert_eq!(parse_bearer("  Bearer   abc123  "), Ok("abc123".to_string()));
+        assert_eq!(parse_bearer("Bearer\tabc123"), Ok("abc123".to_string()));
+        assert_eq!(
+            parse_bearer("Bearer abc 123"),
+            Err("Authorization header has a malformed bearer token")
+        );
+    }
+
+    #[test]
+    fn test_parse_bearer_missing_token() {
+        for header in ["Bearer", "Bearer ", "  bearer   ", ""] {
+            assert!(parse_bearer(header).is_err(), "{:?}", header);
+        }
+        assert_eq!(
+            parse_bearer("Bearer"),
+            Err("Authorization header is missing a bearer token")
+        );
+    }
+
+    #[test]
+    fn test_parse_bearer_missing_scheme() {
+        assert_eq!(
+            parse_bearer("abc123"),
+            Err("Authorization header must use the Bearer scheme")
+        );
+        assert_eq!(
+            parse_bearer("Basic dXNlcjpwYXNz"),
+            Err("Authorization header must use the Bearer scheme")
+        );
+        assert_eq!(
+            parse_bearer("Bearerabc123"),
+            Err("Authorization header must use the Bearer scheme")
+        );
+    }
+}
@@ -0,0 +1,402 @@
+use crate::config::config;
+
+pub const MNSTR_NAME_MAX_LENGTH: usize = 32;
+pub const MNSTR_DESCRIPTION_MAX_LENGTH: usize = 256;
+pub const DISPLAY_NAME_MAX_LENGTH: usize = 32;
+
+/// Checks a mnstr name is 1 to 32 characters of printable text.
+pub fn validate_mnstr_name(mnstr_name: &str) -> Result<(), anyhow::Error> {
+    if mnstr_name.trim().is_empty() {
+        return Err(anyhow::Error::msg("Name is required"));
+    }
+    if mnstr_name.chars().count() > MNSTR_NAME_MAX_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Name must be at most {} characters",
+            MNSTR_NAME_MAX_LENGTH
+        )));
+    }
+    if mnstr_name.chars().any(char::is_control) {
+        return Err(anyhow::Error::msg("Name contains invalid characters"));
+    }
+    if contains_blocked_word(mnstr_name, &config().blocked_words) {
+        return Err(anyhow::Error::msg("Name is not allowed"));
+    }
+    Ok(())
+}
+
+/// Checks a mnstr description is at most 256 characters. Line breaks are the
+/// only control characters allowed.
+pub fn validate_mnstr_description(mnstr_description: &str) -> Result<(), anyhow::Error> {
+    if mnstr_description.chars().count() > MNSTR_DESCRIPTION_MAX_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Description must be at most {} characters",
+            MNSTR_DESCRIPTION_MAX_LENGTH
+        )));
+    }
+    if mnstr_description
+        .chars()
+        .any(|c| c.is_control() && c != '\n')
+    {
+        return Err(anyhow::Error::msg("Description contains invalid characters"));
+    }
+    if contains_blocked_word(mnstr_description, &config().blocked_words) {
+        return Err(anyhow::Error::msg("Description is not allowed"));
+    }
+    Ok(())
+}
+
+/// Markdown link schemes that run code or smuggle content when followed.
+const UNSAFE_LINK_SCHEMES: [&str; 3] = ["javascript:", "vbscript:", "data:"];
+
+/// Cleans a mnstr description for storage as plain text, which clients may
+/// render as markdown. Script and style blocks are removed with their
+/// contents, other HTML tags are stripped, links and link definitions with
+/// an unsafe scheme lose their target, and control characters other than
+/// line breaks are dropped. Stripping repeats until nothing changes, so
+/// markup hidden inside other markup cannot survive. Everything else,
+/// including a lone `<`, is kept as written.
+pub fn sanitize_mnstr_description(mnstr_description: &str) -> String {
+    let mut text = mnstr_description.replace("\r\n", "\n").replace('\r', "\n");
+    loop {
+        let cleaned = strip_blocks(&text, "script");
+        let cleaned = strip_blocks(&cleaned, "style");
+        let cleaned = strip_tags(&cleaned);
+        let cleaned = strip_unsafe_links(&cleaned);
+        let cleaned = strip_unsafe_link_definitions(&cleaned);
+        if cleaned == text {
+            break;
+        }
+        text = cleaned;
+    }
+    text.chars()
+        .map(|c| if c == '\t' { ' ' } else { c })
+        .filter(|c| !c.is_control() || *c == '\n')
+        .collect::<String>()
+        .trim()
+        .to_string()
+}
+
+/// `text` without any `<tag>...</tag>` blocks, ignoring case. An unclosed
+/// block runs to the end of the text.
+fn strip_blocks(text: &str, tag: &str) -> String {
+    let lower = text.to_ascii_lowercase();
+    let open = format!("<{}", tag);
+    let close = format!("</{}", tag);
+    let mut cleaned = String::with_capacity(text.len());
+    let mut position = 0;
+    while let Some(start) = lower[position..].find(&open).map(|start| position + start) {
+        cleaned.push_str(&text[position..start]);
+        position = match lower[start..].find(&close).map(|end| start + end) {
+            Some(end) => match lower[end..].find('>') {
+                Some(gt) => end + gt + 1,
+                None => text.len(),
+            },
+            None => text.len(),
+        };
+    }
+    cleaned.push_str(&text[position..]);
+    cleaned
+}
+
+/// `text` without HTML tags and comments. A `<` that does not start a tag,
+/// as in `3 < 5`, is kept.
+fn strip_tags(text: &str) -> String {
+    let mut cleaned = String::with_capacity(text.len());
+    let mut rest = text;
+    while let Some(start) = rest.find('<') {
+        let starts_tag = rest[start + 1..]
+            .chars()
+            .next()
+            .is_some_and(|c| c.is_ascii_alphabetic() || c == '/' || c == '!');
+        match rest[start..].find('>') {
+            Some(end) if starts_tag => {
+                cleaned.push_str(&rest[..start]);
+                rest = &rest[start + end + 1..];
+            }
+            _ => {
+                cleaned.push_str(&rest[..start + 1]);
+                rest = &rest[start + 1..];
+            }
+        }
+    }
+    cleaned.push_str(rest);
+    cleaned
+}
+
+/// `text` with the `(target)` of markdown links and images removed when the
+/// target uses an unsafe scheme, keeping the link text.
+fn strip_unsafe_links(text: &str) -> String {
+    let mut cleaned = String::with_capacity(text.len());
+    let mut rest = text;
+    while let Some(start) = rest.find("](") {
+        let target_start = start + 2;
+        let Some(length) = closing_paren(&rest[target_start..]) else {
+            break;
+        };
+        cleaned.push_str(&rest[..start + 1]);
+        if !is_unsafe_link_target(&rest[target_start..target_start + length]) {
+            cleaned.push_str(&rest[start + 1..target_start + length + 1]);
+        }
+        rest = &rest[target_start + length + 1..];
+    }
+    cleaned.push_str(rest);
+    cleaned
+}
+
+/// `text` without reference-style link definitions, such as
+/// `[home]: javascript:alert(1)`, whose target uses an unsafe scheme.
+fn strip_unsafe_link_definitions(text: &str) -> String {
+    text.split('\n')
+        .filter(|line| {
+            let Some(definition) = line.trim_start().strip_prefix('[') else {
+                return true;
+            };
+            match definition.split_once("]:") {
+                Some((_, target)) => !is_unsafe_link_target(target),
+                None => true,
+            }
+        })
+        .collect::<Vec<&str>>()
+        .join("\n")
+}
+
+/// Whether a link target uses an unsafe scheme once character references
+/// are decoded and whitespace, control characters and angle brackets are
+/// ignored, as a browser would.
+fn is_unsafe_link_target(target: &str) -> bool {
+    let target = decode_character_references(target)
+        .chars()
+        .filter(|c| !c.is_whitespace() && !c.is_control() && *c != '<' && *c != '>')
+        .collect::<String>()
+        .to_ascii_lowercase();
+    UNSAFE_LINK_SCHEMES
+        .iter()
+        .any(|scheme| target.starts_with(scheme))
+}
+
+/// `text` with numeric character references (`&#106;`, `&#x6A;`, with or
+/// without the `;`) and the named ones that can spell out a scheme decoded.
+/// Anything else is kept as written.
+fn decode_character_references(text: &str) -> String {
+    const NAMED: [(&str, char); 3] = [("colon;", ':'), ("tab;", '\t'), ("newline;", '\n')];
+    let mut decoded = String::with_capacity(text.len());
+    let mut rest = text;
+    while let Some(start) = rest.find('&') {
+        decoded.push_str(&rest[..start]);
+        rest = &rest[start + 1..];
+        if let Some(number) = rest.strip_prefix('#') {
+            let (digits, radix) = match number.strip_prefix(['x', 'X']) {
+                Some(hex) => (hex, 16),
+                None => (number, 10),
+            };
+            let length = digits
+                .find(|c: char| !c.is_digit(radix))
+                .unwrap_or(digits.len());
+            let c = u32::from_str_radix(&digits[..length], radix)
+                .ok()
+                .and_then(char::from_u32);
+            if let Some(c) = c {
+                decoded.push(c);
+                let digits = &digits[length..];
+                rest = digits.strip_prefix(';').unwrap_or(digits);
+                continue;
+            }
+        }
+        let named = NAMED.iter().find(|(name, _)| {
+            rest.get(..name.len())
+                .is_some_and(|prefix| prefix.eq_ignore_ascii_case(name))
+        });
+        match named {
+            Some((name, c)) => {
+                decoded.push(*c);
+                rest = &rest[name.len()..];
+            }
+            None => decoded.push('&'),
+        }
+    }
+    decoded.push_str(rest);
+    decoded
+}
+
+/// The byte offset of the `)` closing a parenthesis opened just before
+/// `text`, allowing nested pairs inside.
+fn closing_paren(text: &str) -> Option<usize> {
+    let mut depth = 1;
+    for (offset, c) in text.char_indices() {
+        match c {
+            '(' => depth += 1,
+            ')' => {
+                depth -= 1;
+                if depth == 0 {
+                    return Some(offset);
+                }
+            }
+            _ => {}
+        }
+    }
+    None
+}
+
+/// Checks a display name is 1 to 32 characters of printable text.
+pub fn validate_display_name(display_name: &str) -> Result<(), anyhow::Error> {
+    if display_name.trim().is_empty() {
+        return Err(anyhow::Error::msg("Display name is required"));
+    }
+    if display_name.chars().count() > DISPLAY_NAME_MAX_LENGTH {
+        return Err(anyhow::Error::msg(format!(
+            "Display name must be at most {} characters",
+            DISPLAY_NAME_MAX_LENGTH
+        )));
+    }
+    if display_name.chars().any(char::is_control) {
+        return Err(anyhow::Error::msg("Display name contains invalid characters"));
+    }
+    if contains_blocked_word(display_name, &config().blocked_words) {
+        return Err(anyhow::Error::msg("Display name is not allowed"));
+    }
+    Ok(())
+}
+
+/// Whether any word of `text` matches one of `blocked_words`, ignoring case.
+pub fn contains_blocked_word(text: &str, blocked_words: &[String]) -> bool {
+    if blocked_words.is_empty() {
+        return false;
+    }
+    text.to_lowercase()
+        .split(|c: char| !c.is_alphanumeric())
+        .any(|word| blocked_words.iter().any(|blocked| blocked == word))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_validate_mnstr_name() {
+        assert!(validate_mnstr_name("Fluffy").is_ok());
+        assert!(validate_mnstr_name(&"a".repeat(MNSTR_NAME_MAX_LENGTH)).is_ok());
+        assert!(validate_mnstr_name("Ünïcødé ✨").is_ok());
+
+        assert!(validate_mnstr_name("").is_err());
+        assert!(validate_mnstr_name("   ").is_err());
+        assert!(validate_mnstr_name(&"a".repeat(MNSTR_NAME_MAX_LENGTH + 1)).is_err());
+        assert!(validate_mnstr_name("Fluf\u{0}fy").is_err());
+        assert!(validate_mnstr_name("Fluf\nfy").is_err());
+    }
+
+    #[test]
+    fn test_validate_mnstr_description() {
+        assert!(validate_mnstr_description("").is_ok());
+        assert!(validate_mnstr_description("Soft.\nLikes naps.").is_ok());
+        assert!(validate_mnstr_description(&"a".repeat(MNSTR_DESCRIPTION_MAX_LENGTH)).is_ok());
+
+        assert!(
+            validate_mnstr_description(&"a".repeat(MNSTR_DESCRIPTION_MAX_LENGTH + 1)).is_err()
+        );
+        assert!(validate_mnstr_description("tab\there").is_err());
+    }
+
+    #[test]
+    fn test_sanitize_mnstr_description() {
+        assert_eq!(
+            sanitize_mnstr_description("Soft.\nLikes **naps** & 3 < 5 snacks."),
+            "Soft.\nLikes **naps** & 3 < 5 snacks."
+        );
+        assert_eq!(
+            sanitize_mnstr_description("Hi<script>alert('x')</script> there"),
+            "Hi there"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("<SCRIPT src=x>alert(1)</SCRIPT >Fluffy"),
+            "Fluffy"
+        );
+        assert_eq!(sanitize_mnstr_description("Fluffy<script>alert(1)"), "Fluffy");
+        assert_eq!(
+            sanitize_mnstr_description("<b>Bold</b> <img src=x onerror=alert(1)><!-- note -->cat"),
+            "Bold cat"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("<style>body{}</style>Plain"),
+            "Plain"
+        );
+    }
+
+    #[test]
+    fn test_sanitize_mnstr_description_control_chars() {
+        assert_eq!(
+            sanitize_mnstr_description(" tab\there\r\nnull\u{0}byte\u{7}\r"),
+            "tab here\nnullbyte"
+        );
+        assert!(validate_mnstr_description(&sanitize_mnstr_description("a\u{1b}[31mred")).is_ok());
+    }
+
+    #[test]
+    fn test_sanitize_mnstr_description_links() {
+        assert_eq!(
+            sanitize_mnstr_description("[home](https://mnstr.app) and [click](JavaScript:alert(1))"),
+            "[home](https://mnstr.app) and [click]"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("![pic](data:text/html;base64,PHNjcmlwdD4=)"),
+            "![pic]"
+        );
+        assert_eq!(sanitize_mnstr_description("[open](no close"), "[open](no close");
+        assert_eq!(
+            sanitize_mnstr_description("[x](&#106;avascript:alert(1)) [y](&#X6A;avascript&colon;x)"),
+            "[x] [y]"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("[z](java&#x09;script:alert(1)) Tom &amp; Jerry"),
+            "[z] Tom &amp; Jerry"
+        );
+    }
+
+    #[test]
+    fn test_sanitize_mnstr_description_nested_markup() {
+        assert_eq!(
+            sanitize_mnstr_description("<<b>img src=x onerror=alert(1)>cat"),
+            "cat"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("<scr<script>x</script>ipt>alert(1)</script>Fluffy"),
+            "alert(1)Fluffy"
+        );
+        assert_eq!(sanitize_mnstr_description("1 << 2 > 0"), "1 << 2 > 0");
+    }
+
+    #[test]
+    fn test_sanitize_mnstr_description_link_definitions() {
+        assert_eq!(
+            sanitize_mnstr_description("[click][evil]\n\n[evil]: javascript:alert(1)"),
+            "[click][evil]"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("[home][site]\n  [site]: https://mnstr.app"),
+            "[home][site]\n  [site]: https://mnstr.app"
+        );
+        assert_eq!(
+            sanitize_mnstr_description("[a]\n[a]: &#100;ata:text/html,x"),
+            "[a]"
+        );
+    }
+
+    #[test]
+    fn test_validate_display_name() {
+        assert!(validate_display_name("mnstr_fan").is_ok());
+        assert!(validate_display_name(&"a".repeat(DISPLAY_NAME_MAX_LENGTH)).is_ok());
+
+        assert!(validate_display_name("").is_err());
+        assert!(validate_display_name(" ").is_err());
+        assert!(validate_display_name(&"a".repeat(DISPLAY_NAME_MAX_LENGTH + 1)).is_err());
+        assert!(validate_display_name("mnstr\tfan").is_err());
+    }
+
+    #[test]
+    fn test_contains_blocked_word() {
+        let blocked_words = vec!["darn".to_string()];
+        assert!(contains_blocked_word("Darn it", &blocked_words));
+        assert!(contains_blocked_word("oh-darn!", &blocked_words));
+        assert!(!contains_blocked_word("darned", &blocked_words));
+        assert!(!contains_blocked_word("Darn it", &[]));
+    }
+}
@@ -0,0 +1,333 @@
+use std::{
+    sync::{LazyLock, RwLock},
+    time::Duration,
+};
+
+use serde::Serialize;
+use sha2::{Digest, Sha256};
+use time::{OffsetDateTime, format_description::well_known::Rfc3339};
+
+use crate::config::Config;
+
+pub const SIGNATURE_HEADER: &str = "X-Signature";
+pub const MAX_DELIVERY_ATTEMPTS: u32 = 3;
+const INITIAL_BACKOFF: Duration = Duration::from_millis(500);
+const DELIVERY_TIMEOUT: Duration = Duration::from_secs(5);
+
+#[derive(Debug, Clone, PartialEq)]
+pub struct WebhookSubscriber {
+    pub url: String,
+    pub secret: String,
+}
+
+static SUBSCRIBERS: LazyLock<RwLock<Vec<WebhookSubscriber>>> =
+    LazyLock::new(|| RwLock::new(Vec::new()));
+
+static CLIENT: LazyLock<reqwest::Client> = LazyLock::new(|| {
+    reqwest::Client::builder()
+        .timeout(DELIVERY_TIMEOUT)
+        .build()
+        .expect("Failed to build webhook client")
+});
+
+pub fn register(subscriber: WebhookSubscriber) {
+    if let Ok(mut subscribers) = SUBSCRIBERS.write() {
+        subscribers.push(subscriber);
+    }
+}
+
+fn subscribers() -> Vec<WebhookSubscriber> {
+    match SUBSCRIBERS.read() {
+        Ok(subscribers) => subscribers.clone(),
+        Err(_) => Vec::new(),
+    }
+}
+
+/// Registers every URL in WEBHOOK_URLS, all signed with WEBHOOK_SECRET.
+pub fn load(config: &Config) {
+    for url in config.webhook_urls.iter() {
+        if config.webhook_secret.is_empty() {
+            println!("[webhooks::load] WEBHOOK_SECRET is not set, skipping webhooks");
+            return;
+        }
+        register(WebhookSubscriber {
+            url: url.clone(),
+            secret: config.webhook_secret.clone(),
+        });
+    }
+}
+
+#[derive(Debug, Serialize, Clone, PartialEq)]
+#[serde(rename_all = "camelCase")]
+pub struct WebhookEvent {
+    pub event_type: String,
+    pub user_id: String,
+    pub mnstr_id: String,
+    pub coins: i32,
+    pub xp: i32,
+    pub occurred_at: String,
+}
+
+impl WebhookEvent {
+    pub fn mnstr_collected(user_id: String, mnstr_id: String, coins: i32, xp: i32) -> Self {
+        Self {
+            event_type: "mnstr.collected".to_string(),
+            user_id,
+            mnstr_id,
+            coins,
+            xp,
+            occurred_at: OffsetDateTime::now_utc()
+                .format(&Rfc3339)
+                .unwrap_or_default(),
+        }
+    }
+}
+
+/// Sends `event` to every subscriber in the background. Delivery failures are
+/// logged and never reach the caller.
+pub fn dispatch(event: WebhookEvent) {
+    let subscribers = subscribers();
+    if subscribers.is_empty() {
+        return;
+    }
+    let body = match serde_json::to_vec(&event) {
+        Ok(body) => body,
+        Err(e) => {
+            println!("[webhooks::dispatch] Failed to serialize event: {:?}", e);
+            return;
+        }
+    };
+    for subscriber in subscribers {
+        let body = body.clone();
+        tokio::spawn(async move {
+            if let Err(e) = deliver(&CLIENT, &subscriber, body, INITIAL_BACKOFF).await {
+                println!(
+                    "[webhooks::dispatch] Failed to deliver to {}: {:?}",
+                    subscriber.url, e
+                );
+            }
+        });
+    }
+}
+
+/// POSTs `body` to the subscriber, retrying server errors and connection
+/// failures with exponential backoff. Client errors are not retried.
+async fn deliver(
+    client: &reqwest::Client,
+    subscriber: &WebhookSubscriber,
+    body: Vec<u8>,
+    initial_backoff: Duration,
+) -> Result<(), anyhow::Error> {
+    let signature = sign(subscriber.secret.as_bytes(), &body);
+    let mut backoff = initial_backoff;
+    let mut attempt = 1;
+    loop {
+        let error = match client
+            .post(&subscriber.url)
+            .header("Content-Type", "application/json")
+            .header(SIGNATURE_HEADER, signature.clone())
+            .body(body.clone())
+            .send()
+            .await
+        {
+            Ok(response) if response.status().is_success() => return Ok(()),
+            Ok(response) if response.status().is_client_error() => {
+                return Err(anyhow::Error::msg(format!(
+                    "Subscriber rejected webhook: {}",
+                    response.status()
+                )));
+            }
+            Ok(response) => anyhow::Error::msg(format!(
+                "Subscriber returned {}",
+                response.status()
+            )),
+            Err(e) => e.into(),
+        };
+        if attempt >= MAX_DELIVERY_ATTEMPTS {
+            return Err(error);
+        }
+        println!(
+            "[webhooks::deliver] Attempt {} to {} failed: {:?}",
+            attempt, subscriber.url, error
+        );
+        tokio::time::sleep(backoff).await;
+        backoff *= 2;
+        attempt += 1;
+    }
+}
+
+/// The X-Signature value for `body`: `sha256=` followed by the hex encoded
+/// HMAC-SHA256 of the body under `secret`.
+pub fn sign(secret: &[u8], body: &[u8]) -> String {
+    let mac = hmac_sha256(secret, body);
+    let hex = mac
+        .iter()
+        .map(|byte| format!("{:02x}", byte))
+        .collect::<String>();
+    format!("sha256={}", hex)
+}
+
+fn hmac_sha256(key: &[u8], message: &[u8]) -> Vec<u8> {
+    const BLOCK_SIZE: usize = 64;
+
+    let mut block_key = [0u8; BLOCK_SIZE];
+    if key.len() > BLOCK_SIZE {
+        let hashed = Sha256::digest(key);
+        block_key[..hashed.len()].copy_from_slice(&hashed);
+    } else {
+        block_key[..key.len()].copy_from_slice(key);
+    }
+
+    let mut inner = Sha256::new();
+    inner.update(block_key.map(|byte| byte ^ 0x36));
+    inner.update(message);
+    let inner = inner.finalize();
+
+    let mut outer = Sha256::new();
+    outer.update(block_key.map(|byte| byte ^ 0x5c));
+    outer.update(&inner);
+    outer.finalize().to_vec()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use tokio::{
+        io::{AsyncReadExt, AsyncWriteExt},
+        net::TcpListener,
+        sync::mpsc,
+    };
+
+    struct ReceivedRequest {
+        signature: Option<String>,
+        body: Vec<u8>,
+    }
+
+    /// Serves one connection per entry in `statuses`, answering each request
+    /// with that status and reporting what it received.
+    async fn serve(statuses: Vec<u16>) -> (String, mpsc::UnboundedReceiver<ReceivedRequest>) {
+        let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+        let url = format!("http://{}/hook", listener.local_addr().unwrap());
+        let (sender, receiver) = mpsc::unbounded_channel();
+        tokio::spawn(async move {
+            for status in statuses {
+                let (mut stream, _) = listener.accept().await.unwrap();
+                let mut request = Vec::new();
+                let mut buffer = [0u8; 1024];
+                let header_end = loop {
+                    let read = stream.read(&mut buffer).await.unwrap();
+                    request.extend_from_slice(&buffer[..read]);
+                    if let Some(end) = request.windows(4).position(|w| w == b"\r\n\r\n") {
+                        break end + 4;
+                    }
+                };
+                let headers = String::from_utf8_lossy(&request[..header_end]).to_string();
+                let header = |name: &str| {
+                    headers.lines().find_map(|line| {
+                        let (key, value) = line.split_once(':')?;
+                        key.eq_ignore_ascii_case(name)
+                            .then(|| value.trim().to_string())
+                    })
+                };
+                let content_length: usize = header("content-length")
+                    .and_then(|length| length.parse().ok())
+                    .unwrap_or(0);
+                while request.len() < header_end + content_length {
+                    let read = stream.read(&mut buffer).await.unwrap();
+                    request.extend_from_slice(&buffer[..read]);
+                }
+                sender
+                    .send(ReceivedRequest {
+                        signature: header(SIGNATURE_HEADER),
+                        body: request[header_end..header_end + content_length].to_vec(),
+                    })
+                    .unwrap();
+                let response = format!(
+                    "HTTP/1.1 {} Status\r\ncontent-length: 0\r\nconnection: close\r\n\r\n",
+                    status
+                );
+                stream.write_all(response.as_bytes()).await.unwrap();
+            }
+        });
+        (url, receiver)
+    }
+
+    fn event_body() -> Vec<u8> {
+        let event = WebhookEvent::mnstr_collected(
+            "user".to_string(),
+            "mnstr".to_string(),
+            474,
+            150,
+        );
+        serde_json::to_vec(&event).unwrap()
+    }
+
+    #[test]
+    fn test_hmac_sha256_rfc_4231() {
+        let key = [0x0bu8; 20];
+        assert_eq!(
+            sign(&key, b"Hi There"),
+            "sha256=b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7"
+        );
+        assert_eq!(
+            sign(b"Jefe", b"what do ya want for nothing?"),
+            "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_deliver_posts_signed_payload() {
+        let (url, mut received) = serve(vec![200]).await;
+        let subscriber = WebhookSubscriber {
+            url,
+            secret: "secret".to_string(),
+        };
+        let body = event_body();
+
+        deliver(&reqwest::Client::new(), &subscriber, body.clone(), Duration::ZERO)
+            .await
+            .unwrap();
+
+        let request = received.recv().await.unwrap();
+        assert_eq!(request.body, body);
+        assert_eq!(request.signature, Some(sign(b"secret", &body)));
+        let payload: serde_json::Value = serde_json::from_slice(&request.body).unwrap();
+        assert_eq!(payload["eventType"], "mnstr.collected");
+        assert_eq!(payload["userId"], "user");
+        assert_eq!(payload["mnstrId"], "mnstr");
+        assert_eq!(payload["coins"], 474);
+        assert_eq!(payload["xp"], 150);
+    }
+
+    #[tokio::test]
+    async fn test_deliver_retries_server_errors() {
+        let (url, mut received) = serve(vec![500, 200]).await;
+        let subscriber = WebhookSubscriber {
+            url,
+            secret: "secret".to_string(),
+        };
+
+        deliver(&reqwest::Client::new(), &subscriber, event_body(), Duration::ZERO)
+            .await
+            .unwrap();
+
+        assert!(received.recv().await.is_some());
+        assert!(received.recv().await.is_some());
+    }
+
+    #[tokio::test]
+    async fn test_deliver_gives_up_on_client_errors() {
+        let (url, mut received) = serve(vec![400]).await;
+        let subscriber = WebhookSubscriber {
+            url,
+            secret: "secret".to_string(),
+        };
+
+        let result =
+            deliver(&reqwest::Client::new(), &subscriber, event_body(), Duration::ZERO).await;
+
+        assert!(result.is_err());
+        assert!(received.recv().await.is_some());
+        assert!(received.recv().await.is_none());
+    }
+}
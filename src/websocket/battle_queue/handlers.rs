@@ -9,6 +9,7 @@ use crate::{
         battle::Battle,
         battle_log::{BattleLog, BattleLogAction},
         battle_status::{BattleStatus, BattleStatusState},
+        experience::xp_to_next_level,
         generated::mnstr_xp::XP_FOR_LEVEL,
         mnstr::{Mnstr, MnstrOrderBy, MnstrOrderDirection},
         user::User,
@@ -319,8 +320,7 @@ fn build_success(
 }
 
 async fn connect_to_redis() -> Result<redis::Client, Error> {
-    let config = std::env::var("REDIS_URL").unwrap();
-    let client = redis::Client::open(config).unwrap();
+    let client = redis::Client::open(crate::config::config().redis_url.clone()).unwrap();
     Ok(client)
 }
 
@@ -943,14 +943,18 @@ async fn handle_accept_request(
     opponent_id: &Option<String>,
     battle_id: &Option<String>,
 ) -> Option<anyhow::Error> {
-    let challenger = match User::find_one(challenger_id.clone(), false).await {
-        Ok(challenger) => challenger,
-        Err(_) => return Some(anyhow::Error::msg("Error finding challenger")),
+    let mut users =
+        match User::find_all_by_ids(vec![challenger_id.clone(), opponent_id.clone().unwrap()]).await {
+            Ok(users) => users,
+            Err(_) => return Some(anyhow::Error::msg("Error finding challenger")),
+        };
+    let challenger = match users.remove(challenger_id) {
+        Some(challenger) => challenger,
+        None => return Some(anyhow::Error::msg("Error finding challenger")),
     };
-
-    let opponent = match User::find_one(opponent_id.clone().unwrap(), false).await {
-        Ok(opponent) => opponent,
-        Err(_) => return Some(anyhow::Error::msg("Error finding opponent")),
+    let opponent = match users.remove(opponent_id.as_ref().unwrap()) {
+        Some(opponent) => opponent,
+        None => return Some(anyhow::Error::msg("Error finding opponent")),
     };
 
     let params = vec![("user_id", challenger.id.clone().into())];
@@ -1001,12 +1005,11 @@ async fn handle_accept_request(
 }
 
 async fn create_battle(challenger_id: &String, opponent_id: &String) -> Result<Battle, ()> {
-    let challenger = User::find_one(challenger_id.clone(), false)
-        .await
-        .map_err(|_| ())?;
-    let opponent = User::find_one(opponent_id.clone(), false)
+    let mut users = User::find_all_by_ids(vec![challenger_id.clone(), opponent_id.clone()])
         .await
         .map_err(|_| ())?;
+    let challenger = users.remove(challenger_id).ok_or(())?;
+    let opponent = users.remove(opponent_id).ok_or(())?;
     let mut battle = Battle::new(
         challenger.id,
         challenger.display_name,
@@ -1654,9 +1657,9 @@ async fn handle_game_ended(
     };
 
     println!("[handle_game_ended] Updating winner");
-    let xp_to_next_level = XP_FOR_LEVEL[loser_mnstr.current_level as usize + 1];
-    let winner_xp_awarded = (xp_to_next_level as f64 / 4.0).floor() as i32;
-    let loser_xp_awarded = (xp_to_next_level as f64 / 8.0).floor() as i32;
+    let loser_xp_to_next_level = xp_to_next_level(&XP_FOR_LEVEL, loser_mnstr.current_level);
+    let winner_xp_awarded = (loser_xp_to_next_level as f64 / 4.0).floor() as i32;
+    let loser_xp_awarded = (loser_xp_to_next_level as f64 / 8.0).floor() as i32;
     let winner_coins_awarded = loser_mnstr.coins();
     let loser_coins_awarded = 5;
 